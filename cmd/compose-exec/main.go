@@ -0,0 +1,49 @@
+// Command compose-exec provides maintenance tasks for resources created with the
+// compose-exec library.
+//
+// Usage:
+//
+//	compose-exec janitor [-older-than duration]
+//
+// janitor removes expired resources created by compose-exec (see compose.Janitor),
+// e.g. from a periodic job on shared CI runners. Resources of docker compose and
+// other tools are never touched.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/hnw/compose-exec/compose"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 || args[0] != "janitor" {
+		fmt.Fprintln(os.Stderr, "usage: compose-exec janitor [-older-than duration]")
+		return 2
+	}
+	fs := flag.NewFlagSet("janitor", flag.ContinueOnError)
+	olderThan := fs.Duration(
+		"older-than",
+		0,
+		"also remove stopped containers and unused networks without an expiry label "+
+			"created longer ago than this",
+	)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := compose.Janitor(ctx, *olderThan); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
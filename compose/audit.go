@@ -0,0 +1,422 @@
+package compose
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/checkpoint"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// AuditRecord describes one mutating Docker Engine call, e.g. creating, starting,
+// stopping or removing a container, network or volume.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Op is the engine operation, e.g. "container.create" or "network.remove".
+	Op string `json:"op"`
+	// Target is the name or ID of the resource the call acts on.
+	Target string `json:"target,omitempty"`
+	// Result is the ID of the resource created by the call, if any.
+	Result string `json:"result,omitempty"`
+	// ParamsDigest is the hex SHA-256 of the JSON-encoded call parameters. It
+	// identifies the exact configuration without recording secrets in the log.
+	ParamsDigest string `json:"params_sha256,omitempty"`
+	// Caller is the first function outside this package on the calling
+	// goroutine's stack ("function file:line"), if any.
+	Caller string `json:"caller,omitempty"`
+	// PID is the ID of this process.
+	PID        int    `json:"pid"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+var (
+	auditMu   sync.Mutex
+	auditHook func(AuditRecord)
+)
+
+// SetAuditHook makes every Docker Engine client created afterwards by this
+// package report its mutating calls to fn once they return, e.g. for compliance
+// logs in shared environments; see JSONAuditHook. Calls may be reported
+// concurrently. A nil fn disables auditing (the default).
+func SetAuditHook(fn func(AuditRecord)) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditHook = fn
+}
+
+func activeAuditHook() func(AuditRecord) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	return auditHook
+}
+
+// JSONAuditHook returns an audit hook writing each record to w as a JSON line.
+// Writes are serialized; a failing write is reported as a warning on os.Stderr.
+func JSONAuditHook(w io.Writer) func(AuditRecord) {
+	var mu sync.Mutex
+	return func(r AuditRecord) {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			writeWarning(os.Stderr, fmt.Sprintf("audit log write failed: %v", err))
+		}
+	}
+}
+
+// auditedDocker reports the mutating calls of a Backend to an audit hook.
+type auditedDocker struct {
+	Backend
+	hook func(AuditRecord)
+}
+
+// withAudit wraps dc if an audit hook is set.
+func withAudit(dc Backend) Backend {
+	if hook := activeAuditHook(); hook != nil {
+		return &auditedDocker{Backend: dc, hook: hook}
+	}
+	return dc
+}
+
+// record runs call and reports it. call returns the ID of a created resource.
+func (a *auditedDocker) record(op, target string, params any, call func() (string, error)) {
+	r := AuditRecord{
+		Time:   time.Now(),
+		Op:     op,
+		Target: target,
+		Caller: auditCaller(),
+		PID:    os.Getpid(),
+	}
+	if b, err := json.Marshal(params); err == nil {
+		sum := sha256.Sum256(b)
+		r.ParamsDigest = hex.EncodeToString(sum[:])
+	}
+	result, err := call()
+	r.DurationMS = time.Since(r.Time).Milliseconds()
+	r.Result = result
+	if err != nil {
+		r.Error = err.Error()
+	}
+	a.hook(r)
+}
+
+// auditPackage is the function name prefix of this package.
+const auditPackage = "github.com/hnw/compose-exec/compose."
+
+func auditCaller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, auditPackage) &&
+			!strings.HasPrefix(f.Function, "runtime.") {
+			return fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func (a *auditedDocker) ImagePull(
+	ctx context.Context,
+	ref string,
+	options image.PullOptions,
+) (rc io.ReadCloser, err error) {
+	// Registry credentials are left out of the digest.
+	params := []any{options.All, options.Platform}
+	a.record("image.pull", ref, params, func() (string, error) {
+		rc, err = a.Backend.ImagePull(ctx, ref, options)
+		return "", err
+	})
+	return rc, err
+}
+
+func (a *auditedDocker) ImageLoad(
+	ctx context.Context,
+	input io.Reader,
+	loadOpts ...client.ImageLoadOption,
+) (resp image.LoadResponse, err error) {
+	a.record("image.load", "", nil, func() (string, error) {
+		resp, err = a.Backend.ImageLoad(ctx, input, loadOpts...)
+		return "", err
+	})
+	return resp, err
+}
+
+func (a *auditedDocker) ImageRemove(
+	ctx context.Context,
+	imageID string,
+	options image.RemoveOptions,
+) (resp []image.DeleteResponse, err error) {
+	a.record("image.remove", imageID, options, func() (string, error) {
+		resp, err = a.Backend.ImageRemove(ctx, imageID, options)
+		return "", err
+	})
+	return resp, err
+}
+
+func (a *auditedDocker) ContainerCreate(
+	ctx context.Context,
+	config *container.Config,
+	hostConfig *container.HostConfig,
+	networkingConfig *network.NetworkingConfig,
+	platform *ocispec.Platform,
+	containerName string,
+) (resp container.CreateResponse, err error) {
+	params := []any{config, hostConfig, networkingConfig, platform}
+	a.record("container.create", containerName, params, func() (string, error) {
+		resp, err = a.Backend.ContainerCreate(
+			ctx, config, hostConfig, networkingConfig, platform, containerName,
+		)
+		return resp.ID, err
+	})
+	return resp, err
+}
+
+func (a *auditedDocker) ContainerStart(
+	ctx context.Context,
+	containerID string,
+	options container.StartOptions,
+) (err error) {
+	a.record("container.start", containerID, options, func() (string, error) {
+		err = a.Backend.ContainerStart(ctx, containerID, options)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) ContainerStop(
+	ctx context.Context,
+	containerID string,
+	options container.StopOptions,
+) (err error) {
+	a.record("container.stop", containerID, options, func() (string, error) {
+		err = a.Backend.ContainerStop(ctx, containerID, options)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) ContainerRestart(
+	ctx context.Context,
+	containerID string,
+	options container.StopOptions,
+) (err error) {
+	a.record("container.restart", containerID, options, func() (string, error) {
+		err = a.Backend.ContainerRestart(ctx, containerID, options)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) ContainerKill(
+	ctx context.Context,
+	containerID string,
+	signal string,
+) (err error) {
+	a.record("container.kill", containerID, signal, func() (string, error) {
+		err = a.Backend.ContainerKill(ctx, containerID, signal)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) ContainerRemove(
+	ctx context.Context,
+	containerID string,
+	options container.RemoveOptions,
+) (err error) {
+	a.record("container.remove", containerID, options, func() (string, error) {
+		err = a.Backend.ContainerRemove(ctx, containerID, options)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) ContainerPause(ctx context.Context, containerID string) (err error) {
+	a.record("container.pause", containerID, nil, func() (string, error) {
+		err = a.Backend.ContainerPause(ctx, containerID)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) ContainerUnpause(ctx context.Context, containerID string) (err error) {
+	a.record("container.unpause", containerID, nil, func() (string, error) {
+		err = a.Backend.ContainerUnpause(ctx, containerID)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) ContainerUpdate(
+	ctx context.Context,
+	containerID string,
+	updateConfig container.UpdateConfig,
+) (resp container.UpdateResponse, err error) {
+	a.record("container.update", containerID, updateConfig, func() (string, error) {
+		resp, err = a.Backend.ContainerUpdate(ctx, containerID, updateConfig)
+		return "", err
+	})
+	return resp, err
+}
+
+func (a *auditedDocker) CheckpointCreate(
+	ctx context.Context,
+	containerID string,
+	options checkpoint.CreateOptions,
+) (err error) {
+	a.record("container.checkpoint", containerID, options, func() (string, error) {
+		err = a.Backend.CheckpointCreate(ctx, containerID, options)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) ContainerCommit(
+	ctx context.Context,
+	containerID string,
+	options container.CommitOptions,
+) (resp container.CommitResponse, err error) {
+	a.record("container.commit", containerID, options, func() (string, error) {
+		resp, err = a.Backend.ContainerCommit(ctx, containerID, options)
+		return resp.ID, err
+	})
+	return resp, err
+}
+
+func (a *auditedDocker) CopyToContainer(
+	ctx context.Context,
+	containerID, dstPath string,
+	content io.Reader,
+	options container.CopyToContainerOptions,
+) (err error) {
+	params := []any{dstPath, options}
+	a.record("container.copy", containerID, params, func() (string, error) {
+		err = a.Backend.CopyToContainer(ctx, containerID, dstPath, content, options)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) ContainerExecCreate(
+	ctx context.Context,
+	containerID string,
+	options container.ExecOptions,
+) (resp container.ExecCreateResponse, err error) {
+	a.record("container.exec", containerID, options, func() (string, error) {
+		resp, err = a.Backend.ContainerExecCreate(ctx, containerID, options)
+		return resp.ID, err
+	})
+	return resp, err
+}
+
+func (a *auditedDocker) ContainerExecStart(
+	ctx context.Context,
+	execID string,
+	options container.ExecStartOptions,
+) (err error) {
+	a.record("exec.start", execID, options, func() (string, error) {
+		err = a.Backend.ContainerExecStart(ctx, execID, options)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) ContainerExecAttach(
+	ctx context.Context,
+	execID string,
+	options container.ExecAttachOptions,
+) (resp dockertypes.HijackedResponse, err error) {
+	// Attaching starts the exec.
+	a.record("exec.start", execID, options, func() (string, error) {
+		resp, err = a.Backend.ContainerExecAttach(ctx, execID, options)
+		return "", err
+	})
+	return resp, err
+}
+
+func (a *auditedDocker) NetworkCreate(
+	ctx context.Context,
+	name string,
+	options network.CreateOptions,
+) (resp network.CreateResponse, err error) {
+	a.record("network.create", name, options, func() (string, error) {
+		resp, err = a.Backend.NetworkCreate(ctx, name, options)
+		return resp.ID, err
+	})
+	return resp, err
+}
+
+func (a *auditedDocker) NetworkRemove(ctx context.Context, networkID string) (err error) {
+	a.record("network.remove", networkID, nil, func() (string, error) {
+		err = a.Backend.NetworkRemove(ctx, networkID)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) NetworkConnect(
+	ctx context.Context,
+	networkID, containerID string,
+	config *network.EndpointSettings,
+) (err error) {
+	params := []any{containerID, config}
+	a.record("network.connect", networkID, params, func() (string, error) {
+		err = a.Backend.NetworkConnect(ctx, networkID, containerID, config)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) NetworkDisconnect(
+	ctx context.Context,
+	networkID, containerID string,
+	force bool,
+) (err error) {
+	params := []any{containerID, force}
+	a.record("network.disconnect", networkID, params, func() (string, error) {
+		err = a.Backend.NetworkDisconnect(ctx, networkID, containerID, force)
+		return "", err
+	})
+	return err
+}
+
+func (a *auditedDocker) VolumeCreate(
+	ctx context.Context,
+	options volume.CreateOptions,
+) (vol volume.Volume, err error) {
+	a.record("volume.create", options.Name, options, func() (string, error) {
+		vol, err = a.Backend.VolumeCreate(ctx, options)
+		return vol.Name, err
+	})
+	return vol, err
+}
+
+func (a *auditedDocker) VolumeRemove(ctx context.Context, volumeID string, force bool) (err error) {
+	a.record("volume.remove", volumeID, force, func() (string, error) {
+		err = a.Backend.VolumeRemove(ctx, volumeID, force)
+		return "", err
+	})
+	return err
+}
@@ -0,0 +1,68 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DockerBackend is the name of the built-in Docker Engine backend.
+const DockerBackend = "docker"
+
+// BackendFactory creates a Backend. It is called once per Cmd and per helper
+// operation (Down, Janitor, ...), which closes the Backend when done.
+type BackendFactory func() (Backend, error)
+
+var (
+	backendMu        sync.Mutex
+	backendFactories = map[string]BackendFactory{}
+	backendName      = DockerBackend
+)
+
+// RegisterBackend makes a Backend implementation available under name for
+// SetBackend, typically from the init function of the package implementing it.
+// The name must be unique and must not be DockerBackend.
+func RegisterBackend(name string, factory BackendFactory) error {
+	if name == "" || name == DockerBackend {
+		return fmt.Errorf("compose: invalid backend name %q", name)
+	}
+	if factory == nil {
+		return errors.New("compose: backend factory is nil")
+	}
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if _, ok := backendFactories[name]; ok {
+		return fmt.Errorf("compose: backend %q is already registered", name)
+	}
+	backendFactories[name] = factory
+	return nil
+}
+
+// SetBackend selects the registered backend used by all operations started
+// afterwards. DockerBackend or "" restores the Docker Engine client.
+func SetBackend(name string) error {
+	if name == "" {
+		name = DockerBackend
+	}
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	if _, ok := backendFactories[name]; !ok && name != DockerBackend {
+		return fmt.Errorf("compose: backend %q is not registered", name)
+	}
+	backendName = name
+	return nil
+}
+
+func activeBackendName() string {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	return backendName
+}
+
+// activeBackendFactory returns the factory of the selected backend, or nil for
+// the Docker Engine client.
+func activeBackendFactory() BackendFactory {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	return backendFactories[backendName]
+}
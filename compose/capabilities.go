@@ -0,0 +1,96 @@
+package compose
+
+import (
+	"fmt"
+	"strings"
+)
+
+// capabilityAll is the special value accepted by cap_add/cap_drop meaning every capability.
+const capabilityAll = "ALL"
+
+// knownCapabilities lists the Linux capabilities accepted by Docker Engine.
+var knownCapabilities = map[string]struct{}{
+	"CAP_AUDIT_CONTROL":      {},
+	"CAP_AUDIT_READ":         {},
+	"CAP_AUDIT_WRITE":        {},
+	"CAP_BLOCK_SUSPEND":      {},
+	"CAP_BPF":                {},
+	"CAP_CHECKPOINT_RESTORE": {},
+	"CAP_CHOWN":              {},
+	"CAP_DAC_OVERRIDE":       {},
+	"CAP_DAC_READ_SEARCH":    {},
+	"CAP_FOWNER":             {},
+	"CAP_FSETID":             {},
+	"CAP_IPC_LOCK":           {},
+	"CAP_IPC_OWNER":          {},
+	"CAP_KILL":               {},
+	"CAP_LEASE":              {},
+	"CAP_LINUX_IMMUTABLE":    {},
+	"CAP_MAC_ADMIN":          {},
+	"CAP_MAC_OVERRIDE":       {},
+	"CAP_MKNOD":              {},
+	"CAP_NET_ADMIN":          {},
+	"CAP_NET_BIND_SERVICE":   {},
+	"CAP_NET_BROADCAST":      {},
+	"CAP_NET_RAW":            {},
+	"CAP_PERFMON":            {},
+	"CAP_SETFCAP":            {},
+	"CAP_SETGID":             {},
+	"CAP_SETPCAP":            {},
+	"CAP_SETUID":             {},
+	"CAP_SYS_ADMIN":          {},
+	"CAP_SYS_BOOT":           {},
+	"CAP_SYS_CHROOT":         {},
+	"CAP_SYS_MODULE":         {},
+	"CAP_SYS_NICE":           {},
+	"CAP_SYS_PACCT":          {},
+	"CAP_SYS_PTRACE":         {},
+	"CAP_SYS_RAWIO":          {},
+	"CAP_SYS_RESOURCE":       {},
+	"CAP_SYS_TIME":           {},
+	"CAP_SYS_TTY_CONFIG":     {},
+	"CAP_SYSLOG":             {},
+	"CAP_WAKE_ALARM":         {},
+}
+
+// normalizeCapabilities canonicalizes capability names to the "CAP_" prefixed,
+// upper-case form used by Docker Engine and rejects unknown names.
+//
+// "ALL" (in any case) is preserved as-is. When present, it makes every other
+// entry redundant, so the result collapses to just "ALL".
+func normalizeCapabilities(field string, caps []string) ([]string, error) {
+	if len(caps) == 0 {
+		return nil, nil
+	}
+	out := make([]string, 0, len(caps))
+	seen := make(map[string]struct{}, len(caps))
+	all := false
+	for _, raw := range caps {
+		name := strings.ToUpper(strings.TrimSpace(raw))
+		if name == "" {
+			continue
+		}
+		if name == capabilityAll || name == "CAP_"+capabilityAll {
+			all = true
+			continue
+		}
+		if !strings.HasPrefix(name, "CAP_") {
+			name = "CAP_" + name
+		}
+		if _, ok := knownCapabilities[name]; !ok {
+			return nil, fmt.Errorf("compose: unknown capability %q in %s", raw, field)
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		out = append(out, name)
+	}
+	if all {
+		return []string{capabilityAll}, nil
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
@@ -0,0 +1,346 @@
+package compose
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// CIFormat selects the log grouping syntax of a CI system.
+type CIFormat string
+
+const (
+	// CIFormatNone disables grouping.
+	CIFormatNone CIFormat = ""
+	// CIFormatGitHubActions uses ::group:: / ::endgroup:: and ::error annotations.
+	CIFormatGitHubActions CIFormat = "github-actions"
+	// CIFormatTeamCity uses ##teamcity blockOpened/blockClosed and buildProblem
+	// service messages.
+	CIFormatTeamCity CIFormat = "teamcity"
+)
+
+// DetectCIFormat returns the format of the CI system this process runs in, or
+// CIFormatNone outside of a supported CI.
+func DetectCIFormat() CIFormat {
+	switch {
+	case os.Getenv("GITHUB_ACTIONS") == "true":
+		return CIFormatGitHubActions
+	case os.Getenv("TEAMCITY_VERSION") != "":
+		return CIFormatTeamCity
+	default:
+		return CIFormatNone
+	}
+}
+
+// CIGroupWriter writes output as a collapsible CI log group, opened with the first
+// write and closed by Close, and can mark the group as failed.
+//
+// CI logs cannot interleave groups, so groups sharing one underlying writer take
+// turns: the first group to write streams live, while others buffer their output
+// and are written as a whole once the writer is free.
+type CIGroupWriter struct {
+	format CIFormat
+	title  string
+	sink   *ciSink
+
+	// Guarded by sink.mu.
+	buf     bytes.Buffer
+	opened  bool
+	closed  bool
+	failure string
+}
+
+// ciSink serializes the groups written to one underlying writer.
+type ciSink struct {
+	mu      sync.Mutex
+	w       io.Writer
+	owner   *CIGroupWriter
+	waiting []*CIGroupWriter
+	// midLine is true when the last byte written was not a newline.
+	midLine bool
+	// groups counts the unclosed groups; the sink is dropped when it reaches zero.
+	groups int
+}
+
+var (
+	ciSinksMu sync.Mutex
+	ciSinks   = map[io.Writer]*ciSink{}
+)
+
+// NewCIGroupWriter returns a writer that groups its output under title in w. With
+// CIFormatNone the output is written to w unchanged.
+func NewCIGroupWriter(w io.Writer, format CIFormat, title string) *CIGroupWriter {
+	return &CIGroupWriter{format: format, title: title, sink: sinkFor(w)}
+}
+
+// sinkFor returns the shared sink of w. Writers that cannot be compared (and thus
+// not shared by identity) get a sink of their own.
+func sinkFor(w io.Writer) *ciSink {
+	if !comparableWriter(w) {
+		return &ciSink{w: w, groups: 1}
+	}
+	ciSinksMu.Lock()
+	defer ciSinksMu.Unlock()
+	s := ciSinks[w]
+	if s == nil {
+		s = &ciSink{w: w}
+		ciSinks[w] = s
+	}
+	s.mu.Lock()
+	s.groups++
+	s.mu.Unlock()
+	return s
+}
+
+// release drops the sink from the registry once its last group closed.
+func (s *ciSink) release() {
+	ciSinksMu.Lock()
+	defer ciSinksMu.Unlock()
+	s.mu.Lock()
+	s.groups--
+	last := s.groups == 0
+	s.mu.Unlock()
+	if last && comparableWriter(s.w) && ciSinks[s.w] == s {
+		delete(ciSinks, s.w)
+	}
+}
+
+func comparableWriter(w io.Writer) bool {
+	return w != nil && reflect.TypeOf(w).Comparable()
+}
+
+// Write writes p into the group, opening it if needed.
+func (g *CIGroupWriter) Write(p []byte) (int, error) {
+	s := g.sink
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g.closed {
+		return 0, fmt.Errorf("compose: write to closed CI group %q", g.title)
+	}
+	if s.owner == nil {
+		s.owner = g
+		if err := s.open(g); err != nil {
+			return 0, err
+		}
+	}
+	if s.owner != g {
+		g.buf.Write(p)
+		if !s.queued(g) {
+			s.waiting = append(s.waiting, g)
+		}
+		return len(p), nil
+	}
+	if err := s.write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Fail marks the group as failed with msg. Close reports it as a problem
+// annotation (an ::error or a buildProblem), so CI UIs list it in their summary.
+func (g *CIGroupWriter) Fail(msg string) {
+	s := g.sink
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g.failure = msg
+}
+
+// Close closes the group and reports a failure set by Fail. Closing a group that
+// is still waiting for the underlying writer writes it as soon as the writer is
+// free. Close is idempotent.
+func (g *CIGroupWriter) Close() error {
+	s := g.sink
+	s.mu.Lock()
+	if g.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	g.closed = true
+	err := s.close(g)
+	s.mu.Unlock()
+	s.release()
+	return err
+}
+
+func (s *ciSink) close(g *CIGroupWriter) error {
+	if s.owner != g {
+		if s.owner == nil {
+			return s.flushAll(g)
+		}
+		if !s.queued(g) {
+			s.waiting = append(s.waiting, g)
+		}
+		return nil
+	}
+	err := s.finish(g)
+	s.owner = nil
+	// Write the groups that completed while g held the writer, then hand it to
+	// the next one still running so it continues live.
+	for len(s.waiting) > 0 && err == nil {
+		next := s.waiting[0]
+		s.waiting = s.waiting[1:]
+		if next.closed {
+			err = s.flushAll(next)
+			continue
+		}
+		s.owner = next
+		err = s.open(next)
+		break
+	}
+	return err
+}
+
+func (s *ciSink) queued(g *CIGroupWriter) bool {
+	for _, w := range s.waiting {
+		if w == g {
+			return true
+		}
+	}
+	return false
+}
+
+// flushAll writes the whole closed group g.
+func (s *ciSink) flushAll(g *CIGroupWriter) error {
+	if err := s.open(g); err != nil {
+		return err
+	}
+	return s.finish(g)
+}
+
+// open writes g's opening marker and the output it buffered so far.
+func (s *ciSink) open(g *CIGroupWriter) error {
+	if !g.opened {
+		g.opened = true
+		if err := s.marker(g.openMarker()); err != nil {
+			return err
+		}
+	}
+	if g.buf.Len() == 0 {
+		return nil
+	}
+	err := s.write(g.buf.Bytes())
+	g.buf.Reset()
+	return err
+}
+
+// finish writes g's failure annotation and closing marker.
+func (s *ciSink) finish(g *CIGroupWriter) error {
+	if !g.opened {
+		if err := s.open(g); err != nil {
+			return err
+		}
+	}
+	if err := s.marker(g.closeMarker()); err != nil {
+		return err
+	}
+	if g.failure == "" {
+		return nil
+	}
+	return s.marker(g.failureMarker())
+}
+
+// marker writes a line that CI systems only recognize at the start of a line.
+func (s *ciSink) marker(line string) error {
+	if line == "" {
+		return nil
+	}
+	if s.midLine {
+		line = "\n" + line
+	}
+	return s.write([]byte(line + "\n"))
+}
+
+func (s *ciSink) write(p []byte) error {
+	if s.w == nil || len(p) == 0 {
+		return nil
+	}
+	if _, err := s.w.Write(p); err != nil {
+		return err
+	}
+	s.midLine = p[len(p)-1] != '\n'
+	return nil
+}
+
+func (g *CIGroupWriter) openMarker() string {
+	switch g.format {
+	case CIFormatGitHubActions:
+		return "::group::" + escapeGitHubData(g.title)
+	case CIFormatTeamCity:
+		return fmt.Sprintf("##teamcity[blockOpened name='%s']", escapeTeamCity(g.title))
+	default:
+		return ""
+	}
+}
+
+func (g *CIGroupWriter) closeMarker() string {
+	switch g.format {
+	case CIFormatGitHubActions:
+		return "::endgroup::"
+	case CIFormatTeamCity:
+		return fmt.Sprintf("##teamcity[blockClosed name='%s']", escapeTeamCity(g.title))
+	default:
+		return ""
+	}
+}
+
+func (g *CIGroupWriter) failureMarker() string {
+	switch g.format {
+	case CIFormatGitHubActions:
+		return fmt.Sprintf("::error title=%s::%s",
+			escapeGitHubProperty(g.title), escapeGitHubData(g.failure))
+	case CIFormatTeamCity:
+		return fmt.Sprintf("##teamcity[buildProblem description='%s: %s']",
+			escapeTeamCity(g.title), escapeTeamCity(g.failure))
+	default:
+		return ""
+	}
+}
+
+var (
+	gitHubDataEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	gitHubPropEscaper = strings.NewReplacer(
+		"%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C",
+	)
+	teamCityEscaper = strings.NewReplacer(
+		"|", "||", "'", "|'", "\n", "|n", "\r", "|r", "[", "|[", "]", "|]",
+	)
+)
+
+func escapeGitHubData(s string) string     { return gitHubDataEscaper.Replace(s) }
+func escapeGitHubProperty(s string) string { return gitHubPropEscaper.Replace(s) }
+func escapeTeamCity(s string) string       { return teamCityEscaper.Replace(s) }
+
+// GroupOutput writes the Cmd's output as a CI log group titled title (the service
+// name if empty) to Stdout, or os.Stdout if Stdout is unset. Stderr joins the group
+// unless it is set to a different writer. When the Cmd fails, the group is marked
+// with a problem annotation carrying the error. Call it before Start; with
+// CIFormatNone it does nothing. Use DetectCIFormat to pick the format.
+func (c *Cmd) GroupOutput(format CIFormat, title string) {
+	if format == CIFormatNone {
+		return
+	}
+	if title == "" {
+		title = c.Service.Name
+	}
+	out := c.Stdout
+	if out == nil {
+		out = os.Stdout
+	}
+	g := NewCIGroupWriter(out, format, title)
+	if c.Stderr == nil || comparableWriter(c.Stderr) && c.Stderr == c.Stdout {
+		c.Stderr = g
+	}
+	c.Stdout = g
+	c.onFinish(func(err error) {
+		if err != nil {
+			g.Fail(err.Error())
+		}
+		if closeErr := g.Close(); closeErr != nil {
+			writeWarning(os.Stderr, fmt.Sprintf("CI group write failed: %v", closeErr))
+		}
+	})
+}
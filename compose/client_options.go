@@ -0,0 +1,163 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/sockets"
+)
+
+// ClientOptions customizes the Docker Engine client used by Cmds, Down, preflight
+// checks and every other helper that talks to the daemon. The zero value keeps the
+// defaults: connection settings from the DOCKER_* environment variables and API
+// version negotiation.
+type ClientOptions struct {
+	// Host is the daemon address, e.g. "unix:///run/docker.sock" or
+	// "tcp://10.0.0.5:2376". Empty uses DOCKER_HOST or the platform default.
+	Host string
+	// APIVersion pins the Engine API version (e.g. "1.44") instead of negotiating
+	// it with the daemon. Empty uses DOCKER_API_VERSION, or negotiation.
+	APIVersion string
+	// HTTPClient replaces the HTTP client, e.g. to route TCP connections through a
+	// corporate proxy or to tune the transport. It is copied, never modified. A
+	// transport without its own dialer is given one for unix and npipe hosts; for TCP
+	// hosts the transport is used as is, including its Proxy. The TLS settings
+	// derived from DOCKER_TLS_VERIFY and DOCKER_CERT_PATH do not apply to it.
+	HTTPClient *http.Client
+	// ResponseHeaderTimeout bounds the wait for the response headers of each request.
+	// Streaming responses (container waits, logs, image pulls) are not limited once
+	// their headers arrived. Zero means no limit.
+	ResponseHeaderTimeout time.Duration
+	// TLSHandshakeTimeout bounds the TLS handshake with a TCP daemon. Zero keeps
+	// the transport's setting.
+	TLSHandshakeTimeout time.Duration
+	// Headers are added to every request, e.g. for an authenticating proxy.
+	Headers map[string]string
+}
+
+var (
+	clientOptsMu sync.RWMutex
+	clientOpts   ClientOptions
+)
+
+// SetClientOptions configures the Docker client for all operations started
+// afterwards. Clients that already exist keep their settings. The zero value
+// restores the defaults.
+func SetClientOptions(opts ClientOptions) error {
+	if opts.Host != "" {
+		if _, err := client.ParseHostURL(opts.Host); err != nil {
+			return fmt.Errorf("compose: invalid client host %q: %w", opts.Host, err)
+		}
+	}
+	if opts.ResponseHeaderTimeout < 0 || opts.TLSHandshakeTimeout < 0 {
+		return errors.New("compose: client timeouts must not be negative")
+	}
+	if opts.hasTimeouts() && opts.HTTPClient != nil && opts.HTTPClient.Transport != nil {
+		if _, ok := opts.HTTPClient.Transport.(*http.Transport); !ok {
+			return fmt.Errorf(
+				"compose: client timeouts require an *http.Transport, got %T",
+				opts.HTTPClient.Transport,
+			)
+		}
+	}
+	opts.Headers = maps.Clone(opts.Headers)
+	clientOptsMu.Lock()
+	clientOpts = opts
+	clientOptsMu.Unlock()
+	return nil
+}
+
+func currentClientOptions() ClientOptions {
+	clientOptsMu.RLock()
+	defer clientOptsMu.RUnlock()
+	return clientOpts
+}
+
+func (o ClientOptions) hasTimeouts() bool {
+	return o.ResponseHeaderTimeout > 0 || o.TLSHandshakeTimeout > 0
+}
+
+// clientOpts translates o into Engine client options. Later options win, so the
+// explicit settings follow FromEnv.
+func (o ClientOptions) clientOpts() []client.Opt {
+	opts := []client.Opt{client.FromEnv}
+	if o.Host != "" {
+		opts = append(opts, client.WithHost(o.Host))
+	}
+	if o.APIVersion != "" {
+		// A pinned version disables the negotiation requested below.
+		opts = append(opts, client.WithVersion(o.APIVersion))
+	}
+	if o.HTTPClient != nil || o.hasTimeouts() {
+		opts = append(opts, o.withHTTPClient())
+	}
+	if len(o.Headers) > 0 {
+		opts = append(opts, client.WithHTTPHeaders(maps.Clone(o.Headers)))
+	}
+	return append(opts, client.WithAPIVersionNegotiation())
+}
+
+// withHTTPClient installs a copy of the configured HTTP client, or of the default
+// one when only timeouts are set, with a cloned transport so neither the caller's
+// client nor http.DefaultTransport is modified.
+func (o ClientOptions) withHTTPClient() client.Opt {
+	return func(c *client.Client) error {
+		hc := c.HTTPClient()
+		custom := o.HTTPClient != nil
+		if custom {
+			cp := *o.HTTPClient
+			hc = &cp
+			if hc.Transport == nil {
+				hc.Transport = http.DefaultTransport
+			}
+			if hc.CheckRedirect == nil {
+				hc.CheckRedirect = client.CheckRedirect
+			}
+		}
+		tr, ok := hc.Transport.(*http.Transport)
+		if !ok {
+			if o.hasTimeouts() {
+				return fmt.Errorf("compose: client timeouts require an *http.Transport, got %T",
+					hc.Transport)
+			}
+			return client.WithHTTPClient(hc)(c)
+		}
+		tr = tr.Clone()
+		//nolint:staticcheck // Dial is how sockets configures local transports.
+		hasDialer := tr.DialContext != nil || tr.Dial != nil
+		if custom && !hasDialer {
+			if err := configureLocalSocket(tr, c.DaemonHost()); err != nil {
+				return err
+			}
+		}
+		if o.ResponseHeaderTimeout > 0 {
+			tr.ResponseHeaderTimeout = o.ResponseHeaderTimeout
+		}
+		if o.TLSHandshakeTimeout > 0 {
+			tr.TLSHandshakeTimeout = o.TLSHandshakeTimeout
+		}
+		hc.Transport = tr
+		return client.WithHTTPClient(hc)(c)
+	}
+}
+
+// configureLocalSocket makes tr dial host when it is a unix socket or named pipe,
+// which a generic HTTP transport cannot reach. TCP transports are left alone so
+// their proxy settings survive.
+func configureLocalSocket(tr *http.Transport, host string) error {
+	u, err := client.ParseHostURL(host)
+	if err != nil {
+		return fmt.Errorf("compose: invalid client host %q: %w", host, err)
+	}
+	switch u.Scheme {
+	case "unix", "npipe":
+		return sockets.ConfigureTransport(tr, u.Scheme, u.Host)
+	default:
+		return nil
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/compose-spec/compose-go/v2/types"
 	dockertypes "github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
 )
 
 // Cmd represents a pending command execution, similar to os/exec.Cmd.
@@ -21,33 +25,162 @@ type Cmd struct {
 	// WorkingDir overrides the docker-compose.yml working_dir for this Cmd.
 	// Leave empty to use the service config or image default.
 	WorkingDir string
+	// StrictAPIVersion makes Start fail with ErrFeatureUnsupportedByDaemon when the
+	// service uses features the daemon's API version cannot express. By default such
+	// features are dropped with a warning on os.Stderr.
+	StrictAPIVersion bool
+	// WaitForRemoval makes Wait return only after the engine has confirmed the
+	// container is gone, so its name and resources can be reused immediately.
+	WaitForRemoval bool
+	// AutoRemove delegates container removal to the engine (HostConfig.AutoRemove),
+	// so the container is cleaned up even if this process dies after it exits.
+	// Wait then waits for the removal instead of removing the container itself.
+	// ExitError.ContainerState is unavailable in this mode.
+	AutoRemove bool
+	// ForwardSignals relays SIGINT, SIGTERM, SIGQUIT, SIGHUP, SIGUSR1 and SIGUSR2
+	// received by this process to the container (like `docker compose run` in the
+	// foreground) instead of stopping it on SIGINT/SIGTERM. The container decides
+	// how to react; Wait returns when it exits.
+	ForwardSignals bool
+	// DisableSignalHandling stops the Cmd from installing any signal handlers, so
+	// cancellation is driven solely by the caller's context. It takes precedence
+	// over ForwardSignals.
+	DisableSignalHandling bool
+	// ExtraMounts are added to the mounts defined in docker-compose.yml for this Cmd
+	// only, e.g. to mount a scratch directory or a socket. An extra mount replaces a
+	// YAML-defined mount with the same target. Bind sources must be absolute paths.
+	ExtraMounts []mount.Mount
+	// ExtraHosts adds /etc/hosts entries in "host:ip" form for this run, replacing
+	// the service's extra_hosts entries for the same host names. As in compose
+	// files, the ip "host-gateway" stands for the host machine, e.g.
+	// "host.docker.internal:host-gateway" to reach services running on the host.
+	ExtraHosts []string
+	// EphemeralPorts publishes every declared port on a free host port chosen by the
+	// engine instead of the fixed `published:` port, so parallel runs of the same
+	// compose file never collide. PublishedPorts reports the chosen ports alongside
+	// the declared ones.
+	EphemeralPorts bool
+	// IncludeEarlyLogs makes Start attach with the daemon's log replay enabled, so
+	// output the logging driver already holds for the container is delivered before
+	// the live stream. Start attaches before the container starts, so a new
+	// container's output, including that of containers exiting immediately, is
+	// complete either way; replay additionally requires a logging driver that
+	// supports reading (e.g. json-file or local) and fails attaching otherwise.
+	IncludeEarlyLogs bool
+	// KeepAlive keeps long, mostly idle runs connected: the daemon is pinged at this
+	// interval and TCP keep-alives are enabled on the attach connection. When the
+	// attach stream breaks while the container is still running, output resumes from
+	// the container logs; stdin is not reconnected. Zero disables this.
+	KeepAlive time.Duration
+	// OnOutputGap, if set, is called when KeepAlive re-attaches, before the missed
+	// output is written to Stdout and Stderr, e.g. to write a marker line there.
+	OnOutputGap func(OutputGap)
+	// StopOnWriteError stops the container as soon as writing its output to Stdout
+	// or Stderr fails, instead of letting it run to completion while its output is
+	// lost. Either way Wait returns a *WriteError.
+	StopOnWriteError bool
+	// OutputBuffer, if positive, decouples Stdout and Stderr from the container's
+	// output stream through a ring buffer of this many bytes each, so a slow or
+	// blocked writer cannot stall reading the output or wedge Wait; see
+	// OutputOverflow and DroppedOutput. After the container exited, Wait waits at
+	// most a few seconds for the buffered output to be written.
+	OutputBuffer int
+	// OutputOverflow is the policy when OutputBuffer is full. The default,
+	// OverflowDropOldest, discards the oldest buffered output.
+	OutputOverflow OutputOverflow
+	// OnOutputDropped, if set, is called whenever OutputBuffer discards output.
+	OnOutputDropped func(OutputDrop)
+	// RestoreFrom starts the container from a checkpoint taken by Cmd.Checkpoint
+	// instead of running its entrypoint. Experimental; see Checkpoint.
+	RestoreFrom *Checkpoint
+	// InitCommands run in the container, in order, right after it starts (alongside
+	// its main process) and before Start returns, so they complete before any
+	// readiness check, e.g. to seed data or fix permissions. They follow the commands
+	// of the service's `x-init` extension. Start fails, removing the container, if
+	// one of them exits non-zero.
+	InitCommands [][]string
+	// ZombieCheck, if positive, diagnoses containers running without an init
+	// process (`init: false`, or see SetDefaultInit): their processes are listed at
+	// this interval while they run, and a warning is written to os.Stderr the first
+	// time zombie processes show up, which means the command as PID 1 does not reap
+	// its children.
+	ZombieCheck time.Duration
+	// MutateCreateConfig, if set, is called with the container's configuration
+	// right before the container is created, as an escape hatch to set engine
+	// options this package does not model. The networking config is never nil.
+	// Options the daemon's API version does not support are still dropped (see
+	// StrictAPIVersion).
+	MutateCreateConfig func(*container.Config, *container.HostConfig, *network.NetworkingConfig)
 
-	Stdin  io.Reader
+	Stdin io.Reader
+	// Stdout and Stderr receive the container's output. A container with a TTY
+	// (Config.Tty, e.g. from service `tty: true`) writes a single raw stream, which
+	// goes to Stdout only, standard error included; KeepAlive cannot resume it.
 	Stdout io.Writer
 	Stderr io.Writer
 
-	// Delayed error propagated from Service initialization.
-	loadErr error
+	// Err holds a configuration error found when the Cmd was constructed, similar
+	// to os/exec.Cmd.Err: the project or service could not be loaded, an argument
+	// is invalid, or CommandContext was given a nil context. If Err is non-nil,
+	// Start and Run return it without contacting the Docker Engine.
+	Err error
 	// ctx is the lifecycle context (set by CommandContext).
 	ctx context.Context
 
 	// Internal
 	service *Service
-	docker  dockerAPI
+	docker  Backend
 	// dockerOwned is true when this Cmd created the client internally.
 	dockerOwned bool
 
 	mu          sync.Mutex
 	started     bool
+	detached    bool
+	rawOutput   bool
 	containerID string
 	waitRespCh  <-chan container.WaitResponse
 	waitErrCh   <-chan error
 	attach      *dockertypes.HijackedResponse
+	logStream   io.Closer
 	ioDone      chan struct{}
 	ioErrCh     chan error
 	stdinDone   chan struct{}
 	signalCtx   context.Context
 	signalStop  func()
+	forwarder   *signalForwarder
+	timing      Timing
+	runStart    time.Time
+	watchStops  []context.CancelFunc
+	// watchersStopped is set once Wait stopped the watchers; later ones are
+	// stopped at once.
+	watchersStopped bool
+	finishHooks     []func(error)
+
+	// restarting is set while Watch restarts the container, and restarts counts
+	// the completed restarts. restartedAttach is the attach stream of the last
+	// restart until the output forwarder takes it over, and replacedAttaches are
+	// the streams it replaced. Once Wait or the forwarder saw the final exit,
+	// restartsClosed refuses further restarts.
+	restarting       chan struct{}
+	restarts         int
+	restartedAttach  *dockertypes.HijackedResponse
+	replacedAttaches []*dockertypes.HijackedResponse
+	restartsClosed   bool
+
+	keepAliveStop context.CancelFunc
+	// outputActivity tracks reads from the attach stream while KeepAlive is set.
+	outputActivity *activityReader
+
+	mountDockerSocket bool
+	archives          []pendingArchive
+
+	// entrypoint overrides the service's entrypoint (see ShellCommand).
+	entrypoint []string
+	// wrapper is prepended to the effective command (see WrapCommand).
+	wrapper []string
+
+	outputBuffers []*outputBuffer
+	droppedOutput int64
 
 	captureStderr bool
 	stderrBuf     bytes.Buffer
@@ -55,4 +188,5 @@ type Cmd struct {
 	stdoutPipe *io.PipeWriter
 	stderrPipe *io.PipeWriter
 	stdinPipe  *io.PipeReader
+	stdinFile  *os.File
 }
@@ -0,0 +1,54 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// pendingArchive is a tar stream to extract into the container before it starts.
+type pendingArchive struct {
+	dir string
+	r   io.Reader
+}
+
+// StreamArchiveTo extracts the tar stream r (optionally compressed with gzip, bzip2
+// or xz) into the directory containerPath of the container after it is created and
+// before the command starts. It loads fixtures without bind mounts, so it also
+// works with remote daemons. containerPath must be absolute and exist in the image.
+//
+// Archives are extracted in call order. r is read during Start; if it implements
+// io.Closer, the caller remains responsible for closing it.
+func (c *Cmd) StreamArchiveTo(containerPath string, r io.Reader) error {
+	if c.isStarted() {
+		return errors.New("compose: already started")
+	}
+	if r == nil {
+		return errors.New("compose: archive reader is nil")
+	}
+	if !path.IsAbs(containerPath) {
+		return fmt.Errorf("compose: archive destination %q must be absolute", containerPath)
+	}
+	c.mu.Lock()
+	c.archives = append(c.archives, pendingArchive{dir: path.Clean(containerPath), r: r})
+	c.mu.Unlock()
+	return nil
+}
+
+// uploadArchives extracts the pending archives into the created container id.
+func (c *Cmd) uploadArchives(ctx context.Context, dc Backend, id string) error {
+	c.mu.Lock()
+	archives := c.archives
+	c.mu.Unlock()
+	for _, a := range archives {
+		err := dc.CopyToContainer(ctx, id, a.dir, a.r, container.CopyToContainerOptions{})
+		if err != nil {
+			return engineErr(fmt.Sprintf("copy archive to %q", a.dir), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Pause freezes all processes of the running container, e.g. to simulate a hung
+// dependency. The container keeps its network endpoints but stops responding.
+func (c *Cmd) Pause(ctx context.Context) error {
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return err
+	}
+	return engineErr("pause container", dc.ContainerPause(ctx, id))
+}
+
+// Unpause resumes a container frozen by Pause.
+func (c *Cmd) Unpause(ctx context.Context) error {
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return err
+	}
+	return engineErr("unpause container", dc.ContainerUnpause(ctx, id))
+}
+
+// UpdateResources changes the CPU and memory limits of the running container.
+// cpus is a number of CPUs (like `cpus:` in compose files) and memory is in bytes;
+// a zero value leaves that limit unchanged. Swap is limited to memory, so a
+// shrunk limit takes effect instead of pushing the container into swap.
+func (c *Cmd) UpdateResources(ctx context.Context, cpus float64, memory int64) error {
+	if cpus < 0 || memory < 0 {
+		return errors.New("compose: resource limits must not be negative")
+	}
+	if cpus == 0 && memory == 0 {
+		return nil
+	}
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return err
+	}
+	var update container.UpdateConfig
+	if cpus > 0 {
+		update.NanoCPUs = int64(math.Round(cpus * 1_000_000_000))
+	}
+	if memory > 0 {
+		update.Memory = memory
+		update.MemorySwap = memory
+	}
+	_, err = dc.ContainerUpdate(ctx, id, update)
+	return engineErr("update container", err)
+}
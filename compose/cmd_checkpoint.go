@@ -0,0 +1,103 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/docker/docker/api/types/checkpoint"
+	"github.com/docker/docker/api/types/container"
+)
+
+// ErrCheckpointUnsupported is matched (via errors.Is) by errors from Checkpoint and
+// from starting a Cmd with RestoreFrom when the daemon cannot checkpoint containers.
+var ErrCheckpointUnsupported = errors.New(
+	"compose: checkpoint/restore requires a Linux daemon in experimental mode",
+)
+
+// Checkpoint identifies a CRIU checkpoint of a service container.
+//
+// Checkpoint/restore is experimental: the daemon must run on Linux in experimental
+// mode with CRIU installed. Restoring skips the service's startup (e.g. a database
+// that already ran its migrations), which can cut dependency startup from tens of
+// seconds to well under one.
+type Checkpoint struct {
+	// Name identifies the checkpoint.
+	Name string
+	// Dir is the absolute directory the checkpoint is written to and restored from.
+	// It is translated with SetPathMapping like bind sources. Empty uses the engine's
+	// directory of the checkpointed container, which only that container can restore
+	// from; set Dir to restore into new containers.
+	Dir string
+}
+
+// Checkpoint snapshots the processes of the running container into cp and leaves
+// the container running. Start a new Cmd for the same service with RestoreFrom set
+// to resume from the snapshot instead of running the entrypoint; the container must
+// be created from the same image and configuration.
+func (c *Cmd) Checkpoint(ctx context.Context, cp Checkpoint) error {
+	if err := cp.validate(); err != nil {
+		return err
+	}
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return err
+	}
+	if supErr := checkpointSupported(ctx, dc); supErr != nil {
+		return supErr
+	}
+	return engineErr("create checkpoint", dc.CheckpointCreate(ctx, id, checkpoint.CreateOptions{
+		CheckpointID:  cp.Name,
+		CheckpointDir: mapHostPath(cp.Dir),
+	}))
+}
+
+func (cp Checkpoint) validate() error {
+	if cp.Name == "" {
+		return errors.New("compose: checkpoint name is required")
+	}
+	if cp.Dir != "" && !path.IsAbs(cp.Dir) {
+		return fmt.Errorf("compose: checkpoint dir %q must be an absolute path", cp.Dir)
+	}
+	return nil
+}
+
+// checkpointSupported rejects daemons without experimental features up front: they
+// fail checkpoint requests with a generic "not found" error otherwise.
+func checkpointSupported(ctx context.Context, dc Backend) error {
+	v, err := dc.ServerVersion(ctx)
+	if err != nil {
+		return engineErr("get server version", err)
+	}
+	if v.Os != "" && v.Os != "linux" {
+		return fmt.Errorf("%w (daemon OS %s)", ErrCheckpointUnsupported, v.Os)
+	}
+	if !v.Experimental {
+		return ErrCheckpointUnsupported
+	}
+	return nil
+}
+
+// startOptions returns the ContainerStart options, restoring from RestoreFrom if set.
+func (c *Cmd) startOptions() container.StartOptions {
+	if c.RestoreFrom == nil {
+		return container.StartOptions{}
+	}
+	return container.StartOptions{
+		CheckpointID:  c.RestoreFrom.Name,
+		CheckpointDir: mapHostPath(c.RestoreFrom.Dir),
+	}
+}
+
+// checkRestore validates RestoreFrom before the container is created, so an
+// unsupported daemon does not leave a created container behind.
+func (c *Cmd) checkRestore(ctx context.Context, dc Backend) error {
+	if c.RestoreFrom == nil {
+		return nil
+	}
+	if err := c.RestoreFrom.validate(); err != nil {
+		return err
+	}
+	return checkpointSupported(ctx, dc)
+}
@@ -0,0 +1,44 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// CommitOptions configures Cmd.Commit.
+type CommitOptions struct {
+	// Comment and Author are recorded in the image metadata.
+	Comment string
+	Author  string
+	// Changes are Dockerfile instructions applied to the image config, e.g.
+	// "ENV MIGRATED=1" or `CMD ["postgres"]`.
+	Changes []string
+	// NoPause commits without pausing the container. By default it is paused while
+	// committing so the filesystem is consistent.
+	NoPause bool
+}
+
+// Commit saves the filesystem of the running container as an image tagged ref
+// (untagged if empty) and returns the image ID, e.g. to share a pre-migrated
+// database across CI jobs. Data in volumes is not part of the image: services
+// whose image declares a VOLUME for their data (like the official postgres image)
+// must be configured to store it elsewhere, e.g. with PGDATA.
+func (c *Cmd) Commit(ctx context.Context, ref string, opts CommitOptions) (string, error) {
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return "", err
+	}
+	resp, err := dc.ContainerCommit(ctx, id, container.CommitOptions{
+		Reference: ref,
+		Comment:   opts.Comment,
+		Author:    opts.Author,
+		Changes:   opts.Changes,
+		Pause:     !opts.NoPause,
+	})
+	if err != nil {
+		return "", engineErr(fmt.Sprintf("commit container as %q", ref), err)
+	}
+	return resp.ID, nil
+}
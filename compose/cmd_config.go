@@ -20,11 +20,9 @@ func (c *Cmd) containerConfigs(
 ) (*container.Config, *container.HostConfig, error) {
 	c.ensureService()
 
-	initEnabled := true
-	if c.Service.Init != nil {
-		initEnabled = *c.Service.Init
+	if err := validatePorts(c.Service.Ports); err != nil {
+		return nil, nil, err
 	}
-
 	exposedPorts, portBindings := c.servicePorts()
 
 	workingDir := c.Service.WorkingDir
@@ -35,9 +33,9 @@ func (c *Cmd) containerConfigs(
 	cfg := &container.Config{
 		Image:        c.Service.Image,
 		WorkingDir:   workingDir,
-		Env:          mergeEnv(serviceEnvSlice(c.Service), c.Env),
+		Env:          c.environ(),
 		Labels:       c.serviceLabels(),
-		Tty:          false,
+		Tty:          c.Service.Tty,
 		OpenStdin:    stdinEnabled(c.Stdin),
 		StdinOnce:    stdinEnabled(c.Stdin),
 		ExposedPorts: exposedPorts,
@@ -52,6 +50,8 @@ func (c *Cmd) containerConfigs(
 	if hc := c.Service.HealthCheck; hc != nil {
 		cfg.Healthcheck = dockerHealthConfig(hc)
 	}
+	cfg.Hostname = c.Service.Hostname
+	cfg.Domainname = c.Service.DomainName
 	if user := strings.TrimSpace(c.Service.User); user != "" {
 		cfg.User = user
 	}
@@ -61,11 +61,15 @@ func (c *Cmd) containerConfigs(
 	if len(c.Service.Entrypoint) > 0 {
 		cfg.Entrypoint = []string(c.Service.Entrypoint)
 	}
+	if len(c.entrypoint) > 0 {
+		cfg.Entrypoint = append([]string(nil), c.entrypoint...)
+	}
 
 	hostCfg := &container.HostConfig{
-		Init:         ptr(initEnabled),
+		Init:         serviceInit(c.Service.Init),
 		Mounts:       mounts,
 		PortBindings: portBindings,
+		AutoRemove:   c.AutoRemove,
 	}
 	if len(c.Service.Tmpfs) > 0 {
 		tmpfs := map[string]string{}
@@ -106,6 +110,12 @@ func (c *Cmd) containerConfigs(
 		return nil, nil, err
 	}
 	applyHostResourceConfig(hostCfg, c.Service)
+	applyResourceShare(hostCfg)
+	extraHosts, hostsErr := mergeExtraHosts(hostCfg.ExtraHosts, c.ExtraHosts)
+	if hostsErr != nil {
+		return nil, nil, hostsErr
+	}
+	hostCfg.ExtraHosts = extraHosts
 	if len(c.Service.Ulimits) > 0 {
 		var ulimits []*container.Ulimit
 		for name, u := range c.Service.Ulimits {
@@ -142,12 +152,7 @@ func (c *Cmd) servicePorts() (nat.PortSet, nat.PortMap) {
 	portBindings := nat.PortMap{}
 
 	for _, p := range c.Service.Ports {
-		proto := p.Protocol
-		if proto == "" {
-			proto = "tcp"
-		}
-
-		portKey := nat.Port(fmt.Sprintf("%d/%s", p.Target, proto))
+		portKey := nat.Port(fmt.Sprintf("%d/%s", p.Target, portProtocol(p)))
 		exposedPorts[portKey] = struct{}{}
 
 		if p.Published != "" {
@@ -155,6 +160,9 @@ func (c *Cmd) servicePorts() (nat.PortSet, nat.PortMap) {
 				HostIP:   p.HostIP,
 				HostPort: p.Published,
 			}
+			if c.EphemeralPorts {
+				binding.HostPort = ""
+			}
 			portBindings[portKey] = append(portBindings[portKey], binding)
 		}
 	}
@@ -171,7 +179,11 @@ func (c *Cmd) serviceLabels() map[string]string {
 	}
 	if svc := strings.TrimSpace(c.Service.Name); svc != "" {
 		labels["com.docker.compose.service"] = svc
+		if hash, err := serviceConfigHash(c.Service); err == nil {
+			labels[configHashLabel] = hash
+		}
 	}
+	labels = addGlobalLabels(labels)
 	if len(labels) == 0 {
 		return nil
 	}
@@ -218,11 +230,19 @@ func applyHostSecurityConfig(
 		return nil
 	}
 	hostCfg.Privileged = svc.Privileged
-	if len(svc.CapAdd) > 0 {
-		hostCfg.CapAdd = append(hostCfg.CapAdd, svc.CapAdd...)
+	capAdd, err := normalizeCapabilities("cap_add", svc.CapAdd)
+	if err != nil {
+		return err
 	}
-	if len(svc.CapDrop) > 0 {
-		hostCfg.CapDrop = append(hostCfg.CapDrop, svc.CapDrop...)
+	if len(capAdd) > 0 {
+		hostCfg.CapAdd = append(hostCfg.CapAdd, capAdd...)
+	}
+	capDrop, err := normalizeCapabilities("cap_drop", svc.CapDrop)
+	if err != nil {
+		return err
+	}
+	if len(capDrop) > 0 {
+		hostCfg.CapDrop = append(hostCfg.CapDrop, capDrop...)
 	}
 	if len(svc.SecurityOpt) > 0 {
 		for _, opt := range svc.SecurityOpt {
@@ -426,3 +446,29 @@ func serviceMounts(
 	}
 	return out, nil
 }
+
+// mergeExtraMounts appends extra to mounts; an extra mount replaces any mount with
+// the same target.
+func mergeExtraMounts(mounts, extra []mount.Mount) ([]mount.Mount, error) {
+	if len(extra) == 0 {
+		return mounts, nil
+	}
+	targets := make(map[string]struct{}, len(extra))
+	for _, m := range extra {
+		if strings.TrimSpace(m.Target) == "" {
+			return nil, errors.New("compose: extra mount target is required")
+		}
+		if m.Type == mount.TypeBind && !filepath.IsAbs(m.Source) &&
+			!strings.HasPrefix(m.Source, "/") {
+			return nil, fmt.Errorf("compose: extra bind mount source %q must be absolute", m.Source)
+		}
+		targets[m.Target] = struct{}{}
+	}
+	out := make([]mount.Mount, 0, len(mounts)+len(extra))
+	for _, m := range mounts {
+		if _, replaced := targets[m.Target]; !replaced {
+			out = append(out, m)
+		}
+	}
+	return append(out, extra...), nil
+}
@@ -0,0 +1,41 @@
+package compose
+
+import (
+	"context"
+	"errors"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ContainerID returns the ID of the container created by Start.
+// It returns an empty string before Start has created the container.
+func (c *Cmd) ContainerID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.containerID
+}
+
+// Inspect returns the Docker inspect data of the started container.
+//
+// It is an error to call Inspect before Start or after Wait has released the container.
+func (c *Cmd) Inspect(ctx context.Context) (container.InspectResponse, error) {
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+	resp, err := dc.ContainerInspect(ctx, id)
+	return resp, engineErr("inspect container", err)
+}
+
+// activeContainer returns the container ID and client of a started Cmd.
+func (c *Cmd) activeContainer() (string, Backend, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.started || c.containerID == "" {
+		return "", nil, errors.New("compose: not started")
+	}
+	if c.docker == nil {
+		return "", nil, errors.New("compose: container already released")
+	}
+	return c.containerID, c.docker, nil
+}
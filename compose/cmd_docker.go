@@ -2,6 +2,7 @@ package compose
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"strings"
 	"time"
@@ -9,6 +10,7 @@ import (
 	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/pkg/jsonmessage"
 )
 
 func (c *Cmd) closeDockerIfOwned() {
@@ -24,7 +26,7 @@ func (c *Cmd) closeDockerIfOwned() {
 	_ = dc.Close()
 }
 
-func (c *Cmd) ensureDockerClient() (dockerAPI, error) {
+func (c *Cmd) ensureDockerClient() (Backend, error) {
 	c.mu.Lock()
 	dc := c.docker
 	c.mu.Unlock()
@@ -48,25 +50,33 @@ func (c *Cmd) ensureDockerClient() (dockerAPI, error) {
 	return cli, nil
 }
 
-func pullImage(ctx context.Context, dc dockerAPI, ref, platform string) error {
-	if _, _, err := dc.ImageInspectWithRaw(ctx, ref); err == nil {
-		return nil
+// pullImage pulls ref unless it is present for the right platform.
+func pullImage(ctx context.Context, dc Backend, ref, platform string) error {
+	if local, _, err := dc.ImageInspectWithRaw(ctx, ref); err == nil {
+		return ensureImagePlatform(ctx, dc, ref, platform, local)
 	} else if !cerrdefs.IsNotFound(err) {
-		return err
+		return engineErr("inspect image", err)
 	}
+	return pullPlatform(ctx, dc, ref, platform)
+}
 
+func pullPlatform(ctx context.Context, dc Backend, ref, platform string) error {
 	rc, err := dc.ImagePull(ctx, ref, image.PullOptions{Platform: platform})
 	if err != nil {
-		return err
+		return engineErr("pull image", err)
 	}
 	defer func() {
 		_ = rc.Close()
 	}()
-	_, _ = io.Copy(io.Discard, rc)
+	// The engine reports pull failures, e.g. a missing platform variant, inside the
+	// progress stream.
+	if err := jsonmessage.DisplayJSONMessagesStream(rc, io.Discard, 0, false, nil); err != nil {
+		return fmt.Errorf("compose: pull image %s: %w", ref, err)
+	}
 	return nil
 }
 
-func stopAndKill(ctx context.Context, dc dockerAPI, id string, timeout time.Duration) error {
+func stopAndKill(ctx context.Context, dc Backend, id string, timeout time.Duration) error {
 	seconds := int(timeout.Seconds())
 	stopCtx, cancel := context.WithTimeout(ctx, timeout+1*time.Second)
 	defer cancel()
@@ -80,12 +90,48 @@ func stopAndKill(ctx context.Context, dc dockerAPI, id string, timeout time.Dura
 	return nil
 }
 
-func forceRemoveContainer(ctx context.Context, dc dockerAPI, id string) error {
+func forceRemoveContainer(ctx context.Context, dc Backend, id string) error {
 	rmCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	return dc.ContainerRemove(rmCtx, id, container.RemoveOptions{Force: true})
 }
 
+// removalConfirmTimeout bounds how long removeContainerConfirmed waits for the engine
+// to finish removing a container.
+const removalConfirmTimeout = 10 * time.Second
+
+// removeContainerConfirmed force-removes the container and polls until the engine no
+// longer knows it, so that names and resources are free when it returns.
+func removeContainerConfirmed(ctx context.Context, dc Backend, id string) error {
+	if err := forceRemoveContainer(ctx, dc, id); err != nil &&
+		!isNotFoundErr(err) && !isRemovalInProgressErr(err) {
+		return err
+	}
+	confirmCtx, cancel := context.WithTimeout(ctx, removalConfirmTimeout)
+	defer cancel()
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		_, err := dc.ContainerInspect(confirmCtx, id)
+		if err != nil && isNotFoundErr(err) {
+			return nil
+		}
+		select {
+		case <-confirmCtx.Done():
+			return fmt.Errorf(
+				"compose: container %s still present after removal: %w",
+				id,
+				confirmCtx.Err(),
+			)
+		case <-ticker.C:
+		}
+	}
+}
+
+func isRemovalInProgressErr(err error) bool {
+	return cerrdefs.IsConflict(err) && strings.Contains(err.Error(), "already in progress")
+}
+
 func isAlreadyExistsErr(err error) bool {
 	return cerrdefs.IsAlreadyExists(err) || strings.Contains(err.Error(), "already exists")
 }
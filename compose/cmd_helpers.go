@@ -45,6 +45,20 @@ func (c *Cmd) projectName() string {
 	return c.service.project.Name
 }
 
+// onFinish registers fn to be called with the outcome once Start fails or Wait
+// returns.
+func (c *Cmd) onFinish(fn func(error)) {
+	c.finishHooks = append(c.finishHooks, fn)
+}
+
+// finished reports the outcome of the Cmd to the event stream and finish hooks.
+func (c *Cmd) finished(err error) {
+	c.emitFinished(err)
+	for _, fn := range c.finishHooks {
+		fn(err)
+	}
+}
+
 func (c *Cmd) resolveCommand() {
 	// Command resolution priority:
 	// 1) Explicit args
@@ -77,14 +91,10 @@ func (c *Cmd) storeAttachState(attachResp *dockertypes.HijackedResponse) {
 	c.mu.Unlock()
 }
 
-func (c *Cmd) storeWait(dc dockerAPI, id string) {
+func (c *Cmd) storeWait(dc Backend, id string, condition container.WaitCondition) {
 	// NOTE: Do not use sigCtx for ContainerWait; if sigCtx is canceled by a signal,
 	// Docker may return a context-canceled error instead of letting us stop the container.
-	respCh, errCh := dc.ContainerWait(
-		context.Background(),
-		id,
-		container.WaitConditionNotRunning,
-	)
+	respCh, errCh := dc.ContainerWait(context.Background(), id, condition)
 	c.mu.Lock()
 	c.waitRespCh = respCh
 	c.waitErrCh = errCh
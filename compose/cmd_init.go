@@ -0,0 +1,149 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// initExtension is the service extension listing init commands. Each entry is a
+// shell string, an exec-form list, or an object with `command` (either form) and an
+// optional `user`, e.g. to fix volume permissions as root:
+//
+//	x-init:
+//	  - ./seed.sh
+//	  - [chown, -R, app, /data]
+//	  - {command: chmod 700 /data, user: root}
+const initExtension = "x-init"
+
+// initCommand is one command run in the container right after it starts.
+type initCommand struct {
+	cmd  []string
+	user string
+}
+
+func (ic initCommand) String() string {
+	return strings.Join(ic.cmd, " ")
+}
+
+// resolveInitCommands returns the service's x-init commands followed by
+// InitCommands.
+func (c *Cmd) resolveInitCommands() ([]initCommand, error) {
+	var raw []json.RawMessage
+	if _, err := decodeExtension(c.Service.Extensions, initExtension, &raw); err != nil {
+		return nil, err
+	}
+	cmds := make([]initCommand, 0, len(raw)+len(c.InitCommands))
+	for i, r := range raw {
+		ic, err := parseInitCommand(r)
+		if err != nil {
+			return nil, fmt.Errorf("compose: %s[%d]: %w", initExtension, i, err)
+		}
+		cmds = append(cmds, ic)
+	}
+	for _, args := range c.InitCommands {
+		if len(args) == 0 {
+			return nil, errors.New("compose: init command is empty")
+		}
+		cmds = append(cmds, initCommand{cmd: args})
+	}
+	return cmds, nil
+}
+
+func parseInitCommand(r json.RawMessage) (initCommand, error) {
+	var obj struct {
+		Command json.RawMessage `json:"command"`
+		User    string          `json:"user"`
+	}
+	if err := json.Unmarshal(r, &obj); err == nil {
+		ic, cmdErr := parseInitArgs(obj.Command)
+		ic.user = obj.User
+		return ic, cmdErr
+	}
+	return parseInitArgs(r)
+}
+
+func parseInitArgs(r json.RawMessage) (initCommand, error) {
+	var shell string
+	if err := json.Unmarshal(r, &shell); err == nil {
+		if strings.TrimSpace(shell) == "" {
+			return initCommand{}, errors.New("command is empty")
+		}
+		return initCommand{cmd: []string{"sh", "-c", shell}}, nil
+	}
+	var args []string
+	if err := json.Unmarshal(r, &args); err != nil || len(args) == 0 {
+		return initCommand{}, errors.New("command must be a non-empty string or list")
+	}
+	return initCommand{cmd: args}, nil
+}
+
+// runInitCommands runs cmds in the started container, in order, and stops at the
+// first failure. The failing command's output is part of the error.
+func runInitCommands(ctx context.Context, dc Backend, id string, cmds []initCommand) error {
+	for _, ic := range cmds {
+		var out bytes.Buffer
+		code, err := execAttached(ctx, dc, id, container.ExecOptions{
+			Cmd:          ic.cmd,
+			User:         ic.user,
+			AttachStdout: true,
+			AttachStderr: true,
+		}, &out)
+		if err != nil {
+			return fmt.Errorf("compose: init command %q: %w", ic, err)
+		}
+		if code != 0 {
+			return fmt.Errorf("compose: init command %q: %w", ic, &ExitError{
+				Code:   code,
+				Stderr: out.Bytes(),
+			})
+		}
+	}
+	return nil
+}
+
+// execAttached runs an exec in the container, copies its combined output to out
+// and returns its exit code.
+func execAttached(
+	ctx context.Context,
+	dc Backend,
+	id string,
+	opts container.ExecOptions,
+	out *bytes.Buffer,
+) (int, error) {
+	resp, err := dc.ContainerExecCreate(ctx, id, opts)
+	if err != nil {
+		return 0, engineErr("create exec", err)
+	}
+	attach, err := dc.ContainerExecAttach(ctx, resp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return 0, engineErr("attach exec", err)
+	}
+	_, err = stdcopy.StdCopy(out, out, attach.Reader)
+	attach.Close()
+	if err != nil {
+		return 0, err
+	}
+	// The exec may be reported as running for a moment after its output ended.
+	for {
+		info, inspectErr := dc.ContainerExecInspect(ctx, resp.ID)
+		if inspectErr != nil {
+			return 0, engineErr("inspect exec", inspectErr)
+		}
+		if !info.Running {
+			return info.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
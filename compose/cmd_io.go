@@ -1,12 +1,13 @@
 package compose
 
 import (
+	"context"
 	"errors"
 	"io"
 	"sync"
+	"time"
 
 	dockertypes "github.com/docker/docker/api/types"
-	"github.com/docker/docker/pkg/stdcopy"
 )
 
 // StdoutPipe returns a pipe that will be connected to the command's standard output.
@@ -122,7 +123,12 @@ func (c *Cmd) closeStdinPipe(err error) {
 	c.mu.Lock()
 	stdinPipe := c.stdinPipe
 	c.stdinPipe = nil
+	stdinFile := c.stdinFile
+	c.stdinFile = nil
 	c.mu.Unlock()
+	if stdinFile != nil {
+		_ = stdinFile.Close()
+	}
 	if stdinPipe == nil {
 		return
 	}
@@ -146,22 +152,51 @@ func (c *Cmd) startForwarding(
 	ioDone := c.ioDone
 	ioErrCh := c.ioErrCh
 	stdinDone := c.stdinDone
+	raw := c.isRawOutput()
 	ready := make(chan struct{})
-	rawReader := attachResp.Reader
+	var activity *activityReader
 	var reader io.Reader
-	if rawReader != nil {
+	if attachResp.Reader != nil {
+		var src io.Reader = attachResp.Reader
+		if c.KeepAlive > 0 {
+			activity = newActivityReader(src)
+			src = activity
+			c.mu.Lock()
+			c.outputActivity = activity
+			c.mu.Unlock()
+		}
 		reader = &readSignalReader{
-			r:     rawReader,
+			r:     src,
 			ready: ready,
 		}
 	} else {
 		close(ready)
 	}
 
+	stdout, stderr, flush := c.bufferWriters(
+		&streamWriter{stream: "stdout", w: stdout},
+		&streamWriter{stream: "stderr", w: stderr},
+	)
+	var tails [2]*outputTail
+	if activity != nil && !raw {
+		tails = [2]*outputTail{{w: stdout}, {w: stderr}}
+		stdout, stderr = tails[0], tails[1]
+	}
 	go func() {
 		var ioErr error
 		if reader != nil {
-			_, ioErr = stdcopy.StdCopy(stdout, stderr, reader)
+			activity, ioErr = c.copyAcrossRestarts(stdout, stderr, reader, raw, activity)
+		}
+		var writeErr *WriteError
+		if errors.As(ioErr, &writeErr) {
+			if c.StopOnWriteError {
+				c.stopAfterWriteError()
+			}
+		} else if ioErr != nil && activity != nil {
+			ioErr = c.resumeOutput(stdout, stderr, activity.last(), tails, ioErr)
+		}
+		if flushErr := flush(); ioErr == nil {
+			ioErr = flushErr
 		}
 		if ioErr != nil && ioErrCh != nil {
 			select {
@@ -190,6 +225,30 @@ func (c *Cmd) startForwarding(
 	return ready
 }
 
+// streamWriter reports errors of w as *WriteError.
+type streamWriter struct {
+	stream string
+	w      io.Writer
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err != nil {
+		return n, &WriteError{Stream: s.stream, Err: err}
+	}
+	return n, nil
+}
+
+// stopAfterWriteError stops the running container after its output could not be
+// written; Wait then reports the write error.
+func (c *Cmd) stopAfterWriteError() {
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return
+	}
+	_ = stopAndKill(context.Background(), dc, id, 2*time.Second)
+}
+
 type readSignalReader struct {
 	r     io.Reader
 	ready chan struct{}
@@ -0,0 +1,372 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// maxIdleReattach bounds consecutive re-attachments that deliver no output, so a
+// logs endpoint that keeps failing cannot spin the forwarder.
+const maxIdleReattach = 3
+
+// resumeMargin widens the first resumed logs window beyond the estimated daemon
+// time of the last output, to absorb errors of that estimate. Output replayed
+// twice because of it is recognized by comparing it with the delivered output.
+const resumeMargin = 2 * time.Second
+
+// outputTailSize is how much delivered output per stream is kept to recognize it
+// in a resumed logs stream.
+const outputTailSize = 64 << 10
+
+// errNotResumable means the output cannot be resumed because Wait released it or
+// the container is no longer running; the original stream error stands.
+var errNotResumable = errors.New("compose: output not resumable")
+
+// activityReader records when the attach stream last delivered data, which is
+// where output resumes after the stream breaks.
+type activityReader struct {
+	r        io.Reader
+	lastRead atomic.Int64
+}
+
+func newActivityReader(r io.Reader) *activityReader {
+	a := &activityReader{r: r}
+	a.lastRead.Store(time.Now().UnixNano())
+	return a
+}
+
+func (a *activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.lastRead.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+func (a *activityReader) last() time.Time {
+	return time.Unix(0, a.lastRead.Load())
+}
+
+// outputTail keeps the last output written to a stream, which a resumed logs
+// stream may replay.
+type outputTail struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (t *outputTail) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.buf = append(t.buf, p[:n]...)
+	if over := len(t.buf) - outputTailSize; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return n, err
+}
+
+func (t *outputTail) bytes() []byte {
+	if t == nil {
+		return nil
+	}
+	return t.buf
+}
+
+// enableTCPKeepAlive turns on TCP keep-alives for a hijacked connection to a TCP
+// daemon, so NAT gateways and firewalls do not drop it while the container is
+// quiet. Unix sockets and named pipes are left alone.
+func enableTCPKeepAlive(conn net.Conn, period time.Duration) {
+	if nc, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = nc.NetConn()
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		_ = tc.SetKeepAlive(true)
+		_ = tc.SetKeepAlivePeriod(period)
+	}
+}
+
+// startKeepAlive pings the daemon every KeepAlive interval until Wait releases the
+// output, which may be after the container exited while its output drains. When
+// the daemon becomes reachable again after failed pings and the attach stream
+// delivered nothing since the first of them, the attach connection most likely died
+// silently on the way, so it is closed to let the forwarder re-attach instead of
+// blocking on a dead socket. A stream that kept delivering output is healthy and
+// left alone, as re-attaching drops stdin.
+func (c *Cmd) startKeepAlive(dc Backend) {
+	ctx, cancel := context.WithCancel(c.contextOrBackground())
+	c.mu.Lock()
+	c.keepAliveStop = cancel
+	c.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		ticker := time.NewTicker(c.KeepAlive)
+		defer ticker.Stop()
+		lost := false
+		var lostAt time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			sent := time.Now()
+			pingCtx, pingCancel := context.WithTimeout(ctx, c.KeepAlive)
+			_, err := dc.Ping(pingCtx)
+			pingCancel()
+			switch {
+			case err != nil:
+				if !lost {
+					lostAt = sent
+				}
+				lost = ctx.Err() == nil
+			case lost:
+				lost = false
+				if c.attachIdleSince(lostAt) {
+					c.breakAttach()
+				}
+			}
+		}
+	}()
+}
+
+// attachIdleSince reports whether the attach stream delivered no data after t.
+func (c *Cmd) attachIdleSince(t time.Time) bool {
+	c.mu.Lock()
+	activity := c.outputActivity
+	c.mu.Unlock()
+	return activity == nil || !activity.last().After(t)
+}
+
+// breakAttach closes the attach connection and any logs stream that replaced it
+// without releasing them, which makes the forwarder's read fail and triggers
+// re-attachment.
+func (c *Cmd) breakAttach() {
+	c.mu.Lock()
+	attach := c.attach
+	logStream := c.logStream
+	c.mu.Unlock()
+	if attach != nil && attach.Conn != nil {
+		_ = attach.Conn.Close()
+	}
+	if logStream != nil {
+		_ = logStream.Close()
+	}
+}
+
+// OutputGap describes a break in a Cmd's output stream that KeepAlive bridged by
+// re-attaching.
+type OutputGap struct {
+	// Since is where the replayed output starts, in the daemon's clock: shortly
+	// before the last output received before the stream broke. Output logged from
+	// then on is fetched again, so nothing is lost; output delivered before is not
+	// repeated.
+	Since time.Time
+	// Resumed is when the output stream was re-established.
+	Resumed time.Time
+	// Err is the error that broke the stream.
+	Err error
+}
+
+// resumeOutput continues forwarding through the container logs after the attach
+// stream failed with streamErr while the container may still be running. last is
+// when the attach stream last delivered output, in this host's clock; the logs are
+// filtered by the daemon's, so they are fetched from a little earlier in the
+// daemon's time, and the replayed entries already in tails are dropped. Log entries
+// carry daemon timestamps, so a logs stream that breaks again is resumed from its
+// last delivered entry without repeating it. It returns nil once the container's
+// output ends normally, or streamErr when the output cannot be resumed.
+func (c *Cmd) resumeOutput(
+	stdout, stderr io.Writer,
+	last time.Time,
+	tails [2]*outputTail,
+	streamErr error,
+) error {
+	if c.isRawOutput() {
+		// Raw log entries are not delimited, so they cannot be deduplicated.
+		return streamErr
+	}
+	since := c.daemonTime(last).Add(-resumeMargin)
+	entries := logEntryFilter{replayed: [2]*replayDedup{
+		{delivered: tails[0].bytes()},
+		{delivered: tails[1].bytes()},
+	}}
+	idle := 0
+	for idle < maxIdleReattach {
+		rc, err := c.followLogs(since)
+		if err != nil {
+			if errors.Is(err, errNotResumable) {
+				return streamErr
+			}
+			return errors.Join(streamErr, err)
+		}
+		if c.OnOutputGap != nil {
+			c.OnOutputGap(OutputGap{Since: since, Resumed: time.Now(), Err: streamErr})
+		}
+		prev := entries.last
+		_, copyErr := stdcopy.StdCopy(entries.writer(stdout, 0), entries.writer(stderr, 1), rc)
+		c.clearLogStream(rc)
+		if copyErr == nil {
+			return nil
+		}
+		streamErr = copyErr
+		if entries.last.After(prev) {
+			idle = 0
+			since = entries.last
+		} else {
+			idle++
+		}
+	}
+	return streamErr
+}
+
+// logEntryFilter strips the timestamp of each log entry and drops entries that are
+// not newer than the last one delivered, which a resumed stream repeats because
+// `since` is inclusive, as well as the replayed output of the attach stream (per
+// stream, stdout and stderr). stdcopy writes one entry per Write.
+type logEntryFilter struct {
+	last     time.Time
+	replayed [2]*replayDedup
+}
+
+func (f *logEntryFilter) writer(w io.Writer, stream int) io.Writer {
+	return &logEntryWriter{f: f, w: w, dedup: f.replayed[stream]}
+}
+
+type logEntryWriter struct {
+	f     *logEntryFilter
+	w     io.Writer
+	dedup *replayDedup
+}
+
+func (lw *logEntryWriter) Write(p []byte) (int, error) {
+	out := p
+	if i := bytes.IndexByte(p, ' '); i >= 0 {
+		if ts, err := time.Parse(time.RFC3339Nano, string(p[:i])); err == nil {
+			if !ts.After(lw.f.last) {
+				return len(p), nil
+			}
+			lw.f.last = ts
+			out = p[i+1:]
+		}
+	}
+	if out = lw.dedup.filter(out); len(out) == 0 {
+		return len(p), nil
+	}
+	if _, writeErr := lw.w.Write(out); writeErr != nil {
+		return 0, writeErr
+	}
+	return len(p), nil
+}
+
+// replayDedup drops the start of a resumed logs stream that repeats output the
+// attach stream delivered before it broke.
+type replayDedup struct {
+	delivered []byte
+	// pending is replayed output held back while it matches delivered output.
+	pending []byte
+	done    bool
+}
+
+// filter returns the part of a replayed entry to write.
+func (d *replayDedup) filter(p []byte) []byte {
+	if d == nil || d.done {
+		return p
+	}
+	d.pending = append(d.pending, p...)
+	if !bytes.HasSuffix(d.delivered, d.pending) && bytes.Contains(d.delivered, d.pending) {
+		// Possibly repeated output; the next entries tell.
+		return nil
+	}
+	d.done = true
+	out := d.pending[overlapLen(d.delivered, d.pending):]
+	d.delivered, d.pending = nil, nil
+	return out
+}
+
+// overlapLen returns the length of the longest prefix of b that a ends with.
+func overlapLen(a, b []byte) int {
+	for i := max(len(a)-len(b), 0); i < len(a); i++ {
+		if bytes.HasPrefix(b, a[i:]) {
+			return len(a) - i
+		}
+	}
+	return 0
+}
+
+// daemonTime converts t from this host's clock to the daemon's, using the time the
+// daemon reports. It returns t if that is unavailable.
+func (c *Cmd) daemonTime(t time.Time) time.Time {
+	c.mu.Lock()
+	dc := c.docker
+	c.mu.Unlock()
+	if dc == nil {
+		return t
+	}
+	sent := time.Now()
+	info, err := dc.Info(c.contextOrBackground())
+	if err != nil {
+		return t
+	}
+	now, err := time.Parse(time.RFC3339Nano, info.SystemTime)
+	if err != nil {
+		return t
+	}
+	// Assume the daemon read its clock halfway through the request.
+	local := sent.Add(time.Since(sent) / 2)
+	return t.Add(now.Sub(local))
+}
+
+// followLogs opens a following logs stream from since, if the container is still
+// running and Wait has not released the output yet.
+func (c *Cmd) followLogs(since time.Time) (io.ReadCloser, error) {
+	c.mu.Lock()
+	dc, id, live := c.docker, c.containerID, c.attach != nil
+	c.mu.Unlock()
+	if !live || dc == nil {
+		return nil, errNotResumable
+	}
+	ctx := c.contextOrBackground()
+	j, err := dc.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, engineErr("inspect container", err)
+	}
+	if j.ContainerJSONBase == nil || j.State == nil || !j.State.Running {
+		return nil, errNotResumable
+	}
+	rc, err := dc.ContainerLogs(ctx, id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Timestamps: true,
+		Since:      fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()),
+	})
+	if err != nil {
+		return nil, engineErr("follow container logs", err)
+	}
+	c.mu.Lock()
+	if c.attach == nil {
+		c.mu.Unlock()
+		_ = rc.Close()
+		return nil, errNotResumable
+	}
+	c.logStream = rc
+	c.mu.Unlock()
+	return rc, nil
+}
+
+func (c *Cmd) clearLogStream(rc io.Closer) {
+	c.mu.Lock()
+	if c.logStream == rc {
+		c.logStream = nil
+	}
+	c.mu.Unlock()
+	_ = rc.Close()
+}
@@ -0,0 +1,159 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogFile tees the Cmd's stdout and stderr into path, rotating it when a write
+// would grow it beyond maxSize bytes: path is renamed to path.1, path.1 to path.2
+// and so on, keeping at most maxFiles files including path. Each file starts with
+// a header line naming the project, service, container, command and the time the
+// file was started. An existing file at path is truncated.
+//
+// Call LogFile before Start; the file is closed when Start fails or Wait returns.
+func (c *Cmd) LogFile(path string, maxSize int64, maxFiles int) error {
+	if path == "" {
+		return errors.New("compose: log file path is required")
+	}
+	if maxSize <= 0 {
+		return fmt.Errorf("compose: log file max size must be positive, got %d", maxSize)
+	}
+	if maxFiles < 1 {
+		return fmt.Errorf("compose: log file max files must be at least 1, got %d", maxFiles)
+	}
+	lf := &rotatingLog{path: path, maxSize: maxSize, maxFiles: maxFiles, cmd: c}
+	if err := lf.open(); err != nil {
+		return err
+	}
+	c.Stdout = teeWriter(c.Stdout, lf)
+	c.Stderr = teeWriter(c.Stderr, lf)
+	c.onFinish(func(error) {
+		if err := lf.Close(); err != nil {
+			writeWarning(os.Stderr, fmt.Sprintf("log file %s: %v", path, err))
+		}
+	})
+	return nil
+}
+
+func teeWriter(w io.Writer, lf *rotatingLog) io.Writer {
+	if w == nil {
+		return lf
+	}
+	return io.MultiWriter(w, lf)
+}
+
+// rotatingLog is the size-rotated file written by Cmd.LogFile. Write errors are
+// reported once as a warning and then ignored, so a full disk never fails the Cmd.
+type rotatingLog struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	cmd      *Cmd
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	part   int
+	header bool
+	failed bool
+}
+
+func (l *rotatingLog) open() error {
+	// #nosec G304 -- path is chosen by the caller.
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("compose: open log file: %w", err)
+	}
+	l.file = f
+	l.size = 0
+	l.part++
+	l.header = false
+	return nil
+}
+
+func (l *rotatingLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil || l.failed {
+		return len(p), nil
+	}
+	if err := l.write(p); err != nil {
+		l.failed = true
+		writeWarning(os.Stderr, fmt.Sprintf("log file %s: %v", l.path, err))
+	}
+	return len(p), nil
+}
+
+func (l *rotatingLog) write(p []byte) error {
+	if l.header && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	if !l.header {
+		l.header = true
+		if err := l.writeRaw([]byte(l.headerLine())); err != nil {
+			return err
+		}
+	}
+	return l.writeRaw(p)
+}
+
+func (l *rotatingLog) writeRaw(p []byte) error {
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return err
+}
+
+// rotate shifts path to path.1 and older files one further, dropping the oldest.
+func (l *rotatingLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	for i := l.maxFiles - 1; i >= 1; i-- {
+		src := l.path
+		if i > 1 {
+			src = fmt.Sprintf("%s.%d", l.path, i-1)
+		}
+		err := os.Rename(src, fmt.Sprintf("%s.%d", l.path, i))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if l.maxFiles == 1 {
+		// No backups: start over in the same file.
+		if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return l.open()
+}
+
+func (l *rotatingLog) headerLine() string {
+	c := l.cmd
+	c.mu.Lock()
+	id := c.containerID
+	c.mu.Unlock()
+	return fmt.Sprintf("# compose-exec log: project=%q service=%q container=%q command=%q "+
+		"part=%d time=%s\n",
+		c.projectName(), c.Service.Name, id, strings.Join(c.Args, " "), l.part,
+		time.Now().UTC().Format(time.RFC3339))
+}
+
+func (l *rotatingLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
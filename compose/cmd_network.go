@@ -0,0 +1,62 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types/network"
+)
+
+// ConnectNetwork attaches the running container to a network, e.g. to end a
+// simulated partition started with DisconnectNetwork. name is a network key of
+// the project (such as "default") or an engine network name.
+//
+// With nil opts, the endpoint is configured as at Start, including the service
+// aliases, so other services resolve the container by name again.
+func (c *Cmd) ConnectNetwork(
+	ctx context.Context,
+	name string,
+	opts *network.EndpointSettings,
+) error {
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return err
+	}
+	netName, key := c.runtimeNetworkName(name)
+	if netName == "" {
+		return errors.New("compose: network name is required")
+	}
+	if opts == nil {
+		opts = endpointSettings(c.Service.Name, c.Service.Networks[key])
+	}
+	err = dc.NetworkConnect(ctx, netName, id, opts)
+	return engineErr(fmt.Sprintf("connect network %q", netName), err)
+}
+
+// DisconnectNetwork detaches the running container from a network, cutting it
+// off from the services on it. name is resolved like in ConnectNetwork.
+func (c *Cmd) DisconnectNetwork(ctx context.Context, name string) error {
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return err
+	}
+	netName, _ := c.runtimeNetworkName(name)
+	if netName == "" {
+		return errors.New("compose: network name is required")
+	}
+	err = dc.NetworkDisconnect(ctx, netName, id, false)
+	return engineErr(fmt.Sprintf("disconnect network %q", netName), err)
+}
+
+// runtimeNetworkName resolves name to the engine network name. key is the project
+// network key, or "" if name is not one.
+func (c *Cmd) runtimeNetworkName(name string) (netName, key string) {
+	networks := c.projectNetworks()
+	_, declared := networks[name]
+	_, joined := c.Service.Networks[name]
+	if declared || joined || name == "default" {
+		return resolveNetworkName(c.projectName(), name, networks), name
+	}
+	return name, ""
+}
@@ -0,0 +1,239 @@
+package compose
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// OutputOverflow selects what happens to container output when Cmd.OutputBuffer
+// is full because Stdout or Stderr does not keep up.
+type OutputOverflow int
+
+const (
+	// OverflowDropOldest discards the oldest buffered output to make room, so the
+	// container's output is always read and the writer sees the most recent output.
+	OverflowDropOldest OutputOverflow = iota
+	// OverflowBlock stops reading the container's output until the writer has made
+	// room (backpressure), so no output is lost while the writer makes progress.
+	// Once the container exited, Wait still gives up on a stuck writer after a few
+	// seconds and drops what it could not write.
+	OverflowBlock
+)
+
+// OutputDrop describes output discarded because of Cmd.OutputBuffer.
+type OutputDrop struct {
+	// Stream is "stdout" or "stderr".
+	Stream string
+	// Bytes is the number of bytes discarded.
+	Bytes int
+}
+
+// outputDrainTimeout bounds how long Wait waits, after the container exited, for
+// buffered output to reach a slow writer; what remains is then dropped.
+var outputDrainTimeout = 5 * time.Second
+
+// DroppedOutput returns the number of output bytes discarded so far because
+// OutputBuffer was full or the writer did not drain it in time.
+func (c *Cmd) DroppedOutput() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.droppedOutput
+}
+
+// bufferWriters wraps stdout and stderr in output buffers if OutputBuffer is set.
+// The returned function flushes them once the output ended and returns the first
+// error of the writers.
+func (c *Cmd) bufferWriters(stdout, stderr io.Writer) (io.Writer, io.Writer, func() error) {
+	if c.OutputBuffer <= 0 {
+		return stdout, stderr, func() error { return nil }
+	}
+	bo := c.newOutputBuffer("stdout", stdout)
+	be := c.newOutputBuffer("stderr", stderr)
+	c.mu.Lock()
+	c.outputBuffers = []*outputBuffer{bo, be}
+	c.mu.Unlock()
+	return bo, be, func() error {
+		return errors.Join(bo.close(), be.close())
+	}
+}
+
+// expireOutputBuffers makes the output buffers drop their remaining output after
+// outputDrainTimeout, so a stuck writer cannot block Wait once the container
+// exited. The returned function cancels this.
+func (c *Cmd) expireOutputBuffers() func() {
+	c.mu.Lock()
+	bufs := c.outputBuffers
+	c.mu.Unlock()
+	if len(bufs) == 0 {
+		return func() {}
+	}
+	t := time.AfterFunc(outputDrainTimeout, func() {
+		for _, b := range bufs {
+			b.abandon()
+		}
+	})
+	return func() { t.Stop() }
+}
+
+func (c *Cmd) newOutputBuffer(stream string, w io.Writer) *outputBuffer {
+	b := &outputBuffer{
+		w:     w,
+		buf:   make([]byte, c.OutputBuffer),
+		block: c.OutputOverflow == OverflowBlock,
+		done:  make(chan struct{}),
+		gone:  make(chan struct{}),
+		onDrop: func(n int) {
+			c.mu.Lock()
+			c.droppedOutput += int64(n)
+			c.mu.Unlock()
+			if c.OnOutputDropped != nil {
+				c.OnOutputDropped(OutputDrop{Stream: stream, Bytes: n})
+			}
+		},
+	}
+	b.cond = sync.NewCond(&b.mu)
+	go b.drain()
+	return b
+}
+
+// outputBuffer is a bounded ring buffer between the attach stream and a writer,
+// drained by its own goroutine.
+type outputBuffer struct {
+	w      io.Writer
+	block  bool
+	onDrop func(n int)
+	done   chan struct{} // closed when drain returns
+	gone   chan struct{} // closed by abandon
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    []byte
+	start  int // index of the oldest buffered byte
+	n      int // number of buffered bytes
+	closed bool
+	// abandoned is set once the writer was given up on; output is dropped.
+	abandoned bool
+	err       error // first error of w
+}
+
+// Write buffers p. It only blocks for OverflowBlock, and fails once the writer did.
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	written := len(p)
+	dropped := 0
+	for len(p) > 0 && b.err == nil {
+		if b.abandoned {
+			dropped += len(p)
+			break
+		}
+		free := len(b.buf) - b.n
+		if free == 0 {
+			if b.block {
+				b.cond.Wait()
+				continue
+			}
+			k := min(len(p), len(b.buf))
+			b.start = (b.start + k) % len(b.buf)
+			b.n -= k
+			dropped += k
+			continue
+		}
+		k := b.put(p[:min(len(p), free)])
+		p = p[k:]
+		b.cond.Broadcast()
+	}
+	if b.err != nil {
+		return written - len(p), b.err
+	}
+	if dropped > 0 {
+		b.mu.Unlock()
+		b.onDrop(dropped)
+		b.mu.Lock()
+	}
+	return written, nil
+}
+
+// put appends p, which must fit, to the ring.
+func (b *outputBuffer) put(p []byte) int {
+	end := (b.start + b.n) % len(b.buf)
+	k := copy(b.buf[end:], p)
+	if k < len(p) {
+		k += copy(b.buf, p[k:])
+	}
+	b.n += k
+	return k
+}
+
+// take removes and returns up to the contiguous buffered bytes, waiting for
+// output. It returns nil once the buffer is closed and empty.
+func (b *outputBuffer) take() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.n == 0 && !b.closed && !b.abandoned {
+		b.cond.Wait()
+	}
+	if b.n == 0 || b.abandoned {
+		return nil
+	}
+	k := min(b.n, len(b.buf)-b.start)
+	chunk := append([]byte(nil), b.buf[b.start:b.start+k]...)
+	b.start = (b.start + k) % len(b.buf)
+	b.n -= k
+	b.cond.Broadcast()
+	return chunk
+}
+
+func (b *outputBuffer) drain() {
+	defer close(b.done)
+	for {
+		chunk := b.take()
+		if chunk == nil {
+			return
+		}
+		if _, err := b.w.Write(chunk); err != nil {
+			b.mu.Lock()
+			b.err = err
+			b.cond.Broadcast()
+			b.mu.Unlock()
+			return
+		}
+	}
+}
+
+// close stops accepting output and waits until the buffer is drained or abandoned.
+// It returns the writer's error, if any.
+func (b *outputBuffer) close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+	select {
+	case <-b.done:
+	case <-b.gone:
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+// abandon drops the buffered output and any further output, unblocking writes
+// and close even while the writer is stuck.
+func (b *outputBuffer) abandon() {
+	b.mu.Lock()
+	if b.abandoned {
+		b.mu.Unlock()
+		return
+	}
+	b.abandoned = true
+	dropped := b.n
+	b.start, b.n = 0, 0
+	b.cond.Broadcast()
+	close(b.gone)
+	b.mu.Unlock()
+	if dropped > 0 {
+		b.onDrop(dropped)
+	}
+}
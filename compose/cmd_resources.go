@@ -24,7 +24,7 @@ type networkSpec struct {
 
 // resolveNetworking determines which network(s) to attach to.
 // It iterates through all networks defined in the service config.
-func (c *Cmd) resolveNetworking(_ context.Context, _ dockerAPI) *resolvedNetworking {
+func (c *Cmd) resolveNetworking(_ context.Context, _ Backend) *resolvedNetworking {
 	if c.Service.NetworkMode != "" {
 		return nil
 	}
@@ -65,25 +65,23 @@ func (c *Cmd) resolveNetworking(_ context.Context, _ dockerAPI) *resolvedNetwork
 
 func (c *Cmd) ensureNetworks(
 	ctx context.Context,
-	dc dockerAPI,
+	dc Backend,
 	nc *resolvedNetworking,
 ) error {
 	if nc == nil || nc.config == nil {
 		return nil
 	}
 
+	info := lazyInfo(ctx, dc)
 	for netName := range nc.config.EndpointsConfig {
 		spec := nc.specs[netName]
-		if spec.declared && bool(spec.config.External) {
-			// External networks must already exist; never create them.
-			continue
-		}
+		external := spec.declared && bool(spec.config.External)
 
 		list, err := dc.NetworkList(ctx, network.ListOptions{
 			Filters: filters.NewArgs(filters.Arg("name", netName)),
 		})
 		if err != nil {
-			return err
+			return engineErr("list networks", err)
 		}
 
 		exists := false
@@ -97,14 +95,87 @@ func (c *Cmd) ensureNetworks(
 		if exists {
 			continue
 		}
+		if external {
+			// External networks must already exist; never create them.
+			return fmt.Errorf(
+				"compose: external network %s not found; create it first "+
+					"(docker network create %s)",
+				networkLabel(spec, netName), netName,
+			)
+		}
+		if drvErr := validateNetworkDriver(spec, netName, info); drvErr != nil {
+			return drvErr
+		}
 
-		_, err = dc.NetworkCreate(ctx, netName, networkCreateOptions(c.projectName(), spec))
+		opts := networkCreateOptions(c.projectName(), spec)
+		if opts.EnableIPv4 != nil {
+			if gateErr := checkAPIFeature(
+				dc.ClientVersion(),
+				c.StrictAPIVersion,
+				"networks.enable_ipv4",
+				"1.47",
+			); gateErr != nil {
+				return gateErr
+			}
+			if !apiVersionSupports(dc.ClientVersion(), "1.47") {
+				opts.EnableIPv4 = nil
+			}
+		}
+		created, err := dc.NetworkCreate(ctx, netName, opts)
 		if err != nil {
 			// If another process already created the network, ignore and continue.
 			if isAlreadyExistsErr(err) {
 				continue
 			}
-			return fmt.Errorf("failed to create network %q: %w", netName, err)
+			if isDriverNotFoundErr(err) {
+				return fmt.Errorf(
+					"compose: network %s: driver %q is not available on the daemon; "+
+						"install the network plugin or choose another driver: %w",
+					networkLabel(spec, netName),
+					spec.config.Driver,
+					engineErr("create network", err),
+				)
+			}
+			return engineErr(fmt.Sprintf("create network %s", networkLabel(spec, netName)), err)
+		}
+		journalRecord(journalOpCreate, journalKindNetwork, created.ID, netName)
+	}
+	return nil
+}
+
+// enableDefaultNetworkIPv6 turns the project's default network dual-stack. See
+// WithDualStackDefaultNetwork.
+func enableDefaultNetworkIPv6(project *types.Project) {
+	cfg, ok := project.Networks["default"]
+	if ok && (bool(cfg.External) || cfg.EnableIPv6 != nil) {
+		return
+	}
+	if project.Networks == nil {
+		project.Networks = types.Networks{}
+	}
+	cfg.EnableIPv6 = ptr(true)
+	project.Networks["default"] = cfg
+}
+
+// validateIPv6Endpoints rejects ipv6_address on project networks that are created
+// without IPv6, which the daemon would report only as a generic endpoint error.
+func validateIPv6Endpoints(serviceName string, nc *resolvedNetworking) error {
+	if nc == nil || nc.config == nil {
+		return nil
+	}
+	for netName, ep := range nc.config.EndpointsConfig {
+		if ep == nil || ep.IPAMConfig == nil || ep.IPAMConfig.IPv6Address == "" {
+			continue
+		}
+		spec := nc.specs[netName]
+		if !spec.declared || bool(spec.config.External) {
+			continue
+		}
+		if spec.config.EnableIPv6 == nil || !*spec.config.EnableIPv6 {
+			return fmt.Errorf(
+				"compose: service %q sets ipv6_address on network %q without enable_ipv6",
+				serviceName, spec.key,
+			)
 		}
 	}
 	return nil
@@ -148,6 +219,7 @@ func networkCreateOptions(projectName string, spec networkSpec) network.CreateOp
 	if spec.key != "" {
 		labels["com.docker.compose.network"] = spec.key
 	}
+	labels = addGlobalLabels(labels)
 	if len(labels) > 0 {
 		opts.Labels = labels
 	}
@@ -284,7 +356,7 @@ func resolveVolumeName(projectName, volumeName string) string {
 	return fmt.Sprintf("%s_%s", projectName, volumeName)
 }
 
-func (c *Cmd) ensureVolumes(ctx context.Context, dc dockerAPI) error {
+func (c *Cmd) ensureVolumes(ctx context.Context, dc Backend) error {
 	projectName := c.projectName()
 	projectVolumes := c.projectVolumes()
 
@@ -321,7 +393,7 @@ func (c *Cmd) ensureVolumes(ctx context.Context, dc dockerAPI) error {
 
 func ensureProjectVolumes(
 	ctx context.Context,
-	dc dockerAPI,
+	dc Backend,
 	projectName string,
 	volumesMap types.Volumes,
 ) error {
@@ -356,7 +428,7 @@ func ensureProjectVolumes(
 
 func ensureServiceVolumes(
 	ctx context.Context,
-	dc dockerAPI,
+	dc Backend,
 	projectName string,
 	serviceVolumes []types.ServiceVolumeConfig,
 ) error {
@@ -387,16 +459,19 @@ func ensureServiceVolumes(
 
 func createVolumeIdempotent(
 	ctx context.Context,
-	dc dockerAPI,
+	dc Backend,
 	createOpts volume.CreateOptions,
 ) error {
+	createOpts.Labels = addGlobalLabels(createOpts.Labels)
 	_, err := dc.VolumeCreate(ctx, createOpts)
 	if err != nil {
 		if isAlreadyExistsErr(err) {
 			return nil
 		}
-		return fmt.Errorf("failed to create volume %q: %w", createOpts.Name, err)
+		return engineErr(fmt.Sprintf("create volume %q", createOpts.Name), err)
 	}
+	// Volumes are named: the name is their ID.
+	journalRecord(journalOpCreate, journalKindVolume, createOpts.Name, createOpts.Name)
 	return nil
 }
 
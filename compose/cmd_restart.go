@@ -0,0 +1,148 @@
+package compose
+
+import (
+	"context"
+	"io"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// restartContainer restarts the running container for a develop.watch restart
+// rule and re-attaches its output, without stdin. Wait and the output forwarder
+// carry on across the restart. Output written before the new attach stream is
+// established is not forwarded. It does nothing once the container exited for
+// good.
+func (c *Cmd) restartContainer(ctx context.Context, dc Backend, id string) error {
+	done := make(chan struct{})
+	c.mu.Lock()
+	if c.restartsClosed || c.restarting != nil {
+		c.mu.Unlock()
+		return nil
+	}
+	c.restarting = done
+	c.mu.Unlock()
+
+	var attach *dockertypes.HijackedResponse
+	err := engineErr("restart container", dc.ContainerRestart(ctx, id, container.StopOptions{}))
+	if err == nil {
+		resp, attachErr := dc.ContainerAttach(ctx, id, container.AttachOptions{
+			Stream: true,
+			Stdout: true,
+			Stderr: true,
+		})
+		if attachErr != nil {
+			err = engineErr("attach container", attachErr)
+		} else {
+			attach = &resp
+		}
+	}
+
+	c.mu.Lock()
+	if attach != nil {
+		if c.attach != nil {
+			c.replacedAttaches = append(c.replacedAttaches, c.attach)
+		}
+		c.attach = attach
+		c.restartedAttach = attach
+	}
+	c.restarts++
+	c.restarting = nil
+	c.mu.Unlock()
+	close(done)
+	return err
+}
+
+// awaitRestart waits for a restart by Watch in progress and reports whether the
+// container was restarted since the seen'th restart, updating seen. Once it
+// reports false, the exit is final and later restarts are refused.
+func (c *Cmd) awaitRestart(seen *int) bool {
+	c.mu.Lock()
+	done := c.restarting
+	c.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.restarts > *seen {
+		*seen = c.restarts
+		return true
+	}
+	c.restartsClosed = true
+	return false
+}
+
+// restartedOutput is called by the output forwarder when the attach stream ended.
+// It returns the output stream of the container restarted by Watch, or nil if the
+// container exited for good.
+func (c *Cmd) restartedOutput(seen *int) io.Reader {
+	if !c.awaitRestart(seen) {
+		c.closeReplacedAttaches()
+		return nil
+	}
+	c.mu.Lock()
+	attach := c.restartedAttach
+	c.restartedAttach = nil
+	c.mu.Unlock()
+	c.closeReplacedAttaches()
+	if attach == nil {
+		// The restart failed to re-attach; forward nothing more.
+		return nil
+	}
+	return attach.Reader
+}
+
+func (c *Cmd) closeReplacedAttaches() {
+	c.mu.Lock()
+	replaced := c.replacedAttaches
+	c.replacedAttaches = nil
+	c.mu.Unlock()
+	for _, attach := range replaced {
+		closeAttach(attach)
+	}
+}
+
+// copyAcrossRestarts copies the container's output from r and, after each restart
+// by Watch, from the new attach stream. It returns the activity reader tracking
+// the last stream, if KeepAlive is set.
+func (c *Cmd) copyAcrossRestarts(
+	stdout, stderr io.Writer,
+	r io.Reader,
+	raw bool,
+	activity *activityReader,
+) (*activityReader, error) {
+	seen := 0
+	for {
+		if _, err := copyOutput(stdout, stderr, r, raw); err != nil {
+			return activity, err
+		}
+		next := c.restartedOutput(&seen)
+		if next == nil {
+			return activity, nil
+		}
+		r = next
+		if activity != nil {
+			activity = newActivityReader(next)
+			r = activity
+			c.mu.Lock()
+			c.outputActivity = activity
+			c.mu.Unlock()
+		}
+	}
+}
+
+// waitForFinalExit is waitForExit across restarts by Watch: a container stopped
+// to be restarted is waited for again.
+func (c *Cmd) waitForFinalExit(ctx context.Context, st *waitState) (container.WaitResponse, error) {
+	seen := 0
+	for {
+		resp, err := waitForExit(ctx, st.sigCtx, st.dc, st.id, st.respCh, st.errCh)
+		// A container waited for until removal is not removed by a restart.
+		if err != nil || c.AutoRemove || !c.awaitRestart(&seen) {
+			return resp, err
+		}
+		st.respCh, st.errCh = st.dc.ContainerWait(
+			context.Background(), st.id, container.WaitConditionNotRunning)
+	}
+}
@@ -4,9 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"os"
-	"os/signal"
-	"syscall"
+	"time"
 
 	"github.com/containerd/platforms"
 	"github.com/docker/docker/api/types/container"
@@ -17,8 +15,8 @@ import (
 // Run starts the container and waits for it to exit, similar to (*exec.Cmd).Run.
 // If created via CommandContext, its context controls cancellation.
 func (c *Cmd) Run() error {
-	if c.loadErr != nil {
-		return c.loadErr
+	if c.Err != nil {
+		return c.Err
 	}
 	if err := c.Start(); err != nil {
 		return err
@@ -28,28 +26,36 @@ func (c *Cmd) Run() error {
 
 // Environ returns a copy of the environment in which the command would run.
 func (c *Cmd) Environ() []string {
-	env := mergeEnv(serviceEnvSlice(c.Service), c.Env)
-	return append([]string(nil), env...)
+	return append([]string(nil), c.environ()...)
 }
 
 // Start creates and starts the container for the configured service command.
 //
 //nolint:gocyclo // Orchestrates container lifecycle with explicit error handling.
 func (c *Cmd) Start() (startErr error) {
-	if c.loadErr != nil {
-		return c.loadErr
+	if c.Err != nil {
+		return c.Err
+	}
+	if err := c.validate(); err != nil {
+		return err
 	}
 	if err := c.markStarted(); err != nil {
 		return err
 	}
 	defer func() {
 		if startErr != nil {
+			startErr = c.redactErr(startErr)
 			c.closePipes(startErr)
+			c.finished(startErr)
 		}
 	}()
 	ctx := c.contextOrBackground()
 	c.ensureService()
 	c.resolveCommand()
+	initCmds, initErr := c.resolveInitCommands()
+	if initErr != nil {
+		return initErr
+	}
 	if c.Service.Build != nil {
 		return errors.New("compose: service.build is not supported (use a pre-built image)")
 	}
@@ -57,8 +63,8 @@ func (c *Cmd) Start() (startErr error) {
 		return errors.New("compose: service.image is required (build is out of scope)")
 	}
 
-	// Signal handling (Ctrl+C etc.) is handled internally per SOW.
-	sigCtx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	// Signal handling (Ctrl+C etc.) is handled internally per SOW, unless disabled.
+	sigCtx, stopSignals := c.notifySignals(ctx)
 	defer func() {
 		if startErr != nil && stopSignals != nil {
 			stopSignals()
@@ -77,10 +83,15 @@ func (c *Cmd) Start() (startErr error) {
 	}()
 
 	// Pull image (build is out of scope).
+	phaseStart := time.Now()
 	err = pullImage(sigCtx, dc, c.Service.Image, c.Service.Platform)
 	if err != nil {
 		return err
 	}
+	pullTime := time.Since(phaseStart)
+	c.updateTiming(func(t *Timing) { t.Pull = pullTime })
+	c.emitPhase(EventPulled, pullTime)
+	phaseStart = time.Now()
 
 	mounts, err := serviceMounts(
 		c.Service,
@@ -91,6 +102,12 @@ func (c *Cmd) Start() (startErr error) {
 	if err != nil {
 		return err
 	}
+	extraMounts, groupAdd := c.extraMounts(dc)
+	mounts, err = mergeExtraMounts(mounts, extraMounts)
+	if err != nil {
+		return err
+	}
+	mounts = mapBindSources(mounts)
 
 	containerName, err := containerNameFor(c.Service.Name)
 	if err != nil {
@@ -101,8 +118,25 @@ func (c *Cmd) Start() (startErr error) {
 	if err != nil {
 		return err
 	}
+	if hostErr := c.applyHostnameTemplate(cfg, hostCfg, containerName); hostErr != nil {
+		return hostErr
+	}
+	if wrapErr := c.applyCommandWrap(sigCtx, dc, cfg); wrapErr != nil {
+		return wrapErr
+	}
+	hostCfg.GroupAdd = append(hostCfg.GroupAdd, groupAdd...)
+
+	// Hold the project lock until the container exists and keeps its networks in use.
+	unlockProject, lockErr := c.lockProjectResources(sigCtx)
+	if lockErr != nil {
+		return lockErr
+	}
+	defer unlockProject()
 
 	networkingCfg := c.resolveNetworking(sigCtx, dc)
+	if v6Err := validateIPv6Endpoints(c.Service.Name, networkingCfg); v6Err != nil {
+		return v6Err
+	}
 
 	if networkingCfg != nil {
 		if netErr := c.ensureNetworks(sigCtx, dc, networkingCfg); netErr != nil {
@@ -119,6 +153,29 @@ func (c *Cmd) Start() (startErr error) {
 		netCfg = networkingCfg.config
 	}
 
+	if hostsErr := resolveExtraHosts(sigCtx, dc, hostCfg); hostsErr != nil {
+		return hostsErr
+	}
+
+	if c.MutateCreateConfig != nil {
+		if netCfg == nil {
+			netCfg = &networktypes.NetworkingConfig{}
+		}
+		c.MutateCreateConfig(cfg, hostCfg, netCfg)
+	}
+
+	if gateErr := gateAPIFeatures(dc.ClientVersion(), c.StrictAPIVersion, &createSpec{
+		config:     cfg,
+		hostConfig: hostCfg,
+		networking: netCfg,
+	}); gateErr != nil {
+		return gateErr
+	}
+
+	if restoreErr := c.checkRestore(sigCtx, dc); restoreErr != nil {
+		return restoreErr
+	}
+
 	platform, plErr := parsePlatform(c.Service.Platform)
 	if plErr != nil {
 		return plErr
@@ -132,37 +189,89 @@ func (c *Cmd) Start() (startErr error) {
 		platform,
 		containerName,
 	)
+	unlockProject()
 	if err != nil {
-		return err
+		return engineErr("create container", err)
 	}
 	c.storeContainerID(createResp.ID)
+	// A TTY container's output is a single stream without stdcopy headers.
+	c.storeRawOutput(cfg.Tty)
+	journalRecord(journalOpCreate, journalKindContainer, createResp.ID, containerName)
+
+	if upErr := c.uploadArchives(sigCtx, dc, createResp.ID); upErr != nil {
+		journalContainerRemoved(
+			createResp.ID,
+			forceRemoveContainer(context.Background(), dc, createResp.ID),
+		)
+		return upErr
+	}
 
 	attachResp, err := dc.ContainerAttach(sigCtx, createResp.ID, container.AttachOptions{
 		Stream: true,
 		Stdin:  stdinEnabled(c.Stdin),
 		Stdout: true,
 		Stderr: true,
-		Logs:   true,
+		Logs:   c.IncludeEarlyLogs,
 	})
 	if err != nil {
-		_ = forceRemoveContainer(context.Background(), dc, createResp.ID)
-		return err
+		journalContainerRemoved(
+			createResp.ID,
+			forceRemoveContainer(context.Background(), dc, createResp.ID),
+		)
+		return engineErr("attach container", err)
 	}
 	c.storeAttachState(&attachResp)
+	if c.KeepAlive > 0 {
+		enableTCPKeepAlive(attachResp.Conn, c.KeepAlive)
+	}
 
 	stdout, stderr := c.normalizedWriters()
 	// Ensure stdout/stderr forwarder is running before starting the container.
 	ioReady := c.startForwarding(attachResp, stdout, stderr)
 	<-ioReady
 
-	err = dc.ContainerStart(sigCtx, createResp.ID, container.StartOptions{})
+	if c.AutoRemove {
+		// Register before starting: a fast-exiting container may already be
+		// removed by the engine when a later wait request arrives.
+		c.storeWait(dc, createResp.ID, container.WaitConditionRemoved)
+	}
+
+	createTime := time.Since(phaseStart)
+	c.updateTiming(func(t *Timing) { t.Create = createTime })
+	c.emitPhase(EventCreated, createTime)
+
+	c.markRunStart()
+	err = dc.ContainerStart(sigCtx, createResp.ID, c.startOptions())
 	if err != nil {
 		closeAttach(&attachResp)
-		_ = forceRemoveContainer(context.Background(), dc, createResp.ID)
-		return err
+		journalContainerRemoved(
+			createResp.ID,
+			forceRemoveContainer(context.Background(), dc, createResp.ID),
+		)
+		return engineErr("start container", err)
+	}
+	if runErr := runInitCommands(sigCtx, dc, createResp.ID, initCmds); runErr != nil {
+		closeAttach(&attachResp)
+		journalContainerRemoved(
+			createResp.ID,
+			forceRemoveContainer(context.Background(), dc, createResp.ID),
+		)
+		return runErr
+	}
+	c.emitEvent(Event{Type: EventStarted})
+	if c.ZombieCheck > 0 && (hostCfg.Init == nil || !*hostCfg.Init) {
+		c.startZombieCheck(dc, createResp.ID)
+	}
+	if c.forwarder != nil {
+		c.forwarder.attach(dc, createResp.ID)
+	}
+	if c.KeepAlive > 0 {
+		c.startKeepAlive(dc)
 	}
 
-	c.storeWait(dc, createResp.ID)
+	if !c.AutoRemove {
+		c.storeWait(dc, createResp.ID, container.WaitConditionNotRunning)
+	}
 	return nil
 }
 
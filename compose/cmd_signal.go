@@ -0,0 +1,103 @@
+package compose
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// notifySignals returns the context used for the container lifecycle and a func
+// releasing the signal handlers.
+//
+// By default SIGINT/SIGTERM cancel the context, which stops the container.
+// With ForwardSignals, received signals are delivered to the container process
+// once it is running (before that they abort Start). With DisableSignalHandling,
+// ctx is returned as is.
+func (c *Cmd) notifySignals(ctx context.Context) (context.Context, func()) {
+	if c.DisableSignalHandling {
+		return ctx, nil
+	}
+	if !c.ForwardSignals {
+		return signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	}
+	f := newSignalForwarder(ctx)
+	c.mu.Lock()
+	c.forwarder = f
+	c.mu.Unlock()
+	return f.ctx, f.stop
+}
+
+// signalForwarder relays process signals to a container via ContainerKill.
+type signalForwarder struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	ch     chan os.Signal
+	done   chan struct{}
+	once   sync.Once
+
+	mu sync.Mutex
+	dc Backend
+	id string
+}
+
+func newSignalForwarder(parent context.Context) *signalForwarder {
+	ctx, cancel := context.WithCancel(parent)
+	f := &signalForwarder{
+		ctx:    ctx,
+		cancel: cancel,
+		ch:     make(chan os.Signal, 4),
+		done:   make(chan struct{}),
+	}
+	signal.Notify(f.ch, forwardedSignals...)
+	go f.loop()
+	return f
+}
+
+func (f *signalForwarder) loop() {
+	for {
+		select {
+		case sig := <-f.ch:
+			f.handle(sig)
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// attach starts forwarding to the container id.
+func (f *signalForwarder) attach(dc Backend, id string) {
+	f.mu.Lock()
+	f.dc = dc
+	f.id = id
+	f.mu.Unlock()
+}
+
+func (f *signalForwarder) handle(sig os.Signal) {
+	f.mu.Lock()
+	dc, id := f.dc, f.id
+	f.mu.Unlock()
+	if id == "" {
+		// Nothing to forward to yet: abort Start like the default mode does.
+		f.cancel()
+		return
+	}
+	name := signalName(sig)
+	if name == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	// The container may already be gone; Wait reports the outcome.
+	_ = dc.ContainerKill(ctx, id, name)
+}
+
+func (f *signalForwarder) stop() {
+	f.once.Do(func() {
+		signal.Stop(f.ch)
+		close(f.done)
+		f.cancel()
+	})
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package compose
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are relayed to the container when Cmd.ForwardSignals is set.
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+func signalName(sig os.Signal) string {
+	switch sig {
+	case os.Interrupt:
+		return "SIGINT"
+	case syscall.SIGTERM:
+		return "SIGTERM"
+	default:
+		return ""
+	}
+}
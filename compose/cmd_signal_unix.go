@@ -0,0 +1,31 @@
+//go:build unix
+
+package compose
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are relayed to the container when Cmd.ForwardSignals is set.
+var forwardedSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGTERM,
+	syscall.SIGQUIT,
+	syscall.SIGHUP,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+var signalNames = map[os.Signal]string{
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGUSR1: "SIGUSR1",
+	syscall.SIGUSR2: "SIGUSR2",
+}
+
+func signalName(sig os.Signal) string {
+	return signalNames[sig]
+}
@@ -0,0 +1,29 @@
+package compose
+
+import (
+	"io"
+
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func (c *Cmd) storeRawOutput(raw bool) {
+	c.mu.Lock()
+	c.rawOutput = raw
+	c.mu.Unlock()
+}
+
+func (c *Cmd) isRawOutput() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rawOutput
+}
+
+// copyOutput copies a container output stream read from r. A raw stream carries
+// no stdcopy headers and all of it goes to stdout; demultiplexing it would
+// misinterpret the output as headers and corrupt it.
+func copyOutput(stdout, stderr io.Writer, r io.Reader, raw bool) (int64, error) {
+	if raw {
+		return io.Copy(stdout, r)
+	}
+	return stdcopy.StdCopy(stdout, stderr, r)
+}
@@ -1,16 +1,76 @@
 package compose
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"os"
 	"strings"
 )
 
+// SetStdinBytes sets the command's standard input to b. The container sees EOF
+// after the last byte; an empty b leaves stdin closed from the start.
+//
+// It is an error to call SetStdinBytes after the command has started or when Stdin
+// is already set.
+func (c *Cmd) SetStdinBytes(b []byte) error {
+	if err := c.checkStdinUnset(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.Stdin = bytes.NewReader(b)
+	c.mu.Unlock()
+	return nil
+}
+
+// SetStdinFile opens path and streams its contents to the command's standard
+// input, followed by EOF. The file is opened immediately, so a missing file is
+// reported here rather than by Start, and it is closed once it has been copied or
+// the command ends.
+//
+// It is an error to call SetStdinFile after the command has started or when Stdin
+// is already set.
+func (c *Cmd) SetStdinFile(path string) error {
+	if err := c.checkStdinUnset(); err != nil {
+		return err
+	}
+	f, err := os.Open(path) // #nosec G304 -- caller-provided input file.
+	if err != nil {
+		return fmt.Errorf("compose: stdin file: %w", err)
+	}
+	if fi, statErr := f.Stat(); statErr == nil && fi.Mode().IsRegular() && fi.Size() == 0 {
+		_ = f.Close()
+		return c.SetStdinBytes(nil)
+	}
+	c.mu.Lock()
+	c.Stdin = f
+	c.stdinFile = f
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Cmd) checkStdinUnset() error {
+	if c.isStarted() {
+		return errors.New("compose: already started")
+	}
+	if c.Stdin != nil {
+		return errors.New("compose: Stdin already set")
+	}
+	return nil
+}
+
+// stdinEnabled reports whether r should be attached as stdin. Known-empty readers
+// are not, so the container sees EOF immediately instead of waiting for a close.
 func stdinEnabled(r io.Reader) bool {
 	if r == nil {
 		return false
 	}
-	if sr, ok := r.(*strings.Reader); ok && sr.Len() == 0 {
-		return false
+	switch sr := r.(type) {
+	case *strings.Reader:
+		return sr.Len() > 0
+	case *bytes.Reader:
+		return sr.Len() > 0
 	}
 	return true
 }
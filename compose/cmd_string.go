@@ -1,21 +1,30 @@
 package compose
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
+
+	"github.com/docker/go-connections/nat"
 )
 
 // String returns a human-friendly representation of the command.
 //
 // When Args is empty, it returns "<default>" to indicate that Docker Engine/image
-// defaults (or YAML service.command via resolution) will be used.
+// defaults (or YAML service.command via resolution) will be used. Secret values
+// (see SetRedactPattern) are masked.
 func (c *Cmd) String() string {
 	if len(c.Args) == 0 {
 		return "<default>"
 	}
+	re := activeRedactPattern()
+	secrets := c.secretValues()
 	parts := make([]string, 0, len(c.Args))
 	for _, a := range c.Args {
+		a = redactSecrets(redactEnvEntry(re, a), secrets)
 		if needsQuoting(a) {
 			parts = append(parts, strconv.Quote(a))
 			continue
@@ -36,3 +45,201 @@ func needsQuoting(s string) bool {
 	}
 	return false
 }
+
+// DebugString describes the command for bug reports and debug logs: the service,
+// project and image, the Cmd fields that override the compose file, and an
+// equivalent `docker run` command line to reproduce the run by hand. Secret values
+// (see SetRedactPattern) are masked, so they must be filled in before running it.
+//
+// The command line covers the common settings (environment, mounts, ports,
+// networks, entrypoint and command); see Start for the full container
+// configuration.
+func (c *Cmd) DebugString() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "service %q", c.Service.Name)
+	if p := c.projectName(); p != "" {
+		fmt.Fprintf(&b, " (project %q)", p)
+	}
+	fmt.Fprintf(&b, " image %q\n", c.Service.Image)
+	if o := c.debugOverrides(); len(o) > 0 {
+		fmt.Fprintf(&b, "overrides: %s\n", strings.Join(o, ", "))
+	}
+	line, err := c.dockerRunLine()
+	if err != nil {
+		fmt.Fprintf(&b, "docker run: %v", c.redactErr(err))
+		return b.String()
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+// debugOverrides lists the Cmd fields set on top of the service config.
+func (c *Cmd) debugOverrides() []string {
+	var out []string
+	if len(c.Env) > 0 {
+		keys := make([]string, 0, len(c.Env))
+		for _, kv := range c.Env {
+			k, _, _ := strings.Cut(kv, "=")
+			keys = append(keys, k)
+		}
+		out = append(out, "env "+strings.Join(keys, " "))
+	}
+	if c.WorkingDir != "" {
+		out = append(out, "working_dir "+c.WorkingDir)
+	}
+	if len(c.ExtraMounts) > 0 {
+		out = append(out, fmt.Sprintf("extra mounts %d", len(c.ExtraMounts)))
+	}
+	if len(c.ExtraHosts) > 0 {
+		out = append(out, "extra hosts "+strings.Join(c.ExtraHosts, " "))
+	}
+	if c.EphemeralPorts {
+		out = append(out, "ephemeral ports")
+	}
+	if c.AutoRemove {
+		out = append(out, "auto remove")
+	}
+	if len(c.InitCommands) > 0 {
+		out = append(out, fmt.Sprintf("init commands %d", len(c.InitCommands)))
+	}
+	if c.MutateCreateConfig != nil {
+		out = append(out, "create config hook (not reflected below)")
+	}
+	return out
+}
+
+// dockerRunLine renders the container configuration as a `docker run` command.
+func (c *Cmd) dockerRunLine() (string, error) {
+	c.ensureService()
+	mounts, err := serviceMounts(
+		c.Service,
+		c.service.workingDir,
+		c.projectName(),
+		c.projectVolumes(),
+	)
+	if err != nil {
+		return "", err
+	}
+	if mounts, err = mergeExtraMounts(mounts, c.ExtraMounts); err != nil {
+		return "", err
+	}
+	cfg, hostCfg, err := c.containerConfigs(mapBindSources(mounts))
+	if err != nil {
+		return "", err
+	}
+
+	re := activeRedactPattern()
+	secrets := c.secretValues()
+	args := []string{"docker", "run", "--rm"}
+	if cfg.OpenStdin {
+		args = append(args, "-i")
+	}
+	if cfg.Tty {
+		args = append(args, "-t")
+	}
+	if hostCfg.Init != nil && *hostCfg.Init {
+		args = append(args, "--init")
+	}
+	if cfg.WorkingDir != "" {
+		args = append(args, "-w", cfg.WorkingDir)
+	}
+	if cfg.User != "" {
+		args = append(args, "-u", cfg.User)
+	}
+	for _, kv := range cfg.Env {
+		args = append(args, "-e", redactEnvEntry(re, kv))
+	}
+	if hostCfg.NetworkMode != "" {
+		args = append(args, "--network", string(hostCfg.NetworkMode))
+	} else if nc := c.resolveNetworking(context.Background(), nil); nc != nil {
+		names := make([]string, 0, len(nc.config.EndpointsConfig))
+		for name := range nc.config.EndpointsConfig {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			args = append(args, "--network", name)
+		}
+	}
+	for _, m := range hostCfg.Mounts {
+		spec := fmt.Sprintf("type=%s,target=%s", m.Type, m.Target)
+		if m.Source != "" {
+			spec = fmt.Sprintf("type=%s,source=%s,target=%s", m.Type, m.Source, m.Target)
+		}
+		if m.ReadOnly {
+			spec += ",readonly"
+		}
+		args = append(args, "--mount", spec)
+	}
+	targets := make([]string, 0, len(hostCfg.Tmpfs))
+	for target := range hostCfg.Tmpfs {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		spec := target
+		if opts := hostCfg.Tmpfs[target]; opts != "" {
+			spec += ":" + opts
+		}
+		args = append(args, "--tmpfs", spec)
+	}
+	if hostCfg.ReadonlyRootfs {
+		args = append(args, "--read-only")
+	}
+	for _, spec := range publishSpecs(hostCfg.PortBindings) {
+		args = append(args, "-p", spec)
+	}
+	for _, h := range hostCfg.ExtraHosts {
+		args = append(args, "--add-host", h)
+	}
+	command := []string(cfg.Cmd)
+	if len(command) == 0 {
+		command = c.Service.Command
+	}
+	if len(cfg.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", cfg.Entrypoint[0])
+		command = append(append([]string(nil), cfg.Entrypoint[1:]...), command...)
+	}
+	args = append(args, cfg.Image)
+	for _, a := range command {
+		args = append(args, redactSecrets(redactEnvEntry(re, a), secrets))
+	}
+
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellArg(a)
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// shellArg quotes s for a POSIX shell unless it consists of safe characters only.
+func shellArg(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_./:=,@%+", r)
+	}) < 0 {
+		return s
+	}
+	return shellQuote(s)
+}
+
+// publishSpecs formats bindings as `docker run -p` values, sorted. Host port ranges
+// and ephemeral ports are kept as declared.
+func publishSpecs(bindings nat.PortMap) []string {
+	var specs []string
+	for port, list := range bindings {
+		for _, b := range list {
+			var spec string
+			switch {
+			case b.HostIP != "":
+				spec = b.HostIP + ":" + b.HostPort + ":" + string(port)
+			case b.HostPort != "":
+				spec = b.HostPort + ":" + string(port)
+			default:
+				spec = string(port)
+			}
+			specs = append(specs, spec)
+		}
+	}
+	sort.Strings(specs)
+	return specs
+}
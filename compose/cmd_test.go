@@ -1,40 +1,156 @@
 package compose
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/compose-spec/compose-go/v2/types"
+	cerrdefs "github.com/containerd/errdefs"
 	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/checkpoint"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/system"
 	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	dockerspec "github.com/moby/docker-image-spec/specs-go/v1"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type fakeDocker struct {
 	stopCalls   int
 	stopErr     bool
 	killCalls   int
+	pauseCalls  []string
+	updateCalls []container.UpdateConfig
+	killSignals []string
 	removeCalls int
 
+	containerListResp []container.Summary
+	imageListResp     map[string][]image.Summary
+	imageRemoveCalls  []string
+	imageRemoveErr    map[string]error
+
 	inspectResp container.InspectResponse
 	inspectErr  error
+	// inspectSeq, if set, is returned by successive inspects before inspectResp.
+	inspectSeq []container.InspectResponse
 
 	networkListResp    []network.Summary
 	networkCreateCalls []networkCreateCall
+	networkRemoveCalls []string
+	// networkRemoveErrs answers NetworkRemove calls in sequence.
+	networkRemoveErrs  []error
+	networkContainers  map[string][]container.Summary
+	serviceContainers  map[string][]container.Summary
+	restartedIDs       []string
+	restartOpts        []container.StopOptions
+	networkConnects    []networkConnectCall
+	networkDisconnects []string
+	removedIDs         []string
+	removeOpts         []container.RemoveOptions
 
 	volumeCreateCalls []volume.CreateOptions
+	volumeRemoves     []string
+	volumeRemoveErr   error
+
+	imageInspects []image.InspectResponse
+	// platformInspects answers ImageInspect calls in sequence; nil is not found.
+	platformInspects []*image.InspectResponse
+	pullPlatforms    []string
+	imageSaves       [][]string
+	imageLoads       [][]byte
+	loadOutput       string
+
+	versionResp dockertypes.Version
+	infoResp    system.Info
+	daemonHost  string
+	apiVersion  string
+	// pullOutput is the JSON progress stream returned by ImagePull.
+	pullOutput string
+
+	copyCalls      []copyCall
+	execCalls      []container.ExecOptions
+	execOutput     []byte
+	execExitCodes  []int
+	createCalls    []containerCreateCall
+	startCalls     int
+	startOptions   []container.StartOptions
+	checkpoints    []string
+	commits        []container.CommitOptions
+	attachOutput   []byte
+	attachConn     net.Conn
+	logsOutput     []byte
+	logsStreams    []io.Reader
+	logsCalls      []container.LogsOptions
+	attachOpts     []container.AttachOptions
+	pings          atomic.Int32
+	pingFailures   int32
+	waitStatus     int64
+	waitErr        error
+	waitOnStop     chan container.WaitResponse
+	waitConditions []container.WaitCondition
+	// topSeq is returned by ContainerTop in order; once exhausted, the container
+	// reports as not running.
+	topSeq []container.TopResponse
+	// volumeListResp is returned by VolumeList.
+	volumeListResp []*volume.Volume
+}
+
+type copyCall struct {
+	dstPath string
+	content []byte
+}
+
+type containerCreateCall struct {
+	config     *container.Config
+	hostConfig *container.HostConfig
+	networking *network.NetworkingConfig
+	name       string
+}
+
+// fakeConn is the hijacked connection returned by fakeDocker.ContainerAttach.
+type fakeConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *fakeConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func (c *fakeConn) Write(p []byte) (int, error) { return len(p), nil }
+
+func (c *fakeConn) Close() error { return nil }
+
+type networkConnectCall struct {
+	network  string
+	settings *network.EndpointSettings
 }
 
 type networkCreateCall struct {
@@ -42,57 +158,191 @@ type networkCreateCall struct {
 	options network.CreateOptions
 }
 
+func (f *fakeDocker) ServerVersion(_ context.Context) (dockertypes.Version, error) {
+	return f.versionResp, nil
+}
+
+func (f *fakeDocker) Ping(_ context.Context) (dockertypes.Ping, error) {
+	if f.pings.Add(1) <= f.pingFailures {
+		return dockertypes.Ping{}, cerrdefs.ErrUnavailable.WithMessage("daemon unreachable")
+	}
+	return dockertypes.Ping{}, nil
+}
+
+func (f *fakeDocker) Info(_ context.Context) (system.Info, error) {
+	return f.infoResp, nil
+}
+
+func (f *fakeDocker) DaemonHost() string {
+	return f.daemonHost
+}
+
+func (f *fakeDocker) ClientVersion() string {
+	return f.apiVersion
+}
+
 func (f *fakeDocker) ImageInspectWithRaw(
 	_ context.Context,
 	_ string,
 ) (image.InspectResponse, []byte, error) {
-	return image.InspectResponse{}, nil, nil
+	if len(f.imageInspects) == 0 {
+		return image.InspectResponse{}, nil, nil
+	}
+	resp := f.imageInspects[0]
+	if len(f.imageInspects) > 1 {
+		f.imageInspects = f.imageInspects[1:]
+	}
+	return resp, nil, nil
+}
+
+func (f *fakeDocker) ImageInspect(
+	_ context.Context,
+	_ string,
+	_ ...client.ImageInspectOption,
+) (image.InspectResponse, error) {
+	if len(f.platformInspects) == 0 {
+		return image.InspectResponse{}, cerrdefs.ErrNotFound.WithMessage("no such image")
+	}
+	resp := f.platformInspects[0]
+	f.platformInspects = f.platformInspects[1:]
+	if resp == nil {
+		return image.InspectResponse{}, cerrdefs.ErrNotFound.WithMessage("no such image")
+	}
+	return *resp, nil
 }
 
 func (f *fakeDocker) ImagePull(
 	_ context.Context,
 	_ string,
-	_ image.PullOptions,
+	options image.PullOptions,
+) (io.ReadCloser, error) {
+	f.pullPlatforms = append(f.pullPlatforms, options.Platform)
+	return io.NopCloser(strings.NewReader(f.pullOutput)), nil
+}
+
+func (f *fakeDocker) ImageList(
+	_ context.Context,
+	options image.ListOptions,
+) ([]image.Summary, error) {
+	var out []image.Summary
+	for _, key := range options.Filters.Keys() {
+		for _, v := range options.Filters.Get(key) {
+			out = append(out, f.imageListResp[key+"="+v]...)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeDocker) ImageRemove(
+	_ context.Context,
+	imageID string,
+	_ image.RemoveOptions,
+) ([]image.DeleteResponse, error) {
+	f.imageRemoveCalls = append(f.imageRemoveCalls, imageID)
+	if err := f.imageRemoveErr[imageID]; err != nil {
+		return nil, err
+	}
+	return []image.DeleteResponse{{Deleted: imageID}}, nil
+}
+
+func (f *fakeDocker) ImageSave(
+	_ context.Context,
+	imageIDs []string,
+	_ ...client.ImageSaveOption,
 ) (io.ReadCloser, error) {
-	return io.NopCloser(&nopReader{}), nil
+	f.imageSaves = append(f.imageSaves, imageIDs)
+	return io.NopCloser(strings.NewReader("tar:" + strings.Join(imageIDs, ","))), nil
+}
+
+func (f *fakeDocker) ImageLoad(
+	_ context.Context,
+	input io.Reader,
+	_ ...client.ImageLoadOption,
+) (image.LoadResponse, error) {
+	b, err := io.ReadAll(input)
+	if err != nil {
+		return image.LoadResponse{}, err
+	}
+	f.imageLoads = append(f.imageLoads, b)
+	return image.LoadResponse{Body: io.NopCloser(strings.NewReader(f.loadOutput)), JSON: true}, nil
 }
 
 func (f *fakeDocker) ContainerCreate(
 	_ context.Context,
-	_ *container.Config,
-	_ *container.HostConfig,
-	_ *network.NetworkingConfig,
+	config *container.Config,
+	hostConfig *container.HostConfig,
+	networkingConfig *network.NetworkingConfig,
 	_ *ocispec.Platform,
-	_ string,
+	containerName string,
 ) (container.CreateResponse, error) {
+	f.createCalls = append(f.createCalls, containerCreateCall{
+		config:     config,
+		hostConfig: hostConfig,
+		networking: networkingConfig,
+		name:       containerName,
+	})
 	return container.CreateResponse{ID: "cid"}, nil
 }
 
 func (f *fakeDocker) ContainerStart(
 	_ context.Context,
 	_ string,
-	_ container.StartOptions,
+	options container.StartOptions,
+) error {
+	f.startCalls++
+	f.startOptions = append(f.startOptions, options)
+	return nil
+}
+
+func (f *fakeDocker) CheckpointCreate(
+	_ context.Context,
+	containerID string,
+	options checkpoint.CreateOptions,
 ) error {
+	f.checkpoints = append(f.checkpoints, containerID+":"+options.CheckpointID+"@"+
+		options.CheckpointDir)
 	return nil
 }
 
+func (f *fakeDocker) ContainerCommit(
+	_ context.Context,
+	_ string,
+	options container.CommitOptions,
+) (container.CommitResponse, error) {
+	f.commits = append(f.commits, options)
+	return container.CommitResponse{ID: "sha256:img"}, nil
+}
+
 func (f *fakeDocker) ContainerAttach(
 	_ context.Context,
 	_ string,
-	_ container.AttachOptions,
+	options container.AttachOptions,
 ) (dockertypes.HijackedResponse, error) {
-	// Not used in unit tests.
-	return dockertypes.HijackedResponse{}, nil
+	f.attachOpts = append(f.attachOpts, options)
+	if f.attachConn != nil {
+		return dockertypes.NewHijackedResponse(f.attachConn, ""), nil
+	}
+	// attachOutput must be stdcopy-framed (see stdcopy.NewStdWriter).
+	conn := &fakeConn{r: bytes.NewReader(f.attachOutput)}
+	return dockertypes.NewHijackedResponse(conn, ""), nil
 }
 
 func (f *fakeDocker) ContainerWait(
 	_ context.Context,
 	_ string,
-	_ container.WaitCondition,
+	condition container.WaitCondition,
 ) (<-chan container.WaitResponse, <-chan error) {
+	f.waitConditions = append(f.waitConditions, condition)
+	if f.waitOnStop != nil {
+		return f.waitOnStop, make(chan error)
+	}
 	respCh := make(chan container.WaitResponse, 1)
 	errCh := make(chan error, 1)
-	respCh <- container.WaitResponse{StatusCode: 0}
+	if f.waitErr != nil {
+		errCh <- f.waitErr
+		return respCh, errCh
+	}
+	respCh <- container.WaitResponse{StatusCode: f.waitStatus}
 	return respCh, errCh
 }
 
@@ -100,43 +350,108 @@ func (f *fakeDocker) ContainerInspect(
 	_ context.Context,
 	_ string,
 ) (container.InspectResponse, error) {
+	if len(f.inspectSeq) > 0 {
+		resp := f.inspectSeq[0]
+		f.inspectSeq = f.inspectSeq[1:]
+		return resp, nil
+	}
 	if f.inspectErr != nil {
 		return container.InspectResponse{}, f.inspectErr
 	}
 	return f.inspectResp, nil
 }
 
+func (f *fakeDocker) ContainerTop(
+	_ context.Context,
+	_ string,
+	_ []string,
+) (container.TopResponse, error) {
+	if len(f.topSeq) == 0 {
+		return container.TopResponse{}, cerrdefs.ErrConflict.WithMessage("container is not running")
+	}
+	resp := f.topSeq[0]
+	f.topSeq = f.topSeq[1:]
+	return resp, nil
+}
+
 func (f *fakeDocker) ContainerStop(
 	_ context.Context,
 	_ string,
 	_ container.StopOptions,
 ) error {
 	f.stopCalls++
+	if f.waitOnStop != nil {
+		select {
+		case f.waitOnStop <- container.WaitResponse{StatusCode: 143}:
+		default:
+		}
+	}
 	if f.stopErr {
 		return context.Canceled
 	}
 	return nil
 }
 
-func (f *fakeDocker) ContainerKill(_ context.Context, _ string, _ string) error {
+func (f *fakeDocker) ContainerRestart(
+	_ context.Context,
+	containerID string,
+	opts container.StopOptions,
+) error {
+	f.restartedIDs = append(f.restartedIDs, containerID)
+	f.restartOpts = append(f.restartOpts, opts)
+	return nil
+}
+
+func (f *fakeDocker) ContainerKill(_ context.Context, _ string, sig string) error {
 	f.killCalls++
+	f.killSignals = append(f.killSignals, sig)
 	return nil
 }
 
 func (f *fakeDocker) ContainerRemove(
 	_ context.Context,
-	_ string,
-	_ container.RemoveOptions,
+	containerID string,
+	opts container.RemoveOptions,
 ) error {
 	f.removeCalls++
+	f.removedIDs = append(f.removedIDs, containerID)
+	f.removeOpts = append(f.removeOpts, opts)
+	return nil
+}
+
+func (f *fakeDocker) ContainerPause(_ context.Context, _ string) error {
+	f.pauseCalls = append(f.pauseCalls, "pause")
+	return nil
+}
+
+func (f *fakeDocker) ContainerUnpause(_ context.Context, _ string) error {
+	f.pauseCalls = append(f.pauseCalls, "unpause")
 	return nil
 }
 
+func (f *fakeDocker) ContainerUpdate(
+	_ context.Context,
+	_ string,
+	updateConfig container.UpdateConfig,
+) (container.UpdateResponse, error) {
+	f.updateCalls = append(f.updateCalls, updateConfig)
+	return container.UpdateResponse{}, nil
+}
+
 func (f *fakeDocker) ContainerList(
 	_ context.Context,
-	_ container.ListOptions,
+	options container.ListOptions,
 ) ([]container.Summary, error) {
-	return []container.Summary{}, nil
+	if nets := options.Filters.Get("network"); len(nets) > 0 {
+		return append([]container.Summary{}, f.networkContainers[nets[0]]...), nil
+	}
+	for _, l := range options.Filters.Get("label") {
+		svc, ok := strings.CutPrefix(l, "com.docker.compose.service=")
+		if ok && f.serviceContainers != nil {
+			return append([]container.Summary{}, f.serviceContainers[svc]...), nil
+		}
+	}
+	return append([]container.Summary{}, f.containerListResp...), nil
 }
 
 func (f *fakeDocker) NetworkList(
@@ -146,6 +461,20 @@ func (f *fakeDocker) NetworkList(
 	return append([]network.Summary(nil), f.networkListResp...), nil
 }
 
+func (f *fakeDocker) NetworkConnect(
+	_ context.Context,
+	networkID, _ string,
+	config *network.EndpointSettings,
+) error {
+	f.networkConnects = append(f.networkConnects, networkConnectCall{networkID, config})
+	return nil
+}
+
+func (f *fakeDocker) NetworkDisconnect(_ context.Context, networkID, _ string, _ bool) error {
+	f.networkDisconnects = append(f.networkDisconnects, networkID)
+	return nil
+}
+
 func (f *fakeDocker) NetworkCreate(
 	_ context.Context,
 	name string,
@@ -158,7 +487,79 @@ func (f *fakeDocker) NetworkCreate(
 	return network.CreateResponse{ID: "fake-network-id"}, nil
 }
 
-func (f *fakeDocker) NetworkRemove(_ context.Context, _ string) error {
+func (f *fakeDocker) ContainerLogs(
+	_ context.Context,
+	_ string,
+	opts container.LogsOptions,
+) (io.ReadCloser, error) {
+	f.logsCalls = append(f.logsCalls, opts)
+	if len(f.logsStreams) > 0 {
+		r := f.logsStreams[0]
+		f.logsStreams = f.logsStreams[1:]
+		return io.NopCloser(r), nil
+	}
+	return io.NopCloser(bytes.NewReader(f.logsOutput)), nil
+}
+
+func (f *fakeDocker) CopyToContainer(
+	_ context.Context,
+	_, dstPath string,
+	content io.Reader,
+	_ container.CopyToContainerOptions,
+) error {
+	b, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	f.copyCalls = append(f.copyCalls, copyCall{dstPath: dstPath, content: b})
+	return nil
+}
+
+func (f *fakeDocker) ContainerExecCreate(
+	_ context.Context,
+	_ string,
+	options container.ExecOptions,
+) (container.ExecCreateResponse, error) {
+	f.execCalls = append(f.execCalls, options)
+	return container.ExecCreateResponse{ID: "exec"}, nil
+}
+
+func (f *fakeDocker) ContainerExecStart(
+	_ context.Context,
+	_ string,
+	_ container.ExecStartOptions,
+) error {
+	return nil
+}
+
+func (f *fakeDocker) ContainerExecAttach(
+	_ context.Context,
+	_ string,
+	_ container.ExecAttachOptions,
+) (dockertypes.HijackedResponse, error) {
+	var b bytes.Buffer
+	_, _ = stdcopy.NewStdWriter(&b, stdcopy.Stderr).Write(f.execOutput)
+	return dockertypes.NewHijackedResponse(&fakeConn{r: &b}, ""), nil
+}
+
+func (f *fakeDocker) ContainerExecInspect(
+	_ context.Context,
+	_ string,
+) (container.ExecInspect, error) {
+	code := 0
+	if n := len(f.execCalls); n > 0 && n <= len(f.execExitCodes) {
+		code = f.execExitCodes[n-1]
+	}
+	return container.ExecInspect{ExitCode: code}, nil
+}
+
+func (f *fakeDocker) NetworkRemove(_ context.Context, networkID string) error {
+	f.networkRemoveCalls = append(f.networkRemoveCalls, networkID)
+	if len(f.networkRemoveErrs) > 0 {
+		err := f.networkRemoveErrs[0]
+		f.networkRemoveErrs = f.networkRemoveErrs[1:]
+		return err
+	}
 	return nil
 }
 
@@ -170,6 +571,21 @@ func (f *fakeDocker) VolumeCreate(
 	return volume.Volume{Name: options.Name}, nil
 }
 
+func (f *fakeDocker) VolumeList(
+	_ context.Context,
+	_ volume.ListOptions,
+) (volume.ListResponse, error) {
+	return volume.ListResponse{Volumes: append([]*volume.Volume(nil), f.volumeListResp...)}, nil
+}
+
+func (f *fakeDocker) VolumeRemove(_ context.Context, volumeID string, _ bool) error {
+	f.volumeRemoves = append(f.volumeRemoves, volumeID)
+	if volumeID == "missing" {
+		return cerrdefs.ErrNotFound.WithMessage("no such volume")
+	}
+	return f.volumeRemoveErr
+}
+
 func (f *fakeDocker) Close() error {
 	return nil
 }
@@ -245,6 +661,98 @@ func TestCmd_Environ_MergeAndCopy(t *testing.T) {
 	}
 }
 
+func TestCmd_ContextEnv(t *testing.T) {
+	t.Setenv("CI_JOB_ID", "42")
+	defer SetContextEnv()
+	SetContextEnv(TraceParentEnv, HostEnv("CI_JOB_ID", "UNSET_VAR_FOR_TEST"))
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	job := "7"
+	c := &Cmd{
+		Service: types.ServiceConfig{Environment: types.MappingWithEquals{"CI_JOB_ID": &job}},
+		Env:     []string{"A=1"},
+		ctx:     ctx,
+	}
+	want := []string{
+		"TRACEPARENT=00-4bf92f35000000000000000000000000-00f067aa00000000-01",
+		"CI_JOB_ID=7",
+		"A=1",
+	}
+	if got := c.Environ(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Environ()=%v want %v", got, want)
+	}
+}
+
+func TestCmd_RedactsSecrets(t *testing.T) {
+	pw := "hunter22"
+	c := &Cmd{
+		Service: types.ServiceConfig{Environment: types.MappingWithEquals{"DB_PASSWORD": &pw}},
+		Env:     []string{"API_TOKEN=tok-123", "MODE=dev"},
+		Args:    []string{"login", "--password=" + pw, "tok-123", "dev"},
+	}
+	if got, want := c.String(), "login --password=**** **** dev"; got != want {
+		t.Fatalf("String()=%q want %q", got, want)
+	}
+	if got, want := RedactEnv(c.Environ()), []string{
+		"DB_PASSWORD=****", "API_TOKEN=****", "MODE=dev",
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("RedactEnv=%v want %v", got, want)
+	}
+
+	ee := &ExitError{Code: 1, Stderr: []byte("bad password hunter22")}
+	err := c.redactErr(ee)
+	if strings.Contains(err.Error(), pw) || !errors.Is(err, ee) {
+		t.Fatalf("redactErr=%v", err)
+	}
+	plain := errors.New("compose: no secret here")
+	if c.redactErr(plain) != plain {
+		t.Fatal("error without secrets was wrapped")
+	}
+
+	defer SetRedactPattern(activeRedactPattern())
+	SetRedactPattern(nil)
+	if got := c.String(); !strings.Contains(got, pw) {
+		t.Fatalf("String() with redaction disabled=%q", got)
+	}
+}
+
+func TestCmd_DebugString(t *testing.T) {
+	pw := "hunter22"
+	c := &Cmd{
+		Service: types.ServiceConfig{
+			Name:        "db",
+			Image:       "postgres:16",
+			Environment: types.MappingWithEquals{"POSTGRES_PASSWORD": &pw},
+			Ports:       []types.ServicePortConfig{{Target: 5432, Published: "15432"}},
+			NetworkMode: "host",
+		},
+		Env:        []string{"PGDATA=/tmp/pg"},
+		WorkingDir: "/work",
+		Args:       []string{"sh", "-c", "echo $PGDATA"},
+	}
+	got := c.DebugString()
+	for _, want := range []string{
+		`service "db" image "postgres:16"`,
+		"overrides: env PGDATA, working_dir /work",
+		"docker run --rm --init -w /work -e 'POSTGRES_PASSWORD=****' -e PGDATA=/tmp/pg",
+		"--network host",
+		"-p 15432:5432/tcp",
+		`postgres:16 sh -c 'echo $PGDATA'`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("DebugString() missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, pw) {
+		t.Fatalf("DebugString() leaks secret:\n%s", got)
+	}
+}
+
 func TestCmd_StdoutPipe_Errors(t *testing.T) {
 	t.Run("already started", func(t *testing.T) {
 		c := &Cmd{}
@@ -353,6 +861,65 @@ func TestStdinEnabled(t *testing.T) {
 	})
 }
 
+func TestCmd_SetStdin(t *testing.T) {
+	t.Run("bytes", func(t *testing.T) {
+		c := &Cmd{}
+		if err := c.SetStdinBytes(nil); err != nil {
+			t.Fatalf("SetStdinBytes: %v", err)
+		}
+		if stdinEnabled(c.Stdin) {
+			t.Fatalf("empty bytes must not enable stdin")
+		}
+		if err := c.SetStdinBytes([]byte("x")); err == nil {
+			t.Fatalf("expected error when Stdin is already set")
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "in.txt")
+		if err := os.WriteFile(path, []byte("payload"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		c := &Cmd{}
+		if err := c.SetStdinFile(path); err != nil {
+			t.Fatalf("SetStdinFile: %v", err)
+		}
+		if !stdinEnabled(c.Stdin) {
+			t.Fatalf("expected stdin to be enabled")
+		}
+		b, err := io.ReadAll(c.Stdin)
+		if err != nil || string(b) != "payload" {
+			t.Fatalf("stdin=%q err=%v want=payload", b, err)
+		}
+		f := c.stdinFile
+		c.closeStdinPipe(nil)
+		if _, err := f.Stat(); err == nil {
+			t.Fatalf("stdin file not closed")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		c := &Cmd{}
+		if err := c.SetStdinFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+			t.Fatalf("expected error for missing file")
+		}
+		empty := filepath.Join(t.TempDir(), "empty")
+		if err := os.WriteFile(empty, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetStdinFile(empty); err != nil {
+			t.Fatalf("SetStdinFile(empty): %v", err)
+		}
+		if stdinEnabled(c.Stdin) || c.stdinFile != nil {
+			t.Fatalf("empty file must not enable stdin")
+		}
+		started := &Cmd{started: true}
+		if err := started.SetStdinBytes([]byte("x")); err == nil {
+			t.Fatalf("expected error after start")
+		}
+	})
+}
+
 func TestServiceMounts_RelativeSourceResolved(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("path semantics differ")
@@ -589,7 +1156,9 @@ func TestCmd_ensureVolumes_RespectsTopLevelNameAndExternal(t *testing.T) {
 }
 
 func TestCmd_ensureNetworks_RespectsTopLevelNameAndExternal(t *testing.T) {
-	fd := &fakeDocker{}
+	fd := &fakeDocker{
+		networkListResp: []network.Summary{{Name: "corp_shared_net"}},
+	}
 
 	svcCfg := types.ServiceConfig{
 		Name:  "svc",
@@ -649,46 +1218,1137 @@ func TestCmd_ensureNetworks_RespectsTopLevelNameAndExternal(t *testing.T) {
 	}
 }
 
-func TestStopAndKill_CallsDocker(t *testing.T) {
+func TestCmd_IPv6Networking(t *testing.T) {
+	svcCfg := types.ServiceConfig{
+		Name:  "svc",
+		Image: "alpine:latest",
+		Networks: map[string]*types.ServiceNetworkConfig{
+			"v6": {Ipv6Address: "fd00:1::10"},
+		},
+	}
+	proj := &Project{
+		Name: "myproj",
+		Networks: types.Networks{
+			"v6": types.NetworkConfig{
+				Name:       "myproj_v6",
+				EnableIPv6: ptr(true),
+				Ipam: types.IPAMConfig{Config: []*types.IPAMPool{
+					{Subnet: "fd00:1::/64"},
+				}},
+			},
+		},
+		Services: types.Services{"svc": svcCfg},
+	}
+	s, err := proj.Service("svc")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+	c := &Cmd{Service: s.config, service: s}
 	fd := &fakeDocker{}
-	_ = stopAndKill(context.Background(), fd, "cid", 2*time.Second)
-	if fd.stopCalls != 1 {
-		t.Fatalf("stopCalls=%d", fd.stopCalls)
+	plan := c.resolveNetworking(context.Background(), fd)
+	if err := validateIPv6Endpoints("svc", plan); err != nil {
+		t.Fatalf("validateIPv6Endpoints: %v", err)
 	}
-	if fd.killCalls != 0 {
-		t.Fatalf("killCalls=%d", fd.killCalls)
+	ep := plan.config.EndpointsConfig["myproj_v6"]
+	if ep == nil || ep.IPAMConfig == nil || ep.IPAMConfig.IPv6Address != "fd00:1::10" {
+		t.Fatalf("endpoint=%+v want ipv6_address", ep)
 	}
-}
-
-func TestStopAndKill_KillsOnStopError(t *testing.T) {
-	fd := &fakeDocker{stopErr: true}
-	_ = stopAndKill(context.Background(), fd, "cid", 2*time.Second)
-	if fd.stopCalls != 1 {
-		t.Fatalf("stopCalls=%d", fd.stopCalls)
+	if err := c.ensureNetworks(context.Background(), fd, plan); err != nil {
+		t.Fatalf("ensureNetworks: %v", err)
 	}
-	if fd.killCalls != 1 {
-		t.Fatalf("killCalls=%d", fd.killCalls)
+	opts := fd.networkCreateCalls[0].options
+	if opts.EnableIPv6 == nil || !*opts.EnableIPv6 || opts.IPAM.Config[0].Subnet != "fd00:1::/64" {
+		t.Fatalf("create options=%+v want IPv6 with subnet", opts)
+	}
+
+	v4only := proj.Networks["v6"]
+	v4only.EnableIPv6 = nil
+	proj.Networks["v6"] = v4only
+	plan = c.resolveNetworking(context.Background(), fd)
+	if err := validateIPv6Endpoints("svc", plan); err == nil {
+		t.Fatalf("expected error for ipv6_address without enable_ipv6")
 	}
 }
 
-func TestCmd_resolveCommand_FallbackOnlyWhenArgsEmpty(t *testing.T) {
-	svc := types.ServiceConfig{Command: types.ShellCommand{"echo", "from-yaml"}}
+func TestCmd_ensureNetworks_DriverValidation(t *testing.T) {
+	ensure := func(t *testing.T, fd *fakeDocker, nets types.Networks) error {
+		t.Helper()
+		svcNets := map[string]*types.ServiceNetworkConfig{}
+		for key := range nets {
+			svcNets[key] = nil
+		}
+		proj := &Project{
+			Name:     "myproj",
+			Networks: nets,
+			Services: types.Services{"svc": {Name: "svc", Networks: svcNets}},
+		}
+		s, err := proj.Service("svc")
+		if err != nil {
+			t.Fatalf("Project.Service: %v", err)
+		}
+		c := &Cmd{Service: s.config, service: s}
+		plan := c.resolveNetworking(context.Background(), fd)
+		return c.ensureNetworks(context.Background(), fd, plan)
+	}
+	drivers := system.Info{}
+	drivers.Plugins.Network = []string{"bridge", "macvlan", "overlay"}
 
-	t.Run("nil args falls back", func(t *testing.T) {
-		c := &Cmd{Service: svc}
-		c.resolveCommand()
-		want := []string{"echo", "from-yaml"}
-		if !reflect.DeepEqual(c.Args, want) {
-			t.Fatalf("Args=%v want=%v", c.Args, want)
+	t.Run("macvlan", func(t *testing.T) {
+		fd := &fakeDocker{infoResp: drivers}
+		err := ensure(t, fd, types.Networks{"lan": {
+			Name:       "myproj_lan",
+			Driver:     "macvlan",
+			DriverOpts: map[string]string{"parent": "eth0", "macvlan_mode": "bridge"},
+		}})
+		if err != nil || len(fd.networkCreateCalls) != 1 {
+			t.Fatalf("err=%v creates=%d", err, len(fd.networkCreateCalls))
+		}
+		if got := fd.networkCreateCalls[0].options.Options["parent"]; got != "eth0" {
+			t.Fatalf("parent=%q want=eth0", got)
 		}
 	})
 
-	t.Run("empty slice falls back", func(t *testing.T) {
-		c := &Cmd{Service: svc, Args: []string{}}
-		c.resolveCommand()
-		want := []string{"echo", "from-yaml"}
-		if !reflect.DeepEqual(c.Args, want) {
-			t.Fatalf("Args=%v want=%v", c.Args, want)
+	t.Run("invalid mode", func(t *testing.T) {
+		fd := &fakeDocker{infoResp: drivers}
+		err := ensure(t, fd, types.Networks{"lan": {
+			Name:       "myproj_lan",
+			Driver:     "macvlan",
+			DriverOpts: map[string]string{"macvlan_mode": "bogus"},
+		}})
+		if err == nil || !strings.Contains(err.Error(), "macvlan_mode") {
+			t.Fatalf("err=%v want invalid macvlan_mode", err)
+		}
+	})
+
+	t.Run("missing driver", func(t *testing.T) {
+		fd := &fakeDocker{infoResp: drivers}
+		err := ensure(t, fd, types.Networks{"iv": {Name: "custom", Driver: "ipvlan"}})
+		if err == nil || !strings.Contains(err.Error(), `"iv" (custom)`) ||
+			!strings.Contains(err.Error(), "not available") {
+			t.Fatalf("err=%v want driver not available for \"iv\" (custom)", err)
+		}
+		if len(fd.networkCreateCalls) != 0 {
+			t.Fatalf("network created despite missing driver")
+		}
+	})
+
+	t.Run("plugin drivers are left to the daemon", func(t *testing.T) {
+		fd := &fakeDocker{infoResp: drivers}
+		err := ensure(t, fd, types.Networks{
+			"wv":  {Name: "myproj_wv", Driver: "weave"},
+			"mgd": {Name: "myproj_mgd", Driver: "vendor/net-plugin"},
+		})
+		if err != nil || len(fd.networkCreateCalls) != 2 {
+			t.Fatalf("err=%v creates=%d", err, len(fd.networkCreateCalls))
+		}
+	})
+
+	t.Run("overlay without swarm", func(t *testing.T) {
+		fd := &fakeDocker{infoResp: drivers}
+		err := ensure(t, fd, types.Networks{"ov": {Name: "myproj_ov", Driver: "overlay"}})
+		if err == nil || !strings.Contains(err.Error(), "swarm") {
+			t.Fatalf("err=%v want swarm hint", err)
+		}
+	})
+
+	t.Run("missing external", func(t *testing.T) {
+		fd := &fakeDocker{}
+		err := ensure(t, fd, types.Networks{"shared": {
+			Name:     "corp_net",
+			External: types.External(true),
+		}})
+		if err == nil || !strings.Contains(err.Error(), `external network "shared" (corp_net)`) {
+			t.Fatalf("err=%v want missing external network", err)
+		}
+	})
+}
+
+func TestCmd_ConnectDisconnectNetwork(t *testing.T) {
+	proj := &Project{
+		Name: "myproj",
+		Networks: types.Networks{
+			"default": {Name: "myproj_default"},
+			"back":    {Name: "custom_back"},
+		},
+		Services: types.Services{"db": {
+			Name: "db",
+			Networks: map[string]*types.ServiceNetworkConfig{
+				"back": {Aliases: []string{"database"}},
+			},
+		}},
+	}
+	s, err := proj.Service("db")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+	c := s.Command()
+	if err := c.DisconnectNetwork(context.Background(), "back"); err == nil {
+		t.Fatalf("expected error before Start")
+	}
+
+	fd := &fakeDocker{}
+	c.started, c.containerID, c.docker = true, "cid", fd
+	if err := c.DisconnectNetwork(context.Background(), "back"); err != nil {
+		t.Fatalf("DisconnectNetwork: %v", err)
+	}
+	if err := c.ConnectNetwork(context.Background(), "back", nil); err != nil {
+		t.Fatalf("ConnectNetwork: %v", err)
+	}
+	if err := c.ConnectNetwork(context.Background(), "bridge", nil); err != nil {
+		t.Fatalf("ConnectNetwork(bridge): %v", err)
+	}
+	if !reflect.DeepEqual(fd.networkDisconnects, []string{"custom_back"}) {
+		t.Fatalf("disconnects=%v want=[custom_back]", fd.networkDisconnects)
+	}
+	if len(fd.networkConnects) != 2 || fd.networkConnects[0].network != "custom_back" ||
+		fd.networkConnects[1].network != "bridge" {
+		t.Fatalf("connects=%+v", fd.networkConnects)
+	}
+	aliases := fd.networkConnects[0].settings.Aliases
+	if !reflect.DeepEqual(aliases, []string{"db", "database"}) {
+		t.Fatalf("aliases=%v want=[db database]", aliases)
+	}
+}
+
+func TestCmd_PauseAndUpdateResources(t *testing.T) {
+	c := &Cmd{}
+	if err := c.Pause(context.Background()); err == nil {
+		t.Fatalf("expected error before Start")
+	}
+	fd := &fakeDocker{}
+	c = startedCmd(fd)
+	if err := c.Pause(context.Background()); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if err := c.Unpause(context.Background()); err != nil {
+		t.Fatalf("Unpause: %v", err)
+	}
+	if !reflect.DeepEqual(fd.pauseCalls, []string{"pause", "unpause"}) {
+		t.Fatalf("pauseCalls=%v", fd.pauseCalls)
+	}
+
+	if err := c.UpdateResources(context.Background(), 0.5, 64<<20); err != nil {
+		t.Fatalf("UpdateResources: %v", err)
+	}
+	if err := c.UpdateResources(context.Background(), 0, 0); err != nil {
+		t.Fatalf("UpdateResources(0, 0): %v", err)
+	}
+	if err := c.UpdateResources(context.Background(), -1, 0); err == nil {
+		t.Fatalf("expected error for negative cpus")
+	}
+	want := []container.UpdateConfig{{Resources: container.Resources{
+		NanoCPUs:   500_000_000,
+		Memory:     64 << 20,
+		MemorySwap: 64 << 20,
+	}}}
+	if !reflect.DeepEqual(fd.updateCalls, want) {
+		t.Fatalf("updateCalls=%+v want=%+v", fd.updateCalls, want)
+	}
+}
+
+func TestPullImage_PlatformMismatch(t *testing.T) {
+	ctx := context.Background()
+	arm := image.InspectResponse{Os: "linux", Architecture: "arm64"}
+	amd := image.InspectResponse{Os: "linux", Architecture: "amd64"}
+	host := dockertypes.Version{Os: "linux", Arch: "amd64"}
+
+	fd := &fakeDocker{versionResp: host, imageInspects: []image.InspectResponse{amd}}
+	if err := pullImage(ctx, fd, "app", ""); err != nil || len(fd.pullPlatforms) != 0 {
+		t.Fatalf("err=%v pulls=%v want no pull for a matching image", err, fd.pullPlatforms)
+	}
+
+	// Without an explicit platform a foreign image is used as is, e.g. for emulation.
+	fd = &fakeDocker{versionResp: host, imageInspects: []image.InspectResponse{arm}}
+	if err := pullImage(ctx, fd, "app", ""); err != nil || len(fd.pullPlatforms) != 0 {
+		t.Fatalf("err=%v pulls=%v want only a warning", err, fd.pullPlatforms)
+	}
+
+	fd = &fakeDocker{imageInspects: []image.InspectResponse{arm, amd}}
+	if err := pullImage(ctx, fd, "app", "linux/amd64"); err != nil {
+		t.Fatalf("pullImage: %v", err)
+	}
+	if !reflect.DeepEqual(fd.pullPlatforms, []string{"linux/amd64"}) {
+		t.Fatalf("pulls=%v want a re-pull for linux/amd64", fd.pullPlatforms)
+	}
+
+	fd = &fakeDocker{versionResp: host, imageInspects: []image.InspectResponse{amd}}
+	err := pullImage(ctx, fd, "app", "linux/arm64")
+	if !errors.Is(err, ErrImagePlatformMismatch) ||
+		!strings.Contains(err.Error(), `"app" is linux/amd64 but linux/arm64 is needed`) {
+		t.Fatalf("err=%v want ErrImagePlatformMismatch", err)
+	}
+
+	fd = &fakeDocker{imageInspects: []image.InspectResponse{arm}}
+	if err := pullImage(ctx, fd, "app", ""); err != nil || len(fd.pullPlatforms) != 0 {
+		t.Fatalf("err=%v pulls=%v want no check without daemon platform", err, fd.pullPlatforms)
+	}
+}
+
+func TestPullImage_ContainerdImageStore(t *testing.T) {
+	ctx := context.Background()
+	arm := image.InspectResponse{Os: "linux", Architecture: "arm64"}
+	amd := image.InspectResponse{Os: "linux", Architecture: "amd64"}
+	containerd := system.Info{
+		Driver:       "overlayfs",
+		DriverStatus: [][2]string{{"driver-type", "io.containerd.snapshotter.v1"}},
+	}
+
+	// The image holds an amd64 variant although a plain inspect reports arm64.
+	fd := &fakeDocker{
+		infoResp:         containerd,
+		apiVersion:       "1.49",
+		imageInspects:    []image.InspectResponse{arm},
+		platformInspects: []*image.InspectResponse{&amd},
+	}
+	if err := pullImage(ctx, fd, "app", "linux/amd64"); err != nil || len(fd.pullPlatforms) != 0 {
+		t.Fatalf("err=%v pulls=%v want the present variant to be used", err, fd.pullPlatforms)
+	}
+
+	fd = &fakeDocker{
+		infoResp:         containerd,
+		apiVersion:       "1.49",
+		imageInspects:    []image.InspectResponse{arm},
+		platformInspects: []*image.InspectResponse{nil, &amd},
+	}
+	if err := pullImage(ctx, fd, "app", "linux/amd64"); err != nil {
+		t.Fatalf("pullImage: %v", err)
+	}
+	if !reflect.DeepEqual(fd.pullPlatforms, []string{"linux/amd64"}) {
+		t.Fatalf("pulls=%v want the missing variant to be pulled", fd.pullPlatforms)
+	}
+
+	fd = &fakeDocker{
+		infoResp:      containerd,
+		apiVersion:    "1.49",
+		imageInspects: []image.InspectResponse{arm},
+	}
+	err := pullImage(ctx, fd, "app", "linux/amd64")
+	if !errors.Is(err, ErrImagePlatformMismatch) ||
+		!strings.Contains(err.Error(), "is not available but linux/amd64 is needed") {
+		t.Fatalf("err=%v want ErrImagePlatformMismatch", err)
+	}
+
+	// Older APIs cannot inspect a variant: the pull is trusted.
+	fd = &fakeDocker{
+		infoResp:      containerd,
+		apiVersion:    "1.48",
+		imageInspects: []image.InspectResponse{arm},
+	}
+	if err := pullImage(ctx, fd, "app", "linux/amd64"); err != nil || len(fd.pullPlatforms) != 1 {
+		t.Fatalf("err=%v pulls=%v want one pull without variant inspect", err, fd.pullPlatforms)
+	}
+	// A pull failing in the progress stream is reported.
+	fd.pullOutput = `{"status":"Pulling from library/app"}` + "\n" +
+		`{"errorDetail":{"message":"no matching manifest for linux/amd64"},` +
+		`"error":"no matching manifest for linux/amd64"}` + "\n"
+	err = pullImage(ctx, fd, "app", "linux/amd64")
+	if !errors.Is(err, ErrImagePlatformMismatch) ||
+		!strings.Contains(err.Error(), "no matching manifest for linux/amd64") {
+		t.Fatalf("err=%v want the pull error", err)
+	}
+
+	st := imageStoreOf(system.Info{
+		Driver:       "stargz",
+		DriverStatus: containerd.DriverStatus,
+	})
+	if !st.containerd || !st.lazyPulling() || st.String() != "containerd" {
+		t.Fatalf("store=%+v want lazy-pulling containerd store", st)
+	}
+	if st = imageStoreOf(system.Info{Driver: "overlay2"}); st.containerd || st.lazyPulling() {
+		t.Fatalf("store=%+v want graph driver", st)
+	}
+}
+
+func TestSaveAndLoadImages(t *testing.T) {
+	ctx := context.Background()
+	proj := &Project{Name: "proj", Services: types.Services{
+		"db":     {Name: "db", Image: "postgres:16"},
+		"web":    {Name: "web", Image: "nginx:1.27"},
+		"worker": {Name: "worker", Image: "postgres:16"},
+		"built":  {Name: "built", Build: &types.BuildConfig{Context: "."}},
+	}}
+	fd := &fakeDocker{}
+	var buf bytes.Buffer
+	if err := saveImages(ctx, fd, proj, &buf); err != nil {
+		t.Fatalf("saveImages: %v", err)
+	}
+	if want := [][]string{{"nginx:1.27", "postgres:16"}}; !reflect.DeepEqual(fd.imageSaves, want) {
+		t.Fatalf("saves=%v", fd.imageSaves)
+	}
+	if buf.String() != "tar:nginx:1.27,postgres:16" {
+		t.Fatalf("archive=%q", buf.String())
+	}
+	if err := saveImages(ctx, fd, &Project{Name: "empty"}, &buf); err == nil {
+		t.Fatalf("expected error for project without images")
+	}
+
+	fd.loadOutput = `{"stream":"Loaded image: postgres:16\n"}`
+	if err := loadImages(ctx, fd, strings.NewReader("tar")); err != nil {
+		t.Fatalf("loadImages: %v", err)
+	}
+	if len(fd.imageLoads) != 1 || string(fd.imageLoads[0]) != "tar" {
+		t.Fatalf("loads=%q", fd.imageLoads)
+	}
+	fd.loadOutput = `{"errorDetail":{"message":"unexpected EOF"},"error":"unexpected EOF"}`
+	if err := loadImages(ctx, fd, strings.NewReader("bad")); err == nil ||
+		!strings.Contains(err.Error(), "unexpected EOF") {
+		t.Fatalf("err=%v want load error", err)
+	}
+}
+
+func TestCmd_Commit(t *testing.T) {
+	ctx := context.Background()
+	if _, err := (&Cmd{}).Commit(ctx, "db:migrated", CommitOptions{}); err == nil {
+		t.Fatalf("expected error for a Cmd that was not started")
+	}
+	fd := &fakeDocker{}
+	id, err := startedCmd(fd).Commit(ctx, "db:migrated", CommitOptions{
+		Comment: "migrated",
+		Changes: []string{"ENV MIGRATED=1"},
+	})
+	if err != nil || id != "sha256:img" {
+		t.Fatalf("id=%q err=%v", id, err)
+	}
+	want := []container.CommitOptions{{
+		Reference: "db:migrated",
+		Comment:   "migrated",
+		Changes:   []string{"ENV MIGRATED=1"},
+		Pause:     true,
+	}}
+	if !reflect.DeepEqual(fd.commits, want) {
+		t.Fatalf("commits=%+v", fd.commits)
+	}
+}
+
+func TestCmd_CheckpointAndRestore(t *testing.T) {
+	ctx := context.Background()
+	fd := &fakeDocker{}
+	c := startedCmd(fd)
+	if err := c.Checkpoint(ctx, Checkpoint{Name: "warm"}); !errors.Is(
+		err, ErrCheckpointUnsupported,
+	) {
+		t.Fatalf("err=%v want ErrCheckpointUnsupported", err)
+	}
+	if err := c.Checkpoint(ctx, Checkpoint{}); err == nil {
+		t.Fatalf("expected error for missing name")
+	}
+	if err := c.Checkpoint(ctx, Checkpoint{Name: "warm", Dir: "rel"}); err == nil {
+		t.Fatalf("expected error for relative dir")
+	}
+
+	if err := SetPathMapping(map[string]string{"/work": "/host/work"}); err != nil {
+		t.Fatalf("SetPathMapping: %v", err)
+	}
+	defer func() { _ = SetPathMapping(nil) }()
+	fd.versionResp = dockertypes.Version{Os: "linux", Experimental: true}
+	cp := Checkpoint{Name: "warm", Dir: "/work/ckpt"}
+	if err := c.Checkpoint(ctx, cp); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	if !reflect.DeepEqual(fd.checkpoints, []string{"cid:warm@/host/work/ckpt"}) {
+		t.Fatalf("checkpoints=%v", fd.checkpoints)
+	}
+
+	restored := &Cmd{
+		Service:     types.ServiceConfig{Name: "db", Image: "postgres:16"},
+		RestoreFrom: &cp,
+		docker:      fd,
+	}
+	if err := restored.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	want := container.StartOptions{CheckpointID: "warm", CheckpointDir: "/host/work/ckpt"}
+	if len(fd.startOptions) != 1 || fd.startOptions[0] != want {
+		t.Fatalf("startOptions=%+v want=%+v", fd.startOptions, want)
+	}
+	if err := restored.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	fd2 := &fakeDocker{}
+	unsupported := &Cmd{
+		Service:     types.ServiceConfig{Name: "db", Image: "postgres:16"},
+		RestoreFrom: &cp,
+		docker:      fd2,
+	}
+	if err := unsupported.Start(); !errors.Is(err, ErrCheckpointUnsupported) {
+		t.Fatalf("err=%v want ErrCheckpointUnsupported", err)
+	}
+	if len(fd2.createCalls) != 0 {
+		t.Fatalf("container created despite unsupported restore")
+	}
+}
+
+func TestFixtureVolumes(t *testing.T) {
+	cfg := types.ServiceConfig{Name: "db", Volumes: []types.ServiceVolumeConfig{
+		{Type: types.VolumeTypeBind, Source: "/src", Target: "/src"},
+		{Type: types.VolumeTypeVolume, Source: "pgdata", Target: "/var/lib/postgresql/data"},
+	}}
+	if got, err := fixtureTarget(cfg, "pgdata"); err != nil || got != "/var/lib/postgresql/data" {
+		t.Fatalf("fixtureTarget=%q err=%v", got, err)
+	}
+	if _, err := fixtureTarget(cfg, "/src"); err == nil {
+		t.Fatalf("expected error for a bind mount")
+	}
+	p := &Project{Name: "proj", Services: types.Services{"db": cfg}}
+	if _, err := p.NewFixture(context.Background(), "db", "cache", nil); err == nil {
+		t.Fatalf("expected error for an unmounted volume")
+	}
+
+	fd := &fakeDocker{}
+	if err := createFixtureVolume(
+		context.Background(), fd, "proj", "proj_pgdata_golden_1", "proj_pgdata_clone_2",
+	); err != nil {
+		t.Fatalf("createFixtureVolume: %v", err)
+	}
+	want := map[string]string{
+		"com.docker.compose.project": "proj",
+		fixtureLabel:                 "proj_pgdata_golden_1",
+		managedLabel:                 "true",
+	}
+	if len(fd.volumeCreateCalls) != 1 || fd.volumeCreateCalls[0].Name != "proj_pgdata_clone_2" ||
+		!reflect.DeepEqual(fd.volumeCreateCalls[0].Labels, want) {
+		t.Fatalf("volumeCreateCalls=%+v", fd.volumeCreateCalls)
+	}
+
+	if err := removeFixtureVolumes(
+		context.Background(), fd, []string{"a", "missing", "b"},
+	); err != nil {
+		t.Fatalf("removeFixtureVolumes: %v", err)
+	}
+	if !reflect.DeepEqual(fd.volumeRemoves, []string{"a", "missing", "b"}) {
+		t.Fatalf("volumeRemoves=%v", fd.volumeRemoves)
+	}
+	fd.volumeRemoveErr = cerrdefs.ErrConflict.WithMessage("volume is in use")
+	err := removeFixtureVolumes(context.Background(), fd, []string{"a"})
+	var ee *EngineError
+	if !errors.As(err, &ee) || ee.Category != CategoryConflict {
+		t.Fatalf("err=%v want EngineError(conflict)", err)
+	}
+}
+
+func TestCmd_InitCommands(t *testing.T) {
+	svc := types.ServiceConfig{
+		Name:  "db",
+		Image: "alpine:latest",
+		Extensions: types.Extensions{"x-init": []any{
+			"echo seeded > /data/seed",
+			[]any{"chown", "app", "/data"},
+			map[string]any{"command": "chmod 700 /data", "user": "root"},
+		}},
+	}
+	fd := &fakeDocker{}
+	c := &Cmd{Service: svc, InitCommands: [][]string{{"true"}}, docker: fd}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := c.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	var got []string
+	for _, e := range fd.execCalls {
+		got = append(got, e.User+":"+strings.Join(e.Cmd, " "))
+	}
+	want := []string{
+		":sh -c echo seeded > /data/seed",
+		":chown app /data",
+		"root:sh -c chmod 700 /data",
+		":true",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("exec calls=%q want=%q", got, want)
+	}
+
+	fd = &fakeDocker{execOutput: []byte("permission denied\n"), execExitCodes: []int{0, 3}}
+	c = &Cmd{Service: svc, docker: fd}
+	err := c.Start()
+	var ee *ExitError
+	if !errors.As(err, &ee) || ee.Code != 3 || !strings.Contains(string(ee.Stderr), "denied") {
+		t.Fatalf("err=%v want ExitError(3) with output", err)
+	}
+	if len(fd.execCalls) != 2 || !reflect.DeepEqual(fd.removedIDs, []string{"cid"}) {
+		t.Fatalf("execCalls=%d removedIDs=%v", len(fd.execCalls), fd.removedIDs)
+	}
+
+	svc.Extensions = types.Extensions{"x-init": []any{42}}
+	fd = &fakeDocker{}
+	if err := (&Cmd{Service: svc, docker: fd}).Start(); err == nil {
+		t.Fatalf("expected error for invalid x-init")
+	}
+	if len(fd.createCalls) != 0 {
+		t.Fatalf("container created despite invalid x-init")
+	}
+}
+
+func TestRunGroup(t *testing.T) {
+	newCmd := func(name string, fd *fakeDocker) *Cmd {
+		return &Cmd{Service: types.ServiceConfig{Name: name, Image: "alpine:latest"}, docker: fd}
+	}
+	ctx := context.Background()
+
+	err := RunGroup(ctx,
+		newCmd("ok", &fakeDocker{}),
+		newCmd("bad", &fakeDocker{waitStatus: 3}),
+		newCmd("worse", &fakeDocker{waitStatus: 4}),
+	)
+	var me *MultiError
+	if !errors.As(err, &me) || len(me.Errors) != 2 ||
+		me.Errors[0].Name != "bad" || me.Errors[1].Name != "worse" {
+		t.Fatalf("err=%v want failures of bad and worse", err)
+	}
+	var ee *ExitError
+	if !errors.As(me.Errors[1], &ee) || ee.Code != 4 {
+		t.Fatalf("err=%v want ExitError(4)", me.Errors[1])
+	}
+	if err := RunGroup(ctx, newCmd("a", &fakeDocker{}), newCmd("b", &fakeDocker{})); err != nil {
+		t.Fatalf("RunGroup: %v", err)
+	}
+
+	blocked := &fakeDocker{waitOnStop: make(chan container.WaitResponse, 1)}
+	done := make(chan error, 1)
+	go func() {
+		done <- RunGroupFailFast(ctx,
+			newCmd("server", blocked),
+			newCmd("client", &fakeDocker{waitStatus: 1}),
+		)
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("RunGroupFailFast did not stop the remaining Cmd")
+	}
+	if !errors.As(err, &me) || len(me.Errors) != 1 || me.Errors[0].Name != "client" {
+		t.Fatalf("err=%v want only the client failure", err)
+	}
+	if blocked.stopCalls == 0 {
+		t.Fatalf("server was not stopped")
+	}
+
+	if err := RunGroup(ctx, newCmd("a", &fakeDocker{}), nil); err == nil {
+		t.Fatalf("expected error for nil Cmd")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	newCmd := func(name string, fd *fakeDocker) *Cmd {
+		return &Cmd{Service: types.ServiceConfig{Name: name, Image: "alpine:latest"}, docker: fd}
+	}
+	ctx := context.Background()
+
+	fds := map[string]*fakeDocker{
+		"build": {}, "seed": {}, "lint": {waitStatus: 1}, "test": {}, "report": {},
+	}
+	p := &Pipeline{}
+	p.Add("report", newCmd("report", fds["report"]), "test").
+		Add("build", newCmd("build", fds["build"])).
+		Add("seed", newCmd("seed", fds["seed"]), "build").
+		Add("lint", newCmd("lint", fds["lint"]), "build").
+		Add("test", newCmd("test", fds["test"]), "seed", "lint")
+	err := p.Run(ctx)
+	var me *MultiError
+	if !errors.As(err, &me) || len(me.Errors) != 3 || me.Errors[0].Name != "report" ||
+		me.Errors[1].Name != "lint" || me.Errors[2].Name != "test" {
+		t.Fatalf("err=%v want failures of report, lint and test", err)
+	}
+	var ee *ExitError
+	if !errors.As(me.Errors[1], &ee) || ee.Code != 1 {
+		t.Fatalf("err=%v want ExitError(1)", me.Errors[1])
+	}
+	if !errors.Is(me.Errors[0], ErrDependencyFailed) ||
+		!errors.Is(me.Errors[2], ErrDependencyFailed) {
+		t.Fatalf("err=%v want skipped dependents", err)
+	}
+	for name, want := range map[string]int{"build": 1, "seed": 1, "test": 0, "report": 0} {
+		if got := fds[name].startCalls; got != want {
+			t.Fatalf("%s started %d times, want %d", name, got, want)
+		}
+	}
+
+	blocked := &fakeDocker{waitOnStop: make(chan container.WaitResponse, 1)}
+	after := &fakeDocker{}
+	done := make(chan error, 1)
+	go func() {
+		done <- (&Pipeline{FailFast: true}).
+			Add("server", newCmd("server", blocked)).
+			Add("client", newCmd("client", &fakeDocker{waitStatus: 2})).
+			Add("after", newCmd("after", after), "server").
+			Run(ctx)
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("FailFast pipeline did not stop the remaining steps")
+	}
+	if !errors.As(err, &me) || len(me.Errors) != 1 || me.Errors[0].Name != "client" {
+		t.Fatalf("err=%v want only the client failure", err)
+	}
+	if blocked.stopCalls == 0 || after.startCalls != 0 {
+		t.Fatalf("stops=%d after starts=%d", blocked.stopCalls, after.startCalls)
+	}
+
+	invalid := map[string]*Pipeline{
+		"duplicate": (&Pipeline{}).Add("a", newCmd("a", &fakeDocker{})).
+			Add("a", newCmd("a", &fakeDocker{})),
+		"nil cmd": (&Pipeline{}).Add("a", nil),
+		"unknown": (&Pipeline{}).Add("a", newCmd("a", &fakeDocker{}), "missing"),
+		"cycle": (&Pipeline{}).Add("a", newCmd("a", &fakeDocker{}), "b").
+			Add("b", newCmd("b", &fakeDocker{}), "a"),
+	}
+	for name, p := range invalid {
+		if err := p.Run(ctx); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if err := (&Pipeline{}).Run(ctx); err != nil {
+		t.Fatalf("empty pipeline: %v", err)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	var buf bytes.Buffer
+	SetEventWriter(&buf)
+	t.Cleanup(func() { SetEventWriter(nil) })
+
+	cmd := &Cmd{
+		Service: types.ServiceConfig{Name: "job", Image: "alpine:latest"},
+		docker:  &fakeDocker{waitStatus: 2},
+	}
+	if err := cmd.Run(); err == nil {
+		t.Fatalf("expected exit error")
+	}
+	var events []Event
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		events = append(events, e)
+	}
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Type)
+		if e.Service != "job" || e.Time.IsZero() {
+			t.Fatalf("event=%+v", e)
+		}
+	}
+	want := []string{EventPulled, EventCreated, EventStarted, EventExited, EventFinished}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("events=%v want=%v", got, want)
+	}
+	if events[1].Container != "cid" || events[0].Image != "alpine:latest" {
+		t.Fatalf("created=%+v pulled=%+v", events[1], events[0])
+	}
+	last := events[len(events)-1]
+	if events[3].ExitCode == nil || *events[3].ExitCode != 2 ||
+		last.ExitCode == nil || *last.ExitCode != 2 || last.Error == "" {
+		t.Fatalf("exited=%+v finished=%+v", events[3], last)
+	}
+
+	buf.Reset()
+	failing := &Cmd{Service: types.ServiceConfig{Name: "job"}, docker: &fakeDocker{}}
+	if err := failing.Run(); err == nil {
+		t.Fatalf("expected error without image")
+	}
+	var e Event
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil ||
+		e.Type != EventFinished || e.Error == "" || e.ExitCode != nil {
+		t.Fatalf("event=%+v err=%v (%q)", e, err, buf.String())
+	}
+}
+
+func TestCIGroupWriter(t *testing.T) {
+	var buf bytes.Buffer
+	one := NewCIGroupWriter(&buf, CIFormatGitHubActions, "one")
+	two := NewCIGroupWriter(&buf, CIFormatGitHubActions, "two")
+	_, _ = io.WriteString(one, "a\n")
+	_, _ = io.WriteString(two, "b\n")
+	_, _ = io.WriteString(one, "c")
+	two.Fail("boom\nagain")
+	if err := two.Close(); err != nil {
+		t.Fatalf("close two: %v", err)
+	}
+	if err := one.Close(); err != nil {
+		t.Fatalf("close one: %v", err)
+	}
+	want := "::group::one\na\nc\n::endgroup::\n" +
+		"::group::two\nb\n::endgroup::\n::error title=two::boom%0Aagain\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got=%q want=%q", got, want)
+	}
+	if _, err := io.WriteString(one, "late"); err == nil {
+		t.Fatalf("expected error writing to closed group")
+	}
+
+	buf.Reset()
+	tc := NewCIGroupWriter(&buf, CIFormatTeamCity, "it's [db]")
+	tc.Fail("exit 1")
+	_ = tc.Close()
+	want = "##teamcity[blockOpened name='it|'s |[db|]']\n" +
+		"##teamcity[blockClosed name='it|'s |[db|]']\n" +
+		"##teamcity[buildProblem description='it|'s |[db|]: exit 1']\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got=%q want=%q", got, want)
+	}
+
+	buf.Reset()
+	cmd := &Cmd{
+		Service: types.ServiceConfig{Name: "job", Image: "alpine:latest"},
+		Stdout:  &buf,
+		docker:  &fakeDocker{waitStatus: 3},
+	}
+	cmd.GroupOutput(CIFormatGitHubActions, "")
+	if cmd.Stderr != cmd.Stdout {
+		t.Fatalf("stderr was not grouped")
+	}
+	if err := cmd.Run(); err == nil {
+		t.Fatalf("expected exit error")
+	}
+	got := buf.String()
+	if !strings.HasPrefix(got, "::group::job\n") ||
+		!strings.Contains(got, "::endgroup::\n::error title=job::") {
+		t.Fatalf("output=%q", got)
+	}
+	if len(ciSinks) != 0 {
+		t.Fatalf("sinks were not released: %d", len(ciSinks))
+	}
+}
+
+func TestDecorateWriter(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	var buf bytes.Buffer
+	w := DecorateWriter(&buf, WithColor("db"), WithTimestamps())
+	_, _ = io.WriteString(w, "one\ntw")
+	_, _ = io.WriteString(w, "o\n\nthree")
+	prefix := regexp.QuoteMeta("\x1b["+serviceColor("db")+"mdb | \x1b[0m") +
+		`\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}(Z|[+-]\d\d:\d\d) `
+	re := regexp.MustCompile("^" + prefix + "one\n" + prefix + "two\n" + prefix + "\n" +
+		prefix + "three$")
+	if !re.MatchString(buf.String()) {
+		t.Fatalf("output=%q", buf.String())
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	buf.Reset()
+	_, _ = io.WriteString(DecorateWriter(&buf, WithColor("web")), "a\nb\n")
+	if got, want := buf.String(), "web | a\nweb | b\n"; got != want {
+		t.Fatalf("got=%q want=%q", got, want)
+	}
+}
+
+func TestCmd_IncludeEarlyLogs(t *testing.T) {
+	var frames bytes.Buffer
+	_, _ = stdcopy.NewStdWriter(&frames, stdcopy.Stdout).Write([]byte("done\n"))
+	for _, early := range []bool{false, true} {
+		fd := &fakeDocker{attachOutput: frames.Bytes()}
+		cmd := &Cmd{
+			Service:          types.ServiceConfig{Name: "fast", Image: "alpine:latest"},
+			Args:             []string{"echo", "done"},
+			IncludeEarlyLogs: early,
+			docker:           fd,
+		}
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("early=%v: Output: %v", early, err)
+		}
+		// The container exits as soon as it starts; its output must still arrive once.
+		if string(out) != "done\n" {
+			t.Fatalf("early=%v: out=%q", early, out)
+		}
+		if len(fd.attachOpts) != 1 || fd.attachOpts[0].Logs != early ||
+			!fd.attachOpts[0].Stream {
+			t.Fatalf("early=%v: attach=%+v", early, fd.attachOpts)
+		}
+	}
+}
+
+// blockingWriter blocks every Write until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.buf.Write(p)
+}
+
+func TestCmd_OutputBuffer(t *testing.T) {
+	defer func(d time.Duration) { outputDrainTimeout = d }(outputDrainTimeout)
+	outputDrainTimeout = 100 * time.Millisecond
+
+	var frames bytes.Buffer
+	for i := range 100 {
+		w := stdcopy.NewStdWriter(&frames, stdcopy.Stdout)
+		_, _ = fmt.Fprintf(w, "line-%02d\n", i)
+	}
+
+	t.Run("drop oldest with a stuck writer", func(t *testing.T) {
+		stuck := &blockingWriter{release: make(chan struct{})}
+		defer close(stuck.release)
+		var drops atomic.Int64
+		cmd := &Cmd{
+			Service:      types.ServiceConfig{Name: "noisy", Image: "alpine:latest"},
+			Stdout:       stuck,
+			OutputBuffer: 64,
+			OnOutputDropped: func(d OutputDrop) {
+				if d.Stream == "stdout" {
+					drops.Add(int64(d.Bytes))
+				}
+			},
+			docker: &fakeDocker{attachOutput: frames.Bytes()},
+		}
+		done := make(chan error, 1)
+		go func() { done <- cmd.Run() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Run is wedged by a stuck writer")
+		}
+		// 800 bytes of output: one write of at most 64 bytes is in flight and
+		// everything else was dropped.
+		if n := cmd.DroppedOutput(); n < 800-64 || n >= 800 || n != drops.Load() {
+			t.Fatalf("DroppedOutput=%d callback=%d", n, drops.Load())
+		}
+	})
+
+	t.Run("block delivers everything", func(t *testing.T) {
+		slow := &blockingWriter{release: make(chan struct{})}
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			close(slow.release)
+		}()
+		cmd := &Cmd{
+			Service:        types.ServiceConfig{Name: "noisy", Image: "alpine:latest"},
+			Stdout:         slow,
+			OutputBuffer:   16,
+			OutputOverflow: OverflowBlock,
+			docker:         &fakeDocker{attachOutput: frames.Bytes()},
+		}
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if cmd.DroppedOutput() != 0 || !strings.HasSuffix(slow.buf.String(), "line-99\n") ||
+			strings.Count(slow.buf.String(), "\n") != 100 {
+			t.Fatalf("dropped=%d out=%q", cmd.DroppedOutput(), slow.buf.String())
+		}
+	})
+}
+
+func TestCmd_StopOnWriteError(t *testing.T) {
+	var frames bytes.Buffer
+	_, _ = stdcopy.NewStdWriter(&frames, stdcopy.Stderr).Write([]byte("boom\n"))
+	errFull := errors.New("disk full")
+	for _, stop := range []bool{false, true} {
+		fd := &fakeDocker{attachOutput: frames.Bytes()}
+		if stop {
+			fd.waitOnStop = make(chan container.WaitResponse, 1)
+		}
+		cmd := &Cmd{
+			Service:          types.ServiceConfig{Name: "app", Image: "alpine:latest"},
+			Stderr:           errWriter{errFull},
+			StopOnWriteError: stop,
+			docker:           fd,
+		}
+		err := cmd.Run()
+		var we *WriteError
+		if !errors.As(err, &we) || we.Stream != "stderr" || !errors.Is(err, errFull) {
+			t.Fatalf("stop=%v: err=%v want *WriteError for stderr", stop, err)
+		}
+		var ee *ExitError
+		if errors.As(err, &ee) {
+			t.Fatalf("stop=%v: err=%v must not be an exit error", stop, err)
+		}
+		if want := map[bool]int{false: 0, true: 1}[stop]; fd.stopCalls != want {
+			t.Fatalf("stop=%v: stopCalls=%d want %d", stop, fd.stopCalls, want)
+		}
+	}
+}
+
+type errWriter struct{ err error }
+
+func (w errWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestCmd_LogFile(t *testing.T) {
+	var frames bytes.Buffer
+	for i := range 30 {
+		w := stdcopy.NewStdWriter(&frames, stdcopy.Stdout)
+		_, _ = fmt.Fprintf(w, "line-%02d\n", i)
+	}
+	path := filepath.Join(t.TempDir(), "soak.log")
+	var stdout bytes.Buffer
+	cmd := &Cmd{
+		Service: types.ServiceConfig{Name: "soak", Image: "alpine:latest"},
+		Args:    []string{"run", "forever"},
+		Stdout:  &stdout,
+		docker:  &fakeDocker{attachOutput: frames.Bytes()},
+	}
+	if err := cmd.LogFile(path, 200, 2); err != nil {
+		t.Fatalf("LogFile: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.HasSuffix(stdout.String(), "line-29\n") {
+		t.Fatalf("stdout=%q", stdout.String())
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Fatalf("expected at most 2 files, stat err=%v", err)
+	}
+	var all string
+	for _, name := range []string{path + ".1", path} {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if len(b) > 200 {
+			t.Fatalf("%s has %d bytes", name, len(b))
+		}
+		header, body, _ := strings.Cut(string(b), "\n")
+		if !strings.HasPrefix(header, "# compose-exec log:") ||
+			!strings.Contains(header, `service="soak" container="cid" command="run forever"`) {
+			t.Fatalf("header=%q", header)
+		}
+		all += body
+	}
+	if !strings.HasSuffix(all, "line-28\nline-29\n") || strings.Contains(all, "line-00") {
+		t.Fatalf("rotated output=%q", all)
+	}
+
+	if err := (&Cmd{}).LogFile(path, 0, 1); err == nil {
+		t.Fatalf("expected error for zero max size")
+	}
+	if err := (&Cmd{}).LogFile(path, 10, 0); err == nil {
+		t.Fatalf("expected error for zero max files")
+	}
+}
+
+func TestJSONLineDemuxer(t *testing.T) {
+	var out bytes.Buffer
+	d := NewJSONLineDemuxer(&out, 2)
+	input := `{"level":"error","msg":"boom","time":"2024-05-01T10:00:00Z","db":"main"}` + "\n" +
+		"plain text\n" +
+		`{"severity":"info","message":"hi","ts":1714557600.5}` + "\n" +
+		`{"lvl":"warn","msg":"dropped"}` + "\n" +
+		`{"msg":"tail"}`
+	for _, chunk := range []string{input[:10], input[10:]} {
+		if _, err := io.WriteString(d, chunk); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if out.String() != input {
+		t.Fatalf("passthrough=%q", out.String())
+	}
+	if d.Dropped() != 1 {
+		t.Fatalf("dropped=%d want 1", d.Dropped())
+	}
+	first := <-d.Records()
+	if first.Level != "ERROR" || first.Msg != "boom" ||
+		!first.Time.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) ||
+		!reflect.DeepEqual(first.Fields, map[string]any{"db": "main"}) {
+		t.Fatalf("first=%+v", first)
+	}
+	second := <-d.Records()
+	if second.Level != "INFO" || second.Msg != "hi" ||
+		!second.Time.Equal(time.Unix(1714557600, 5e8)) || len(second.Fields) != 0 {
+		t.Fatalf("second=%+v", second)
+	}
+	_ = d.Close()
+	var rest []string
+	for rec := range d.Records() {
+		rest = append(rest, rec.Msg)
+	}
+	if !reflect.DeepEqual(rest, []string{"tail"}) {
+		t.Fatalf("records after close=%v", rest)
+	}
+
+	for line, want := range map[string]string{
+		`{"level":50,"msg":"bunyan"}`: "ERROR",
+		`{"level":60,"msg":"pino"}`:   "FATAL",
+		`{"level":35,"msg":"custom"}`: "INFO",
+		`{"level":10,"msg":"trace"}`:  "TRACE",
+	} {
+		rec, ok := parseLogRecord([]byte(line))
+		if !ok || rec.Level != want || len(rec.Fields) != 0 {
+			t.Fatalf("%s: level=%q fields=%v want=%q", line, rec.Level, rec.Fields, want)
+		}
+	}
+}
+
+func TestNetemSpecAndContainers(t *testing.T) {
+	spec := netemSpec{delay: 200 * time.Millisecond, jitter: time.Millisecond, loss: 1.5}
+	args, err := spec.args()
+	if err != nil {
+		t.Fatalf("args: %v", err)
+	}
+	if want := "delay 200000us 1000us loss 1.5%"; args != want {
+		t.Fatalf("args=%q want=%q", args, want)
+	}
+	if _, err := (netemSpec{loss: 101}).args(); err == nil {
+		t.Fatalf("expected error for loss > 100")
+	}
+	want := `tc qdisc replace dev "$i" root netem ` + args
+	if s := netemScript("replace", args); !strings.Contains(s, want) {
+		t.Fatalf("script=%q", s)
+	}
+
+	proj := &Project{Name: "proj", Services: types.Services{"db": {Name: "db"}}}
+	fd := &fakeDocker{containerListResp: []container.Summary{{ID: "c1"}, {ID: "c2"}}}
+	ids, err := proj.runningContainers(context.Background(), fd, "db")
+	if err != nil || !reflect.DeepEqual(ids, []string{"c1", "c2"}) {
+		t.Fatalf("ids=%v err=%v", ids, err)
+	}
+	if _, err := proj.runningContainers(context.Background(), &fakeDocker{}, "db"); err == nil {
+		t.Fatalf("expected error without running containers")
+	}
+	if _, err := proj.runningContainers(context.Background(), fd, "missing"); err == nil {
+		t.Fatalf("expected error for unknown service")
+	}
+}
+
+func TestStopAndKill_CallsDocker(t *testing.T) {
+	fd := &fakeDocker{}
+	_ = stopAndKill(context.Background(), fd, "cid", 2*time.Second)
+	if fd.stopCalls != 1 {
+		t.Fatalf("stopCalls=%d", fd.stopCalls)
+	}
+	if fd.killCalls != 0 {
+		t.Fatalf("killCalls=%d", fd.killCalls)
+	}
+}
+
+func TestStopAndKill_KillsOnStopError(t *testing.T) {
+	fd := &fakeDocker{stopErr: true}
+	_ = stopAndKill(context.Background(), fd, "cid", 2*time.Second)
+	if fd.stopCalls != 1 {
+		t.Fatalf("stopCalls=%d", fd.stopCalls)
+	}
+	if fd.killCalls != 1 {
+		t.Fatalf("killCalls=%d", fd.killCalls)
+	}
+}
+
+func TestCmd_resolveCommand_FallbackOnlyWhenArgsEmpty(t *testing.T) {
+	svc := types.ServiceConfig{Command: types.ShellCommand{"echo", "from-yaml"}}
+
+	t.Run("nil args falls back", func(t *testing.T) {
+		c := &Cmd{Service: svc}
+		c.resolveCommand()
+		want := []string{"echo", "from-yaml"}
+		if !reflect.DeepEqual(c.Args, want) {
+			t.Fatalf("Args=%v want=%v", c.Args, want)
+		}
+	})
+
+	t.Run("empty slice falls back", func(t *testing.T) {
+		c := &Cmd{Service: svc, Args: []string{}}
+		c.resolveCommand()
+		want := []string{"echo", "from-yaml"}
+		if !reflect.DeepEqual(c.Args, want) {
+			t.Fatalf("Args=%v want=%v", c.Args, want)
 		}
 	})
 
@@ -701,281 +2361,2453 @@ func TestCmd_resolveCommand_FallbackOnlyWhenArgsEmpty(t *testing.T) {
 		}
 	})
 
-	t.Run("empty-string arg is not treated as default", func(t *testing.T) {
-		c := &Cmd{Service: svc, Args: []string{""}}
-		c.resolveCommand()
-		want := []string{""}
-		if !reflect.DeepEqual(c.Args, want) {
-			t.Fatalf("Args=%v want=%v", c.Args, want)
+	t.Run("empty-string arg is not treated as default", func(t *testing.T) {
+		c := &Cmd{Service: svc, Args: []string{""}}
+		c.resolveCommand()
+		want := []string{""}
+		if !reflect.DeepEqual(c.Args, want) {
+			t.Fatalf("Args=%v want=%v", c.Args, want)
+		}
+	})
+}
+
+func TestWaitForExit_ClosedErrChStillWaitsForResp(t *testing.T) {
+	respCh := make(chan container.WaitResponse)
+	errCh := make(chan error)
+	close(errCh)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		respCh <- container.WaitResponse{StatusCode: 0}
+	}()
+
+	start := time.Now()
+	_, err := waitForExit(context.Background(), context.Background(), nil, "cid", respCh, errCh)
+	if err != nil {
+		t.Fatalf("waitForExit: %v", err)
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Fatalf("waitForExit returned before respCh was ready")
+	}
+}
+
+func TestCmd_Wait_FailurePathsReleaseIOAndRemoveOnce(t *testing.T) {
+	run := func(t *testing.T, fd *fakeDocker, cancelAfterStart bool) error {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		c := &Cmd{
+			Service: types.ServiceConfig{Name: "svc", Image: "alpine:latest"},
+			docker:  fd,
+			ctx:     ctx,
+		}
+		out, err := c.StdoutPipe()
+		if err != nil {
+			t.Fatalf("StdoutPipe: %v", err)
+		}
+		in, err := c.StdinPipe()
+		if err != nil {
+			t.Fatalf("StdinPipe: %v", err)
+		}
+		if err := c.Start(); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		if cancelAfterStart {
+			cancel()
+		}
+
+		readDone := make(chan struct{})
+		go func() {
+			defer close(readDone)
+			_, _ = io.Copy(io.Discard, out)
+		}()
+		waitErr := c.Wait()
+		select {
+		case <-readDone:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("stdout pipe still open after Wait")
+		}
+		if _, err := in.Write([]byte("x")); err == nil {
+			t.Fatalf("stdin pipe still open after Wait")
+		}
+		if !reflect.DeepEqual(fd.removedIDs, []string{"cid"}) {
+			t.Fatalf("removedIDs=%v want=[cid]", fd.removedIDs)
+		}
+		return waitErr
+	}
+
+	t.Run("wait error", func(t *testing.T) {
+		conn, peer := net.Pipe()
+		defer peer.Close()
+		fd := &fakeDocker{
+			waitErr:    cerrdefs.ErrUnavailable.WithMessage("connection reset"),
+			attachConn: conn,
+		}
+		err := run(t, fd, false)
+		var ee *EngineError
+		if !errors.As(err, &ee) || ee.Category != CategoryUnavailable {
+			t.Fatalf("err=%v want EngineError(unavailable)", err)
+		}
+	})
+
+	t.Run("context canceled while draining output", func(t *testing.T) {
+		conn, peer := net.Pipe()
+		defer peer.Close()
+		fd := &fakeDocker{attachConn: conn}
+		if err := run(t, fd, true); !errors.Is(err, context.Canceled) {
+			t.Fatalf("err=%v want context.Canceled", err)
+		}
+	})
+
+	t.Run("output error", func(t *testing.T) {
+		// Not a valid stdcopy frame header.
+		fd := &fakeDocker{attachOutput: []byte{9, 0, 0, 0, 0, 0, 0, 1, 'x'}}
+		if err := run(t, fd, false); err == nil {
+			t.Fatalf("expected output error")
+		}
+	})
+}
+
+func TestCmd_StdcopyTTYOutputIsRaw(t *testing.T) {
+	// A TTY container's attach stream carries no stdcopy headers.
+	raw := "ready\r\n$ "
+	run := func(t *testing.T, tty bool, output []byte) (string, *fakeDocker) {
+		t.Helper()
+		var out bytes.Buffer
+		fd := &fakeDocker{attachOutput: output}
+		c := &Cmd{
+			Service: types.ServiceConfig{Name: "svc", Image: "alpine:latest", Tty: tty},
+			Stdout:  &out,
+			docker:  fd,
+		}
+		if err := c.Start(); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		_ = c.Wait()
+		return out.String(), fd
+	}
+
+	out, fd := run(t, true, []byte(raw))
+	if out != raw {
+		t.Fatalf("stdout=%q want raw %q", out, raw)
+	}
+	if len(fd.createCalls) != 1 || !fd.createCalls[0].config.Tty {
+		t.Fatalf("container created without Tty: %+v", fd.createCalls)
+	}
+
+	// Without a TTY the stream is demultiplexed, so no header bytes leak.
+	var framed bytes.Buffer
+	_, _ = stdcopy.NewStdWriter(&framed, stdcopy.Stdout).Write([]byte("plain\n"))
+	if out, _ := run(t, false, framed.Bytes()); out != "plain\n" {
+		t.Fatalf("stdout=%q want demultiplexed output", out)
+	}
+}
+
+func TestCmd_MutateCreateConfig(t *testing.T) {
+	var out bytes.Buffer
+	fd := &fakeDocker{attachOutput: []byte("raw tty output\r\n")}
+	c := &Cmd{
+		Service: types.ServiceConfig{Name: "svc", Image: "alpine:latest", NetworkMode: "none"},
+		Stdout:  &out,
+		docker:  fd,
+		MutateCreateConfig: func(
+			cfg *container.Config,
+			hostCfg *container.HostConfig,
+			netCfg *network.NetworkingConfig,
+		) {
+			cfg.Tty = true
+			hostCfg.Sysctls = map[string]string{"net.core.somaxconn": "1024"}
+			netCfg.EndpointsConfig = map[string]*network.EndpointSettings{"extra": {}}
+		},
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	_ = c.Wait()
+	if len(fd.createCalls) != 1 {
+		t.Fatalf("createCalls=%d", len(fd.createCalls))
+	}
+	call := fd.createCalls[0]
+	if !call.config.Tty || call.hostConfig.Sysctls["net.core.somaxconn"] != "1024" {
+		t.Fatalf("hook changes lost: config=%+v hostConfig=%+v", call.config, call.hostConfig)
+	}
+	if call.networking == nil || call.networking.EndpointsConfig["extra"] == nil {
+		t.Fatalf("networking=%+v", call.networking)
+	}
+	if out.String() != "raw tty output\r\n" {
+		t.Fatalf("stdout=%q; Tty set by the hook must switch to raw output", out.String())
+	}
+	if !strings.Contains(c.DebugString(), "create config hook") {
+		t.Fatalf("DebugString does not mention the hook:\n%s", c.DebugString())
+	}
+}
+
+func TestCmd_KeepAliveResumesOutputFromLogs(t *testing.T) {
+	frame := func(s string) []byte {
+		var b bytes.Buffer
+		_, _ = stdcopy.NewStdWriter(&b, stdcopy.Stdout).Write([]byte(s))
+		return b.Bytes()
+	}
+	running := container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{
+		State: &container.State{Running: true},
+	}}
+	run := func(t *testing.T, fd *fakeDocker) (string, error) {
+		t.Helper()
+		var out bytes.Buffer
+		c := &Cmd{
+			Service:   types.ServiceConfig{Name: "svc", Image: "alpine:latest"},
+			KeepAlive: 10 * time.Millisecond,
+			Stdout:    &out,
+			docker:    fd,
+		}
+		if err := c.Start(); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		err := c.Wait()
+		return out.String(), err
+	}
+
+	t.Run("stream error while running", func(t *testing.T) {
+		fd := &fakeDocker{
+			attachConn: &fakeConn{r: io.MultiReader(
+				bytes.NewReader(frame("before\n")),
+				iotest.ErrReader(net.ErrClosed),
+			)},
+			inspectResp: running,
+			logsOutput:  frame("after\n"),
+		}
+		out, err := run(t, fd)
+		if err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+		if out != "before\nafter\n" {
+			t.Fatalf("stdout=%q", out)
+		}
+		if len(fd.logsCalls) != 1 || !fd.logsCalls[0].Follow || fd.logsCalls[0].Since == "" {
+			t.Fatalf("logsCalls=%+v want one follow from the last read", fd.logsCalls)
+		}
+	})
+
+	t.Run("repeated breaks resync without duplicates", func(t *testing.T) {
+		entry := func(sec int, s string) string {
+			return time.Date(2026, 1, 2, 3, 4, sec, 0, time.UTC).Format(time.RFC3339Nano) +
+				" " + s
+		}
+		var first, second bytes.Buffer
+		w := stdcopy.NewStdWriter(&first, stdcopy.Stdout)
+		_, _ = w.Write([]byte(entry(1, "a\n")))
+		_, _ = w.Write([]byte(entry(2, "b\n")))
+		w = stdcopy.NewStdWriter(&second, stdcopy.Stdout)
+		_, _ = w.Write([]byte(entry(2, "b\n")))
+		_, _ = w.Write([]byte(entry(3, "c\n")))
+		fd := &fakeDocker{
+			attachConn:  &fakeConn{r: iotest.ErrReader(net.ErrClosed)},
+			inspectResp: running,
+			logsStreams: []io.Reader{
+				io.MultiReader(&first, iotest.ErrReader(io.ErrUnexpectedEOF)),
+				&second,
+			},
+		}
+		var gaps []OutputGap
+		var out bytes.Buffer
+		c := &Cmd{
+			Service:   types.ServiceConfig{Name: "svc", Image: "alpine:latest"},
+			KeepAlive: time.Hour,
+			Stdout:    &out,
+			docker:    fd,
+			OnOutputGap: func(g OutputGap) {
+				gaps = append(gaps, g)
+				_, _ = out.WriteString("--- resumed ---\n")
+			},
+		}
+		if err := c.Start(); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		if err := c.Wait(); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+		want := "--- resumed ---\na\nb\n--- resumed ---\nc\n"
+		if out.String() != want {
+			t.Fatalf("stdout=%q want=%q", out.String(), want)
+		}
+		if len(fd.logsCalls) != 2 || !fd.logsCalls[0].Timestamps ||
+			fd.logsCalls[1].Since != "1767323042.000000000" {
+			t.Fatalf("logsCalls=%+v", fd.logsCalls)
+		}
+		if len(gaps) != 2 || !errors.Is(gaps[0].Err, net.ErrClosed) ||
+			!errors.Is(gaps[1].Err, io.ErrUnexpectedEOF) {
+			t.Fatalf("gaps=%+v", gaps)
+		}
+	})
+
+	t.Run("stale connection after ping recovery", func(t *testing.T) {
+		conn, peer := net.Pipe()
+		defer peer.Close()
+		fd := &fakeDocker{
+			attachConn:   conn,
+			inspectResp:  running,
+			logsOutput:   frame("resumed\n"),
+			pingFailures: 2,
+		}
+		out, err := run(t, fd)
+		if err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+		if out != "resumed\n" || fd.pings.Load() < 3 {
+			t.Fatalf("stdout=%q pings=%d", out, fd.pings.Load())
+		}
+	})
+
+	t.Run("resume corrects clock skew and drops replayed output", func(t *testing.T) {
+		daemonNow := time.Now().Add(time.Hour)
+		var logs bytes.Buffer
+		w := stdcopy.NewStdWriter(&logs, stdcopy.Stdout)
+		for i, line := range []string{"a\n", "b\n", "c\n"} {
+			ts := daemonNow.Add(time.Duration(i) * time.Millisecond).Format(time.RFC3339Nano)
+			_, _ = w.Write([]byte(ts + " " + line))
+		}
+		fd := &fakeDocker{
+			// The attach stream broke in the middle of "b\n".
+			attachConn: &fakeConn{r: io.MultiReader(
+				bytes.NewReader(frame("a\nb")),
+				iotest.ErrReader(net.ErrClosed),
+			)},
+			inspectResp: running,
+			infoResp:    system.Info{SystemTime: daemonNow.Format(time.RFC3339Nano)},
+			logsOutput:  logs.Bytes(),
+		}
+		out, err := run(t, fd)
+		if err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+		if out != "a\nb\nc\n" {
+			t.Fatalf("stdout=%q want each line once", out)
+		}
+		sec, err := strconv.ParseFloat(fd.logsCalls[0].Since, 64)
+		if err != nil {
+			t.Fatalf("Since=%q: %v", fd.logsCalls[0].Since, err)
+		}
+		since := time.Unix(0, int64(sec*float64(time.Second)))
+		if d := daemonNow.Sub(since); d < resumeMargin || d > resumeMargin+time.Minute {
+			t.Fatalf("since=%v is %v before the daemon's now, want about %v",
+				since, d, resumeMargin)
+		}
+	})
+
+	t.Run("active stream is not broken after ping recovery", func(t *testing.T) {
+		c := &Cmd{}
+		if !c.attachIdleSince(time.Now()) {
+			t.Fatalf("no attach stream must count as idle")
+		}
+		c.outputActivity = newActivityReader(strings.NewReader("output"))
+		lostAt := time.Now()
+		if !c.attachIdleSince(lostAt) {
+			t.Fatalf("stream without reads since the outage must count as idle")
+		}
+		time.Sleep(time.Millisecond)
+		if _, err := c.outputActivity.Read(make([]byte, 8)); err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		if c.attachIdleSince(lostAt) {
+			t.Fatalf("stream that delivered output during the outage must not be broken")
+		}
+	})
+
+	t.Run("container not running keeps the stream error", func(t *testing.T) {
+		fd := &fakeDocker{
+			attachConn: &fakeConn{r: iotest.ErrReader(net.ErrClosed)},
+			inspectResp: container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{State: &container.State{}},
+			},
+		}
+		if _, err := run(t, fd); !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("err=%v want net.ErrClosed", err)
+		}
+		if len(fd.logsCalls) != 0 {
+			t.Fatalf("unexpected logs follow: %+v", fd.logsCalls)
+		}
+	})
+}
+
+func TestCmd_WaitUntilHealthy_HealthcheckNotExecutable(t *testing.T) {
+	noShell := &container.HealthcheckResult{
+		ExitCode: -1,
+		Output: "OCI runtime exec failed: exec failed: unable to start container process: " +
+			`exec: "/bin/sh": stat /bin/sh: no such file or directory: unknown`,
+	}
+	failing := &container.HealthcheckResult{ExitCode: 1, Output: "connection refused"}
+	run := func(log ...*container.HealthcheckResult) error {
+		fd := &fakeDocker{inspectResp: container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{State: &container.State{
+				Running: true,
+				Health:  &container.Health{Status: "starting", Log: log},
+			}},
+			Config: &container.Config{Healthcheck: &container.HealthConfig{
+				Test: []string{"CMD-SHELL", "curl -f localhost"},
+			}},
+		}}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		c := &Cmd{
+			Service: types.ServiceConfig{
+				Name:        "svc",
+				Image:       "distroless",
+				HealthCheck: &types.HealthCheckConfig{Test: []string{"CMD-SHELL", "true"}},
+			},
+			ctx:         ctx,
+			docker:      fd,
+			started:     true,
+			containerID: "cid",
+			waitRespCh:  make(chan container.WaitResponse),
+		}
+		return c.WaitUntilHealthy()
+	}
+
+	err := run(noShell, noShell, noShell)
+	if !errors.Is(err, ErrHealthcheckNotExecutable) ||
+		!strings.Contains(err.Error(), "no /bin/sh") {
+		t.Fatalf("err=%v want ErrHealthcheckNotExecutable", err)
+	}
+	if err := run(failing, noShell, noShell); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err=%v want to keep waiting before the threshold", err)
+	}
+	if err := run(noShell, noShell, noShell, failing); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err=%v want to keep waiting once the check runs", err)
+	}
+}
+
+func TestCmd_WaitUntilHealthy_StopsOnSignalContext(t *testing.T) {
+	fd := &fakeDocker{
+		inspectResp: container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{
+				State: &container.State{
+					Running: true,
+					Health: &container.Health{
+						Status: "starting",
+					},
+				},
+			},
+		},
+	}
+
+	ctx, cancelCtx := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelCtx()
+	sigCtx, cancelSig := context.WithCancel(context.Background())
+	defer cancelSig()
+
+	c := &Cmd{
+		Service: types.ServiceConfig{
+			Name:  "svc",
+			Image: "alpine:latest",
+			HealthCheck: &types.HealthCheckConfig{
+				Test: []string{"CMD", "true"},
+			},
+		},
+		ctx:         ctx,
+		docker:      fd,
+		started:     true,
+		containerID: "cid",
+		waitRespCh:  make(chan container.WaitResponse),
+		signalCtx:   sigCtx,
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancelSig()
+	}()
+
+	start := time.Now()
+	err := c.WaitUntilHealthy()
+	elapsed := time.Since(start)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v want=%v", err, context.Canceled)
+	}
+	if elapsed > 1200*time.Millisecond {
+		t.Fatalf("WaitUntilHealthy did not stop quickly on signal context: %v", elapsed)
+	}
+}
+
+func TestContainerConfigs_AddsComposeLabels(t *testing.T) {
+	svc := types.ServiceConfig{Name: "svc", Image: "alpine:latest"}
+	proj := &Project{Name: "proj", Services: types.Services{"svc": svc}}
+	s, err := proj.Service("svc")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+
+	c := &Cmd{Service: s.config, service: s}
+	cfg, _, err := c.containerConfigs(nil)
+	if err != nil {
+		t.Fatalf("containerConfigs: %v", err)
+	}
+	if cfg.Labels == nil {
+		t.Fatalf("labels nil")
+	}
+	if cfg.Labels["com.docker.compose.project"] != "proj" {
+		t.Fatalf("project label=%q", cfg.Labels["com.docker.compose.project"])
+	}
+	if cfg.Labels["com.docker.compose.service"] != "svc" {
+		t.Fatalf("service label=%q", cfg.Labels["com.docker.compose.service"])
+	}
+}
+
+func TestContainerConfigs_WorkingDirOverride(t *testing.T) {
+	svc := types.ServiceConfig{
+		Image:      "alpine:latest",
+		WorkingDir: "/service",
+	}
+	c := &Cmd{
+		Service:    svc,
+		WorkingDir: "/override",
+	}
+	cfg, _, err := c.containerConfigs(nil)
+	if err != nil {
+		t.Fatalf("containerConfigs: %v", err)
+	}
+	if cfg.WorkingDir != "/override" {
+		t.Fatalf("WorkingDir=%q want=%q", cfg.WorkingDir, "/override")
+	}
+}
+
+func TestContainerConfigs_ReadOnlyRootfs(t *testing.T) {
+	svc := types.ServiceConfig{
+		Image:    "alpine:latest",
+		ReadOnly: true,
+	}
+	c := &Cmd{Service: svc}
+
+	_, hostCfg, err := c.containerConfigs(nil)
+	if err != nil {
+		t.Fatalf("containerConfigs: %v", err)
+	}
+	if !hostCfg.ReadonlyRootfs {
+		t.Fatalf("ReadonlyRootfs=false want=true")
+	}
+}
+
+func TestContainerConfigs_TmpfsMapping(t *testing.T) {
+	svc := types.ServiceConfig{
+		Image: "alpine:latest",
+		Tmpfs: types.StringList{
+			"/run:size=64m,mode=1777,noexec",
+			"/cache",
+		},
+	}
+	c := &Cmd{Service: svc}
+
+	_, hostCfg, err := c.containerConfigs(nil)
+	if err != nil {
+		t.Fatalf("containerConfigs: %v", err)
+	}
+	want := map[string]string{
+		"/run":   "size=64m,mode=1777,noexec",
+		"/cache": "",
+	}
+	if !reflect.DeepEqual(hostCfg.Tmpfs, want) {
+		t.Fatalf("Tmpfs=%v want=%v", hostCfg.Tmpfs, want)
+	}
+}
+
+func TestContainerConfigs_MapsAdditionalHostOptions(t *testing.T) {
+	svc := types.ServiceConfig{
+		Image:       "alpine:latest",
+		SecurityOpt: []string{"no-new-privileges:true", "label=disable"},
+		ShmSize:     types.UnitBytes(128 * 1024 * 1024),
+		ExtraHosts: types.HostsList{
+			"example.local": []string{"127.0.0.1"},
+			"api.local":     []string{"10.0.0.10", "10.0.0.11"},
+		},
+		Devices: []types.DeviceMapping{
+			{
+				Source:      "/dev/null",
+				Target:      "/dev/xnull",
+				Permissions: "r",
+			},
+			{
+				Source: "/dev/zero",
+			},
+		},
+		CPUS:      1.5,
+		CPUShares: 512,
+		CPUSet:    "0,2",
+	}
+	c := &Cmd{Service: svc}
+
+	_, hostCfg, err := c.containerConfigs(nil)
+	if err != nil {
+		t.Fatalf("containerConfigs: %v", err)
+	}
+
+	if !reflect.DeepEqual(hostCfg.SecurityOpt, svc.SecurityOpt) {
+		t.Fatalf("SecurityOpt=%v want=%v", hostCfg.SecurityOpt, svc.SecurityOpt)
+	}
+	if hostCfg.ShmSize != int64(svc.ShmSize) {
+		t.Fatalf("ShmSize=%d want=%d", hostCfg.ShmSize, int64(svc.ShmSize))
+	}
+
+	wantHosts := svc.ExtraHosts.AsList(":")
+	if !sameStringMultiset(hostCfg.ExtraHosts, wantHosts) {
+		t.Fatalf("ExtraHosts=%v want(as set)=%v", hostCfg.ExtraHosts, wantHosts)
+	}
+
+	wantDevices := []container.DeviceMapping{
+		{
+			PathOnHost:        "/dev/null",
+			PathInContainer:   "/dev/xnull",
+			CgroupPermissions: "r",
+		},
+		{
+			PathOnHost:        "/dev/zero",
+			PathInContainer:   "/dev/zero",
+			CgroupPermissions: "rwm",
+		},
+	}
+	if !reflect.DeepEqual(hostCfg.Devices, wantDevices) {
+		t.Fatalf("Devices=%v want=%v", hostCfg.Devices, wantDevices)
+	}
+
+	if hostCfg.NanoCPUs != 1_500_000_000 {
+		t.Fatalf("NanoCPUs=%d want=%d", hostCfg.NanoCPUs, int64(1_500_000_000))
+	}
+	if hostCfg.CPUShares != 512 {
+		t.Fatalf("CPUShares=%d want=%d", hostCfg.CPUShares, int64(512))
+	}
+	if hostCfg.CpusetCpus != "0,2" {
+		t.Fatalf("CpusetCpus=%q want=%q", hostCfg.CpusetCpus, "0,2")
+	}
+}
+
+func TestContainerConfigs_ExtraHosts(t *testing.T) {
+	c := &Cmd{
+		Service: types.ServiceConfig{
+			Name:  "svc",
+			Image: "alpine:latest",
+			ExtraHosts: types.HostsList{
+				"api.local": {"10.0.0.10"},
+				"db.local":  {"10.0.0.11"},
+			},
+		},
+		ExtraHosts: []string{"db.local=127.0.0.1", "host.docker.internal:host-gateway"},
+	}
+	_, hostCfg, err := c.containerConfigs(nil)
+	if err != nil {
+		t.Fatalf("containerConfigs: %v", err)
+	}
+	want := []string{
+		"api.local:10.0.0.10",
+		"db.local:127.0.0.1",
+		"host.docker.internal:host-gateway",
+	}
+	if !sameStringMultiset(hostCfg.ExtraHosts, want) {
+		t.Fatalf("ExtraHosts=%v want(as set)=%v", hostCfg.ExtraHosts, want)
+	}
+
+	ctx := context.Background()
+	bridge := network.Summary{Name: "bridge", IPAM: network.IPAM{
+		Config: []network.IPAMConfig{{Subnet: "172.17.0.0/16", Gateway: "172.17.0.1"}},
+	}}
+	fd := &fakeDocker{apiVersion: "1.41", networkListResp: []network.Summary{bridge}}
+	got, err := resolveHostGateway(ctx, fd, want)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("got=%v err=%v want host-gateway passed to the daemon", got, err)
+	}
+	fd.apiVersion = "1.40"
+	got, err = resolveHostGateway(ctx, fd, want)
+	if err != nil || got[2] != "host.docker.internal:172.17.0.1" || got[0] != want[0] {
+		t.Fatalf("got=%v err=%v want host-gateway resolved to the bridge gateway", got, err)
+	}
+
+	c.ExtraHosts = []string{"no-address"}
+	if err := c.validate(); err == nil || !strings.Contains(err.Error(), "no-address") {
+		t.Fatalf("validate=%v want invalid extra host", err)
+	}
+}
+
+func TestResolveExtraHosts_HostDockerInternal(t *testing.T) {
+	ctx := context.Background()
+	linux := system.Info{OSType: "linux", OperatingSystem: "Ubuntu 24.04 LTS"}
+	desktop := system.Info{OSType: "linux", OperatingSystem: "Docker Desktop"}
+	resolve := func(info system.Info, hosts ...string) []string {
+		t.Helper()
+		hostCfg := &container.HostConfig{ExtraHosts: hosts}
+		fd := &fakeDocker{apiVersion: "1.47", infoResp: info}
+		if err := resolveExtraHosts(ctx, fd, hostCfg); err != nil {
+			t.Fatalf("resolveExtraHosts: %v", err)
+		}
+		return hostCfg.ExtraHosts
+	}
+
+	if got := resolve(linux); len(got) != 0 {
+		t.Fatalf("ExtraHosts=%v want none while disabled", got)
+	}
+	SetHostDockerInternal(true)
+	defer SetHostDockerInternal(false)
+	want := []string{"api.local:10.0.0.10", "host.docker.internal:host-gateway"}
+	if got := resolve(linux, "api.local:10.0.0.10"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ExtraHosts=%v want=%v", got, want)
+	}
+	if got := resolve(desktop); len(got) != 0 {
+		t.Fatalf("ExtraHosts=%v want none on Docker Desktop", got)
+	}
+	own := []string{"host.docker.internal=192.168.1.5"}
+	if got := resolve(linux, own...); !reflect.DeepEqual(got, own) {
+		t.Fatalf("ExtraHosts=%v want the service's own entry kept", got)
+	}
+}
+
+func TestContainerConfigs_LoadsSeccompProfileFromFile(t *testing.T) {
+	dir := t.TempDir()
+	profile := `{"defaultAction":"SCMP_ACT_ERRNO"}`
+	if err := os.WriteFile(filepath.Join(dir, "seccomp.json"), []byte(profile), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	svc := types.ServiceConfig{
+		Image:       "alpine:latest",
+		SecurityOpt: []string{"seccomp:seccomp.json"},
+	}
+	project := &Project{WorkingDir: dir}
+	s := newService(project, svc)
+	c := &Cmd{Service: s.config, service: s}
+
+	_, hostCfg, err := c.containerConfigs(nil)
+	if err != nil {
+		t.Fatalf("containerConfigs: %v", err)
+	}
+	if len(hostCfg.SecurityOpt) != 1 {
+		t.Fatalf("SecurityOpt len=%d want=1", len(hostCfg.SecurityOpt))
+	}
+	want := "seccomp=" + profile
+	if hostCfg.SecurityOpt[0] != want {
+		t.Fatalf("SecurityOpt=%q want=%q", hostCfg.SecurityOpt[0], want)
+	}
+}
+
+func sameStringMultiset(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	counts := map[string]int{}
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		counts[s]--
+	}
+	for _, n := range counts {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNormalizeCapabilities(t *testing.T) {
+	t.Run("prefix and case", func(t *testing.T) {
+		got, err := normalizeCapabilities(
+			"cap_add",
+			[]string{"net_admin", "CAP_SYS_TIME", "NET_ADMIN"},
+		)
+		if err != nil {
+			t.Fatalf("normalizeCapabilities: %v", err)
+		}
+		want := []string{"CAP_NET_ADMIN", "CAP_SYS_TIME"}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got=%v want=%v", got, want)
+		}
+	})
+
+	t.Run("all collapses", func(t *testing.T) {
+		got, err := normalizeCapabilities("cap_drop", []string{"MKNOD", "all"})
+		if err != nil {
+			t.Fatalf("normalizeCapabilities: %v", err)
+		}
+		if !reflect.DeepEqual(got, []string{"ALL"}) {
+			t.Fatalf("got=%v want=[ALL]", got)
+		}
+	})
+
+	t.Run("unknown capability", func(t *testing.T) {
+		_, err := normalizeCapabilities("cap_add", []string{"ALL", "NET_ADMN"})
+		if err == nil {
+			t.Fatalf("expected error")
+		}
+		if !strings.Contains(err.Error(), "NET_ADMN") || !strings.Contains(err.Error(), "cap_add") {
+			t.Fatalf("err=%v", err)
+		}
+	})
+}
+
+func TestContainerConfigs_RejectsUnknownCapability(t *testing.T) {
+	c := &Cmd{Service: types.ServiceConfig{Image: "alpine:latest", CapAdd: []string{"NET_ADMN"}}}
+	if _, _, err := c.containerConfigs(nil); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestPreflight_WarnsOnOldAPIVersion(t *testing.T) {
+	fd := &fakeDocker{
+		versionResp: dockertypes.Version{Version: "19.03.0", APIVersion: "1.39"},
+		infoResp: system.Info{
+			DockerRootDir: "/var/lib/docker",
+			Warnings:      []string{"WARNING: No swap limit support"},
+		},
+		daemonHost: "tcp://remote:2376",
+	}
+	report, err := preflight(context.Background(), fd)
+	if err != nil {
+		t.Fatalf("preflight: %v", err)
+	}
+	if report.APIVersion != "1.39" || report.DockerRootDir != "/var/lib/docker" {
+		t.Fatalf("report=%+v", report)
+	}
+	if report.ImageStore != "graphdriver" || report.LazyPulling {
+		t.Fatalf("ImageStore=%q LazyPulling=%v", report.ImageStore, report.LazyPulling)
+	}
+	if report.DiskFreeKnown {
+		t.Fatalf("disk space must be unknown for remote daemons")
+	}
+	if len(report.Warnings) != 2 || !strings.Contains(report.Warnings[0], "1.40") {
+		t.Fatalf("Warnings=%v", report.Warnings)
+	}
+}
+
+func TestGateAPIFeatures(t *testing.T) {
+	newSpec := func() *createSpec {
+		return &createSpec{
+			config: &container.Config{
+				Healthcheck: &container.HealthConfig{StartInterval: time.Second},
+			},
+			networking: &network.NetworkingConfig{
+				EndpointsConfig: map[string]*network.EndpointSettings{
+					"proj_default": {GwPriority: 10},
+				},
+			},
+		}
+	}
+
+	t.Run("supported", func(t *testing.T) {
+		spec := newSpec()
+		if err := gateAPIFeatures("1.48", true, spec); err != nil {
+			t.Fatalf("gateAPIFeatures: %v", err)
+		}
+		if spec.config.Healthcheck.StartInterval != time.Second {
+			t.Fatalf("StartInterval stripped")
+		}
+	})
+
+	t.Run("strict returns typed error", func(t *testing.T) {
+		err := gateAPIFeatures("1.43", true, newSpec())
+		if !errors.Is(err, ErrFeatureUnsupportedByDaemon) {
+			t.Fatalf("err=%v want ErrFeatureUnsupportedByDaemon", err)
+		}
+		var fe *FeatureUnsupportedError
+		if !errors.As(err, &fe) || fe.Feature != "healthcheck.start_interval" {
+			t.Fatalf("err=%#v", err)
+		}
+	})
+
+	t.Run("lenient strips", func(t *testing.T) {
+		spec := newSpec()
+		if err := gateAPIFeatures("1.44", false, spec); err != nil {
+			t.Fatalf("gateAPIFeatures: %v", err)
+		}
+		if spec.config.Healthcheck.StartInterval != time.Second {
+			t.Fatalf("StartInterval stripped on 1.44")
+		}
+		if got := spec.networking.EndpointsConfig["proj_default"].GwPriority; got != 0 {
+			t.Fatalf("GwPriority=%d want=0", got)
+		}
+	})
+}
+
+func TestCmd_InspectRequiresStart(t *testing.T) {
+	c := &Cmd{}
+	if c.ContainerID() != "" {
+		t.Fatalf("ContainerID=%q want empty", c.ContainerID())
+	}
+	if _, err := c.Inspect(context.Background()); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	fd := &fakeDocker{
+		inspectResp: container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{ID: "cid"},
+		},
+	}
+	c = &Cmd{docker: fd, started: true, containerID: "cid"}
+	j, err := c.Inspect(context.Background())
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if j.ID != "cid" || c.ContainerID() != "cid" {
+		t.Fatalf("ID=%q ContainerID=%q", j.ID, c.ContainerID())
+	}
+}
+
+func TestCmd_HealthLog(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fd := &fakeDocker{inspectResp: container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{State: &container.State{
+			Running: true,
+			Health: &container.Health{Status: "unhealthy", Log: []*container.HealthcheckResult{
+				{Start: start, End: start.Add(time.Second), ExitCode: 0, Output: "ok"},
+				{Start: start, End: start.Add(time.Second), ExitCode: 1, Output: "refused\n"},
+			}},
+		}},
+	}}
+	c := startedCmd(fd)
+	probes, err := c.HealthLog(context.Background())
+	if err != nil {
+		t.Fatalf("HealthLog: %v", err)
+	}
+	want := []HealthProbe{
+		{Start: start, End: start.Add(time.Second), ExitCode: 0, Output: "ok"},
+		{Start: start, End: start.Add(time.Second), ExitCode: 1, Output: "refused\n"},
+	}
+	if !reflect.DeepEqual(probes, want) {
+		t.Fatalf("probes=%+v want=%+v", probes, want)
+	}
+
+	c.Service.HealthCheck = &types.HealthCheckConfig{Test: []string{"CMD", "check"}}
+	c.waitRespCh = make(chan container.WaitResponse)
+	err = c.waitUntilHealthy(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "unhealthy (exit code 1): refused") {
+		t.Fatalf("err=%v want the last probe output", err)
+	}
+
+	fd.inspectResp.State.Health = nil
+	if _, err := c.HealthLog(context.Background()); err == nil {
+		t.Fatalf("expected error without healthcheck")
+	}
+}
+
+func TestCmd_Err(t *testing.T) {
+	proj := &Project{Name: "proj", Services: types.Services{
+		"app": {Name: "app", Image: "alpine:latest"},
+	}}
+	var nilCtx context.Context
+	cases := []struct {
+		name string
+		cmd  *Cmd
+		want string
+	}{
+		{"empty command name", proj.Command("app", "", "x"), "empty command name"},
+		{"NUL byte", proj.Command("app", "echo", "a\x00b"), "args[1] contains a NUL byte"},
+		{"nil context", proj.CommandContext(nilCtx, "app", "true"), "nil Context"},
+		{"unknown service", proj.Command("db", "true"), "db"},
+	}
+	for _, tc := range cases {
+		if tc.cmd.Err == nil || !strings.Contains(tc.cmd.Err.Error(), tc.want) {
+			t.Fatalf("%s: Err=%v want %q", tc.name, tc.cmd.Err, tc.want)
+		}
+		if err := tc.cmd.Run(); err != tc.cmd.Err {
+			t.Fatalf("%s: Run=%v want Err", tc.name, err)
+		}
+	}
+	if c := proj.Command("app", "sh", "-c", ""); c.Err != nil {
+		t.Fatalf("empty non-leading argument must be allowed: %v", c.Err)
+	}
+
+	fd := &fakeDocker{}
+	c := proj.Command("app", "true")
+	c.docker = fd
+	c.RestoreFrom = &Checkpoint{Name: "cp"}
+	c.InitCommands = [][]string{{"seed"}}
+	if err := c.Start(); err == nil || !strings.Contains(err.Error(), "RestoreFrom") {
+		t.Fatalf("Start=%v want conflicting fields error", err)
+	}
+	c = proj.Command("app", "true")
+	c.docker = fd
+	c.OutputOverflow = OverflowBlock
+	if err := c.Start(); err == nil || !strings.Contains(err.Error(), "OutputBuffer") {
+		t.Fatalf("Start=%v want OutputOverflow error", err)
+	}
+	if len(fd.createCalls) != 0 || fd.pullPlatforms != nil {
+		t.Fatalf("engine was contacted: creates=%d", len(fd.createCalls))
+	}
+}
+
+func TestService_ConfigAndProjectAreCopies(t *testing.T) {
+	v := "1"
+	svc := types.ServiceConfig{
+		Name:        "svc",
+		Image:       "alpine:latest",
+		Environment: types.MappingWithEquals{"A": &v},
+		Ports:       []types.ServicePortConfig{{Target: 80, Published: "8080"}},
+	}
+	proj := &Project{Name: "proj", Services: types.Services{"svc": svc}}
+	s, err := proj.Service("svc")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+
+	cfg := s.Config()
+	if cfg.Image != "alpine:latest" || len(cfg.Ports) != 1 || s.Name() != "svc" {
+		t.Fatalf("Config=%+v", cfg)
+	}
+	*cfg.Environment["A"] = "changed"
+	cfg.Ports[0].Published = "9090"
+	if got := s.Config(); *got.Environment["A"] != "1" || got.Ports[0].Published != "8080" {
+		t.Fatalf("Config mutation leaked: %+v", got)
+	}
+
+	p := s.Project()
+	p.Name = "other"
+	if s.Project().Name != "proj" {
+		t.Fatalf("Project mutation leaked")
+	}
+}
+
+func TestService_With(t *testing.T) {
+	v := "1"
+	proj := &Project{Name: "proj", Services: types.Services{"db": {
+		Name:        "db",
+		Image:       "postgres:15",
+		Environment: types.MappingWithEquals{"A": &v},
+		Ports:       []types.ServicePortConfig{{Target: 5432, Published: "5432"}},
+	}}}
+	s, err := proj.Service("db")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+	t.Setenv("FROM_HOST", "h")
+
+	d := s.With(
+		OverrideEnv("X=1", "FROM_HOST"),
+		OverrideImage("postgres:16.3"),
+		OverridePorts("0:5432"),
+	)
+	cfg := d.Config()
+	if cfg.Image != "postgres:16.3" {
+		t.Fatalf("image=%q want=postgres:16.3", cfg.Image)
+	}
+	env := cfg.Environment
+	if *env["A"] != "1" || *env["X"] != "1" || *env["FROM_HOST"] != "h" {
+		t.Fatalf("environment=%v", env)
+	}
+	if len(cfg.Ports) != 1 || cfg.Ports[0].Published != "0" || cfg.Ports[0].Target != 5432 {
+		t.Fatalf("ports=%+v", cfg.Ports)
+	}
+	if got := s.Config(); got.Image != "postgres:15" || len(got.Environment) != 1 {
+		t.Fatalf("With modified the original service: %+v", got)
+	}
+	if c := d.Command("true"); c.Service.Image != "postgres:16.3" || c.Err != nil {
+		t.Fatalf("derived Cmd image=%q err=%v", c.Service.Image, c.Err)
+	}
+
+	bad := s.With(OverridePorts("not-a-port"))
+	if err := bad.Command("true").Run(); err == nil {
+		t.Fatalf("expected override error from Run")
+	}
+}
+
+func TestProject_ForEachService_AggregatesErrors(t *testing.T) {
+	proj := &Project{
+		Name: "proj",
+		Services: types.Services{
+			"a": {Name: "a", Build: &types.BuildConfig{Context: "."}},
+			"b": {Name: "b", Build: &types.BuildConfig{Context: "."}},
+		},
+	}
+	results, err := proj.ForEachService(context.Background(), nil, "true")
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if len(results) != 2 || results[0].Service != "a" || results[1].Service != "b" {
+		t.Fatalf("results=%+v", results)
+	}
+	for _, r := range results {
+		if r.ExitCode != -1 || r.Err == nil {
+			t.Fatalf("result=%+v", r)
+		}
+	}
+	var me *MultiError
+	if !errors.As(err, &me) || len(me.Errors) != 2 {
+		t.Fatalf("err=%#v want *MultiError with 2 entries", err)
+	}
+	if me.Errors[0].Kind != "service" || me.Errors[0].Name != "a" {
+		t.Fatalf("Errors[0]=%+v", me.Errors[0])
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	proj := &Project{
+		Name: "proj",
+		Services: types.Services{
+			"db": {
+				Name:  "db",
+				Image: "postgres:13",
+				Build: &types.BuildConfig{Context: "."},
+				Volumes: []types.ServiceVolumeConfig{
+					{Type: types.VolumeTypeVolume, Source: "data", Target: "/data"},
+				},
+			},
+		},
+		Volumes: types.Volumes{"data": {Name: "proj_data"}},
+	}
+	db, err := proj.Service("db")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+	images := []string{"postgres:14", "postgres:15"}
+	m := Matrix(db, images)
+	if !reflect.DeepEqual(m.Images(), images) {
+		t.Fatalf("images=%v", m.Images())
+	}
+	for i, svc := range m.Services() {
+		if got := svc.Config().Image; got != images[i] {
+			t.Fatalf("service %d image=%q want=%q", i, got, images[i])
+		}
+	}
+	if db.Config().Image != "postgres:13" {
+		t.Fatalf("base service was modified")
+	}
+
+	// Every image mounts a data volume of its own project.
+	fd := &fakeDocker{}
+	for i, svc := range m.Services() {
+		if got, want := svc.Project().Name, fmt.Sprintf("proj-matrix-%d", i+1); got != want {
+			t.Fatalf("service %d project=%q want=%q", i, got, want)
+		}
+		// Without build, which makes m.Run below fail before creating containers.
+		c := svc.With(func(cfg *types.ServiceConfig) error {
+			cfg.Build = nil
+			return nil
+		}).Command("true")
+		c.docker = fd
+		if err := c.Run(); err != nil {
+			t.Fatalf("Run %s: %v", images[i], err)
+		}
+	}
+	var sources []string
+	for _, call := range fd.createCalls {
+		for _, mnt := range call.hostConfig.Mounts {
+			sources = append(sources, mnt.Source)
+		}
+	}
+	if want := []string{"proj-matrix-1_data", "proj-matrix-2_data"}; !reflect.DeepEqual(
+		sources, want) {
+		t.Fatalf("mount sources=%v want=%v", sources, want)
+	}
+
+	results, err := m.Run(context.Background(), "true")
+	var me *MultiError
+	if !errors.As(err, &me) || len(me.Errors) != 2 ||
+		me.Errors[0].Kind != "image" || me.Errors[1].Name != "postgres:15" {
+		t.Fatalf("err=%v", err)
+	}
+	if len(results) != 2 || results[0].Image != "postgres:14" || results[0].ExitCode != -1 {
+		t.Fatalf("results=%+v", results)
+	}
+	if _, err := Matrix(nil, images).Run(context.Background()); err == nil {
+		t.Fatalf("expected error for nil service")
+	}
+}
+
+func TestService_ImageConfig(t *testing.T) {
+	img := image.InspectResponse{Config: &dockerspec.DockerOCIImageConfig{
+		ImageConfig: ocispec.ImageConfig{
+			Entrypoint:   []string{"docker-entrypoint.sh"},
+			Cmd:          []string{"postgres"},
+			Env:          []string{"PGDATA=/var/lib/postgresql/data"},
+			ExposedPorts: map[string]struct{}{"5432/tcp": {}, "5431/udp": {}},
+			User:         "postgres",
+		},
+	}}
+	fd := &fakeDocker{imageInspects: []image.InspectResponse{img}}
+	s := newService(nil, types.ServiceConfig{Name: "db", Image: "postgres:16"})
+	got, err := s.imageConfig(context.Background(), fd)
+	if err != nil {
+		t.Fatalf("imageConfig: %v", err)
+	}
+	want := ImageConfig{
+		Entrypoint:   []string{"docker-entrypoint.sh"},
+		Cmd:          []string{"postgres"},
+		Env:          []string{"PGDATA=/var/lib/postgresql/data"},
+		ExposedPorts: []string{"5431/udp", "5432/tcp"},
+		User:         "postgres",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ImageConfig=%+v want %+v", got, want)
+	}
+
+	noImage := newService(nil, types.ServiceConfig{Name: "app"})
+	if _, err := noImage.imageConfig(context.Background(), fd); err == nil {
+		t.Fatal("imageConfig without image succeeded")
+	}
+}
+
+func TestEffectiveCommand(t *testing.T) {
+	img := ImageConfig{Entrypoint: []string{"docker-entrypoint.sh"}, Cmd: []string{"postgres"}}
+	tests := []struct {
+		name string
+		cfg  container.Config
+		want []string
+	}{
+		{name: "image defaults", want: []string{"docker-entrypoint.sh", "postgres"}},
+		{
+			name: "args replace CMD",
+			cfg:  container.Config{Cmd: []string{"psql"}},
+			want: []string{"docker-entrypoint.sh", "psql"},
+		},
+		{
+			name: "entrypoint drops CMD",
+			cfg:  container.Config{Entrypoint: []string{"bash"}},
+			want: []string{"bash"},
+		},
+		{
+			name: "entrypoint and args",
+			cfg:  container.Config{Entrypoint: []string{"bash"}, Cmd: []string{"-c", "true"}},
+			want: []string{"bash", "-c", "true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := effectiveCommand(&tt.cfg, img); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("effectiveCommand=%q want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCmd_WrapAndShellCommand(t *testing.T) {
+	img := image.InspectResponse{Config: &dockerspec.DockerOCIImageConfig{
+		ImageConfig: ocispec.ImageConfig{
+			Entrypoint: []string{"docker-entrypoint.sh"},
+			Cmd:        []string{"postgres"},
+		},
+	}}
+	start := func(t *testing.T, setup func(*Cmd)) *container.Config {
+		t.Helper()
+		fd := &fakeDocker{imageInspects: []image.InspectResponse{img}}
+		c := &Cmd{
+			Service: types.ServiceConfig{Name: "db", Image: "postgres:16"},
+			docker:  fd,
+		}
+		setup(c)
+		if err := c.Start(); err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		_ = c.Wait()
+		if len(fd.createCalls) != 1 {
+			t.Fatalf("createCalls=%d", len(fd.createCalls))
+		}
+		return fd.createCalls[0].config
+	}
+
+	cfg := start(t, func(c *Cmd) {
+		c.WrapCommand("timeout", "30s")
+		c.WrapCommand("nice")
+	})
+	argv := append(append([]string(nil), cfg.Entrypoint...), cfg.Cmd...)
+	want := []string{"nice", "timeout", "30s", "docker-entrypoint.sh", "postgres"}
+	if !reflect.DeepEqual(argv, want) {
+		t.Fatalf("wrapped argv=%q want %q", argv, want)
+	}
+
+	cfg = start(t, func(c *Cmd) { c.ShellCommand("echo $HOME") })
+	if !reflect.DeepEqual([]string(cfg.Entrypoint), []string{"/bin/sh"}) ||
+		!reflect.DeepEqual([]string(cfg.Cmd), []string{"-c", "echo $HOME"}) {
+		t.Fatalf("shell entrypoint=%q cmd=%q", cfg.Entrypoint, cfg.Cmd)
+	}
+
+	cfg = start(t, func(c *Cmd) {
+		c.ShellCommand("sleep 60")
+		c.WrapCommand("timeout", "1s")
+	})
+	argv = append(append([]string(nil), cfg.Entrypoint...), cfg.Cmd...)
+	want = []string{"timeout", "1s", "/bin/sh", "-c", "sleep 60"}
+	if !reflect.DeepEqual(argv, want) {
+		t.Fatalf("wrapped shell argv=%q want %q", argv, want)
+	}
+}
+
+func TestServiceConfigHash(t *testing.T) {
+	svc := types.ServiceConfig{Name: "svc", Image: "alpine:3.20", Profiles: []string{"a"}}
+	proj := &Project{Name: "proj", Services: types.Services{"svc": svc}}
+	s, err := proj.Service("svc")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+	hash, err := s.ConfigHash()
+	if err != nil || len(hash) != 64 {
+		t.Fatalf("ConfigHash=%q err=%v", hash, err)
+	}
+
+	sameCfg := svc
+	sameCfg.Profiles = []string{"b"}
+	if h, _ := serviceConfigHash(sameCfg); h != hash {
+		t.Fatalf("profiles must not affect the hash")
+	}
+	changed := svc
+	changed.Image = "alpine:3.21"
+	if h, _ := serviceConfigHash(changed); h == hash {
+		t.Fatalf("image change must affect the hash")
+	}
+
+	c := &Cmd{Service: s.config, service: s}
+	cfg, _, err := c.containerConfigs(nil)
+	if err != nil {
+		t.Fatalf("containerConfigs: %v", err)
+	}
+	if cfg.Labels[configHashLabel] != hash {
+		t.Fatalf("config-hash label=%q want=%q", cfg.Labels[configHashLabel], hash)
+	}
+}
+
+func TestRemoveContainerConfirmed(t *testing.T) {
+	t.Run("gone", func(t *testing.T) {
+		fd := &fakeDocker{inspectErr: cerrdefs.ErrNotFound}
+		if err := removeContainerConfirmed(context.Background(), fd, "cid"); err != nil {
+			t.Fatalf("removeContainerConfirmed: %v", err)
+		}
+		if fd.removeCalls != 1 {
+			t.Fatalf("removeCalls=%d", fd.removeCalls)
+		}
+	})
+
+	t.Run("still present", func(t *testing.T) {
+		fd := &fakeDocker{}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if err := removeContainerConfirmed(ctx, fd, "cid"); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
+
+func TestCmd_AutoRemove(t *testing.T) {
+	fd := &fakeDocker{}
+	c := &Cmd{
+		Service:    types.ServiceConfig{Name: "svc", Image: "alpine:latest"},
+		AutoRemove: true,
+		docker:     fd,
+	}
+	if err := c.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(fd.createCalls) != 1 || !fd.createCalls[0].hostConfig.AutoRemove {
+		t.Fatalf("AutoRemove not set on HostConfig")
+	}
+	want := []container.WaitCondition{container.WaitConditionRemoved}
+	if !reflect.DeepEqual(fd.waitConditions, want) {
+		t.Fatalf("waitConditions=%v want=%v", fd.waitConditions, want)
+	}
+	if fd.removeCalls != 0 {
+		t.Fatalf("removeCalls=%d want=0", fd.removeCalls)
+	}
+}
+
+func TestSignalForwarder_ForwardsAfterAttach(t *testing.T) {
+	fd := &fakeDocker{}
+	f := newSignalForwarder(context.Background())
+	defer f.stop()
+
+	f.attach(fd, "cid")
+	f.handle(syscall.SIGTERM)
+	if !reflect.DeepEqual(fd.killSignals, []string{"SIGTERM"}) {
+		t.Fatalf("killSignals=%v want=[SIGTERM]", fd.killSignals)
+	}
+	if f.ctx.Err() != nil {
+		t.Fatalf("forwarded signal must not cancel the context")
+	}
+}
+
+func TestSignalForwarder_CancelsBeforeAttach(t *testing.T) {
+	f := newSignalForwarder(context.Background())
+	defer f.stop()
+
+	f.handle(syscall.SIGTERM)
+	if f.ctx.Err() == nil {
+		t.Fatalf("signal before attach must cancel the context")
+	}
+}
+
+func TestCmd_DisableSignalHandling(t *testing.T) {
+	ctx := context.Background()
+	c := &Cmd{DisableSignalHandling: true, ForwardSignals: true}
+	sigCtx, stop := c.notifySignals(ctx)
+	if sigCtx != ctx || stop != nil {
+		t.Fatalf("notifySignals must return the caller context unchanged")
+	}
+	if c.forwarder != nil {
+		t.Fatalf("no signal forwarder expected")
+	}
+}
+
+func TestCmd_Timing(t *testing.T) {
+	fd := &fakeDocker{
+		inspectResp: container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{
+				State: &container.State{
+					StartedAt:  "2024-05-01T10:00:00.5Z",
+					FinishedAt: "2024-05-01T10:00:03Z",
+				},
+			},
+		},
+	}
+	c := &Cmd{
+		Service: types.ServiceConfig{Name: "svc", Image: "alpine:latest"},
+		docker:  fd,
+	}
+	if err := c.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	tm := c.Timing()
+	if got := tm.FinishedAt.Sub(tm.StartedAt); got != 2500*time.Millisecond {
+		t.Fatalf("container duration=%v want=2.5s", got)
+	}
+	if tm.Total() != tm.Pull+tm.Create+tm.Run+tm.Cleanup {
+		t.Fatalf("unexpected phase durations: %+v", tm)
+	}
+	if !parseEngineTime("0001-01-01T00:00:00Z").IsZero() {
+		t.Fatalf("unset engine time must map to zero")
+	}
+}
+
+func TestCmd_StreamArchiveTo(t *testing.T) {
+	fd := &fakeDocker{}
+	c := &Cmd{
+		Service: types.ServiceConfig{Name: "svc", Image: "alpine:latest"},
+		docker:  fd,
+	}
+	if err := c.StreamArchiveTo("data", strings.NewReader("x")); err == nil {
+		t.Fatalf("expected error for relative destination")
+	}
+	if err := c.StreamArchiveTo("/data", nil); err == nil {
+		t.Fatalf("expected error for nil reader")
+	}
+	if err := c.StreamArchiveTo("/data/", strings.NewReader("first")); err != nil {
+		t.Fatalf("StreamArchiveTo: %v", err)
+	}
+	if err := c.StreamArchiveTo("/etc", strings.NewReader("second")); err != nil {
+		t.Fatalf("StreamArchiveTo: %v", err)
+	}
+	if err := c.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []copyCall{
+		{dstPath: "/data", content: []byte("first")},
+		{dstPath: "/etc", content: []byte("second")},
+	}
+	if !reflect.DeepEqual(fd.copyCalls, want) {
+		t.Fatalf("copyCalls=%v want=%v", fd.copyCalls, want)
+	}
+	if err := c.StreamArchiveTo("/late", strings.NewReader("x")); err == nil {
+		t.Fatalf("expected error after start")
+	}
+}
+
+func TestMergeExtraMounts(t *testing.T) {
+	yaml := []mount.Mount{
+		{Type: mount.TypeBind, Source: "/src/app", Target: "/app"},
+		{Type: mount.TypeVolume, Source: "data", Target: "/data"},
+	}
+	extra := []mount.Mount{
+		{Type: mount.TypeBind, Source: "/tmp/scratch", Target: "/data"},
+		{Type: mount.TypeBind, Source: "/var/run/x.sock", Target: "/x.sock"},
+	}
+	got, err := mergeExtraMounts(yaml, extra)
+	if err != nil {
+		t.Fatalf("mergeExtraMounts: %v", err)
+	}
+	want := []mount.Mount{yaml[0], extra[0], extra[1]}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mounts=%+v want=%+v", got, want)
+	}
+
+	_, err = mergeExtraMounts(nil, []mount.Mount{
+		{Type: mount.TypeBind, Source: "rel/dir", Target: "/x"},
+	})
+	if err == nil {
+		t.Fatalf("expected error for relative bind source")
+	}
+}
+
+func TestDockerSocketMount(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "docker.sock")
+	if err := os.WriteFile(sock, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// A socket path the daemon may not see (e.g. Docker Desktop) is not mounted.
+	m, groups, warnings := dockerSocketMount("unix://" + sock)
+	if m.Source != "/var/run/docker.sock" || groups != nil || len(warnings) != 2 {
+		t.Fatalf("unexpected forwarded socket mount: %+v groups=%v warnings=%v",
+			m, groups, warnings)
+	}
+
+	defer func() { _ = SetPathMapping(nil) }()
+	if err := SetPathMapping(map[string]string{filepath.Dir(sock): "/host/run"}); err != nil {
+		t.Fatalf("SetPathMapping: %v", err)
+	}
+	m, _, warnings = dockerSocketMount("unix://" + sock)
+	if m.Source != sock || m.Target != "/var/run/docker.sock" || m.Type != mount.TypeBind {
+		t.Fatalf("unexpected mapped socket mount: %+v", m)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("warnings=%v want one security warning", warnings)
+	}
+	if got := mapBindSources([]mount.Mount{m})[0].Source; got != "/host/run/docker.sock" {
+		t.Fatalf("mapped source=%q", got)
+	}
+
+	m, groups, warnings = dockerSocketMount("tcp://10.0.0.1:2376")
+	if m.Source != "/var/run/docker.sock" || groups != nil {
+		t.Fatalf("unexpected remote socket mount: %+v groups=%v", m, groups)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("warnings=%v want security and remote warnings", warnings)
+	}
+}
+
+func TestSyncSpec_SnapshotDiffAndCopy(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.txt", "a")
+	write("sub/b.txt", "b")
+	write("node_modules/x.js", "x")
+
+	spec := syncSpec{root: dir, target: "/app", ignore: []string{"node_modules/"}}
+	prev, err := spec.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := prev["node_modules/x.js"]; ok || len(prev) != 2 {
+		t.Fatalf("snapshot=%v want a.txt and sub/b.txt", prev)
+	}
+
+	write("sub/b.txt", "bb")
+	write("c.txt", "c")
+	if err := os.Remove(filepath.Join(dir, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	next, err := spec.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, removed := diffSnapshots(prev, next)
+	if !reflect.DeepEqual(changed, []string{"c.txt", "sub/b.txt"}) ||
+		!reflect.DeepEqual(removed, []string{"a.txt"}) {
+		t.Fatalf("changed=%v removed=%v", changed, removed)
+	}
+
+	fd := &fakeDocker{}
+	if err := spec.copyToContainer(context.Background(), fd, "cid", changed); err != nil {
+		t.Fatalf("copyToContainer: %v", err)
+	}
+	if len(fd.copyCalls) != 1 || fd.copyCalls[0].dstPath != "/" {
+		t.Fatalf("copyCalls=%v", fd.copyCalls)
+	}
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(fd.copyCalls[0].content))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"app/c.txt", "app/sub/b.txt"}) {
+		t.Fatalf("archive entries=%v", names)
+	}
+
+	if err := spec.removeFromContainer(context.Background(), fd, "cid", removed); err != nil {
+		t.Fatalf("removeFromContainer: %v", err)
+	}
+	wantRm := []string{"rm", "-rf", "--", "/app/a.txt"}
+	if len(fd.execCalls) != 1 || !reflect.DeepEqual(fd.execCalls[0].Cmd, wantRm) {
+		t.Fatalf("execCalls=%v want Cmd=%v", fd.execCalls, wantRm)
+	}
+}
+
+func TestCmd_WatchSkipsUnsupportedActions(t *testing.T) {
+	c := &Cmd{Service: types.ServiceConfig{
+		Name: "svc",
+		Develop: &types.DevelopConfig{Watch: []types.Trigger{
+			{Path: ".", Target: "/app", Action: types.WatchActionRebuild},
+		}},
+	}}
+	if err := c.Watch(context.Background()); err == nil ||
+		!strings.Contains(err.Error(), "supported action") {
+		t.Fatalf("expected unsupported action error, got %v", err)
+	}
+
+	// Rebuild rules are skipped; restart rules need no target.
+	c.Service.Develop.Watch = append(c.Service.Develop.Watch,
+		types.Trigger{Path: "src", Target: "/app/src", Action: types.WatchActionSyncRestart},
+		types.Trigger{Path: "conf", Action: types.WatchActionRestart},
+	)
+	rules, err := c.watchRules()
+	if err != nil {
+		t.Fatalf("watchRules: %v", err)
+	}
+	if len(rules) != 2 || rules[0].action != types.WatchActionSyncRestart ||
+		rules[0].spec.target != "/app/src" || rules[1].action != types.WatchActionRestart {
+		t.Fatalf("rules=%+v want the sync+restart and restart rules", rules)
+	}
+}
+
+func TestPollWatch_RestartsOnce(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	restarts := 0
+	restart := func(context.Context) error {
+		restarts++
+		return nil
+	}
+	rules := make([]watchRule, len(dirs))
+	snaps := make([]fileSnapshot, len(dirs))
+	for i, dir := range dirs {
+		rules[i] = watchRule{
+			spec:    syncSpec{root: dir},
+			action:  types.WatchActionRestart,
+			restart: restart,
+		}
+		snap, err := rules[i].spec.snapshot()
+		if err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		snaps[i] = snap
+	}
+
+	ctx := context.Background()
+	if err := pollWatch(ctx, &fakeDocker{}, "cid", rules, snaps); err != nil {
+		t.Fatalf("pollWatch: %v", err)
+	}
+	if restarts != 0 {
+		t.Fatalf("restarted %d times without changes", restarts)
+	}
+	for _, dir := range dirs {
+		if err := os.WriteFile(filepath.Join(dir, "app.conf"), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pollWatch(ctx, &fakeDocker{}, "cid", rules, snaps); err != nil {
+		t.Fatalf("pollWatch: %v", err)
+	}
+	if restarts != 1 {
+		t.Fatalf("restarted %d times want 1", restarts)
+	}
+}
+
+// restartingDocker simulates a container that can be restarted: a restart ends
+// the pending wait and the attach stream like a stop does, and exit ends the
+// container for good.
+type restartingDocker struct {
+	*fakeDocker
+	mu       sync.Mutex
+	waits    []chan container.WaitResponse
+	streams  []*io.PipeWriter
+	restarts int
+	exited   bool
+}
+
+func (r *restartingDocker) ContainerWait(
+	_ context.Context,
+	_ string,
+	_ container.WaitCondition,
+) (<-chan container.WaitResponse, <-chan error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch := make(chan container.WaitResponse, 1)
+	if r.exited {
+		ch <- container.WaitResponse{}
+	} else {
+		r.waits = append(r.waits, ch)
+	}
+	return ch, make(chan error)
+}
+
+func (r *restartingDocker) ContainerAttach(
+	_ context.Context,
+	_ string,
+	_ container.AttachOptions,
+) (dockertypes.HijackedResponse, error) {
+	pr, pw := io.Pipe()
+	r.mu.Lock()
+	r.streams = append(r.streams, pw)
+	r.mu.Unlock()
+	return dockertypes.NewHijackedResponse(&fakeConn{r: pr}, ""), nil
+}
+
+func (r *restartingDocker) ContainerRestart(
+	_ context.Context,
+	_ string,
+	_ container.StopOptions,
+) error {
+	r.stop(143)
+	r.mu.Lock()
+	r.restarts++
+	r.mu.Unlock()
+	return nil
+}
+
+// stop ends the pending waits and the attach streams.
+func (r *restartingDocker) stop(code int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ch := range r.waits {
+		ch <- container.WaitResponse{StatusCode: code}
+	}
+	r.waits = nil
+	for _, pw := range r.streams {
+		_ = pw.Close()
+	}
+	r.streams = nil
+}
+
+func (r *restartingDocker) exit() {
+	r.mu.Lock()
+	r.exited = true
+	r.mu.Unlock()
+	r.stop(0)
+}
+
+// write sends stdout output through the current attach stream.
+func (r *restartingDocker) write(t *testing.T, s string) {
+	t.Helper()
+	r.mu.Lock()
+	pw := r.streams[len(r.streams)-1]
+	r.mu.Unlock()
+	if _, err := stdcopy.NewStdWriter(pw, stdcopy.Stdout).Write([]byte(s)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestCmd_WaitAcrossWatchRestart(t *testing.T) {
+	rd := &restartingDocker{fakeDocker: &fakeDocker{}}
+	var out bytes.Buffer
+	c := &Cmd{
+		Service: types.ServiceConfig{Name: "svc", Image: "alpine:latest"},
+		Stdout:  &out,
+		docker:  rd,
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- c.Wait() }()
+
+	rd.write(t, "before\n")
+	if err := c.restartContainer(context.Background(), rd, c.ContainerID()); err != nil {
+		t.Fatalf("restartContainer: %v", err)
+	}
+	rd.write(t, "after\n")
+	rd.exit()
+
+	select {
+	case err := <-waitErr:
+		if err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Wait did not return after the final exit")
+	}
+	if got := out.String(); got != "before\nafter\n" {
+		t.Fatalf("stdout=%q want output of both runs", got)
+	}
+	if rd.restarts != 1 || len(rd.removedIDs) != 1 {
+		t.Fatalf("restarts=%d removed=%v", rd.restarts, rd.removedIDs)
+	}
+	// The container exited for good: later restarts are refused.
+	if err := c.restartContainer(context.Background(), rd, c.ContainerID()); err != nil ||
+		rd.restarts != 1 {
+		t.Fatalf("restart after exit: err=%v restarts=%d", err, rd.restarts)
+	}
+}
+
+func TestCmd_WatchStopsWithWait(t *testing.T) {
+	rd := &restartingDocker{fakeDocker: &fakeDocker{}}
+	c := &Cmd{
+		Service: types.ServiceConfig{
+			Name:  "svc",
+			Image: "alpine:latest",
+			Develop: &types.DevelopConfig{Watch: []types.Trigger{
+				{Path: t.TempDir(), Target: "/app", Action: types.WatchActionSync},
+			}},
+		},
+		docker: rd,
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	watchErr := make(chan error, 1)
+	go func() { watchErr <- c.Watch(context.Background()) }()
+	for {
+		c.mu.Lock()
+		registered := len(c.watchStops) > 0
+		c.mu.Unlock()
+		if registered {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rd.exit()
+	if err := c.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	select {
+	case err := <-watchErr:
+		if err != nil {
+			t.Fatalf("Watch: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Watch did not return after Wait")
+	}
+}
+
+func TestCmd_WatchPathValidation(t *testing.T) {
+	c := &Cmd{Service: types.ServiceConfig{Name: "svc"}}
+	if _, err := c.WatchPath(t.TempDir(), "relative"); err == nil {
+		t.Fatalf("expected error for relative container path")
+	}
+	if _, err := c.WatchPath(t.TempDir(), "/app"); err == nil ||
+		!strings.Contains(err.Error(), "not started") {
+		t.Fatalf("expected not started error, got %v", err)
+	}
+}
+
+func TestSelfMountFor(t *testing.T) {
+	sm := selfMountFor("/home/me/proj", "tcp://10.0.0.1:2376")
+	if sm.WorkingDir != "/home/me/proj" || sm.PathMapping != nil {
+		t.Fatalf("expected mirror mount, got %+v", sm)
+	}
+	want := []string{
+		"-v", "/home/me/proj:/home/me/proj",
+		"-v", "/var/run/docker.sock:/var/run/docker.sock",
+		"-w", "/home/me/proj",
+	}
+	if got := sm.DockerRunArgs(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("args=%q want=%q", got, want)
+	}
+
+	sm = selfMountFor(`C:\Users\me\proj`, "npipe:////./pipe/docker_engine")
+	if sm.WorkingDir != "/c/Users/me/proj" {
+		t.Fatalf("WorkingDir=%q want=/c/Users/me/proj", sm.WorkingDir)
+	}
+	wantMap := map[string]string{"/c/Users/me/proj": `C:\Users\me\proj`}
+	if !reflect.DeepEqual(sm.PathMapping, wantMap) {
+		t.Fatalf("PathMapping=%v", sm.PathMapping)
+	}
+}
+
+func TestSetPathMapping(t *testing.T) {
+	err := SetPathMapping(map[string]string{
+		"/workspace":     "/home/me/project",
+		"/workspace/sub": "/mnt/other",
+		"/win":           `C:\src`,
+	})
+	if err != nil {
+		t.Fatalf("SetPathMapping: %v", err)
+	}
+	defer func() { _ = SetPathMapping(nil) }()
+
+	cases := map[string]string{
+		"/workspace":          "/home/me/project",
+		"/workspace/data/x":   "/home/me/project/data/x",
+		"/workspace/sub/file": "/mnt/other/file",
+		"/workspacefoo":       "/workspacefoo",
+		"/win/app":            `C:\src\app`,
+		"/elsewhere":          "/elsewhere",
+	}
+	for in, want := range cases {
+		if got := mapHostPath(in); got != want {
+			t.Fatalf("mapHostPath(%q)=%q want=%q", in, got, want)
+		}
+	}
+
+	mounts := mapBindSources([]mount.Mount{
+		{Type: mount.TypeBind, Source: "/workspace/a", Target: "/a"},
+		{Type: mount.TypeVolume, Source: "/workspace", Target: "/v"},
+	})
+	if mounts[0].Source != "/home/me/project/a" || mounts[1].Source != "/workspace" {
+		t.Fatalf("unexpected mapped mounts: %+v", mounts)
+	}
+
+	if err := SetPathMapping(map[string]string{"relative": "/x"}); err == nil {
+		t.Fatalf("expected error for relative key")
+	}
+}
+
+func TestRegisterReaperFilter(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	got := make(chan string, 1)
+	go func() {
+		defer func() { _ = server.Close() }()
+		line, _ := bufio.NewReader(server).ReadString('\n')
+		got <- line
+		_, _ = server.Write([]byte("ACK\n"))
+	}()
+
+	if err := registerReaperFilter(client, "proj"); err != nil {
+		t.Fatalf("registerReaperFilter: %v", err)
+	}
+	if line := <-got; line != "label=com.docker.compose.project=proj\n" {
+		t.Fatalf("filter=%q", line)
+	}
+
+	cfg := reaperServiceConfig()
+	if cfg.NetworkMode != "bridge" || len(cfg.Ports) != 1 || cfg.Ports[0].Published != "0" {
+		t.Fatalf("unexpected reaper service config: %+v", cfg)
+	}
+}
+
+func TestSetClientOptions(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "")
+	t.Setenv("DOCKER_API_VERSION", "")
+	defer func() { _ = SetClientOptions(ClientOptions{}) }()
+
+	proxy := func(*http.Request) (*url.URL, error) { return url.Parse("http://proxy:3128") }
+	tr := &http.Transport{Proxy: proxy}
+	err := SetClientOptions(ClientOptions{
+		Host:                  "unix:///tmp/compose-exec-test.sock",
+		APIVersion:            "1.44",
+		HTTPClient:            &http.Client{Transport: tr},
+		ResponseHeaderTimeout: 5 * time.Second,
+		Headers:               map[string]string{"X-Test": "1"},
+	})
+	if err != nil {
+		t.Fatalf("SetClientOptions: %v", err)
+	}
+	dc, err := newDockerClient()
+	if err != nil {
+		t.Fatalf("newDockerClient: %v", err)
+	}
+	defer func() { _ = dc.Close() }()
+	if got := dc.DaemonHost(); got != "unix:///tmp/compose-exec-test.sock" {
+		t.Fatalf("DaemonHost=%q", got)
+	}
+	if got := dc.ClientVersion(); got != "1.44" {
+		t.Fatalf("ClientVersion=%q want pinned 1.44", got)
+	}
+	got, ok := configuredTransport(t).(*http.Transport)
+	if !ok || got == tr {
+		t.Fatalf("expected a cloned *http.Transport, got %T", got)
+	}
+	dials := got.Dial != nil //nolint:staticcheck // The socket dialer is a legacy Dial.
+	if got.ResponseHeaderTimeout != 5*time.Second || !dials {
+		t.Fatalf("transport not configured: timeout=%v dial=%v", got.ResponseHeaderTimeout, dials)
+	}
+	if tr.Dial != nil || tr.ResponseHeaderTimeout != 0 { //nolint:staticcheck // As above.
+		t.Fatalf("caller's transport was modified")
+	}
+
+	// TCP hosts keep the caller's proxy.
+	err = SetClientOptions(ClientOptions{Host: "tcp://10.0.0.5:2375", HTTPClient: &http.Client{
+		Transport: &http.Transport{Proxy: proxy},
+	}})
+	if err != nil {
+		t.Fatalf("SetClientOptions(tcp): %v", err)
+	}
+	got = configuredTransport(t).(*http.Transport)
+	if u, _ := got.Proxy(nil); u == nil || u.Host != "proxy:3128" {
+		t.Fatalf("proxy not preserved: %v", u)
+	}
+
+	bad := []ClientOptions{
+		{Host: "not a host"},
+		{ResponseHeaderTimeout: -time.Second},
+		{
+			TLSHandshakeTimeout: time.Second,
+			HTTPClient:          &http.Client{Transport: roundTripFunc(nil)},
+		},
+	}
+	for _, opts := range bad {
+		if err := SetClientOptions(opts); err == nil {
+			t.Fatalf("expected error for %+v", opts)
+		}
+	}
+}
+
+func TestRegisterBackend(t *testing.T) {
+	defer func() { _ = SetBackend("") }()
+
+	fd := &fakeDocker{}
+	calls := 0
+	err := RegisterBackend("test-backend", func() (Backend, error) {
+		calls++
+		return fd, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterBackend: %v", err)
+	}
+	if err := SetBackend("test-backend"); err != nil {
+		t.Fatalf("SetBackend: %v", err)
+	}
+	dc, err := newDockerClient()
+	if err != nil || dc != fd || calls != 1 {
+		t.Fatalf("newDockerClient=%v, %v (calls %d); want the registered backend", dc, err, calls)
+	}
+
+	if err := RegisterBackend("test-backend-err", func() (Backend, error) {
+		return nil, errors.New("unreachable")
+	}); err != nil {
+		t.Fatalf("RegisterBackend: %v", err)
+	}
+	_ = SetBackend("test-backend-err")
+	if _, err := newDockerClient(); err == nil ||
+		!strings.Contains(err.Error(), "test-backend-err") {
+		t.Fatalf("factory error not reported: %v", err)
+	}
+
+	if err := SetBackend(DockerBackend); err != nil {
+		t.Fatalf("SetBackend(docker): %v", err)
+	}
+	dc, err = newDockerClient()
+	if err != nil {
+		t.Fatalf("newDockerClient: %v", err)
+	}
+	defer func() { _ = dc.Close() }()
+	if _, ok := dc.(*client.Client); !ok {
+		t.Fatalf("default backend = %T, want *client.Client", dc)
+	}
+
+	factory := func() (Backend, error) { return fd, nil }
+	for _, name := range []string{"", DockerBackend, "test-backend"} {
+		if err := RegisterBackend(name, factory); err == nil {
+			t.Fatalf("RegisterBackend(%q) succeeded", name)
 		}
+	}
+	if err := RegisterBackend("test-backend-nil", nil); err == nil {
+		t.Fatalf("RegisterBackend with a nil factory succeeded")
+	}
+	if err := SetBackend("unknown"); err == nil {
+		t.Fatalf("SetBackend(unknown) succeeded")
+	}
+}
+
+// configuredTransport returns the transport the current client options produce,
+// before the Engine client wraps it for tracing.
+func configuredTransport(t *testing.T) http.RoundTripper {
+	t.Helper()
+	var rt http.RoundTripper
+	opts := append(currentClientOptions().clientOpts(), func(c *client.Client) error {
+		rt = c.HTTPClient().Transport
+		return nil
 	})
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		t.Fatalf("NewClientWithOpts: %v", err)
+	}
+	_ = cli.Close()
+	return rt
 }
 
-func TestWaitForExit_ClosedErrChStillWaitsForResp(t *testing.T) {
-	respCh := make(chan container.WaitResponse)
-	errCh := make(chan error)
-	close(errCh)
+type roundTripFunc func(*http.Request) (*http.Response, error)
 
-	go func() {
-		time.Sleep(50 * time.Millisecond)
-		respCh <- container.WaitResponse{StatusCode: 0}
-	}()
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
 
-	start := time.Now()
-	_, err := waitForExit(context.Background(), context.Background(), nil, "cid", respCh, errCh)
+func TestCmdDetach_ServiceInstance(t *testing.T) {
+	ctx := context.Background()
+	fd := &fakeDocker{execOutput: []byte("pong\n"), execExitCodes: []int{0, 2}}
+	c := startedCmd(fd)
+	c.Service.Name = "db"
+	c.waitRespCh = make(chan container.WaitResponse)
+	inst, err := c.Detach()
 	if err != nil {
-		t.Fatalf("waitForExit: %v", err)
+		t.Fatalf("Detach: %v", err)
 	}
-	if time.Since(start) < 40*time.Millisecond {
-		t.Fatalf("waitForExit returned before respCh was ready")
+	if inst.Service != "db" || inst.ID != "cid" {
+		t.Fatalf("instance=%+v", inst)
 	}
-}
-
-func TestCmd_WaitUntilHealthy_StopsOnSignalContext(t *testing.T) {
-	fd := &fakeDocker{
-		inspectResp: container.InspectResponse{
-			ContainerJSONBase: &container.ContainerJSONBase{
-				State: &container.State{
-					Running: true,
-					Health: &container.Health{
-						Status: "starting",
-					},
-				},
-			},
-		},
+	if err := c.Wait(); err == nil || !strings.Contains(err.Error(), "detached") {
+		t.Fatalf("Wait after Detach: %v", err)
+	}
+	if _, err := c.Detach(); err == nil {
+		t.Fatal("second Detach succeeded")
+	}
+	if fd.removeCalls != 0 {
+		t.Fatalf("removeCalls=%d after Detach", fd.removeCalls)
 	}
 
-	ctx, cancelCtx := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancelCtx()
-	sigCtx, cancelSig := context.WithCancel(context.Background())
-	defer cancelSig()
+	out, err := inst.Exec(ctx, "ping")
+	if err != nil || string(out) != "pong\n" {
+		t.Fatalf("Exec: out=%q err=%v", out, err)
+	}
+	var ee *ExitError
+	if _, err := inst.Exec(ctx, "false"); !errors.As(err, &ee) || ee.Code != 2 {
+		t.Fatalf("Exec non-zero: %v", err)
+	}
+	if err := inst.Restart(ctx, time.Second); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	if err := inst.Stop(ctx, 0); err != nil || fd.stopCalls != 1 {
+		t.Fatalf("Stop: err=%v stopCalls=%d", err, fd.stopCalls)
+	}
+	if ok, err := inst.Healthy(ctx); err != nil || ok {
+		t.Fatalf("Healthy of stopped container: ok=%v err=%v", ok, err)
+	}
+	if err := inst.Remove(ctx); err != nil || fd.removeCalls != 1 {
+		t.Fatalf("Remove: err=%v removeCalls=%d", err, fd.removeCalls)
+	}
+	if !reflect.DeepEqual(fd.restartedIDs, []string{"cid"}) {
+		t.Fatalf("restartedIDs=%v", fd.restartedIDs)
+	}
+}
 
-	c := &Cmd{
-		Service: types.ServiceConfig{
-			Name:  "svc",
-			Image: "alpine:latest",
-			HealthCheck: &types.HealthCheckConfig{
-				Test: []string{"CMD", "true"},
-			},
-		},
-		ctx:         ctx,
-		docker:      fd,
-		started:     true,
-		containerID: "cid",
-		waitRespCh:  make(chan container.WaitResponse),
-		signalCtx:   sigCtx,
+func TestUpOptionsOutputFor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	var shared, dbOut bytes.Buffer
+	off := false
+	opts := UpOptions{
+		Stdout: &shared,
+		Output: map[string]ServiceOutput{"db": {Stdout: &dbOut}},
+	}
+	if out := opts.outputFor("cache", &off); out.Stdout != nil || out.Stderr != nil {
+		t.Fatalf("attach: false service is streamed: %+v", out)
 	}
+	if out := opts.outputFor("db", &off); out.Stdout != &dbOut || out.Stderr != nil {
+		t.Fatalf("explicit output not used: %+v", out)
+	}
+	out := opts.outputFor("app", nil)
+	if out.Stderr != nil {
+		t.Fatalf("stderr routed without UpOptions.Stderr: %+v", out)
+	}
+	_, _ = out.Stdout.Write([]byte("ready\n"))
+	if got := shared.String(); got != "app | ready\n" {
+		t.Fatalf("shared output=%q", got)
+	}
+}
 
-	go func() {
-		time.Sleep(100 * time.Millisecond)
-		cancelSig()
-	}()
+func TestProjectDependencyOrder(t *testing.T) {
+	proj := &Project{Name: "proj", Services: types.Services{
+		"app":   {Name: "app", DependsOn: types.DependsOnConfig{"db": {}, "cache": {}}},
+		"cache": {Name: "cache"},
+		"db":    {Name: "db", DependsOn: types.DependsOnConfig{"vault": {}}},
+		"vault": {Name: "vault"},
+	}}
+	got, err := proj.dependencyOrder(proj.ServiceNames())
+	if err != nil || !reflect.DeepEqual(got, []string{"cache", "vault", "db", "app"}) {
+		t.Fatalf("order=%v err=%v", got, err)
+	}
+	// Dependencies that were not asked for are not added.
+	got, err = proj.dependencyOrder([]string{"app", "db"})
+	if err != nil || !reflect.DeepEqual(got, []string{"db", "app"}) {
+		t.Fatalf("order=%v err=%v", got, err)
+	}
 
-	start := time.Now()
-	err := c.WaitUntilHealthy()
-	elapsed := time.Since(start)
-	if !errors.Is(err, context.Canceled) {
-		t.Fatalf("err=%v want=%v", err, context.Canceled)
+	proj.Services["vault"] = types.ServiceConfig{
+		Name:      "vault",
+		DependsOn: types.DependsOnConfig{"app": {}},
 	}
-	if elapsed > 1200*time.Millisecond {
-		t.Fatalf("WaitUntilHealthy did not stop quickly on signal context: %v", elapsed)
+	if _, err := proj.dependencyOrder(proj.ServiceNames()); err == nil ||
+		!strings.Contains(err.Error(), "dependency cycle") {
+		t.Fatalf("cycle err=%v", err)
 	}
 }
 
-func TestContainerConfigs_AddsComposeLabels(t *testing.T) {
-	svc := types.ServiceConfig{Name: "svc", Image: "alpine:latest"}
-	proj := &Project{Name: "proj", Services: types.Services{"svc": svc}}
-	s, err := proj.Service("svc")
-	if err != nil {
-		t.Fatalf("Project.Service: %v", err)
+func TestServiceInstanceStreamOutput(t *testing.T) {
+	var frames bytes.Buffer
+	_, _ = stdcopy.NewStdWriter(&frames, stdcopy.Stdout).Write([]byte("out\n"))
+	_, _ = stdcopy.NewStdWriter(&frames, stdcopy.Stderr).Write([]byte("err\n"))
+	fd := &fakeDocker{logsOutput: frames.Bytes()}
+	inst := &ServiceInstance{Service: "app", ID: "cid", dc: fd}
+	var stdout, stderr bytes.Buffer
+	if err := inst.streamOutput(&stdout, &stderr); err != nil {
+		t.Fatalf("streamOutput: %v", err)
+	}
+	if err := inst.Remove(context.Background()); err != nil {
+		t.Fatalf("Remove: %v", err)
 	}
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Fatalf("stdout=%q stderr=%q", stdout.String(), stderr.String())
+	}
+	if inst.stopOutput != nil {
+		t.Fatal("output streaming not stopped by Remove")
+	}
+}
 
-	c := &Cmd{Service: s.config, service: s}
-	cfg, _, err := c.containerConfigs(nil)
-	if err != nil {
-		t.Fatalf("containerConfigs: %v", err)
+func TestServiceInstanceSupervise(t *testing.T) {
+	state := func(running bool, health, startedAt string) container.InspectResponse {
+		st := &container.State{Running: running, StartedAt: startedAt, ExitCode: 137}
+		if health != "" {
+			st.Health = &container.Health{Status: health}
+		}
+		return container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{State: st}}
 	}
-	if cfg.Labels == nil {
-		t.Fatalf("labels nil")
+	fd := &fakeDocker{
+		inspectSeq: []container.InspectResponse{
+			state(true, "starting", "t1"),
+			state(true, "healthy", "t1"),
+			state(true, "healthy", "t1"),
+			state(true, "unhealthy", "t1"),
+			state(true, "starting", "t2"),
+			state(false, "", "t2"),
+		},
+		inspectErr: cerrdefs.ErrNotFound,
 	}
-	if cfg.Labels["com.docker.compose.project"] != "proj" {
-		t.Fatalf("project label=%q", cfg.Labels["com.docker.compose.project"])
+	inst := &ServiceInstance{Service: "db", ID: "cid", dc: fd}
+
+	var got []string
+	for tr := range inst.Supervise(context.Background(), time.Millisecond) {
+		got = append(got, fmt.Sprintf("%s>%s/%v/%d", tr.From, tr.To, tr.Restarted, tr.ExitCode))
 	}
-	if cfg.Labels["com.docker.compose.service"] != "svc" {
-		t.Fatalf("service label=%q", cfg.Labels["com.docker.compose.service"])
+	want := []string{
+		">starting/false/0",
+		"starting>healthy/false/0",
+		"healthy>unhealthy/false/0",
+		"unhealthy>starting/true/0",
+		"starting>stopped/false/137",
+		"stopped>gone/false/0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("transitions=%v want=%v", got, want)
 	}
 }
 
-func TestContainerConfigs_WorkingDirOverride(t *testing.T) {
-	svc := types.ServiceConfig{
-		Image:      "alpine:latest",
-		WorkingDir: "/service",
+func TestAuditHook_RecordsMutations(t *testing.T) {
+	var buf bytes.Buffer
+	defer SetAuditHook(nil)
+	SetAuditHook(JSONAuditHook(&buf))
+
+	dc := withAudit(&fakeDocker{})
+	ctx := context.Background()
+	cfg := &container.Config{Image: "alpine", Env: []string{"PASSWORD=hunter22"}}
+	if _, err := dc.ContainerCreate(ctx, cfg, nil, nil, nil, "proj-web-1"); err != nil {
+		t.Fatalf("ContainerCreate: %v", err)
 	}
-	c := &Cmd{
-		Service:    svc,
-		WorkingDir: "/override",
+	if _, err := dc.ContainerInspect(ctx, "cid"); err != nil {
+		t.Fatalf("ContainerInspect: %v", err)
 	}
-	cfg, _, err := c.containerConfigs(nil)
-	if err != nil {
-		t.Fatalf("containerConfigs: %v", err)
+	if err := dc.ContainerRemove(ctx, "cid", container.RemoveOptions{Force: true}); err != nil {
+		t.Fatalf("ContainerRemove: %v", err)
 	}
-	if cfg.WorkingDir != "/override" {
-		t.Fatalf("WorkingDir=%q want=%q", cfg.WorkingDir, "/override")
+
+	if strings.Contains(buf.String(), "hunter22") {
+		t.Fatalf("audit log leaks parameters: %s", buf.String())
+	}
+	var recs []AuditRecord
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var r AuditRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		recs = append(recs, r)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("records=%+v", recs)
+	}
+	create, remove := recs[0], recs[1]
+	if create.Op != "container.create" || create.Target != "proj-web-1" ||
+		create.Result != "cid" || len(create.ParamsDigest) != 64 {
+		t.Fatalf("create=%+v", create)
+	}
+	if remove.Op != "container.remove" || remove.Target != "cid" || remove.PID != os.Getpid() {
+		t.Fatalf("remove=%+v", remove)
+	}
+	// The test itself belongs to the package, so the caller is the test runner.
+	if create.Caller == "" || strings.HasPrefix(create.Caller, auditPackage) {
+		t.Fatalf("caller=%q", create.Caller)
 	}
 }
 
-func TestContainerConfigs_ReadOnlyRootfs(t *testing.T) {
-	svc := types.ServiceConfig{
-		Image:    "alpine:latest",
-		ReadOnly: true,
+func TestCgroupLimits(t *testing.T) {
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
 	}
-	c := &Cmd{Service: svc}
 
-	_, hostCfg, err := c.containerConfigs(nil)
-	if err != nil {
-		t.Fatalf("containerConfigs: %v", err)
+	v2 := t.TempDir()
+	write(filepath.Join(v2, "proc"), "0::/ci/job\n")
+	write(filepath.Join(v2, "ci", "cpu.max"), "200000 100000\n")
+	write(filepath.Join(v2, "ci", "memory.max"), "max\n")
+	write(filepath.Join(v2, "ci", "job", "cpu.max"), "max 100000\n")
+	write(filepath.Join(v2, "ci", "job", "memory.max"), "4294967296\n")
+	if cpus, mem := cgroupLimits(v2, filepath.Join(v2, "proc")); cpus != 2 || mem != 4<<30 {
+		t.Fatalf("v2: cpus=%v mem=%d", cpus, mem)
 	}
-	if !hostCfg.ReadonlyRootfs {
-		t.Fatalf("ReadonlyRootfs=false want=true")
+
+	v1 := t.TempDir()
+	write(filepath.Join(v1, "proc"), "4:memory:/\n3:cpu,cpuacct:/\n")
+	write(filepath.Join(v1, "cpu", "cpu.cfs_quota_us"), "150000\n")
+	write(filepath.Join(v1, "cpu", "cpu.cfs_period_us"), "100000\n")
+	write(filepath.Join(v1, "memory", "memory.limit_in_bytes"), "9223372036854771712\n")
+	if cpus, mem := cgroupLimits(v1, filepath.Join(v1, "proc")); cpus != 1.5 || mem != 0 {
+		t.Fatalf("v1: cpus=%v mem=%d", cpus, mem)
 	}
 }
 
-func TestContainerConfigs_TmpfsMapping(t *testing.T) {
-	svc := types.ServiceConfig{
-		Image: "alpine:latest",
-		Tmpfs: types.StringList{
-			"/run:size=64m,mode=1777,noexec",
-			"/cache",
-		},
+func TestApplyResourceShare(t *testing.T) {
+	defer SetResourceShare(0)
+	SetResourceShare(4)
+	cpus, mem := controllerLimits()
+	if cpus <= 0 {
+		cpus = float64(runtime.NumCPU())
 	}
-	c := &Cmd{Service: svc}
 
-	_, hostCfg, err := c.containerConfigs(nil)
-	if err != nil {
-		t.Fatalf("containerConfigs: %v", err)
+	var hc container.HostConfig
+	applyResourceShare(&hc)
+	if want := int64(math.Round(cpus / 4 * 1e9)); hc.NanoCPUs != want {
+		t.Fatalf("NanoCPUs=%d want %d", hc.NanoCPUs, want)
 	}
-	want := map[string]string{
-		"/run":   "size=64m,mode=1777,noexec",
-		"/cache": "",
+	if hc.Memory != mem/4 {
+		t.Fatalf("Memory=%d want %d", hc.Memory, mem/4)
 	}
-	if !reflect.DeepEqual(hostCfg.Tmpfs, want) {
-		t.Fatalf("Tmpfs=%v want=%v", hostCfg.Tmpfs, want)
+
+	own := container.HostConfig{Resources: container.Resources{CpusetCpus: "0", Memory: 1 << 20}}
+	applyResourceShare(&own)
+	if own.NanoCPUs != 0 || own.Memory != 1<<20 {
+		t.Fatalf("service limits overridden: %+v", own.Resources)
 	}
 }
 
-func TestContainerConfigs_MapsAdditionalHostOptions(t *testing.T) {
-	svc := types.ServiceConfig{
-		Image:       "alpine:latest",
-		SecurityOpt: []string{"no-new-privileges:true", "label=disable"},
-		ShmSize:     types.UnitBytes(128 * 1024 * 1024),
-		ExtraHosts: types.HostsList{
-			"example.local": []string{"127.0.0.1"},
-			"api.local":     []string{"10.0.0.10", "10.0.0.11"},
-		},
-		Devices: []types.DeviceMapping{
-			{
-				Source:      "/dev/null",
-				Target:      "/dev/xnull",
-				Permissions: "r",
-			},
-			{
-				Source: "/dev/zero",
-			},
-		},
-		CPUS:      1.5,
-		CPUShares: 512,
-		CPUSet:    "0,2",
+func TestApplyHostnameTemplate(t *testing.T) {
+	defer func() { _ = SetHostnameTemplate("") }()
+	if err := SetHostnameTemplate("{{.Service}}-{{.RunID}}-{{.Suffix}}"); err != nil {
+		t.Fatalf("SetHostnameTemplate: %v", err)
 	}
-	c := &Cmd{Service: svc}
-
-	_, hostCfg, err := c.containerConfigs(nil)
-	if err != nil {
-		t.Fatalf("containerConfigs: %v", err)
+	c := &Cmd{Service: types.ServiceConfig{Name: "Web_App"}}
+	cfg, hostCfg := &container.Config{}, &container.HostConfig{}
+	if err := c.applyHostnameTemplate(cfg, hostCfg, "compose-exec-web_app-a1b2c3"); err != nil {
+		t.Fatalf("applyHostnameTemplate: %v", err)
+	}
+	if want := "web-app-" + RunID() + "-a1b2c3"; cfg.Hostname != want {
+		t.Fatalf("Hostname=%q want %q", cfg.Hostname, want)
 	}
 
-	if !reflect.DeepEqual(hostCfg.SecurityOpt, svc.SecurityOpt) {
-		t.Fatalf("SecurityOpt=%v want=%v", hostCfg.SecurityOpt, svc.SecurityOpt)
+	cfg = &container.Config{}
+	hostCfg = &container.HostConfig{NetworkMode: "host"}
+	if err := c.applyHostnameTemplate(cfg, hostCfg, "x-1"); err != nil || cfg.Hostname != "" {
+		t.Fatalf("host network: Hostname=%q err=%v", cfg.Hostname, err)
 	}
-	if hostCfg.ShmSize != int64(svc.ShmSize) {
-		t.Fatalf("ShmSize=%d want=%d", hostCfg.ShmSize, int64(svc.ShmSize))
+	cfg = &container.Config{Hostname: "db"}
+	if err := c.applyHostnameTemplate(cfg, &container.HostConfig{}, "x-1"); err != nil ||
+		cfg.Hostname != "db" {
+		t.Fatalf("service hostname: Hostname=%q err=%v", cfg.Hostname, err)
 	}
 
-	wantHosts := svc.ExtraHosts.AsList(":")
-	if !sameStringMultiset(hostCfg.ExtraHosts, wantHosts) {
-		t.Fatalf("ExtraHosts=%v want(as set)=%v", hostCfg.ExtraHosts, wantHosts)
+	if err := SetHostnameTemplate("{{.Nope"); err == nil {
+		t.Fatal("invalid template accepted")
 	}
-
-	wantDevices := []container.DeviceMapping{
-		{
-			PathOnHost:        "/dev/null",
-			PathInContainer:   "/dev/xnull",
-			CgroupPermissions: "r",
-		},
-		{
-			PathOnHost:        "/dev/zero",
-			PathInContainer:   "/dev/zero",
-			CgroupPermissions: "rwm",
-		},
+	if err := SetHostnameTemplate("{{.Missing}}"); err != nil {
+		t.Fatalf("SetHostnameTemplate: %v", err)
 	}
-	if !reflect.DeepEqual(hostCfg.Devices, wantDevices) {
-		t.Fatalf("Devices=%v want=%v", hostCfg.Devices, wantDevices)
+	err := c.applyHostnameTemplate(&container.Config{}, &container.HostConfig{}, "x-1")
+	if err == nil {
+		t.Fatal("template referencing an unknown field succeeded")
 	}
+}
 
-	if hostCfg.NanoCPUs != 1_500_000_000 {
-		t.Fatalf("NanoCPUs=%d want=%d", hostCfg.NanoCPUs, int64(1_500_000_000))
+func TestSetDefaultInit(t *testing.T) {
+	defer SetDefaultInit(InitEnabled)
+	initOf := func(init *bool) *bool {
+		t.Helper()
+		c := &Cmd{Service: types.ServiceConfig{Name: "svc", Image: "alpine", Init: init}}
+		_, hostCfg, err := c.containerConfigs(nil)
+		if err != nil {
+			t.Fatalf("containerConfigs: %v", err)
+		}
+		return hostCfg.Init
 	}
-	if hostCfg.CPUShares != 512 {
-		t.Fatalf("CPUShares=%d want=%d", hostCfg.CPUShares, int64(512))
+	tests := []struct {
+		def  InitDefault
+		want *bool
+	}{
+		{InitEnabled, ptr(true)},
+		{InitEngine, nil},
+		{InitDisabled, ptr(false)},
 	}
-	if hostCfg.CpusetCpus != "0,2" {
-		t.Fatalf("CpusetCpus=%q want=%q", hostCfg.CpusetCpus, "0,2")
+	for _, tt := range tests {
+		SetDefaultInit(tt.def)
+		if got := initOf(nil); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("default %d: Init=%v want %v", tt.def, got, tt.want)
+		}
+		if got := initOf(ptr(false)); got == nil || *got {
+			t.Fatalf("default %d: init: false gave Init=%v", tt.def, got)
+		}
+		if got := initOf(ptr(true)); got == nil || !*got {
+			t.Fatalf("default %d: init: true gave Init=%v", tt.def, got)
+		}
 	}
 }
 
-func TestContainerConfigs_LoadsSeccompProfileFromFile(t *testing.T) {
-	dir := t.TempDir()
-	profile := `{"defaultAction":"SCMP_ACT_ERRNO"}`
-	if err := os.WriteFile(filepath.Join(dir, "seccomp.json"), []byte(profile), 0o600); err != nil {
-		t.Fatalf("WriteFile: %v", err)
+func TestWatchZombies(t *testing.T) {
+	titles := []string{"UID", "PID", "PPID", "C", "STIME", "TTY", "TIME", "CMD"}
+	healthy := container.TopResponse{Titles: titles, Processes: [][]string{
+		{"root", "10", "1", "0", "12:00", "?", "00:00:00", "sh -c worker"},
+	}}
+	zombie := container.TopResponse{Titles: titles, Processes: [][]string{
+		{"root", "10", "1", "0", "12:00", "?", "00:00:00", "sh -c worker"},
+		{"root", "11", "10", "0", "12:00", "?", "00:00:00", "[sleep] <defunct>"},
+	}}
+	fd := &fakeDocker{topSeq: []container.TopResponse{healthy, zombie}}
+	got := watchZombies(context.Background(), fd, "cid", time.Millisecond)
+	if len(got) != 1 || !strings.Contains(got[0], "<defunct>") {
+		t.Fatalf("zombies=%q", got)
 	}
 
-	svc := types.ServiceConfig{
-		Image:       "alpine:latest",
-		SecurityOpt: []string{"seccomp:seccomp.json"},
+	fd = &fakeDocker{topSeq: []container.TopResponse{healthy}}
+	if got := watchZombies(context.Background(), fd, "cid", time.Millisecond); got != nil {
+		t.Fatalf("zombies of a stopped container=%q", got)
 	}
-	project := &Project{WorkingDir: dir}
-	s := newService(project, svc)
-	c := &Cmd{Service: s.config, service: s}
 
-	_, hostCfg, err := c.containerConfigs(nil)
+	byStat := container.TopResponse{
+		Titles:    []string{"PID", "STAT", "COMMAND"},
+		Processes: [][]string{{"1", "Ss", "app"}, {"7", "Z", "child"}},
+	}
+	if got := zombieProcesses(byStat); !reflect.DeepEqual(got, []string{"7 Z child"}) {
+		t.Fatalf("zombieProcesses=%q", got)
+	}
+}
+
+func TestSetGlobalLabels(t *testing.T) {
+	defer SetGlobalLabels(nil)
+	SetGlobalLabels(map[string]string{
+		"org.example.owner":          "ci",
+		"com.docker.compose.project": "other",
+		"":                           "ignored",
+	})
+	c := &Cmd{Service: types.ServiceConfig{
+		Name:   "svc",
+		Image:  "alpine",
+		Labels: types.Labels{"org.example.owner": "team-a"},
+	}}
+	cfg, _, err := c.containerConfigs(nil)
 	if err != nil {
 		t.Fatalf("containerConfigs: %v", err)
 	}
-	if len(hostCfg.SecurityOpt) != 1 {
-		t.Fatalf("SecurityOpt len=%d want=1", len(hostCfg.SecurityOpt))
+	if cfg.Labels["org.example.owner"] != "team-a" {
+		t.Fatalf("service label overridden: %v", cfg.Labels)
 	}
-	want := "seccomp=" + profile
-	if hostCfg.SecurityOpt[0] != want {
-		t.Fatalf("SecurityOpt=%q want=%q", hostCfg.SecurityOpt[0], want)
+	if cfg.Labels["com.docker.compose.project"] != c.projectName() {
+		t.Fatalf("project label overridden: %v", cfg.Labels)
 	}
-}
-
-func sameStringMultiset(a, b []string) bool {
-	if len(a) != len(b) {
-		return false
+	if _, ok := cfg.Labels[""]; ok {
+		t.Fatalf("empty key applied: %v", cfg.Labels)
 	}
 
-	counts := map[string]int{}
-	for _, s := range a {
-		counts[s]++
+	opts := networkCreateOptions("proj", networkSpec{key: "default"})
+	if opts.Labels["org.example.owner"] != "ci" {
+		t.Fatalf("network labels=%v", opts.Labels)
 	}
-	for _, s := range b {
-		counts[s]--
+	fd := &fakeDocker{}
+	if err := createVolumeIdempotent(
+		context.Background(), fd, volume.CreateOptions{Name: "data"},
+	); err != nil {
+		t.Fatalf("createVolumeIdempotent: %v", err)
 	}
-	for _, n := range counts {
-		if n != 0 {
-			return false
-		}
+	vols := fd.volumeCreateCalls
+	if len(vols) != 1 || vols[0].Labels["org.example.owner"] != "ci" {
+		t.Fatalf("volume creates=%+v", vols)
 	}
-	return true
 }
@@ -0,0 +1,57 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var errNilContext = errors.New("compose: nil Context")
+
+// cmdErr returns the construction error of a Cmd: loadErr if set, or a problem
+// with args.
+func cmdErr(loadErr error, args []string) error {
+	if loadErr != nil {
+		return loadErr
+	}
+	return validateArgs(args)
+}
+
+// validateArgs rejects arguments the Docker Engine cannot execute.
+func validateArgs(args []string) error {
+	if len(args) > 0 && args[0] == "" {
+		return errors.New("compose: empty command name in args")
+	}
+	for i, a := range args {
+		if strings.ContainsRune(a, 0) {
+			return fmt.Errorf("compose: args[%d] contains a NUL byte", i)
+		}
+	}
+	return nil
+}
+
+// validate checks the fields set after construction for invalid values and
+// combinations, so Start fails before contacting the Docker Engine.
+func (c *Cmd) validate() error {
+	if err := validateArgs(c.Args); err != nil {
+		return err
+	}
+	for _, entry := range c.ExtraHosts {
+		if _, _, err := parseExtraHost(entry); err != nil {
+			return err
+		}
+	}
+	switch {
+	case c.OutputBuffer < 0:
+		return errors.New("compose: OutputBuffer is negative")
+	case c.OutputOverflow != OverflowDropOldest && c.OutputBuffer == 0:
+		return errors.New("compose: OutputOverflow is set without OutputBuffer")
+	case c.KeepAlive < 0:
+		return errors.New("compose: KeepAlive is negative")
+	case c.RestoreFrom != nil && len(c.InitCommands) > 0:
+		// A restored container resumes the checkpointed state, in which the init
+		// commands already ran.
+		return errors.New("compose: InitCommands cannot be combined with RestoreFrom")
+	}
+	return nil
+}
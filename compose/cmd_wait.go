@@ -13,37 +13,53 @@ import (
 
 // Wait waits for the started container to exit and returns its exit status.
 // If created via CommandContext, its context controls cancellation.
-func (c *Cmd) Wait() error {
+func (c *Cmd) Wait() (waitErr error) {
 	ctx := c.contextOrBackground()
 	defer c.closeDockerIfOwned()
 	st, err := c.snapshotWaitState()
 	if err != nil {
 		return err
 	}
+	defer func() { c.finished(waitErr) }()
+	defer func() { waitErr = c.redactErr(waitErr) }()
 	if st.stopSignals != nil {
 		defer st.stopSignals()
 	}
 
-	waitResp, err := waitForExit(ctx, st.sigCtx, st.dc, st.id, st.respCh, st.errCh)
-	if err != nil {
-		return err
+	waitResp, err := c.waitForFinalExit(ctx, st)
+	exitedAt := c.markRunEnd()
+	c.stopWatchers()
+	if err == nil {
+		c.emitExited(int(waitResp.StatusCode), c.Timing().Run)
 	}
-
-	ioErr := waitForIO(ctx, st.dc, st.id, st.attach, st.stdinDone, st.ioDone, st.ioErrCh)
-
-	closeAttach(st.attach)
-
-	if ioErr != nil {
-		return ioErr
+	defer func() {
+		cleanupTime := time.Since(exitedAt)
+		c.updateTiming(func(t *Timing) { t.Cleanup = cleanupTime })
+	}()
+	if err == nil {
+		stopExpiry := c.expireOutputBuffers()
+		err = waitForIO(ctx, st.stdinDone, st.ioDone, st.ioErrCh)
+		stopExpiry()
+	}
+	// Every path below releases the attach stream and pipes, then removes the
+	// container exactly once.
+	c.releaseIO(err)
+	if err != nil {
+		return c.abortWait(st, err)
 	}
 
 	code := int(waitResp.StatusCode)
 	var exitState *container.State
-	if waitResp.Error == nil && code != 0 {
-		exitState = captureContainerState(st.dc, st.id)
+	if !c.AutoRemove {
+		state := captureContainerState(st.dc, st.id)
+		c.recordContainerTimes(state)
+		if waitResp.Error == nil && code != 0 {
+			exitState = state
+		}
 	}
 
-	rmErr := forceRemoveContainer(context.Background(), st.dc, st.id)
+	rmErr := c.removeContainer(st.dc, st.id)
+	journalContainerRemoved(st.id, rmErr)
 
 	if waitResp.Error != nil {
 		err := errors.New(waitResp.Error.Message)
@@ -69,17 +85,69 @@ func (c *Cmd) Wait() error {
 	return nil
 }
 
+func (c *Cmd) removeContainer(dc Backend, id string) error {
+	if c.AutoRemove {
+		// The engine removes the container; the wait condition already covered it.
+		return nil
+	}
+	if c.WaitForRemoval {
+		return removeContainerConfirmed(context.Background(), dc, id)
+	}
+	return forceRemoveContainer(context.Background(), dc, id)
+}
+
+// releaseIO stops keep-alive pings, tears down the output streams and closes the
+// user-facing pipes, so no reader of StdoutPipe/StderrPipe and no stdin copy blocks
+// once Wait returns. err is passed to the pipe readers; nil means EOF.
+func (c *Cmd) releaseIO(err error) {
+	c.mu.Lock()
+	attach := c.attach
+	c.attach = nil
+	logStream := c.logStream
+	c.logStream = nil
+	keepAliveStop := c.keepAliveStop
+	c.keepAliveStop = nil
+	c.mu.Unlock()
+	if keepAliveStop != nil {
+		keepAliveStop()
+	}
+	closeAttach(attach)
+	if logStream != nil {
+		_ = logStream.Close()
+	}
+	c.closePipes(err)
+}
+
+// abortWait force-removes the container after a failed wait and returns err,
+// joined with any cleanup error.
+func (c *Cmd) abortWait(st *waitState, err error) error {
+	rmErr := forceRemoveContainer(context.Background(), st.dc, st.id)
+	if rmErr != nil && isNotFoundErr(rmErr) {
+		rmErr = nil
+	}
+	journalContainerRemoved(st.id, rmErr)
+	if rmErr != nil {
+		return errors.Join(err, fmt.Errorf("compose: cleanup failed: %w", rmErr))
+	}
+	return err
+}
+
 // WaitUntilHealthy blocks until the started container becomes healthy.
 // If created via CommandContext, its context controls cancellation.
 //
 // Strict behavior:
-// - If the service has no healthcheck defined, it returns an error immediately.
-// - If the container becomes unhealthy or stops running, it returns an error immediately.
+//   - If the service has no healthcheck defined, it returns an error immediately.
+//   - If the container becomes unhealthy or stops running, it returns an error immediately.
+//   - If the healthcheck command repeatedly cannot be executed, it returns an error
+//     wrapping ErrHealthcheckNotExecutable.
 func (c *Cmd) WaitUntilHealthy() error {
-	if c.loadErr != nil {
-		return c.loadErr
+	return c.waitUntilHealthy(c.contextOrBackground())
+}
+
+func (c *Cmd) waitUntilHealthy(ctx context.Context) error {
+	if c.Err != nil {
+		return c.Err
 	}
-	ctx := c.contextOrBackground()
 	if c.Service.HealthCheck == nil {
 		return errors.New("compose: healthcheck is not defined for this service")
 	}
@@ -126,7 +194,7 @@ const (
 
 func inspectHealthStatus(
 	ctx context.Context,
-	dc dockerAPI,
+	dc Backend,
 	containerID string,
 ) (healthStatus, error) {
 	j, err := dc.ContainerInspect(ctx, containerID)
@@ -145,24 +213,33 @@ func inspectHealthStatus(
 	if j.State.Health == nil {
 		return healthStatusPending, errors.New("compose: container has no healthcheck")
 	}
+	if j.State.Health.Status != "healthy" {
+		var test []string
+		if j.Config != nil && j.Config.Healthcheck != nil {
+			test = j.Config.Healthcheck.Test
+		}
+		if execErr := healthExecError(j.State.Health, test); execErr != nil {
+			return healthStatusPending, execErr
+		}
+	}
 	switch j.State.Health.Status {
 	case "healthy":
 		return healthStatusHealthy, nil
 	case "unhealthy":
-		return healthStatusPending, errors.New("compose: container became unhealthy")
+		return healthStatusPending, unhealthyErr(j.State.Health)
 	default:
 		return healthStatusPending, nil
 	}
 }
 
-func captureContainerState(dc dockerAPI, containerID string) *container.State {
+func captureContainerState(dc Backend, containerID string) *container.State {
 	if dc == nil || containerID == "" {
 		return nil
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	j, err := dc.ContainerInspect(ctx, containerID)
-	if err != nil || j.State == nil {
+	if err != nil || j.ContainerJSONBase == nil || j.State == nil {
 		return nil
 	}
 	return j.State
@@ -170,10 +247,9 @@ func captureContainerState(dc dockerAPI, containerID string) *container.State {
 
 type waitState struct {
 	id          string
-	dc          dockerAPI
+	dc          Backend
 	respCh      <-chan container.WaitResponse
 	errCh       <-chan error
-	attach      *dockertypes.HijackedResponse
 	ioDone      chan struct{}
 	ioErrCh     chan error
 	stdinDone   chan struct{}
@@ -187,6 +263,9 @@ func (c *Cmd) snapshotWaitState() (*waitState, error) {
 	if !c.started {
 		return nil, errors.New("compose: not started")
 	}
+	if c.detached {
+		return nil, errors.New("compose: detached")
+	}
 	if c.containerID == "" || c.docker == nil || c.waitRespCh == nil {
 		return nil, errors.New("compose: internal state incomplete")
 	}
@@ -195,7 +274,6 @@ func (c *Cmd) snapshotWaitState() (*waitState, error) {
 		dc:          c.docker,
 		respCh:      c.waitRespCh,
 		errCh:       c.waitErrCh,
-		attach:      c.attach,
 		ioDone:      c.ioDone,
 		ioErrCh:     c.ioErrCh,
 		stdinDone:   c.stdinDone,
@@ -207,7 +285,7 @@ func (c *Cmd) snapshotWaitState() (*waitState, error) {
 func waitForExit(
 	ctx context.Context,
 	sigCtx context.Context,
-	dc dockerAPI,
+	dc Backend,
 	id string,
 	respCh <-chan container.WaitResponse,
 	errCh <-chan error,
@@ -243,8 +321,7 @@ func waitForExit(
 				continue
 			}
 			if err != nil {
-				_ = forceRemoveContainer(context.Background(), dc, id)
-				return container.WaitResponse{}, err
+				return container.WaitResponse{}, engineErr("wait container", err)
 			}
 		}
 	}
@@ -258,11 +335,9 @@ func closeAttach(attach *dockertypes.HijackedResponse) {
 	attach.Close()
 }
 
+// waitForIO waits for the output forwarder to drain after the container exited.
 func waitForIO(
 	ctx context.Context,
-	dc dockerAPI,
-	id string,
-	attach *dockertypes.HijackedResponse,
 	stdinDone chan struct{},
 	ioDone chan struct{},
 	ioErrCh chan error,
@@ -273,24 +348,22 @@ func waitForIO(
 		case <-time.After(1 * time.Second):
 		}
 	}
-	if ioDone != nil {
-		select {
-		case <-ioDone:
-			if ioErrCh != nil {
-				select {
-				case err, ok := <-ioErrCh:
-					if ok && err != nil {
-						return err
-					}
-				default:
+	if ioDone == nil {
+		return nil
+	}
+	select {
+	case <-ioDone:
+		if ioErrCh != nil {
+			select {
+			case err, ok := <-ioErrCh:
+				if ok && err != nil {
+					return err
 				}
+			default:
 			}
-			return nil
-		case <-ctx.Done():
-			closeAttach(attach)
-			_ = forceRemoveContainer(context.Background(), dc, id)
-			return ctx.Err()
 		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return nil
 }
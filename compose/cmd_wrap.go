@@ -0,0 +1,64 @@
+package compose
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// shellPath is the shell ShellCommand runs scripts with.
+const shellPath = "/bin/sh"
+
+// WrapCommand makes the container run wrapper followed by the command it would
+// run otherwise, e.g. c.WrapCommand("timeout", "30s") limits it to 30 seconds.
+// The wrapped command is resolved like the engine does: the entrypoint (the
+// service's, else the image's) followed by the arguments (Args, else the service's
+// command, else the image's CMD unless the service overrides the entrypoint).
+// Repeated calls nest, the last one outermost. Call it before Start.
+func (c *Cmd) WrapCommand(wrapper ...string) {
+	c.wrapper = append(append([]string(nil), wrapper...), c.wrapper...)
+}
+
+// ShellCommand makes the container run script with /bin/sh -c instead of its
+// command, bypassing the image's entrypoint, like
+// `docker run --entrypoint /bin/sh <image> -c <script>`. The image must provide
+// /bin/sh. It replaces Args and composes with WrapCommand. Call it before Start.
+func (c *Cmd) ShellCommand(script string) {
+	c.Args = []string{"-c", script}
+	c.entrypoint = []string{shellPath}
+}
+
+// applyCommandWrap rewrites cfg so the container runs c's wrapper around the
+// effective command. The image is inspected only when cfg does not set the
+// entrypoint, as its entrypoint and CMD are part of the command then.
+func (c *Cmd) applyCommandWrap(ctx context.Context, dc Backend, cfg *container.Config) error {
+	if len(c.wrapper) == 0 {
+		return nil
+	}
+	var img ImageConfig
+	if len(cfg.Entrypoint) == 0 {
+		s := &Service{config: c.Service}
+		var err error
+		if img, err = s.imageConfig(ctx, dc); err != nil {
+			return err
+		}
+	}
+	argv := effectiveCommand(cfg, img)
+	cfg.Entrypoint = append([]string(nil), c.wrapper...)
+	cfg.Cmd = argv
+	return nil
+}
+
+// effectiveCommand returns the command a container created with cfg from an image
+// with img runs, following the engine's rules: a create-time entrypoint replaces
+// the image's and drops its CMD, and create-time arguments replace the CMD.
+func effectiveCommand(cfg *container.Config, img ImageConfig) []string {
+	entrypoint, args := img.Entrypoint, img.Cmd
+	if len(cfg.Entrypoint) > 0 {
+		entrypoint, args = cfg.Entrypoint, nil
+	}
+	if len(cfg.Cmd) > 0 {
+		args = cfg.Cmd
+	}
+	return append(append([]string(nil), entrypoint...), args...)
+}
@@ -19,9 +19,10 @@ func Command(service string, arg ...string) *Cmd {
 //
 // Note: Each call loads project configuration. For repeated invocations,
 // use LoadProject once and reuse Project.CommandContext().
+// If ctx is nil, the returned Cmd's Err reports it.
 func CommandContext(ctx context.Context, service string, arg ...string) *Cmd {
 	if ctx == nil {
-		panic("nil Context")
+		return cmdWithLoadErr(ctx, errNilContext, arg)
 	}
 	return commandWithContext(ctx, service, arg...)
 }
@@ -52,8 +53,8 @@ func commandWithContext(ctx context.Context, service string, arg ...string) *Cmd
 
 func cmdWithLoadErr(ctx context.Context, err error, arg []string) *Cmd {
 	return &Cmd{
-		Args:    append([]string(nil), arg...),
-		loadErr: err,
-		ctx:     ctx,
+		Args: append([]string(nil), arg...),
+		Err:  err,
+		ctx:  ctx,
 	}
 }
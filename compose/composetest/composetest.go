@@ -0,0 +1,147 @@
+// Package composetest provides test helpers for code that runs commands with
+// package compose.
+package composetest
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hnw/compose-exec/compose"
+)
+
+// DefaultRecorderSize is the number of output bytes a Recorder from Record retains.
+const DefaultRecorderSize = 64 << 10
+
+// pollInterval is how often AssertEventually evaluates its condition.
+const pollInterval = 50 * time.Millisecond
+
+// Recorder is an io.Writer that retains the last bytes written to it in a ring
+// buffer, so failure messages can show recent output without keeping all of it.
+// It is safe for concurrent use.
+type Recorder struct {
+	mu        sync.Mutex
+	buf       []byte
+	start     int
+	full      bool
+	truncated bool
+}
+
+// NewRecorder returns a Recorder that retains the last size bytes.
+func NewRecorder(size int) *Recorder {
+	return &Recorder{buf: make([]byte, 0, max(size, 1))}
+}
+
+// Write records p, discarding the oldest output beyond the Recorder's size.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(p)
+	size := cap(r.buf)
+	if len(p) > size {
+		p = p[len(p)-size:]
+		r.truncated = true
+	}
+	for len(p) > 0 {
+		if !r.full {
+			k := min(len(p), size-len(r.buf))
+			r.buf = append(r.buf, p[:k]...)
+			p = p[k:]
+			r.full = len(r.buf) == size
+			continue
+		}
+		r.truncated = true
+		k := copy(r.buf[r.start:], p)
+		r.start = (r.start + k) % size
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// String returns the retained output, oldest first.
+func (r *Recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return string(r.buf[r.start:]) + string(r.buf[:r.start])
+}
+
+// Truncated reports whether output was discarded because the buffer was full.
+func (r *Recorder) Truncated() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.truncated
+}
+
+// Contains reports whether the retained output contains substr.
+func (r *Recorder) Contains(substr string) bool {
+	return strings.Contains(r.String(), substr)
+}
+
+// summary formats the retained output for failure messages.
+func (r *Recorder) summary() string {
+	out := r.String()
+	if r.Truncated() {
+		out = "...\n" + out
+	}
+	if out == "" {
+		return "(no output)"
+	}
+	return out
+}
+
+var recorders sync.Map // *compose.Cmd -> *Recorder
+
+// Record tees cmd's stdout and stderr into a Recorder of DefaultRecorderSize bytes
+// and returns it; AssertOutputContains then checks cmd's output. Call it before
+// cmd is started.
+func Record(t testing.TB, cmd *compose.Cmd) *Recorder {
+	t.Helper()
+	r := NewRecorder(DefaultRecorderSize)
+	cmd.Stdout = teeWriter(cmd.Stdout, r)
+	cmd.Stderr = teeWriter(cmd.Stderr, r)
+	recorders.Store(cmd, r)
+	t.Cleanup(func() { recorders.Delete(cmd) })
+	return r
+}
+
+// teeWriter returns a writer that writes to both w (if set) and to.
+func teeWriter(w, to io.Writer) io.Writer {
+	if w == nil {
+		return to
+	}
+	return io.MultiWriter(w, to)
+}
+
+// AssertOutputContains fails the test unless the output recorded for cmd so far
+// contains want. cmd must have been passed to Record. To wait for output, combine
+// it with AssertEventually and Recorder.Contains.
+func AssertOutputContains(t testing.TB, cmd *compose.Cmd, want string) {
+	t.Helper()
+	v, ok := recorders.Load(cmd)
+	if !ok {
+		t.Fatalf("composetest: output of service %q is not recorded; call Record before Start",
+			cmd.Service.Name)
+		return
+	}
+	r := v.(*Recorder)
+	if !r.Contains(want) {
+		t.Fatalf("composetest: output of service %q does not contain %q; output:\n%s",
+			cmd.Service.Name, want, r.summary())
+	}
+}
+
+// AssertEventually fails the test unless cond returns true within timeout. cond is
+// evaluated immediately and then periodically.
+func AssertEventually(t testing.TB, cond func() bool, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("composetest: condition not met within %s", timeout)
+			return
+		}
+		time.Sleep(pollInterval)
+	}
+}
@@ -0,0 +1,114 @@
+package composetest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/hnw/compose-exec/compose"
+)
+
+// fakeT records failures instead of stopping the test.
+type fakeT struct {
+	testing.TB
+	failures []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Fatalf(format string, args ...any) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder(8)
+	_, _ = io.WriteString(r, "abc")
+	if r.String() != "abc" || r.Truncated() {
+		t.Fatalf("got=%q truncated=%v", r.String(), r.Truncated())
+	}
+	_, _ = io.WriteString(r, "defgh")
+	_, _ = io.WriteString(r, "ij")
+	if r.String() != "cdefghij" || !r.Truncated() {
+		t.Fatalf("got=%q truncated=%v", r.String(), r.Truncated())
+	}
+	_, _ = io.WriteString(r, "0123456789")
+	if r.String() != "23456789" {
+		t.Fatalf("got=%q", r.String())
+	}
+}
+
+func TestAssertOutputContains(t *testing.T) {
+	cmd := &compose.Cmd{Service: types.ServiceConfig{Name: "web"}}
+	ft := &fakeT{TB: t}
+	AssertOutputContains(ft, cmd, "ready")
+	if len(ft.failures) != 1 || !strings.Contains(ft.failures[0], "call Record") {
+		t.Fatalf("failures=%q", ft.failures)
+	}
+
+	var orig strings.Builder
+	cmd.Stdout = &orig
+	Record(t, cmd)
+	_, _ = io.WriteString(cmd.Stdout, "server ready\n")
+	_, _ = io.WriteString(cmd.Stderr, "warning\n")
+	ft = &fakeT{TB: t}
+	AssertOutputContains(ft, cmd, "ready")
+	AssertOutputContains(ft, cmd, "listening")
+	if len(ft.failures) != 1 || !strings.Contains(ft.failures[0], "server ready\nwarning") {
+		t.Fatalf("failures=%q", ft.failures)
+	}
+	if orig.String() != "server ready\n" {
+		t.Fatalf("stdout was not passed through: %q", orig.String())
+	}
+}
+
+func TestAssertEventually(t *testing.T) {
+	var calls atomic.Int32
+	AssertEventually(t, func() bool { return calls.Add(1) >= 3 }, 5*time.Second)
+
+	ft := &fakeT{TB: t}
+	AssertEventually(ft, func() bool { return false }, 10*time.Millisecond)
+	if len(ft.failures) != 1 {
+		t.Fatalf("failures=%q", ft.failures)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "cli.golden")
+	run := func(ft testing.TB, stdout string) {
+		cmd := &compose.Cmd{Service: types.ServiceConfig{Name: "cli"}}
+		g := NewGolden(ft, cmd, path, WithReplace(regexp.MustCompile(`port \d+`), "port <PORT>"))
+		_, _ = io.WriteString(cmd.Stdout, stdout)
+		_, _ = io.WriteString(cmd.Stderr, "container 0123456789ab exited")
+		g.Verify()
+	}
+
+	ft := &fakeT{TB: t}
+	run(ft, "started at 2024-05-01T10:00:00.123Z on port 8080\n")
+	if len(ft.failures) != 1 || !strings.Contains(ft.failures[0], UpdateGoldenEnv) {
+		t.Fatalf("failures=%q", ft.failures)
+	}
+
+	t.Setenv(UpdateGoldenEnv, "1")
+	run(t, "started at 2024-05-01T10:00:00.123Z on port 8080\n")
+	b, err := os.ReadFile(path)
+	want := "-- stdout --\nstarted at <TIME> on port <PORT>\n" +
+		"-- stderr --\ncontainer <ID> exited\n"
+	if err != nil || string(b) != want {
+		t.Fatalf("golden=%q err=%v", b, err)
+	}
+
+	t.Setenv(UpdateGoldenEnv, "")
+	run(t, "started at 2025-01-02T03:04:05+09:00 on port 9090\n")
+	ft = &fakeT{TB: t}
+	run(ft, "crashed\n")
+	if len(ft.failures) != 1 || !strings.Contains(ft.failures[0], `got:  "crashed"`) {
+		t.Fatalf("failures=%q", ft.failures)
+	}
+}
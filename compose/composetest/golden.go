@@ -0,0 +1,158 @@
+package composetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hnw/compose-exec/compose"
+)
+
+// UpdateGoldenEnv is the environment variable that, when set to a non-empty value,
+// makes Golden.Verify write the golden file instead of comparing against it.
+const UpdateGoldenEnv = "COMPOSE_EXEC_UPDATE_GOLDEN"
+
+// defaultNormalizers replace output that changes from run to run.
+var defaultNormalizers = []replacement{
+	{
+		regexp.MustCompile(
+			`\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:?\d\d)?`,
+		),
+		"<TIME>",
+	},
+	{regexp.MustCompile(`\b[0-9a-f]{64}\b`), "<ID>"},
+	{regexp.MustCompile(`\b[0-9a-f]{12}\b`), "<ID>"},
+}
+
+type replacement struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// GoldenOption configures NewGolden.
+type GoldenOption func(*Golden)
+
+// WithReplace additionally replaces matches of re with repl (as in
+// regexp.Regexp.ReplaceAllString) before comparing, e.g. for ports or temp paths.
+func WithReplace(re *regexp.Regexp, repl string) GoldenOption {
+	return func(g *Golden) { g.normalizers = append(g.normalizers, replacement{re, repl}) }
+}
+
+// Golden snapshot-tests a Cmd's output: its stdout and stderr are captured,
+// normalized (timestamps and container IDs are replaced by <TIME> and <ID>) and
+// compared with a golden file. Run the tests with COMPOSE_EXEC_UPDATE_GOLDEN=1 to
+// record or update the golden files.
+type Golden struct {
+	t           testing.TB
+	path        string
+	normalizers []replacement
+
+	mu     sync.Mutex
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+// NewGolden captures cmd's stdout and stderr for comparison with the golden file at
+// path; output still reaches writers already set on cmd. Call it before cmd is
+// started, and Verify after it finished.
+func NewGolden(t testing.TB, cmd *compose.Cmd, path string, opts ...GoldenOption) *Golden {
+	t.Helper()
+	g := &Golden{
+		t:           t,
+		path:        path,
+		normalizers: append([]replacement(nil), defaultNormalizers...),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	cmd.Stdout = teeWriter(cmd.Stdout, &lockedWriter{mu: &g.mu, w: &g.stdout})
+	cmd.Stderr = teeWriter(cmd.Stderr, &lockedWriter{mu: &g.mu, w: &g.stderr})
+	return g
+}
+
+// Verify compares the normalized output with the golden file and fails the test on
+// a difference, or writes the golden file if COMPOSE_EXEC_UPDATE_GOLDEN is set.
+func (g *Golden) Verify() {
+	g.t.Helper()
+	got := g.snapshot()
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(g.path), 0o750); err != nil {
+			g.t.Fatalf("composetest: create golden dir: %v", err)
+			return
+		}
+		if err := os.WriteFile(g.path, []byte(got), 0o600); err != nil {
+			g.t.Fatalf("composetest: write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(g.path)
+	if errors.Is(err, os.ErrNotExist) {
+		g.t.Fatalf("composetest: golden file %s does not exist; run with %s=1 to create it",
+			g.path, UpdateGoldenEnv)
+		return
+	}
+	if err != nil {
+		g.t.Fatalf("composetest: read golden file: %v", err)
+		return
+	}
+	if got != string(want) {
+		g.t.Fatalf("composetest: output differs from %s (run with %s=1 to update):\n%s",
+			g.path, UpdateGoldenEnv, lineDiff(string(want), got))
+	}
+}
+
+// snapshot returns the normalized output in the golden file format.
+func (g *Golden) snapshot() string {
+	g.mu.Lock()
+	stdout, stderr := g.stdout.String(), g.stderr.String()
+	g.mu.Unlock()
+	return "-- stdout --\n" + g.normalize(stdout) + "-- stderr --\n" + g.normalize(stderr)
+}
+
+func (g *Golden) normalize(s string) string {
+	for _, r := range g.normalizers {
+		s = r.re.ReplaceAllString(s, r.repl)
+	}
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
+
+// lineDiff lists the lines that differ between want and got.
+func lineDiff(want, got string) string {
+	wl := strings.Split(want, "\n")
+	gl := strings.Split(got, "\n")
+	var b strings.Builder
+	for i := range max(len(wl), len(gl)) {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w != g {
+			fmt.Fprintf(&b, "line %d:\n  want: %q\n  got:  %q\n", i+1, w, g)
+		}
+	}
+	return b.String()
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,35 @@
+package compose
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// configHashLabel is the label docker compose uses to detect service config changes.
+const configHashLabel = "com.docker.compose.config-hash"
+
+// serviceConfigHash computes the service config hash the same way as the docker
+// compose CLI: a SHA-256 over the JSON service config, excluding attributes that
+// do not affect the container (build, pull policy, scale, dependencies, profiles).
+func serviceConfigHash(cfg types.ServiceConfig) (string, error) {
+	cfg = copyServiceConfig(cfg)
+	cfg.Build = nil
+	cfg.PullPolicy = ""
+	cfg.Scale = nil
+	if cfg.Deploy != nil {
+		replicas := 1
+		cfg.Deploy.Replicas = &replicas
+	}
+	cfg.DependsOn = nil
+	cfg.Profiles = nil
+
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
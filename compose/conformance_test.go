@@ -0,0 +1,375 @@
+//go:build integration && conformance
+
+package compose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// The conformance harness creates every service of the corpus in
+// testdata/conformance twice: with `docker compose create` and with this package's
+// translator. It diffs the resulting container configurations attribute by
+// attribute and writes a machine-readable support matrix to the file named by
+// COMPOSE_EXEC_CONFORMANCE_REPORT, if set.
+//
+// Run it with:
+//
+//	go test -tags=integration,conformance -run TestConformance ./compose
+
+// conformanceAttr extracts one compose attribute from an inspected container.
+type conformanceAttr struct {
+	name    string
+	extract func(container.InspectResponse) any
+	// known documents an intended or not yet supported difference; mismatches of
+	// such attributes are reported but do not fail the test.
+	known string
+}
+
+var conformanceAttrs = []conformanceAttr{
+	{name: "image", extract: func(r container.InspectResponse) any { return r.Config.Image }},
+	{name: "command", extract: func(r container.InspectResponse) any { return r.Config.Cmd }},
+	{name: "entrypoint", extract: func(r container.InspectResponse) any {
+		return r.Config.Entrypoint
+	}},
+	{name: "working_dir", extract: func(r container.InspectResponse) any {
+		return r.Config.WorkingDir
+	}},
+	{name: "user", extract: func(r container.InspectResponse) any { return r.Config.User }},
+	{name: "environment", extract: func(r container.InspectResponse) any {
+		return sortedCopy(r.Config.Env)
+	}},
+	{name: "labels", extract: func(r container.InspectResponse) any {
+		out := map[string]string{}
+		for k, v := range r.Config.Labels {
+			if !strings.HasPrefix(k, "com.docker.compose.") {
+				out[k] = v
+			}
+		}
+		return out
+	}},
+	{name: "stop_signal", extract: func(r container.InspectResponse) any {
+		return r.Config.StopSignal
+	}},
+	{name: "stop_grace_period", extract: func(r container.InspectResponse) any {
+		return r.Config.StopTimeout
+	}},
+	{name: "healthcheck", extract: func(r container.InspectResponse) any {
+		return r.Config.Healthcheck
+	}},
+	{name: "hostname", extract: func(r container.InspectResponse) any {
+		return r.Config.Hostname
+	}},
+	{name: "tty", extract: func(r container.InspectResponse) any {
+		return r.Config.Tty
+	}},
+	{name: "stdin_open", extract: func(r container.InspectResponse) any {
+		return r.Config.OpenStdin
+	}, known: "stdin is opened only when Cmd.Stdin is set"},
+	{name: "init", extract: func(r container.InspectResponse) any {
+		return r.HostConfig.Init != nil && *r.HostConfig.Init
+	}, known: "init defaults to true so signals reach the command; see SetDefaultInit"},
+	{name: "cap_add", extract: func(r container.InspectResponse) any {
+		return sortedCopy(r.HostConfig.CapAdd)
+	}},
+	{name: "cap_drop", extract: func(r container.InspectResponse) any {
+		return sortedCopy(r.HostConfig.CapDrop)
+	}},
+	{name: "read_only", extract: func(r container.InspectResponse) any {
+		return r.HostConfig.ReadonlyRootfs
+	}},
+	{name: "tmpfs", extract: func(r container.InspectResponse) any { return r.HostConfig.Tmpfs }},
+	{name: "shm_size", extract: func(r container.InspectResponse) any {
+		return r.HostConfig.ShmSize
+	}},
+	{name: "mem_limit", extract: func(r container.InspectResponse) any {
+		return r.HostConfig.Memory
+	}},
+	{name: "cpus", extract: func(r container.InspectResponse) any {
+		return r.HostConfig.NanoCPUs
+	}},
+	{name: "ulimits", extract: func(r container.InspectResponse) any {
+		return r.HostConfig.Ulimits
+	}},
+	{name: "extra_hosts", extract: func(r container.InspectResponse) any {
+		return sortedCopy(r.HostConfig.ExtraHosts)
+	}},
+	{name: "dns", extract: func(r container.InspectResponse) any {
+		return r.HostConfig.DNS
+	}, known: "dns is not applied"},
+	{name: "sysctls", extract: func(r container.InspectResponse) any {
+		return r.HostConfig.Sysctls
+	}, known: "sysctls are not applied"},
+	{name: "security_opt", extract: func(r container.InspectResponse) any {
+		return sortedCopy(r.HostConfig.SecurityOpt)
+	}},
+	{name: "pid", extract: func(r container.InspectResponse) any {
+		return r.HostConfig.PidMode
+	}, known: "pid is not applied"},
+	{name: "ipc", extract: func(r container.InspectResponse) any {
+		return r.HostConfig.IpcMode
+	}, known: "ipc is not applied"},
+	{name: "ports", extract: func(r container.InspectResponse) any {
+		out := map[string][]string{}
+		for port, bindings := range r.HostConfig.PortBindings {
+			for _, b := range bindings {
+				out[string(port)] = append(out[string(port)], b.HostIP+":"+b.HostPort)
+			}
+		}
+		return out
+	}},
+	{name: "volumes", extract: func(r container.InspectResponse) any {
+		out := make([]string, 0, len(r.Mounts))
+		for _, m := range r.Mounts {
+			src := m.Source
+			if m.Type == "volume" {
+				src = m.Name
+			}
+			out = append(out, fmt.Sprintf("%s %s:%s rw=%v", m.Type, src, m.Destination, m.RW))
+		}
+		sort.Strings(out)
+		return out
+	}},
+	{name: "networks", extract: func(r container.InspectResponse) any {
+		out := map[string][]string{}
+		if r.NetworkSettings == nil {
+			return out
+		}
+		for name, ep := range r.NetworkSettings.Networks {
+			out[name] = sortedCopy(ep.Aliases)
+		}
+		return out
+	}},
+}
+
+type conformanceResult struct {
+	Case      string `json:"case"`
+	Service   string `json:"service"`
+	Attribute string `json:"attribute"`
+	// Status is "match", "known" (documented difference) or "mismatch".
+	Status  string `json:"status"`
+	Compose any    `json:"compose,omitempty"`
+	Library any    `json:"library,omitempty"`
+	Note    string `json:"note,omitempty"`
+}
+
+type conformanceReport struct {
+	Results []conformanceResult `json:"results"`
+	// Matrix maps each attribute to "supported", "partial" or "unsupported".
+	Matrix map[string]string `json:"matrix"`
+}
+
+func TestConformance(t *testing.T) {
+	requireDocker(t)
+	if err := exec.Command("docker", "compose", "version").Run(); err != nil {
+		t.Skipf("docker compose CLI unavailable: %v", err)
+	}
+	cases, err := filepath.Glob(filepath.Join("testdata", "conformance", "*.yaml"))
+	if err != nil || len(cases) == 0 {
+		t.Fatalf("no conformance corpus: %v", err)
+	}
+	dc, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		t.Fatalf("docker client: %v", err)
+	}
+	defer dc.Close()
+
+	var report conformanceReport
+	for _, file := range cases {
+		name := strings.TrimSuffix(filepath.Base(file), ".yaml")
+		t.Run(name, func(t *testing.T) {
+			report.Results = append(report.Results, runConformanceCase(t, dc, name, file)...)
+		})
+	}
+	report.Matrix = conformanceMatrix(report.Results)
+
+	if path := os.Getenv("COMPOSE_EXEC_CONFORMANCE_REPORT"); path != "" {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			t.Fatalf("marshal report: %v", err)
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatalf("write report: %v", err)
+		}
+	}
+}
+
+func runConformanceCase(
+	t *testing.T,
+	dc *client.Client,
+	name, file string,
+) []conformanceResult {
+	t.Helper()
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read corpus: %v", err)
+	}
+	dir, proj := setupIntegrationWithComposeYAML(t, string(content))
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	// Create the reference containers, and with them the project's networks and
+	// volumes, which the library containers then join.
+	out, err := exec.CommandContext(ctx, "docker", "compose",
+		"-f", composeFile, "-p", proj.Name, "create").CombinedOutput()
+	if err != nil {
+		t.Fatalf("docker compose create: %v\n%s", err, out)
+	}
+	t.Cleanup(func() {
+		_ = exec.Command("docker", "compose", "-f", composeFile, "-p", proj.Name,
+			"down", "-v").Run()
+	})
+
+	var results []conformanceResult
+	for _, svcName := range proj.ServiceNames() {
+		ref, err := composeContainer(ctx, dc, proj.Name, svcName)
+		if err != nil {
+			t.Fatalf("reference container for %s: %v", svcName, err)
+		}
+		lib, err := libraryContainer(ctx, t, dc, proj, svcName)
+		if err != nil {
+			t.Fatalf("library container for %s: %v", svcName, err)
+		}
+		for _, attr := range conformanceAttrs {
+			want, got := attr.extract(ref), attr.extract(lib)
+			res := conformanceResult{Case: name, Service: svcName, Attribute: attr.name}
+			switch {
+			case reflect.DeepEqual(want, got) && isEmptyAttr(want):
+				// Not exercised by this case.
+				continue
+			case reflect.DeepEqual(want, got):
+				res.Status = "match"
+			case attr.known != "":
+				res.Status, res.Note = "known", attr.known
+				res.Compose, res.Library = want, got
+			default:
+				res.Status = "mismatch"
+				res.Compose, res.Library = want, got
+				t.Errorf("%s/%s: %s differs\ncompose: %#v\nlibrary: %#v",
+					name, svcName, attr.name, want, got)
+			}
+			results = append(results, res)
+		}
+	}
+	return results
+}
+
+func composeContainer(
+	ctx context.Context,
+	dc *client.Client,
+	project, service string,
+) (container.InspectResponse, error) {
+	list, err := dc.ContainerList(ctx, container.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", "com.docker.compose.project="+project),
+			filters.Arg("label", "com.docker.compose.service="+service),
+		),
+	})
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+	if len(list) != 1 {
+		return container.InspectResponse{}, fmt.Errorf("found %d containers", len(list))
+	}
+	return dc.ContainerInspect(ctx, list[0].ID)
+}
+
+// libraryContainer creates (but does not start) the service's container the way
+// Cmd.Start does, and returns its inspection.
+func libraryContainer(
+	ctx context.Context,
+	t *testing.T,
+	dc *client.Client,
+	proj *Project,
+	service string,
+) (container.InspectResponse, error) {
+	svc, err := proj.Service(service)
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+	c := svc.Command()
+	c.ensureService()
+	mounts, err := serviceMounts(c.Service, svc.workingDir, c.projectName(), c.projectVolumes())
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+	cfg, hostCfg, err := c.containerConfigs(mounts)
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+	var netCfg *network.NetworkingConfig
+	if resolved := c.resolveNetworking(ctx, dc); resolved != nil {
+		netCfg = resolved.config
+	}
+	created, err := dc.ContainerCreate(ctx, cfg, hostCfg, netCfg, nil, "")
+	if err != nil {
+		return container.InspectResponse{}, err
+	}
+	t.Cleanup(func() {
+		_ = dc.ContainerRemove(context.Background(), created.ID,
+			container.RemoveOptions{Force: true})
+	})
+	return dc.ContainerInspect(ctx, created.ID)
+}
+
+// conformanceMatrix summarizes results per attribute: "supported" when every case
+// matches, "unsupported" when none does, and "partial" otherwise.
+func conformanceMatrix(results []conformanceResult) map[string]string {
+	matched := map[string]int{}
+	total := map[string]int{}
+	for _, r := range results {
+		total[r.Attribute]++
+		if r.Status == "match" {
+			matched[r.Attribute]++
+		}
+	}
+	out := make(map[string]string, len(total))
+	for attr, n := range total {
+		switch matched[attr] {
+		case n:
+			out[attr] = "supported"
+		case 0:
+			out[attr] = "unsupported"
+		default:
+			out[attr] = "partial"
+		}
+	}
+	return out
+}
+
+func isEmptyAttr(v any) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Map, reflect.Slice:
+		return rv.Len() == 0
+	case reflect.Pointer:
+		return rv.IsNil()
+	default:
+		return rv.IsZero()
+	}
+}
+
+func sortedCopy(in []string) []string {
+	out := append([]string{}, in...)
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,85 @@
+package compose
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContextEnvFunc derives container environment variables ("KEY=value" entries)
+// from the context a Cmd runs with, e.g. to correlate the container's logs and
+// traces with the caller's telemetry.
+type ContextEnvFunc func(ctx context.Context) []string
+
+var (
+	contextEnvMu  sync.Mutex
+	contextEnvFns []ContextEnvFunc
+)
+
+// SetContextEnv makes every Cmd add the entries returned by fns, called with the
+// Cmd's context (see CommandContext), to its container environment. The service's
+// environment and Cmd.Env take precedence over them. Calling SetContextEnv without
+// arguments disables the injection (the default).
+func SetContextEnv(fns ...ContextEnvFunc) {
+	contextEnvMu.Lock()
+	defer contextEnvMu.Unlock()
+	contextEnvFns = append([]ContextEnvFunc(nil), fns...)
+}
+
+// contextEnv returns the entries of the registered ContextEnvFuncs for ctx.
+func contextEnv(ctx context.Context) []string {
+	contextEnvMu.Lock()
+	fns := contextEnvFns
+	contextEnvMu.Unlock()
+	var env []string
+	for _, fn := range fns {
+		env = append(env, fn(ctx)...)
+	}
+	return env
+}
+
+// TraceParentEnv is a ContextEnvFunc setting TRACEPARENT and, if present,
+// TRACESTATE in the W3C Trace Context format from the OpenTelemetry span in ctx,
+// so instrumented programs in the container continue the caller's trace. It
+// returns nothing if ctx carries no valid span.
+func TraceParentEnv(ctx context.Context) []string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	env := []string{
+		"TRACEPARENT=00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-" +
+			sc.TraceFlags().String(),
+	}
+	if ts := sc.TraceState().String(); ts != "" {
+		env = append(env, "TRACESTATE="+ts)
+	}
+	return env
+}
+
+// HostEnv returns a ContextEnvFunc passing the named variables of this process's
+// environment through when set, e.g. HostEnv("CI_JOB_ID", "GITHUB_RUN_ID").
+func HostEnv(keys ...string) ContextEnvFunc {
+	keys = append([]string(nil), keys...)
+	return func(context.Context) []string {
+		var env []string
+		for _, k := range keys {
+			if v, ok := os.LookupEnv(k); ok {
+				env = append(env, k+"="+v)
+			}
+		}
+		return env
+	}
+}
+
+// environ returns the container environment: the context entries, overridden by
+// the service's environment, overridden by Env.
+func (c *Cmd) environ() []string {
+	base := serviceEnvSlice(c.Service)
+	if extra := contextEnv(c.contextOrBackground()); len(extra) > 0 {
+		base = mergeEnv(extra, base)
+	}
+	return mergeEnv(base, c.Env)
+}
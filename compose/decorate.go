@@ -0,0 +1,103 @@
+package compose
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// decorateTimeFormat is RFC 3339 with milliseconds.
+const decorateTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// serviceColors are the ANSI colors used for service prefixes, in the order
+// `docker compose up` uses them.
+var serviceColors = []string{
+	"36", "33", "32", "35", "34", "96", "93", "92", "95", "94",
+}
+
+// DecorateOption configures DecorateWriter.
+type DecorateOption func(*decorateSpec)
+
+type decorateSpec struct {
+	timestamps bool
+	service    string
+	color      bool
+}
+
+// WithTimestamps starts every line with the RFC 3339 time it was written.
+func WithTimestamps() DecorateOption {
+	return func(s *decorateSpec) { s.timestamps = true }
+}
+
+// WithColor starts every line with "service | ", colored per service like
+// `docker compose up`. The color depends only on the name, so a service keeps its
+// color across runs. Colors are omitted when the NO_COLOR environment variable is
+// set.
+func WithColor(service string) DecorateOption {
+	return func(s *decorateSpec) {
+		s.service = service
+		s.color = os.Getenv("NO_COLOR") == ""
+	}
+}
+
+// DecorateWriter returns a writer that decorates each line written to w as
+// configured by opts, e.g. for Cmd.Stdout and Cmd.Stderr of long-running services.
+// Output is passed through as it arrives; partial lines are not held back. The
+// returned writer is safe for concurrent use.
+func DecorateWriter(w io.Writer, opts ...DecorateOption) io.Writer {
+	d := &decoratedWriter{w: w, lineStart: true}
+	for _, opt := range opts {
+		opt(&d.spec)
+	}
+	if d.spec.service != "" {
+		d.prefix = d.spec.service + " | "
+		if d.spec.color {
+			d.prefix = "\x1b[" + serviceColor(d.spec.service) + "m" + d.prefix + "\x1b[0m"
+		}
+	}
+	return d
+}
+
+func serviceColor(service string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(service))
+	return serviceColors[h.Sum32()%uint32(len(serviceColors))]
+}
+
+type decoratedWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	spec      decorateSpec
+	prefix    string
+	lineStart bool
+	buf       bytes.Buffer
+}
+
+func (d *decoratedWriter) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.buf.Reset()
+	for rest := p; len(rest) > 0; {
+		if d.lineStart {
+			d.buf.WriteString(d.prefix)
+			if d.spec.timestamps {
+				d.buf.WriteString(time.Now().Format(decorateTimeFormat))
+				d.buf.WriteByte(' ')
+			}
+		}
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		d.buf.Write(line)
+		rest = rest[len(line):]
+		d.lineStart = line[len(line)-1] == '\n'
+	}
+	if _, err := d.w.Write(d.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
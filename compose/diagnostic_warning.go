@@ -20,7 +20,7 @@ func maybeWarnMissingComposeFileInContainer(wd string) {
 	}
 	writeWarning(
 		os.Stderr,
-		"Running inside a container but 'docker-compose.yml' is not found. Ensure the host's current directory is mounted to the same path inside this container (Mirror Mount).",
+		"Running inside a container but 'docker-compose.yml' is not found. Ensure the host's current directory is mounted to the same path inside this container (Mirror Mount); compose.SelfMountSpec computes the required mounts.",
 	)
 }
 
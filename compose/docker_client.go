@@ -2,23 +2,64 @@ package compose
 
 import (
 	"context"
+	"fmt"
 	"io"
 
 	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/checkpoint"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/system"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
-type dockerAPI interface {
+// Backend is the container engine API this package drives: the subset of the
+// Docker Engine API client it uses, in Docker API types. The default backend is
+// the Docker Engine client configured by SetClientOptions; *client.Client
+// implements it. Alternative engines, e.g. the Podman native API, nerdctl or a
+// remote agent, can be implemented out of tree and selected with RegisterBackend
+// and SetBackend, reusing the compose translation of this package.
+//
+// The interface grows with the features of this package; implementations should
+// embed a fallback (or return errdefs "not implemented" errors) for methods they
+// cannot support.
+type Backend interface {
+	ServerVersion(ctx context.Context) (dockertypes.Version, error)
+	Ping(ctx context.Context) (dockertypes.Ping, error)
+	Info(ctx context.Context) (system.Info, error)
+	DaemonHost() string
+	// ClientVersion returns the API version in use (negotiated after the first request).
+	ClientVersion() string
+
 	ImageInspectWithRaw(
 		ctx context.Context,
 		imageID string,
 	) (image.InspectResponse, []byte, error)
+	ImageInspect(
+		ctx context.Context,
+		imageID string,
+		inspectOpts ...client.ImageInspectOption,
+	) (image.InspectResponse, error)
 	ImagePull(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error)
+	ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
+	ImageSave(
+		ctx context.Context,
+		imageIDs []string,
+		saveOpts ...client.ImageSaveOption,
+	) (io.ReadCloser, error)
+	ImageLoad(
+		ctx context.Context,
+		input io.Reader,
+		loadOpts ...client.ImageLoadOption,
+	) (image.LoadResponse, error)
+	ImageRemove(
+		ctx context.Context,
+		imageID string,
+		options image.RemoveOptions,
+	) ([]image.DeleteResponse, error)
 
 	ContainerCreate(
 		ctx context.Context,
@@ -40,13 +81,59 @@ type dockerAPI interface {
 		condition container.WaitCondition,
 	) (<-chan container.WaitResponse, <-chan error)
 	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+	ContainerTop(
+		ctx context.Context,
+		containerID string,
+		arguments []string,
+	) (container.TopResponse, error)
 	ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
+	ContainerRestart(ctx context.Context, containerID string, options container.StopOptions) error
 	ContainerKill(ctx context.Context, containerID string, signal string) error
 	ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error
+	ContainerPause(ctx context.Context, containerID string) error
+	ContainerUnpause(ctx context.Context, containerID string) error
+	ContainerUpdate(
+		ctx context.Context,
+		containerID string,
+		updateConfig container.UpdateConfig,
+	) (container.UpdateResponse, error)
+	CheckpointCreate(
+		ctx context.Context,
+		containerID string,
+		options checkpoint.CreateOptions,
+	) error
+	ContainerCommit(
+		ctx context.Context,
+		containerID string,
+		options container.CommitOptions,
+	) (container.CommitResponse, error)
 	ContainerList(
 		ctx context.Context,
 		options container.ListOptions,
 	) ([]container.Summary, error)
+	ContainerLogs(
+		ctx context.Context,
+		containerID string,
+		options container.LogsOptions,
+	) (io.ReadCloser, error)
+	CopyToContainer(
+		ctx context.Context,
+		containerID, dstPath string,
+		content io.Reader,
+		options container.CopyToContainerOptions,
+	) error
+	ContainerExecCreate(
+		ctx context.Context,
+		containerID string,
+		options container.ExecOptions,
+	) (container.ExecCreateResponse, error)
+	ContainerExecStart(ctx context.Context, execID string, options container.ExecStartOptions) error
+	ContainerExecAttach(
+		ctx context.Context,
+		execID string,
+		options container.ExecAttachOptions,
+	) (dockertypes.HijackedResponse, error)
+	ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error)
 
 	NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error)
 	NetworkCreate(
@@ -55,10 +142,29 @@ type dockerAPI interface {
 		options network.CreateOptions,
 	) (network.CreateResponse, error)
 	NetworkRemove(ctx context.Context, networkID string) error
+	NetworkConnect(
+		ctx context.Context,
+		networkID, containerID string,
+		config *network.EndpointSettings,
+	) error
+	NetworkDisconnect(ctx context.Context, networkID, containerID string, force bool) error
 	VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error)
+	VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error)
+	VolumeRemove(ctx context.Context, volumeID string, force bool) error
 	Close() error
 }
 
-func newDockerClient() (dockerAPI, error) {
-	return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+func newDockerClient() (Backend, error) {
+	if factory := activeBackendFactory(); factory != nil {
+		b, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("compose: backend %s: %w", activeBackendName(), err)
+		}
+		return withAudit(b), nil
+	}
+	cli, err := client.NewClientWithOpts(currentClientOptions().clientOpts()...)
+	if err != nil {
+		return nil, err
+	}
+	return withAudit(cli), nil
 }
@@ -0,0 +1,93 @@
+package compose
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+// dockerSocketPath is where the socket is mounted in the container, and the
+// engine's default socket path on daemon hosts we cannot inspect.
+const dockerSocketPath = "/var/run/docker.sock"
+
+// MountDockerSocket bind-mounts the Docker engine socket into the container at
+// /var/run/docker.sock, for services that need engine access (e.g. cleaners or
+// builders). Call it before Start. The container gains full control over the
+// engine; Start writes a warning to os.Stderr. Use SetPathMapping if the socket
+// to mount is at another path on the daemon host, e.g. for a rootless daemon.
+func (c *Cmd) MountDockerSocket() {
+	c.mountDockerSocket = true
+}
+
+// dockerSocketMount returns the socket mount for the daemon at host, the groups to
+// add to the container, and warnings to report. A local socket path covered by
+// SetPathMapping is left untranslated, like other bind sources before
+// mapBindSources.
+//
+// Bind sources are resolved on the daemon's side. A local unix-socket daemon at a
+// default path (Linux hosts, and Docker-outside-of-Docker setups mounting the
+// socket there) or at a mapped path is mounted with its group, so non-root users
+// can access it. For other daemons, e.g. Docker Desktop or tcp:// and ssh://
+// daemons, the default socket path on the daemon machine is mounted instead.
+func dockerSocketMount(host string) (mount.Mount, []string, []string) {
+	warnings := []string{
+		"the Docker socket is mounted into the container; it has full control of the engine",
+	}
+	m := mount.Mount{Type: mount.TypeBind, Source: dockerSocketPath, Target: dockerSocketPath}
+
+	path, ok := strings.CutPrefix(host, "unix://")
+	if !ok {
+		warnings = append(warnings, fmt.Sprintf(
+			"daemon %s is not a local unix socket; mounting %s from the daemon host",
+			host,
+			dockerSocketPath,
+		))
+		return m, nil, warnings
+	}
+	if _, mapped := lookupHostPath(path); !mapped && !defaultSocketPaths[path] {
+		// The client's socket is not the daemon's file (Docker Desktop forwards it
+		// from another machine), so neither its path nor its group apply there.
+		warnings = append(warnings, fmt.Sprintf(
+			"daemon socket %s may not exist on the daemon host; mounting %s from there "+
+				"(use SetPathMapping to mount another path)",
+			path,
+			dockerSocketPath,
+		))
+		return m, nil, warnings
+	}
+	m.Source = path
+
+	// The daemon's socket itself, or bind-mounted from it: the group is the same.
+	var groups []string
+	if gid, known := fileGroupID(path); known && gid != 0 {
+		groups = append(groups, strconv.FormatUint(uint64(gid), 10))
+	}
+	return m, groups, warnings
+}
+
+// defaultSocketPaths are the engine's default socket paths on Linux daemon hosts.
+var defaultSocketPaths = map[string]bool{
+	dockerSocketPath:   true,
+	"/run/docker.sock": true,
+}
+
+// extraMounts returns the per-Cmd mounts (ExtraMounts plus the Docker socket, if
+// requested) and the groups they require.
+func (c *Cmd) extraMounts(dc Backend) ([]mount.Mount, []string) {
+	if !c.mountDockerSocket {
+		return c.ExtraMounts, nil
+	}
+	sock, groups, warnings := dockerSocketMount(dc.DaemonHost())
+	warnAll(warnings)
+	extra := append(append([]mount.Mount(nil), c.ExtraMounts...), sock)
+	return extra, groups
+}
+
+func warnAll(msgs []string) {
+	for _, msg := range msgs {
+		writeWarning(os.Stderr, msg)
+	}
+}
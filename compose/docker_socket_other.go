@@ -0,0 +1,8 @@
+//go:build !unix
+
+package compose
+
+// fileGroupID is not implemented on this platform.
+func fileGroupID(_ string) (uint32, bool) {
+	return 0, false
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package compose
+
+import "golang.org/x/sys/unix"
+
+// fileGroupID returns the group owning path.
+func fileGroupID(path string) (uint32, bool) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, false
+	}
+	return st.Gid, true
+}
@@ -4,19 +4,75 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
 )
 
+// Values accepted by DownOptions.RemoveImages, mirroring `docker compose down --rmi`.
+const (
+	// RemoveImagesLocal removes only images local to the project: those labeled with
+	// the project name or named "<project>-<service>", as built images are, for the
+	// services of the project's containers.
+	RemoveImagesLocal = "local"
+	// RemoveImagesAll additionally removes every image used by the project's containers.
+	RemoveImagesAll = "all"
+)
+
+// DownOptions configures DownWithOptions.
+type DownOptions struct {
+	// RemoveImages selects which images to remove after containers and networks:
+	// "" (none), RemoveImagesLocal, or RemoveImagesAll.
+	// Images still used by other containers are left in place.
+	RemoveImages string
+	// RemoveVolumes also removes the project's volumes, like `docker compose down
+	// --volumes`. External volumes are not labeled with the project and are kept.
+	RemoveVolumes bool
+	// LockTimeout, if positive, makes DownWithOptions hold the project lock (see
+	// WithProjectLock) exclusively, waiting at most this long for it. The lock is
+	// also taken, with the timeout given there, if the project was loaded with
+	// WithProjectLock in this process.
+	LockTimeout time.Duration
+}
+
 // Down cleans up all resources (containers and networks) associated with the project.
 // It ignores "not found" errors for idempotency.
 func Down(ctx context.Context, projectName string) error {
+	return DownWithOptions(ctx, projectName, DownOptions{})
+}
+
+// DownWithOptions is like Down but accepts options, e.g. to also remove project images.
+func DownWithOptions(ctx context.Context, projectName string, opts DownOptions) error {
 	if projectName == "" {
 		return fmt.Errorf("compose: project name is required")
 	}
+	switch opts.RemoveImages {
+	case "", RemoveImagesLocal, RemoveImagesAll:
+	default:
+		return fmt.Errorf(
+			"compose: invalid RemoveImages %q (supported: %q, %q)",
+			opts.RemoveImages,
+			RemoveImagesLocal,
+			RemoveImagesAll,
+		)
+	}
+
+	timeout, lock := projectLockTimeout(projectName)
+	if opts.LockTimeout > 0 {
+		timeout, lock = opts.LockTimeout, true
+	}
+	if lock {
+		unlock, lockErr := lockProject(ctx, projectName, true, timeout)
+		if lockErr != nil {
+			return lockErr
+		}
+		defer unlock()
+	}
 
 	cli, err := newDockerClient()
 	if err != nil {
@@ -24,57 +80,242 @@ func Down(ctx context.Context, projectName string) error {
 	}
 	defer func() { _ = cli.Close() }()
 
-	var errs []string
+	return downProject(ctx, cli, projectName, opts)
+}
+
+func downProject(ctx context.Context, cli Backend, projectName string, opts DownOptions) error {
+	errs := &MultiError{Op: "down"}
+	projectFilter := filters.Arg("label", "com.docker.compose.project="+projectName)
 
 	// ---------------------------------------------------------
 	// 1. Remove Containers (MUST be done before removing networks)
 	// ---------------------------------------------------------
 	containers, err := cli.ContainerList(ctx, container.ListOptions{
-		All: true,
-		Filters: filters.NewArgs(
-			filters.Arg("label", "com.docker.compose.project="+projectName),
-		),
+		All:     true,
+		Filters: filters.NewArgs(projectFilter),
 	})
 	if err != nil {
-		return fmt.Errorf("compose: failed to list containers: %w", err)
+		return engineErr("list containers", err)
 	}
 
+	usedImages := make([]string, 0, len(containers))
+	var services []string
 	for _, c := range containers {
-		rmErr := cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true})
-		if rmErr == nil {
-			continue
+		if c.ImageID != "" {
+			usedImages = append(usedImages, c.ImageID)
 		}
-		if cerrdefs.IsNotFound(rmErr) ||
-			strings.Contains(strings.ToLower(rmErr.Error()), "not found") {
+		if svc := c.Labels["com.docker.compose.service"]; svc != "" {
+			services = append(services, svc)
+		}
+		rmErr := cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true})
+		journalContainerRemoved(c.ID, rmErr)
+		if rmErr == nil || isNotFoundErr(rmErr) {
 			continue
 		}
-		errs = append(errs, fmt.Sprintf("container %s: %v", c.Names, rmErr))
+		errs.add("container", strings.Join(c.Names, ","), engineErr("remove container", rmErr))
 	}
 
 	// ---------------------------------------------------------
 	// 2. Remove Networks
 	// ---------------------------------------------------------
 	list, err := cli.NetworkList(ctx, network.ListOptions{
-		Filters: filters.NewArgs(filters.Arg("label", "com.docker.compose.project="+projectName)),
+		Filters: filters.NewArgs(projectFilter),
 	})
 	if err != nil {
-		errs = append(errs, fmt.Sprintf("failed to list networks: %v", err))
+		errs.add("network", "", fmt.Errorf("failed to list networks: %w", err))
 	} else {
 		for _, n := range list {
-			err := cli.NetworkRemove(ctx, n.ID)
-			if err == nil {
-				continue
+			if rmErr := removeNetwork(ctx, cli, n); rmErr != nil {
+				errs.add("network", n.Name, rmErr)
 			}
-			if cerrdefs.IsNotFound(err) ||
-				strings.Contains(strings.ToLower(err.Error()), "not found") {
-				continue
+		}
+	}
+
+	// ---------------------------------------------------------
+	// 3. Remove Volumes and Images (opt-in)
+	// ---------------------------------------------------------
+	if opts.RemoveVolumes {
+		removeProjectVolumes(ctx, cli, projectFilter, errs)
+	}
+	if opts.RemoveImages != "" {
+		removeProjectImages(ctx, cli, projectName, services, opts, usedImages, errs)
+	}
+
+	return errs.errOrNil()
+}
+
+// networkRemoveBackoff are the delays between attempts to remove a network that
+// still has active endpoints, e.g. a container of a concurrent Start or one being
+// removed by the daemon.
+var networkRemoveBackoff = []time.Duration{
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	400 * time.Millisecond,
+	800 * time.Millisecond,
+	1600 * time.Millisecond,
+}
+
+// NetworkInUseError is reported by Down for a network that still has containers
+// attached after retrying, typically containers of another project sharing it.
+type NetworkInUseError struct {
+	// Network is the network name.
+	Network string
+	// Containers names the containers attached to the network, if they could be
+	// listed.
+	Containers []string
+	// Err is the daemon's error.
+	Err error
+}
+
+func (e *NetworkInUseError) Error() string {
+	if len(e.Containers) == 0 {
+		return fmt.Sprintf("compose: network %s is still in use", e.Network)
+	}
+	return fmt.Sprintf("compose: network %s is still in use by %s",
+		e.Network, strings.Join(e.Containers, ", "))
+}
+
+// Unwrap returns the daemon's error.
+func (e *NetworkInUseError) Unwrap() error { return e.Err }
+
+// removeNetwork removes n, treating a network removed concurrently as removed and
+// retrying with backoff while it has active endpoints.
+func removeNetwork(ctx context.Context, cli Backend, n network.Summary) error {
+	for attempt := 0; ; attempt++ {
+		err := cli.NetworkRemove(ctx, n.ID)
+		journalNetworkRemoved(n.ID, err)
+		if err == nil || isNotFoundErr(err) {
+			return nil
+		}
+		if !isActiveEndpointsErr(err) {
+			return engineErr("remove network", err)
+		}
+		if attempt == len(networkRemoveBackoff) {
+			return &NetworkInUseError{
+				Network:    n.Name,
+				Containers: networkContainers(ctx, cli, n.ID),
+				Err:        engineErr("remove network", err),
 			}
-			errs = append(errs, fmt.Sprintf("network %s: %v", n.Name, err))
+		}
+		t := time.NewTimer(networkRemoveBackoff[attempt])
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// isActiveEndpointsErr reports whether a network removal failed because
+// containers are still attached to the network.
+func isActiveEndpointsErr(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "active endpoints")
+}
+
+// networkContainers names the containers attached to the network id.
+func networkContainers(ctx context.Context, cli Backend, id string) []string {
+	list, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("network", id)),
+	})
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(list))
+	for _, c := range list {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// removeProjectVolumes removes the volumes labeled with the project.
+func removeProjectVolumes(
+	ctx context.Context,
+	cli Backend,
+	projectFilter filters.KeyValuePair,
+	errs *MultiError,
+) {
+	vols, err := cli.VolumeList(ctx, volume.ListOptions{Filters: filters.NewArgs(projectFilter)})
+	if err != nil {
+		errs.add("volume", "", engineErr("list volumes", err))
+		return
+	}
+	for _, v := range vols.Volumes {
+		if v == nil {
+			continue
+		}
+		rmErr := cli.VolumeRemove(ctx, v.Name, false)
+		journalVolumeRemoved(v.Name, rmErr)
+		if rmErr != nil && !isNotFoundErr(rmErr) {
+			errs.add("volume", v.Name, engineErr("remove volume", rmErr))
+		}
+	}
+}
+
+// removeProjectImages removes the images labeled with the project and those named
+// after its services as built by docker compose (<project>-<service>). A pattern
+// like <project>-* would also match the images of other projects sharing the
+// prefix, e.g. ephemeral ones.
+func removeProjectImages(
+	ctx context.Context,
+	cli Backend,
+	projectName string,
+	services []string,
+	opts DownOptions,
+	usedImages []string,
+	errs *MultiError,
+) {
+	seen := map[string]struct{}{}
+	var targets []string
+	add := func(id string) {
+		if _, ok := seen[id]; ok {
+			return
+		}
+		seen[id] = struct{}{}
+		targets = append(targets, id)
+	}
+
+	listFilters := []filters.Args{
+		filters.NewArgs(filters.Arg("label", "com.docker.compose.project="+projectName)),
+	}
+	if len(services) > 0 {
+		refs := filters.NewArgs()
+		for _, svc := range services {
+			refs.Add("reference", projectName+"-"+svc)
+		}
+		listFilters = append(listFilters, refs)
+	}
+	for _, f := range listFilters {
+		images, err := cli.ImageList(ctx, image.ListOptions{Filters: f})
+		if err != nil {
+			errs.add("image", "", fmt.Errorf("failed to list images: %w", err))
+			continue
+		}
+		for _, img := range images {
+			add(img.ID)
+		}
+	}
+	if opts.RemoveImages == RemoveImagesAll {
+		for _, id := range usedImages {
+			add(id)
 		}
 	}
 
-	if len(errs) > 0 {
-		return fmt.Errorf("compose: down errors: %s", strings.Join(errs, "; "))
+	for _, id := range targets {
+		_, err := cli.ImageRemove(ctx, id, image.RemoveOptions{PruneChildren: true})
+		if err == nil || isNotFoundErr(err) || cerrdefs.IsConflict(err) {
+			// Conflict: the image is still used by containers outside this project.
+			continue
+		}
+		errs.add("image", id, engineErr("remove image", err))
 	}
-	return nil
+}
+
+func isNotFoundErr(err error) bool {
+	return cerrdefs.IsNotFound(err) || strings.Contains(strings.ToLower(err.Error()), "not found")
 }
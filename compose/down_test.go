@@ -0,0 +1,523 @@
+package compose
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+)
+
+func TestDownProject_RemoveImages(t *testing.T) {
+	newFake := func() *fakeDocker {
+		return &fakeDocker{
+			containerListResp: []container.Summary{
+				{
+					ID:      "c1",
+					ImageID: "sha256:alpine",
+					Labels:  map[string]string{"com.docker.compose.service": "web"},
+				},
+			},
+			imageListResp: map[string][]image.Summary{
+				"label=com.docker.compose.project=proj": {{ID: "sha256:built"}},
+				"reference=proj-web": {
+					{ID: "sha256:built"},
+					{ID: "sha256:tagged"},
+				},
+				// Images of a sibling project sharing the name prefix.
+				"reference=proj-*": {{ID: "sha256:sibling"}},
+			},
+			imageRemoveErr: map[string]error{
+				"sha256:alpine": cerrdefs.ErrConflict,
+			},
+		}
+	}
+
+	t.Run("none", func(t *testing.T) {
+		fd := newFake()
+		if err := downProject(context.Background(), fd, "proj", DownOptions{}); err != nil {
+			t.Fatalf("downProject: %v", err)
+		}
+		if len(fd.imageRemoveCalls) != 0 {
+			t.Fatalf("imageRemoveCalls=%v", fd.imageRemoveCalls)
+		}
+	})
+
+	t.Run("local", func(t *testing.T) {
+		fd := newFake()
+		opts := DownOptions{RemoveImages: RemoveImagesLocal}
+		if err := downProject(context.Background(), fd, "proj", opts); err != nil {
+			t.Fatalf("downProject: %v", err)
+		}
+		want := []string{"sha256:built", "sha256:tagged"}
+		if !reflect.DeepEqual(fd.imageRemoveCalls, want) {
+			t.Fatalf("imageRemoveCalls=%v want=%v", fd.imageRemoveCalls, want)
+		}
+	})
+
+	t.Run("all ignores images in use elsewhere", func(t *testing.T) {
+		fd := newFake()
+		opts := DownOptions{RemoveImages: RemoveImagesAll}
+		if err := downProject(context.Background(), fd, "proj", opts); err != nil {
+			t.Fatalf("downProject: %v", err)
+		}
+		want := []string{"sha256:built", "sha256:tagged", "sha256:alpine"}
+		if !reflect.DeepEqual(fd.imageRemoveCalls, want) {
+			t.Fatalf("imageRemoveCalls=%v want=%v", fd.imageRemoveCalls, want)
+		}
+	})
+}
+
+func TestDownProject_RemoveVolumes(t *testing.T) {
+	vols := []*volume.Volume{{Name: "proj_data"}, {Name: "missing"}}
+	fd := &fakeDocker{volumeListResp: vols}
+	if err := downProject(context.Background(), fd, "proj", DownOptions{}); err != nil {
+		t.Fatalf("downProject: %v", err)
+	}
+	if len(fd.volumeRemoves) != 0 {
+		t.Fatalf("volumes removed without RemoveVolumes: %v", fd.volumeRemoves)
+	}
+
+	opts := DownOptions{RemoveVolumes: true}
+	if err := downProject(context.Background(), fd, "proj", opts); err != nil {
+		t.Fatalf("downProject: %v", err)
+	}
+	if want := []string{"proj_data", "missing"}; !reflect.DeepEqual(fd.volumeRemoves, want) {
+		t.Fatalf("removed volumes=%v want=%v", fd.volumeRemoves, want)
+	}
+
+	fd = &fakeDocker{volumeListResp: vols[:1], volumeRemoveErr: errors.New("volume is in use")}
+	err := downProject(context.Background(), fd, "proj", opts)
+	var me *MultiError
+	if !errors.As(err, &me) || len(me.Errors) != 1 || me.Errors[0].Kind != "volume" {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestDownProject_NetworkRemovalRaces(t *testing.T) {
+	defer func(b []time.Duration) { networkRemoveBackoff = b }(networkRemoveBackoff)
+	networkRemoveBackoff = []time.Duration{time.Millisecond, time.Millisecond}
+	active := cerrdefs.ErrPermissionDenied.WithMessage(
+		"error while removing network: network proj_default id n1 has active endpoints")
+	nets := []network.Summary{{ID: "n1", Name: "proj_default"}}
+
+	fd := &fakeDocker{
+		networkListResp:   nets,
+		networkRemoveErrs: []error{cerrdefs.ErrNotFound.WithMessage("network n1 not found")},
+	}
+	if err := downProject(context.Background(), fd, "proj", DownOptions{}); err != nil {
+		t.Fatalf("network removed concurrently: %v", err)
+	}
+
+	fd = &fakeDocker{networkListResp: nets, networkRemoveErrs: []error{active, active}}
+	if err := downProject(context.Background(), fd, "proj", DownOptions{}); err != nil {
+		t.Fatalf("endpoints released while retrying: %v", err)
+	}
+	if len(fd.networkRemoveCalls) != 3 {
+		t.Fatalf("networkRemoveCalls=%v want 3 attempts", fd.networkRemoveCalls)
+	}
+
+	fd = &fakeDocker{
+		networkListResp:   nets,
+		networkRemoveErrs: []error{active, active, active},
+		networkContainers: map[string][]container.Summary{
+			"n1": {{ID: "c9", Names: []string{"/other-app-1"}}},
+		},
+	}
+	err := downProject(context.Background(), fd, "proj", DownOptions{})
+	var inUse *NetworkInUseError
+	if !errors.As(err, &inUse) || inUse.Network != "proj_default" ||
+		!reflect.DeepEqual(inUse.Containers, []string{"other-app-1"}) {
+		t.Fatalf("err=%v want NetworkInUseError naming other-app-1", err)
+	}
+	if !strings.Contains(err.Error(), "network proj_default is still in use by other-app-1") {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestDownWithOptions_RejectsUnknownRemoveImages(t *testing.T) {
+	err := DownWithOptions(context.Background(), "proj", DownOptions{RemoveImages: "some"})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestMultiError_UnwrapAndFilter(t *testing.T) {
+	errs := &MultiError{Op: "down"}
+	if errs.errOrNil() != nil {
+		t.Fatalf("empty MultiError must be nil")
+	}
+	errs.add("network", "proj_default", cerrdefs.ErrConflict)
+	errs.add("container", "/c1", cerrdefs.ErrUnavailable)
+
+	var err error = errs
+	if !errors.Is(err, cerrdefs.ErrConflict) || !errors.Is(err, cerrdefs.ErrUnavailable) {
+		t.Fatalf("errors.Is must see sub-errors: %v", err)
+	}
+	want := "compose: down errors: network proj_default: conflict; container /c1: unavailable"
+	if err.Error() != want {
+		t.Fatalf("Error()=%q want=%q", err.Error(), want)
+	}
+
+	rest := errs.Filter(func(re *ResourceError) bool {
+		return !errors.Is(re, cerrdefs.ErrConflict)
+	})
+	var me *MultiError
+	if !errors.As(rest, &me) || len(me.Errors) != 1 || me.Errors[0].Kind != "container" {
+		t.Fatalf("Filter=%v", rest)
+	}
+	if errs.Filter(func(*ResourceError) bool { return false }) != nil {
+		t.Fatalf("Filter removing everything must return nil")
+	}
+}
+
+func TestRecoverJournalDir_ReapsStaleEntries(t *testing.T) {
+	dir := t.TempDir()
+	host := journalHostname()
+	write := func(name string, entries ...journalEntry) string {
+		t.Helper()
+		var buf []byte
+		for _, e := range entries {
+			b, err := json.Marshal(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf = append(append(buf, b...), '\n')
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, buf, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// Same PID with a different nonce: an earlier incarnation of this process.
+	stale := write(
+		journalFileName(host, os.Getpid(), "stale"),
+		journalEntry{Op: journalOpCreate, Kind: journalKindNetwork, ID: "n1"},
+		journalEntry{Op: journalOpCreate, Kind: journalKindContainer, ID: "c1"},
+		journalEntry{Op: journalOpCreate, Kind: journalKindContainer, ID: "c2"},
+		journalEntry{Op: journalOpRemove, Kind: journalKindContainer, ID: "c2"},
+		journalEntry{Op: journalOpCreate, Kind: journalKindVolume, ID: "v1", Name: "v1"},
+		journalEntry{Op: journalOpCreate, Kind: journalKindVolume, ID: "v2", Name: "v2"},
+		journalEntry{Op: journalOpRemove, Kind: journalKindVolume, ID: "v2"},
+	)
+	// Our own journal must be left alone.
+	own := write(
+		journalFileName(host, os.Getpid(), journalNonce),
+		journalEntry{Op: journalOpCreate, Kind: journalKindContainer, ID: "mine"},
+	)
+
+	fd := &fakeDocker{}
+	if err := recoverJournalDir(context.Background(), fd, dir); err != nil {
+		t.Fatalf("recoverJournalDir: %v", err)
+	}
+	if !reflect.DeepEqual(fd.removedIDs, []string{"c1"}) {
+		t.Fatalf("removed containers=%v want=[c1]", fd.removedIDs)
+	}
+	if !reflect.DeepEqual(fd.networkRemoveCalls, []string{"n1"}) {
+		t.Fatalf("removed networks=%v want=[n1]", fd.networkRemoveCalls)
+	}
+	// Volumes hold data: they are reported, never removed.
+	if len(fd.volumeRemoves) != 0 {
+		t.Fatalf("removed volumes=%v want none", fd.volumeRemoves)
+	}
+	entries, err := readJournal(own)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = append(entries,
+		journalEntry{Op: journalOpCreate, Kind: journalKindVolume, ID: "v1", Name: "v1"})
+	kept := reapJournalEntries(context.Background(), fd, entries, &MultiError{})
+	if !reflect.DeepEqual(kept, []string{"v1"}) {
+		t.Fatalf("kept volumes=%v want=[v1]", kept)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("stale journal still present: %v", err)
+	}
+	if _, err := os.Stat(own); err != nil {
+		t.Fatalf("own journal removed: %v", err)
+	}
+}
+
+func TestJournal_DeletedWhenEverythingRemoved(t *testing.T) {
+	dir := t.TempDir()
+	if err := SetJournalDir(dir); err != nil {
+		t.Fatalf("SetJournalDir: %v", err)
+	}
+	defer func() { _ = SetJournalDir("") }()
+	path := filepath.Join(dir, journalFileName(journalHostname(), os.Getpid(), journalNonce))
+
+	journalRecord(journalOpCreate, journalKindNetwork, "n1", "proj_default")
+	journalRecord(journalOpCreate, journalKindContainer, "c1", "proj-app-1")
+	journalContainerRemoved("c1", nil)
+	journalRecord(journalOpCreate, journalKindVolume, "proj_data", "proj_data")
+	journalVolumeRemoved("proj_data", nil)
+	// Resources this process did not create are not recorded.
+	journalContainerRemoved("other", nil)
+	entries, err := readJournal(path)
+	if err != nil || len(entries) != 5 {
+		t.Fatalf("entries=%+v err=%v", entries, err)
+	}
+
+	journalNetworkRemoved("n1", cerrdefs.ErrConflict.WithMessage("has active endpoints"))
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("journal removed while the network is alive: %v", err)
+	}
+	journalNetworkRemoved("n1", nil)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("journal still present after everything was removed: %v", err)
+	}
+
+	// A later create starts a new file.
+	journalRecord(journalOpCreate, journalKindContainer, "c2", "proj-app-2")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("journal not recreated: %v", err)
+	}
+}
+
+func TestEngineErr_Classification(t *testing.T) {
+	if err := engineErr("create container", nil); err != nil {
+		t.Fatalf("engineErr(nil)=%v want=nil", err)
+	}
+
+	tests := []struct {
+		err       error
+		category  ErrorCategory
+		status    int
+		temporary bool
+	}{
+		{cerrdefs.ErrNotFound.WithMessage("no such container"), CategoryNotFound, 404, false},
+		{cerrdefs.ErrConflict.WithMessage("name in use"), CategoryConflict, 409, true},
+		{cerrdefs.ErrInternal.WithMessage("boom"), CategoryInternal, 500, false},
+		{context.Canceled, CategoryCanceled, 0, false},
+		{errors.New("plain"), CategoryUnknown, 0, false},
+	}
+	for _, tt := range tests {
+		err := engineErr("create container", tt.err)
+		var ee *EngineError
+		if !errors.As(err, &ee) {
+			t.Fatalf("engineErr(%v) is %T, want *EngineError", tt.err, err)
+		}
+		if ee.Category != tt.category || ee.StatusCode != tt.status {
+			t.Fatalf("%v: category=%q status=%d want=%q %d",
+				tt.err, ee.Category, ee.StatusCode, tt.category, tt.status)
+		}
+		if ee.Temporary() != tt.temporary {
+			t.Fatalf("%v: temporary=%v want=%v", tt.err, ee.Temporary(), tt.temporary)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("%v: wrapped error lost", tt.err)
+		}
+		if again := engineErr("start container", err); again != err {
+			t.Fatalf("re-wrapping changed the error: %v", again)
+		}
+	}
+
+	err := engineErr("inspect container", cerrdefs.ErrNotFound)
+	if !cerrdefs.IsNotFound(err) || !isNotFoundErr(err) {
+		t.Fatalf("errdefs classification lost: %v", err)
+	}
+	if got, want := err.Error(), "compose: inspect container: not found"; got != want {
+		t.Fatalf("Error()=%q want=%q", got, want)
+	}
+}
+
+func TestStopProject_KeepsContainers(t *testing.T) {
+	running := []container.Summary{{ID: "c1", Names: []string{"/proj-web-1"}}}
+	fd := &fakeDocker{containerListResp: running}
+	if err := stopProject(context.Background(), fd, "proj", time.Second); err != nil {
+		t.Fatalf("stopProject: %v", err)
+	}
+	if fd.stopCalls != 1 || fd.removeCalls != 0 {
+		t.Fatalf("stopCalls=%d removeCalls=%d", fd.stopCalls, fd.removeCalls)
+	}
+
+	fd = &fakeDocker{containerListResp: running, stopErr: true}
+	err := stopProject(context.Background(), fd, "proj", 0)
+	var me *MultiError
+	if !errors.As(err, &me) || me.Op != "stop" || len(me.Errors) != 1 ||
+		me.Errors[0].Kind != "container" {
+		t.Fatalf("err=%#v", err)
+	}
+}
+
+func TestRestartServices_Rolling(t *testing.T) {
+	proj := &Project{Name: "proj", Services: types.Services{
+		"db":  {Name: "db"},
+		"web": {Name: "web"},
+	}}
+	newFake := func(health string) *fakeDocker {
+		return &fakeDocker{
+			serviceContainers: map[string][]container.Summary{
+				"db":  {{ID: "db1"}},
+				"web": {{ID: "web1"}, {ID: "web2"}},
+			},
+			inspectResp: container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{
+				State: &container.State{Running: true, Health: &container.Health{Status: health}},
+			}},
+		}
+	}
+
+	fd := newFake("healthy")
+	opts := RestartOptions{Rolling: true}
+	if err := proj.restartServices(context.Background(), fd, opts, nil); err != nil {
+		t.Fatalf("restartServices: %v", err)
+	}
+	if want := []string{"db1", "web1", "web2"}; !reflect.DeepEqual(fd.restartedIDs, want) {
+		t.Fatalf("restartedIDs=%v want=%v", fd.restartedIDs, want)
+	}
+
+	fd = newFake("unhealthy")
+	err := proj.restartServices(context.Background(), fd, opts, []string{"db", "web"})
+	var me *MultiError
+	if !errors.As(err, &me) || len(me.Errors) != 1 || me.Errors[0].Name != "db" {
+		t.Fatalf("err=%v", err)
+	}
+	if want := []string{"db1"}; !reflect.DeepEqual(fd.restartedIDs, want) {
+		t.Fatalf("restartedIDs=%v want=%v", fd.restartedIDs, want)
+	}
+
+	// A container that exited after the restart fails at once, healthcheck or not.
+	fd = newFake("")
+	fd.inspectResp.State = &container.State{Status: "exited", ExitCode: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = proj.restartServices(ctx, fd, opts, []string{"db"})
+	if err == nil || !strings.Contains(err.Error(), "container stopped") {
+		t.Fatalf("exited: err=%v", err)
+	}
+}
+
+func TestRestartServices_SubSecondTimeout(t *testing.T) {
+	proj := &Project{Name: "proj", Services: types.Services{"db": {Name: "db"}}}
+	fd := &fakeDocker{serviceContainers: map[string][]container.Summary{"db": {{ID: "db1"}}}}
+	opts := RestartOptions{Timeouts: map[string]time.Duration{"db": 500 * time.Millisecond}}
+	if err := proj.restartServices(context.Background(), fd, opts, nil); err != nil {
+		t.Fatalf("restartServices: %v", err)
+	}
+	if len(fd.restartOpts) != 1 || fd.restartOpts[0].Timeout == nil ||
+		*fd.restartOpts[0].Timeout != 1 {
+		t.Fatalf("restartOpts=%+v want a 1s timeout", fd.restartOpts)
+	}
+}
+
+func TestStopOptions(t *testing.T) {
+	for _, tc := range []struct {
+		timeout time.Duration
+		want    int
+	}{
+		{time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{10 * time.Second, 10},
+	} {
+		opts := stopOptions(tc.timeout)
+		if opts.Timeout == nil || *opts.Timeout != tc.want {
+			t.Fatalf("stopOptions(%v).Timeout=%v want %d", tc.timeout, opts.Timeout, tc.want)
+		}
+	}
+	if opts := stopOptions(0); opts.Timeout != nil {
+		t.Fatalf("stopOptions(0).Timeout=%v want engine default", *opts.Timeout)
+	}
+}
+
+func TestRestartServices_MissingContainers(t *testing.T) {
+	proj := &Project{Name: "proj", Services: types.Services{"db": {Name: "db"}}}
+	fd := &fakeDocker{serviceContainers: map[string][]container.Summary{}}
+	if err := proj.restartServices(context.Background(), fd, RestartOptions{}, nil); err != nil {
+		t.Fatalf("implicit: %v", err)
+	}
+	err := proj.restartServices(context.Background(), fd, RestartOptions{}, []string{"db"})
+	if err == nil || !strings.Contains(err.Error(), "no running container") {
+		t.Fatalf("explicit: err=%v", err)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	managed := map[string]string{managedLabel: "true"}
+	past := map[string]string{
+		managedLabel:   "true",
+		expiresAtLabel: now.Add(-time.Minute).Format(time.RFC3339),
+	}
+	future := map[string]string{
+		managedLabel:   "true",
+		expiresAtLabel: now.Add(time.Hour).Format(time.RFC3339),
+	}
+	old := now.Add(-3 * time.Hour)
+	fd := &fakeDocker{
+		containerListResp: []container.Summary{
+			{ID: "expired", Labels: past, State: container.StateRunning, Created: now.Unix()},
+			{ID: "valid", Labels: future, State: container.StateExited, Created: old.Unix()},
+			{ID: "old", Labels: managed, State: container.StateExited, Created: old.Unix()},
+			{ID: "busy", Labels: managed, State: container.StateRunning, Created: old.Unix()},
+			{ID: "new", Labels: managed, State: container.StateExited, Created: now.Unix()},
+			{ID: "foreign", State: container.StateExited, Created: old.Unix()},
+		},
+		networkListResp: []network.Summary{
+			{ID: "n-expired", Name: "a_default", Labels: past, Created: now},
+			{ID: "n-old", Name: "b_default", Labels: managed, Created: old},
+			{ID: "n-foreign", Name: "c_default", Created: old},
+		},
+		networkRemoveErrs: []error{
+			cerrdefs.ErrConflict.WithMessage("error: network a_default has active endpoints"),
+		},
+		volumeListResp: []*volume.Volume{
+			{Name: "v-expired", Labels: past},
+			{Name: "v-old", Labels: managed, CreatedAt: old.Format(time.RFC3339)},
+			{Name: "v-valid", Labels: future},
+			{Name: "v-foreign", CreatedAt: old.Format(time.RFC3339)},
+		},
+	}
+	if err := janitor(context.Background(), fd, now, 2*time.Hour); err != nil {
+		t.Fatalf("janitor: %v", err)
+	}
+	if !reflect.DeepEqual(fd.removedIDs, []string{"expired", "old"}) {
+		t.Fatalf("removed containers=%v", fd.removedIDs)
+	}
+	if !fd.removeOpts[0].Force || fd.removeOpts[1].Force {
+		t.Fatalf("only labeled containers are force-removed: %+v", fd.removeOpts)
+	}
+	if !reflect.DeepEqual(fd.networkRemoveCalls, []string{"n-expired", "n-old"}) {
+		t.Fatalf("removed networks=%v", fd.networkRemoveCalls)
+	}
+	if !reflect.DeepEqual(fd.volumeRemoves, []string{"v-expired"}) {
+		t.Fatalf("removed volumes=%v", fd.volumeRemoves)
+	}
+
+	fd = &fakeDocker{containerListResp: []container.Summary{
+		{ID: "old", Labels: managed, State: container.StateExited, Created: 1},
+	}}
+	if err := janitor(context.Background(), fd, now, 0); err != nil || len(fd.removedIDs) != 0 {
+		t.Fatalf("janitor without olderThan: err=%v removed=%v", err, fd.removedIDs)
+	}
+}
+
+func TestSetResourceTTL(t *testing.T) {
+	defer SetResourceTTL(0)
+	if labels := addGlobalLabels(nil); !reflect.DeepEqual(labels, map[string]string{
+		managedLabel: "true",
+	}) {
+		t.Fatalf("labels without TTL=%v", labels)
+	}
+	SetResourceTTL(time.Hour)
+	at, err := time.Parse(time.RFC3339, addGlobalLabels(nil)[expiresAtLabel])
+	if err != nil {
+		t.Fatalf("expires-at: %v", err)
+	}
+	if d := time.Until(at); d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("expires-at in %v", d)
+	}
+}
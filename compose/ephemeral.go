@@ -0,0 +1,65 @@
+package compose
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ephemeralCleanupTimeout bounds the Down call run by an ephemeral project's cleanup.
+const ephemeralCleanupTimeout = 30 * time.Second
+
+// EphemeralProject loads the compose project in dir under a randomized project name
+// (the regular name plus a random suffix), so parallel runs of the same compose
+// files never share containers, networks, or volumes. opts are passed to
+// LoadProject.
+//
+// cleanup removes the project's containers, networks, and volumes and returns
+// when it is done; calls after the first do nothing and return the first result.
+// In tests, register it with t.Cleanup:
+//
+//	proj, cleanup, err := compose.EphemeralProject(ctx, dir)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	t.Cleanup(func() {
+//		if err := cleanup(); err != nil {
+//			t.Error(err)
+//		}
+//	})
+func EphemeralProject(
+	ctx context.Context,
+	dir string,
+	opts ...LoadOption,
+) (proj *Project, cleanup func() error, err error) {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	loaded, err := LoadProject(ctx, dir, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	sfx, err := randSuffix(4)
+	if err != nil {
+		return nil, nil, err
+	}
+	eph, err := loaded.WithName(loaded.Name + "-" + sfx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := eph.Name
+	var (
+		once    sync.Once
+		downErr error
+	)
+	cleanup = func() error {
+		once.Do(func() {
+			downCtx, cancel := context.WithTimeout(context.Background(), ephemeralCleanupTimeout)
+			defer cancel()
+			downErr = DownWithOptions(downCtx, name, DownOptions{RemoveVolumes: true})
+		})
+		return downErr
+	}
+	return eph, cleanup, nil
+}
@@ -1,9 +1,15 @@
 package compose
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 
+	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
 )
 
 // ExitError is returned when a container exits with a non-zero status.
@@ -46,3 +52,209 @@ func (e *ExitError) Pid() int {
 	}
 	return 0
 }
+
+// WriteError is returned by Wait when writing the container's output to Cmd.Stdout
+// or Cmd.Stderr failed. It is returned instead of the container's exit status,
+// which is then not meaningful: the container may have been stopped because of it
+// (see Cmd.StopOnWriteError).
+type WriteError struct {
+	// Stream is "stdout" or "stderr".
+	Stream string
+	// Err is the writer's error.
+	Err error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("compose: write %s: %v", e.Stream, e.Err)
+}
+
+// Unwrap returns the writer's error.
+func (e *WriteError) Unwrap() error { return e.Err }
+
+// ProfileError is returned for a service that the project defines but excludes
+// because none of its profiles is active (see Project.WithProfiles).
+type ProfileError struct {
+	// Service is the requested service.
+	Service string
+	// Profiles lists the profiles that enable the service.
+	Profiles []string
+}
+
+func (e *ProfileError) Error() string {
+	quoted := make([]string, len(e.Profiles))
+	for i, p := range e.Profiles {
+		quoted[i] = fmt.Sprintf("%q", p)
+	}
+	return fmt.Sprintf(
+		"compose: service %q is disabled: it requires profile %s (see Project.WithProfiles)",
+		e.Service,
+		strings.Join(quoted, " or "),
+	)
+}
+
+// ResourceError is the failure of a single resource within a batch operation.
+type ResourceError struct {
+	// Kind is the kind of resource or item that failed, e.g. "container",
+	// "network", "volume", "image" or "service"; batch operations over Cmds use
+	// "cmd" and "step", and RecoverAndClean uses "journal" for journal files. New
+	// kinds may be added.
+	Kind string
+	// Name identifies the resource. It may be empty for listing failures.
+	Name string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *ResourceError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Kind, e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ResourceError) Unwrap() error { return e.Err }
+
+// MultiError aggregates per-resource failures of a batch operation such as Down
+// or Project.ForEachService. errors.Is and errors.As inspect every sub-error.
+type MultiError struct {
+	// Op names the batch operation, e.g. "down".
+	Op string
+	// Errors holds one entry per failed resource.
+	Errors []*ResourceError
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, re := range e.Errors {
+		msgs = append(msgs, re.Error())
+	}
+	return fmt.Sprintf("compose: %s errors: %s", e.Op, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the sub-errors.
+func (e *MultiError) Unwrap() []error {
+	out := make([]error, 0, len(e.Errors))
+	for _, re := range e.Errors {
+		out = append(out, re)
+	}
+	return out
+}
+
+// Filter returns a MultiError holding only the sub-errors for which keep returns
+// true, or nil if none remain. It lets callers ignore specific failure classes.
+func (e *MultiError) Filter(keep func(*ResourceError) bool) error {
+	out := &MultiError{Op: e.Op}
+	for _, re := range e.Errors {
+		if keep(re) {
+			out.Errors = append(out.Errors, re)
+		}
+	}
+	return out.errOrNil()
+}
+
+func (e *MultiError) add(kind, name string, err error) {
+	e.Errors = append(e.Errors, &ResourceError{Kind: kind, Name: name, Err: err})
+}
+
+// errOrNil returns e if it holds any sub-error, and an untyped nil otherwise.
+func (e *MultiError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// ErrorCategory classifies Docker Engine API errors.
+type ErrorCategory string
+
+// Engine error categories. They mirror the errdefs classes used by the Docker SDK.
+const (
+	CategoryNotFound         ErrorCategory = "not-found"
+	CategoryConflict         ErrorCategory = "conflict"
+	CategoryInvalidArgument  ErrorCategory = "invalid-argument"
+	CategoryUnauthorized     ErrorCategory = "unauthorized"
+	CategoryPermissionDenied ErrorCategory = "permission-denied"
+	CategoryNotImplemented   ErrorCategory = "not-implemented"
+	CategoryUnavailable      ErrorCategory = "unavailable"
+	CategoryInternal         ErrorCategory = "internal"
+	CategoryCanceled         ErrorCategory = "canceled"
+	CategoryDeadline         ErrorCategory = "deadline-exceeded"
+	// CategoryConnection means the daemon could not be reached at all.
+	CategoryConnection ErrorCategory = "connection"
+	CategoryUnknown    ErrorCategory = "unknown"
+)
+
+// EngineError is a failed Docker Engine API call. It unwraps to the SDK error, so
+// errdefs checks keep working, while callers can branch on StatusCode or Category
+// without importing Docker packages.
+type EngineError struct {
+	// Op is the failed operation, e.g. "create container" or "pull image".
+	Op string
+	// StatusCode is the HTTP status implied by Category, or 0 when no response
+	// was received (CategoryConnection, CategoryCanceled, CategoryDeadline).
+	StatusCode int
+	// Category classifies the failure.
+	Category ErrorCategory
+	// Err is the underlying SDK error.
+	Err error
+}
+
+func (e *EngineError) Error() string {
+	return fmt.Sprintf("compose: %s: %v", e.Op, e.Err)
+}
+
+func (e *EngineError) Unwrap() error { return e.Err }
+
+// Temporary reports whether retrying the operation may succeed.
+func (e *EngineError) Temporary() bool {
+	switch e.Category {
+	case CategoryUnavailable, CategoryConnection, CategoryDeadline, CategoryConflict:
+		return true
+	default:
+		return false
+	}
+}
+
+// engineErr wraps a Docker SDK error in an *EngineError. It returns nil for nil,
+// and err unchanged if it already is one.
+func engineErr(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var ee *EngineError
+	if errors.As(err, &ee) {
+		return err
+	}
+	cat, status := classifyEngineErr(err)
+	return &EngineError{Op: op, StatusCode: status, Category: cat, Err: err}
+}
+
+func classifyEngineErr(err error) (ErrorCategory, int) {
+	switch {
+	case cerrdefs.IsNotFound(err):
+		return CategoryNotFound, http.StatusNotFound
+	case cerrdefs.IsConflict(err), cerrdefs.IsAlreadyExists(err):
+		return CategoryConflict, http.StatusConflict
+	case cerrdefs.IsInvalidArgument(err):
+		return CategoryInvalidArgument, http.StatusBadRequest
+	case cerrdefs.IsUnauthorized(err):
+		return CategoryUnauthorized, http.StatusUnauthorized
+	case cerrdefs.IsPermissionDenied(err):
+		return CategoryPermissionDenied, http.StatusForbidden
+	case cerrdefs.IsNotImplemented(err):
+		return CategoryNotImplemented, http.StatusNotImplemented
+	case cerrdefs.IsUnavailable(err):
+		return CategoryUnavailable, http.StatusServiceUnavailable
+	case cerrdefs.IsInternal(err):
+		return CategoryInternal, http.StatusInternalServerError
+	case errors.Is(err, context.Canceled), cerrdefs.IsCanceled(err):
+		return CategoryCanceled, 0
+	case errors.Is(err, context.DeadlineExceeded), cerrdefs.IsDeadlineExceeded(err):
+		return CategoryDeadline, 0
+	case client.IsErrConnectionFailed(err):
+		return CategoryConnection, 0
+	default:
+		return CategoryUnknown, 0
+	}
+}
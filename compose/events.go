@@ -0,0 +1,130 @@
+package compose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event types written to the event stream.
+const (
+	// EventPulled follows ensuring the image is present; Duration is the pull phase.
+	EventPulled = "pulled"
+	// EventCreated follows creating and attaching the container; Duration is the
+	// create phase.
+	EventCreated = "created"
+	// EventStarted follows starting the container and running its init commands.
+	EventStarted = "started"
+	// EventExited follows the container's exit; Duration is the run phase.
+	EventExited = "exited"
+	// EventFinished is the last event of a Cmd: Start failed or Wait returned.
+	// Duration is the total of all phases and Error is set on failure.
+	EventFinished = "finished"
+)
+
+// Event is one line of the event stream enabled with SetEventWriter.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"event"`
+	Project   string    `json:"project,omitempty"`
+	Service   string    `json:"service"`
+	Container string    `json:"container,omitempty"`
+	Image     string    `json:"image,omitempty"`
+	// ExitCode is set by EventExited and by EventFinished once the container exited.
+	ExitCode *int `json:"exit_code,omitempty"`
+	// DurationMS is the duration of the phase the event completes, in milliseconds.
+	DurationMS int64  `json:"duration_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// eventWriter serializes events so concurrent Cmds never interleave lines.
+type eventWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var (
+	eventsMu      sync.Mutex
+	currentEvents *eventWriter
+)
+
+// SetEventWriter makes every Cmd write its lifecycle events to w as
+// newline-delimited JSON (see Event), e.g. for CI systems to render progress and
+// summaries of containerized steps. A nil w disables the stream (the default).
+// Writes to w are serialized; a failing write is reported as a warning on
+// os.Stderr and does not affect the Cmd.
+func SetEventWriter(w io.Writer) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if w == nil {
+		currentEvents = nil
+		return
+	}
+	currentEvents = &eventWriter{w: w}
+}
+
+func activeEvents() *eventWriter {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	return currentEvents
+}
+
+// emitEvent fills in the Cmd's identity and writes e to the active event stream,
+// if any.
+func (c *Cmd) emitEvent(e Event) {
+	ew := activeEvents()
+	if ew == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	e.Project = c.projectName()
+	e.Service = c.Service.Name
+	if e.Container == "" {
+		c.mu.Lock()
+		e.Container = c.containerID
+		c.mu.Unlock()
+	}
+	if err := ew.write(e); err != nil {
+		writeWarning(os.Stderr, fmt.Sprintf("event stream write failed: %v", err))
+	}
+}
+
+func (c *Cmd) emitPhase(typ string, d time.Duration) {
+	c.emitEvent(Event{Type: typ, Image: c.Service.Image, DurationMS: d.Milliseconds()})
+}
+
+func (c *Cmd) emitExited(code int, d time.Duration) {
+	c.emitEvent(Event{Type: EventExited, ExitCode: &code, DurationMS: d.Milliseconds()})
+}
+
+// emitFinished reports the outcome of Start (on failure) or Wait.
+func (c *Cmd) emitFinished(err error) {
+	e := Event{Type: EventFinished, DurationMS: c.Timing().Total().Milliseconds()}
+	var ee *ExitError
+	switch {
+	case err == nil:
+		code := 0
+		e.ExitCode = &code
+	case errors.As(err, &ee):
+		e.ExitCode = &ee.Code
+		e.Error = err.Error()
+	default:
+		e.Error = err.Error()
+	}
+	c.emitEvent(e)
+}
+
+func (ew *eventWriter) write(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	_, err = ew.w.Write(append(b, '\n'))
+	return err
+}
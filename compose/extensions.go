@@ -0,0 +1,39 @@
+package compose
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// Extension decodes the top-level extension field name (e.g. "x-test") into
+// target and reports whether it is present. Decoding goes through JSON, so target
+// may use json struct tags. All extensions are available as p.Extensions.
+func (p *Project) Extension(name string, target any) (bool, error) {
+	if p == nil {
+		return false, nil
+	}
+	return decodeExtension(p.Extensions, name, target)
+}
+
+// Extension decodes the service-level extension field name (e.g. "x-test") into
+// target and reports whether it is present. See Project.Extension.
+func (s *Service) Extension(name string, target any) (bool, error) {
+	return decodeExtension(s.config.Extensions, name, target)
+}
+
+func decodeExtension(ext types.Extensions, name string, target any) (bool, error) {
+	v, ok := ext[name]
+	if !ok {
+		return false, nil
+	}
+	b, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(b, target)
+	}
+	if err != nil {
+		return true, fmt.Errorf("compose: decode extension %q: %w", name, err)
+	}
+	return true, nil
+}
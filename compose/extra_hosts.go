@@ -0,0 +1,181 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/system"
+)
+
+const (
+	// hostGateway is the extra_hosts address the daemon replaces with the address
+	// of the host, e.g. "host.docker.internal:host-gateway".
+	hostGateway = "host-gateway"
+	// hostGatewayMinAPI is the first Engine API version resolving hostGateway.
+	hostGatewayMinAPI = "1.41"
+)
+
+// hostDockerInternalName is the host name Docker Desktop provides for the host.
+const hostDockerInternalName = "host.docker.internal"
+
+var (
+	hostDockerInternalMu      sync.Mutex
+	hostDockerInternalEnabled bool
+)
+
+// SetHostDockerInternal makes every Cmd add the extra host
+// "host.docker.internal:host-gateway" when the daemon is a Linux Docker Engine,
+// which, unlike Docker Desktop, does not provide that name. Compose files written
+// for Docker Desktop then reach services on the host unchanged, e.g. on Linux CI
+// runners. Services that define host.docker.internal themselves are left alone.
+// It is disabled by default.
+func SetHostDockerInternal(enabled bool) {
+	hostDockerInternalMu.Lock()
+	defer hostDockerInternalMu.Unlock()
+	hostDockerInternalEnabled = enabled
+}
+
+func hostDockerInternalActive() bool {
+	hostDockerInternalMu.Lock()
+	defer hostDockerInternalMu.Unlock()
+	return hostDockerInternalEnabled
+}
+
+// provisionHostDockerInternal adds host.docker.internal to hosts if
+// SetHostDockerInternal is enabled and the daemon does not provide it.
+func provisionHostDockerInternal(
+	ctx context.Context,
+	dc Backend,
+	hosts []string,
+) ([]string, error) {
+	if !hostDockerInternalActive() {
+		return hosts, nil
+	}
+	for _, entry := range hosts {
+		if host, _, err := parseExtraHost(entry); err == nil && host == hostDockerInternalName {
+			return hosts, nil
+		}
+	}
+	info, err := dc.Info(ctx)
+	if err != nil {
+		return nil, engineErr("get daemon info", err)
+	}
+	if !needsHostDockerInternal(info) {
+		return hosts, nil
+	}
+	return append(hosts, hostDockerInternalName+":"+hostGateway), nil
+}
+
+// needsHostDockerInternal reports whether the daemon runs Linux containers without
+// resolving host.docker.internal itself, as Docker Desktop does.
+func needsHostDockerInternal(info system.Info) bool {
+	return info.OSType == "linux" && !strings.Contains(info.OperatingSystem, "Docker Desktop")
+}
+
+// parseExtraHost splits an extra_hosts entry in "host:ip" or "host=ip" form.
+func parseExtraHost(entry string) (host, ip string, err error) {
+	sep := ":"
+	if strings.Contains(entry, "=") {
+		sep = "="
+	}
+	host, ip, ok := strings.Cut(entry, sep)
+	host, ip = strings.TrimSpace(host), strings.TrimSpace(ip)
+	if !ok || host == "" || ip == "" {
+		return "", "", fmt.Errorf("compose: invalid extra host %q (want host:ip)", entry)
+	}
+	return host, ip, nil
+}
+
+// mergeExtraHosts adds the Cmd.ExtraHosts entries extra to the service's entries
+// base. An entry of extra replaces the entries of base for the same host name.
+func mergeExtraHosts(base, extra []string) ([]string, error) {
+	if len(extra) == 0 {
+		return base, nil
+	}
+	override := map[string]bool{}
+	added := make([]string, 0, len(extra))
+	for _, entry := range extra {
+		host, ip, err := parseExtraHost(entry)
+		if err != nil {
+			return nil, err
+		}
+		override[host] = true
+		added = append(added, host+":"+ip)
+	}
+	merged := make([]string, 0, len(base)+len(added))
+	for _, entry := range base {
+		if host, _, err := parseExtraHost(entry); err == nil && override[host] {
+			continue
+		}
+		merged = append(merged, entry)
+	}
+	return append(merged, added...), nil
+}
+
+// resolveExtraHosts finalizes hostCfg.ExtraHosts for the daemon dc.
+func resolveExtraHosts(
+	ctx context.Context,
+	dc Backend,
+	hostCfg *container.HostConfig,
+) error {
+	hosts, err := provisionHostDockerInternal(ctx, dc, hostCfg.ExtraHosts)
+	if err != nil {
+		return err
+	}
+	if hosts, err = resolveHostGateway(ctx, dc, hosts); err != nil {
+		return err
+	}
+	hostCfg.ExtraHosts = hosts
+	return nil
+}
+
+// resolveHostGateway replaces host-gateway in hosts with the gateway of the
+// default bridge network for daemons too old to resolve it themselves, so the
+// value works on every supported Docker Engine.
+func resolveHostGateway(ctx context.Context, dc Backend, hosts []string) ([]string, error) {
+	if apiVersionSupports(dc.ClientVersion(), hostGatewayMinAPI) {
+		return hosts, nil
+	}
+	var gateway string
+	out := make([]string, 0, len(hosts))
+	for _, entry := range hosts {
+		host, ip, err := parseExtraHost(entry)
+		if err != nil || ip != hostGateway {
+			out = append(out, entry)
+			continue
+		}
+		if gateway == "" {
+			if gateway, err = bridgeGateway(ctx, dc); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, host+":"+gateway)
+	}
+	return out, nil
+}
+
+func bridgeGateway(ctx context.Context, dc Backend) (string, error) {
+	nets, err := dc.NetworkList(ctx, network.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", "bridge")),
+	})
+	if err != nil {
+		return "", engineErr("list networks", err)
+	}
+	for _, n := range nets {
+		if n.Name != "bridge" {
+			continue
+		}
+		for _, cfg := range n.IPAM.Config {
+			if cfg.Gateway != "" {
+				return cfg.Gateway, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("compose: cannot resolve %s: the default bridge network has no "+
+		"gateway; use the host's address instead", hostGateway)
+}
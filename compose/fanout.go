@@ -0,0 +1,83 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+)
+
+// ServiceResult is the outcome of running a command in one service.
+type ServiceResult struct {
+	// Service is the compose service name.
+	Service string
+	// Stdout and Stderr hold the captured output.
+	Stdout []byte
+	Stderr []byte
+	// ExitCode is the container exit status, or -1 if the command did not exit
+	// normally (e.g. the container could not be started).
+	ExitCode int
+	// Err is the error returned by Run, if any.
+	Err error
+}
+
+// ForEachService runs args concurrently in every service matching selector
+// (all services if selector is nil) and waits for all of them.
+//
+// Results are returned in service name order. If any service fails, the returned
+// error is a *MultiError with one "service" entry per failure.
+func (p *Project) ForEachService(
+	ctx context.Context,
+	selector ServiceSelector,
+	arg ...string,
+) ([]ServiceResult, error) {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	if p == nil {
+		return nil, errors.New("compose: project is nil")
+	}
+	services := p.ServicesMatching(selector)
+	results := make([]ServiceResult, len(services))
+
+	var wg sync.WaitGroup
+	for i, svc := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runServiceCommand(ctx, svc, arg)
+		}()
+	}
+	wg.Wait()
+
+	errs := &MultiError{Op: "for-each-service"}
+	for _, r := range results {
+		if r.Err != nil {
+			errs.add("service", r.Service, r.Err)
+		}
+	}
+	return results, errs.errOrNil()
+}
+
+func runServiceCommand(ctx context.Context, svc *Service, arg []string) ServiceResult {
+	var stdout, stderr bytes.Buffer
+	cmd := svc.CommandContext(ctx, arg...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	res := ServiceResult{Service: svc.Name()}
+	res.Err = cmd.Run()
+	res.Stdout = stdout.Bytes()
+	res.Stderr = stderr.Bytes()
+
+	var ee *ExitError
+	switch {
+	case res.Err == nil:
+		res.ExitCode = 0
+	case errors.As(res.Err, &ee):
+		res.ExitCode = ee.Code
+	default:
+		res.ExitCode = -1
+	}
+	return res
+}
@@ -0,0 +1,158 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/versions"
+)
+
+// ErrFeatureUnsupportedByDaemon is matched (via errors.Is) by errors returned when
+// a service uses a feature that the negotiated Engine API version cannot express.
+var ErrFeatureUnsupportedByDaemon = errors.New("compose: feature unsupported by daemon")
+
+// FeatureUnsupportedError reports a compose feature that requires a newer Engine API
+// than the one negotiated with the daemon.
+type FeatureUnsupportedError struct {
+	// Feature is the compose attribute, e.g. "healthcheck.start_interval".
+	Feature string
+	// RequiredAPIVersion is the minimum Engine API version for Feature.
+	RequiredAPIVersion string
+	// APIVersion is the negotiated Engine API version.
+	APIVersion string
+}
+
+func (e *FeatureUnsupportedError) Error() string {
+	return fmt.Sprintf(
+		"compose: %s requires Docker Engine API %s (daemon negotiated %s)",
+		e.Feature,
+		e.RequiredAPIVersion,
+		e.APIVersion,
+	)
+}
+
+// Is reports whether target is ErrFeatureUnsupportedByDaemon.
+func (e *FeatureUnsupportedError) Is(target error) bool {
+	return target == ErrFeatureUnsupportedByDaemon
+}
+
+// createSpec groups the configs passed to ContainerCreate.
+type createSpec struct {
+	config     *container.Config
+	hostConfig *container.HostConfig
+	networking *network.NetworkingConfig
+}
+
+// apiFeature describes a container option that older daemons reject or ignore.
+type apiFeature struct {
+	name   string
+	minAPI string
+	used   func(*createSpec) bool
+	strip  func(*createSpec)
+}
+
+var containerAPIFeatures = []apiFeature{
+	{
+		name:   "healthcheck.start_interval",
+		minAPI: "1.44",
+		used: func(s *createSpec) bool {
+			return s.config != nil && s.config.Healthcheck != nil &&
+				s.config.Healthcheck.StartInterval != 0
+		},
+		strip: func(s *createSpec) { s.config.Healthcheck.StartInterval = 0 },
+	},
+	{
+		name:   "networks.mac_address",
+		minAPI: "1.44",
+		used: func(s *createSpec) bool {
+			return anyEndpoint(s, func(ep *network.EndpointSettings) bool {
+				return ep.MacAddress != ""
+			})
+		},
+		strip: func(s *createSpec) {
+			eachEndpoint(s, func(ep *network.EndpointSettings) { ep.MacAddress = "" })
+		},
+	},
+	{
+		name:   "networks.gw_priority",
+		minAPI: "1.48",
+		used: func(s *createSpec) bool {
+			return anyEndpoint(s, func(ep *network.EndpointSettings) bool {
+				return ep.GwPriority != 0
+			})
+		},
+		strip: func(s *createSpec) {
+			eachEndpoint(s, func(ep *network.EndpointSettings) { ep.GwPriority = 0 })
+		},
+	},
+}
+
+// gateAPIFeatures checks spec against the negotiated API version. Unsupported
+// features are removed with a warning, or rejected when strict is set.
+// An empty apiVersion (unknown) disables gating.
+func gateAPIFeatures(apiVersion string, strict bool, spec *createSpec) error {
+	for _, f := range containerAPIFeatures {
+		if !f.used(spec) {
+			continue
+		}
+		if err := checkAPIFeature(apiVersion, strict, f.name, f.minAPI); err != nil {
+			return err
+		}
+		if !apiVersionSupports(apiVersion, f.minAPI) {
+			f.strip(spec)
+		}
+	}
+	return nil
+}
+
+// checkAPIFeature returns a FeatureUnsupportedError in strict mode, or writes a
+// warning otherwise, when apiVersion is older than minAPI.
+func checkAPIFeature(apiVersion string, strict bool, feature, minAPI string) error {
+	if apiVersionSupports(apiVersion, minAPI) {
+		return nil
+	}
+	if strict {
+		return &FeatureUnsupportedError{
+			Feature:            feature,
+			RequiredAPIVersion: minAPI,
+			APIVersion:         apiVersion,
+		}
+	}
+	writeWarning(os.Stderr, fmt.Sprintf(
+		"%s is ignored: requires Docker Engine API %s (daemon negotiated %s)",
+		feature,
+		minAPI,
+		apiVersion,
+	))
+	return nil
+}
+
+func apiVersionSupports(apiVersion, minAPI string) bool {
+	return apiVersion == "" || versions.GreaterThanOrEqualTo(apiVersion, minAPI)
+}
+
+func anyEndpoint(s *createSpec, fn func(*network.EndpointSettings) bool) bool {
+	if s.networking == nil {
+		return false
+	}
+	for _, ep := range s.networking.EndpointsConfig {
+		if ep != nil && fn(ep) {
+			return true
+		}
+	}
+	return false
+}
+
+func eachEndpoint(s *createSpec, fn func(*network.EndpointSettings)) {
+	if s.networking == nil {
+		return
+	}
+	for _, ep := range s.networking.EndpointsConfig {
+		if ep != nil {
+			fn(ep)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package compose
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// watchPollInterval is how often watched host paths are scanned for changes.
+var watchPollInterval = 500 * time.Millisecond
+
+// syncSpec describes a host path mirrored into a container path.
+type syncSpec struct {
+	// root is the absolute host path (file or directory).
+	root string
+	// target is the absolute container path root is mapped to.
+	target string
+	// include and ignore are path patterns relative to root (see matchesPattern).
+	include []string
+	ignore  []string
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	mode    fs.FileMode
+}
+
+// fileSnapshot maps slash-separated paths relative to the sync root to their stamps.
+// A root that is a single file is recorded as ".".
+type fileSnapshot map[string]fileStamp
+
+func (s *syncSpec) snapshot() (fileSnapshot, error) {
+	snap := fileSnapshot{}
+	info, err := os.Lstat(s.root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return snap, nil
+		}
+		return nil, err
+	}
+	if !info.IsDir() {
+		snap["."] = stampOf(info)
+		return snap, nil
+	}
+	err = filepath.WalkDir(s.root, func(p string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if os.IsNotExist(walkErr) {
+				return nil
+			}
+			return walkErr
+		}
+		rel, relErr := filepath.Rel(s.root, p)
+		if relErr != nil || rel == "." {
+			return relErr
+		}
+		rel = filepath.ToSlash(rel)
+		if matchesPattern(s.ignore, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if len(s.include) > 0 && !matchesPattern(s.include, rel) {
+			return nil
+		}
+		info, infoErr := d.Info()
+		if infoErr != nil {
+			if os.IsNotExist(infoErr) {
+				return nil
+			}
+			return infoErr
+		}
+		snap[rel] = stampOf(info)
+		return nil
+	})
+	return snap, err
+}
+
+func stampOf(info fs.FileInfo) fileStamp {
+	return fileStamp{modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}
+}
+
+// diffSnapshots returns sorted paths that were added or modified, and removed.
+func diffSnapshots(prev, next fileSnapshot) ([]string, []string) {
+	var changed, removed []string
+	for p, st := range next {
+		if old, ok := prev[p]; !ok || old != st {
+			changed = append(changed, p)
+		}
+	}
+	for p := range prev {
+		if _, ok := next[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// matchesPattern reports whether rel, or any of its parent directories, matches
+// one of the path.Match patterns. A trailing "/" in a pattern is ignored, so
+// "node_modules/" excludes the whole directory.
+func matchesPattern(patterns []string, rel string) bool {
+	for _, pat := range patterns {
+		pat = strings.TrimSuffix(strings.TrimPrefix(pat, "./"), "/")
+		if pat == "" {
+			continue
+		}
+		for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(pat, p); ok {
+				return true
+			}
+			if ok, _ := path.Match(pat, path.Base(p)); ok && !strings.Contains(pat, "/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containerPath maps a snapshot path to its location in the container.
+func (s *syncSpec) containerPath(rel string) string {
+	if rel == "." {
+		return s.target
+	}
+	return path.Join(s.target, rel)
+}
+
+// copyToContainer copies the given snapshot paths into the container. The archive
+// uses absolute entry names extracted at "/", so missing parent directories are
+// created by the engine. Files that disappeared in the meantime are skipped.
+func (s *syncSpec) copyToContainer(
+	ctx context.Context,
+	dc Backend,
+	id string,
+	rels []string,
+) error {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	n := 0
+	for _, rel := range rels {
+		ok, err := s.addToArchive(tw, rel)
+		if err != nil {
+			return err
+		}
+		if ok {
+			n++
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	return dc.CopyToContainer(ctx, id, "/", &buf, container.CopyToContainerOptions{})
+}
+
+func (s *syncSpec) addToArchive(tw *tar.Writer, rel string) (bool, error) {
+	hostPath := s.root
+	if rel != "." {
+		hostPath = filepath.Join(s.root, filepath.FromSlash(rel))
+	}
+	info, err := os.Lstat(hostPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	link := ""
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(hostPath); err != nil {
+			return false, err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return false, err
+	}
+	hdr.Name = strings.TrimPrefix(s.containerPath(rel), "/")
+	if err := tw.WriteHeader(hdr); err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() {
+		return true, nil
+	}
+	// #nosec G304 -- hostPath is below the watched root.
+	f, err := os.Open(hostPath)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := io.CopyN(tw, f, hdr.Size); err != nil {
+		return false, errors.Join(err, errors.New("compose: file changed while syncing"))
+	}
+	return true, nil
+}
+
+// removeFromContainer deletes the given snapshot paths in the container.
+// The engine API has no delete operation, so this execs rm in the background.
+func (s *syncSpec) removeFromContainer(
+	ctx context.Context,
+	dc Backend,
+	id string,
+	rels []string,
+) error {
+	if len(rels) == 0 {
+		return nil
+	}
+	args := []string{"rm", "-rf", "--"}
+	for _, rel := range rels {
+		args = append(args, s.containerPath(rel))
+	}
+	return execDetached(ctx, dc, id, container.ExecOptions{Cmd: args})
+}
+
+func execDetached(ctx context.Context, dc Backend, id string, opts container.ExecOptions) error {
+	resp, err := dc.ContainerExecCreate(ctx, id, opts)
+	if err != nil {
+		return err
+	}
+	return dc.ContainerExecStart(ctx, resp.ID, container.ExecStartOptions{Detach: true})
+}
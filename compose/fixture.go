@@ -0,0 +1,272 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// fixtureImage is the helper image Fixture uses to copy volumes. It must provide sh
+// and cp -a.
+var fixtureImage = "alpine:3.20"
+
+// fixtureServiceName is the service name of fixture copy containers.
+const fixtureServiceName = "compose-exec-fixture"
+
+// fixtureLabel marks golden and cloned volumes with the name of their golden volume.
+const fixtureLabel = "io.github.hnw.compose-exec.fixture"
+
+// defaultFixtureStopGrace is how long a provisioned service may take to shut down
+// cleanly when it sets no stop_grace_period.
+const defaultFixtureStopGrace = 10 * time.Second
+
+// Fixture implements the "template database" pattern: a service is provisioned once
+// into a golden data volume, and every test run gets its own copy of that volume,
+// so tests start from the same state without repeating slow setup such as
+// migrations or seed data.
+type Fixture struct {
+	// Golden is the name of the volume holding the provisioned data.
+	Golden string
+
+	project *Project
+	service string
+	key     string
+	target  string
+
+	mu     sync.Mutex
+	clones map[string]struct{}
+}
+
+// FixtureClone is a per-run copy of a Fixture's golden volume.
+type FixtureClone struct {
+	// Volume is the name of the cloned volume.
+	Volume string
+	f      *Fixture
+}
+
+// NewFixture provisions service once. volumeKey is the key of a named volume the
+// service mounts (a `volumes:` entry with type volume); a new golden volume is
+// mounted in its place, the service is started and provision is called with the
+// running Cmd, e.g. to wait until healthy and run migrations. The service is then
+// stopped within its stop_grace_period so the data is flushed. The golden volume is
+// kept until Close.
+func (p *Project) NewFixture(
+	ctx context.Context,
+	service, volumeKey string,
+	provision func(context.Context, *Cmd) error,
+) (*Fixture, error) {
+	if p == nil {
+		return nil, errors.New("compose: project is nil")
+	}
+	cfg, err := p.serviceConfig(service)
+	if err != nil {
+		return nil, err
+	}
+	target, err := fixtureTarget(cfg, volumeKey)
+	if err != nil {
+		return nil, err
+	}
+	f := &Fixture{
+		project: p,
+		service: service,
+		key:     volumeKey,
+		target:  target,
+		clones:  map[string]struct{}{},
+	}
+	f.Golden, err = f.volumeName("golden")
+	if err != nil {
+		return nil, err
+	}
+	if createErr := f.createVolume(ctx, f.Golden); createErr != nil {
+		return nil, createErr
+	}
+	if provErr := f.provision(ctx, cfg, provision); provErr != nil {
+		return nil, errors.Join(provErr, f.removeVolumes(context.Background(), f.Golden))
+	}
+	return f, nil
+}
+
+// fixtureTarget returns where service mounts the named volume key.
+func fixtureTarget(cfg types.ServiceConfig, key string) (string, error) {
+	for _, v := range cfg.Volumes {
+		if v.Type == types.VolumeTypeVolume && v.Source == key && v.Target != "" {
+			return v.Target, nil
+		}
+	}
+	return "", fmt.Errorf("compose: service %q does not mount volume %q", cfg.Name, key)
+}
+
+func (f *Fixture) volumeName(kind string) (string, error) {
+	sfx, err := randSuffix(4)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s_%s_%s_%s", f.project.Name, f.key, kind, sfx), nil
+}
+
+func (f *Fixture) provision(
+	ctx context.Context,
+	cfg types.ServiceConfig,
+	provision func(context.Context, *Cmd) error,
+) error {
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	cmd := f.project.CommandContext(runCtx, f.service)
+	cmd.ExtraMounts = append(cmd.ExtraMounts, f.mount(f.Golden))
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	var provErr error
+	if provision != nil {
+		provErr = provision(ctx, cmd)
+	}
+
+	grace := defaultFixtureStopGrace
+	if cfg.StopGracePeriod != nil {
+		grace = time.Duration(*cfg.StopGracePeriod)
+	}
+	if id, dc, err := cmd.activeContainer(); err == nil {
+		_ = stopAndKill(context.Background(), dc, id, grace)
+	}
+	waitErr := cmd.Wait()
+	var ee *ExitError
+	if errors.As(waitErr, &ee) {
+		// Services commonly exit non-zero on SIGTERM; the data is what matters.
+		waitErr = nil
+	}
+	if provErr != nil {
+		return fmt.Errorf("compose: provision fixture %q: %w", f.service, provErr)
+	}
+	return waitErr
+}
+
+func (f *Fixture) mount(name string) mount.Mount {
+	return mount.Mount{Type: mount.TypeVolume, Source: name, Target: f.target}
+}
+
+// Clone copies the golden volume into a new volume for one test run. Remove the
+// clone with FixtureClone.Remove, or let Close remove all remaining clones.
+func (f *Fixture) Clone(ctx context.Context) (*FixtureClone, error) {
+	name, err := f.volumeName("clone")
+	if err != nil {
+		return nil, err
+	}
+	if createErr := f.createVolume(ctx, name); createErr != nil {
+		return nil, createErr
+	}
+	if copyErr := f.copyVolume(ctx, f.Golden, name); copyErr != nil {
+		return nil, errors.Join(copyErr, f.removeVolumes(context.Background(), name))
+	}
+	f.mu.Lock()
+	f.clones[name] = struct{}{}
+	f.mu.Unlock()
+	return &FixtureClone{Volume: name, f: f}, nil
+}
+
+// Close removes the remaining clones and the golden volume.
+func (f *Fixture) Close(ctx context.Context) error {
+	f.mu.Lock()
+	names := make([]string, 0, len(f.clones)+1)
+	for name := range f.clones {
+		names = append(names, name)
+	}
+	f.clones = map[string]struct{}{}
+	f.mu.Unlock()
+	return f.removeVolumes(ctx, append(names, f.Golden)...)
+}
+
+// Mount returns the mount that replaces the service's data volume with the clone,
+// for use in Cmd.ExtraMounts.
+func (fc *FixtureClone) Mount() mount.Mount {
+	return fc.f.mount(fc.Volume)
+}
+
+// CommandContext returns a Cmd for the fixture's service that uses the clone as its
+// data volume.
+func (fc *FixtureClone) CommandContext(ctx context.Context, arg ...string) *Cmd {
+	cmd := fc.f.project.CommandContext(ctx, fc.f.service, arg...)
+	cmd.ExtraMounts = append(cmd.ExtraMounts, fc.Mount())
+	return cmd
+}
+
+// Remove deletes the clone. The volume must no longer be in use.
+func (fc *FixtureClone) Remove(ctx context.Context) error {
+	fc.f.mu.Lock()
+	delete(fc.f.clones, fc.Volume)
+	fc.f.mu.Unlock()
+	return fc.f.removeVolumes(ctx, fc.Volume)
+}
+
+func (f *Fixture) createVolume(ctx context.Context, name string) error {
+	dc, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dc.Close() }()
+	return createFixtureVolume(ctx, dc, f.project.Name, f.Golden, name)
+}
+
+func createFixtureVolume(ctx context.Context, dc Backend, project, golden, name string) error {
+	_, err := dc.VolumeCreate(ctx, volume.CreateOptions{
+		Name: name,
+		Labels: addGlobalLabels(map[string]string{
+			"com.docker.compose.project": project,
+			fixtureLabel:                 golden,
+		}),
+	})
+	if err != nil {
+		return engineErr(fmt.Sprintf("create volume %q", name), err)
+	}
+	journalRecord(journalOpCreate, journalKindVolume, name, name)
+	return nil
+}
+
+func (f *Fixture) removeVolumes(ctx context.Context, names ...string) error {
+	dc, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dc.Close() }()
+	return removeFixtureVolumes(ctx, dc, names)
+}
+
+func removeFixtureVolumes(ctx context.Context, dc Backend, names []string) error {
+	var errs []error
+	for _, name := range names {
+		err := dc.VolumeRemove(ctx, name, false)
+		journalVolumeRemoved(name, err)
+		if err != nil && !isNotFoundErr(err) {
+			errs = append(errs, engineErr(fmt.Sprintf("remove volume %q", name), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyVolume copies src into dst in a short-lived helper container, preserving
+// ownership and permissions.
+func (f *Fixture) copyVolume(ctx context.Context, src, dst string) error {
+	cfg := types.ServiceConfig{Name: fixtureServiceName, Image: fixtureImage}
+	cmd := newService(f.project, cfg).CommandContext(ctx, "cp", "-a", "/from/.", "/to/")
+	cmd.ExtraMounts = []mount.Mount{
+		{Type: mount.TypeVolume, Source: src, Target: "/from", ReadOnly: true},
+		{Type: mount.TypeVolume, Source: dst, Target: "/to"},
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(out.String()); msg != "" {
+			return fmt.Errorf("compose: copy volume %q: %s: %w", src, msg, err)
+		}
+		return fmt.Errorf("compose: copy volume %q: %w", src, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// RunGroup runs cmds concurrently and waits for all of them, like calling Run on
+// each from its own goroutine. ctx cancels every Cmd in addition to the context it
+// was created with. The Cmds must not have been started.
+//
+// If any Cmd fails, the returned error is a *MultiError with one "cmd" entry per
+// failure, named after the Cmd's service and in the order of cmds; use errors.As
+// to get at individual ExitErrors.
+func RunGroup(ctx context.Context, cmds ...*Cmd) error {
+	return runGroup(ctx, false, cmds)
+}
+
+// RunGroupFailFast is like RunGroup, but the first failure stops the remaining
+// Cmds and is the only one reported; the Cmds it stops are not.
+func RunGroupFailFast(ctx context.Context, cmds ...*Cmd) error {
+	return runGroup(ctx, true, cmds)
+}
+
+func runGroup(ctx context.Context, failFast bool, cmds []*Cmd) error {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	for i, c := range cmds {
+		if c == nil {
+			return fmt.Errorf("compose: group cmd %d is nil", i)
+		}
+	}
+	groupCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(cmds))
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		stopped bool
+	)
+	for i, c := range cmds {
+		unbind := c.bindContext(groupCtx)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer unbind()
+			err := c.Run()
+			if err == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if stopped {
+				return
+			}
+			errs[i] = err
+			if failFast {
+				stopped = true
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	me := &MultiError{Op: "run-group"}
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		me.add("cmd", cmds[i].Service.Name, err)
+	}
+	return me.errOrNil()
+}
+
+// bindContext makes ctx cancel the Cmd in addition to its own context. The
+// returned function releases the binding.
+func (c *Cmd) bindContext(ctx context.Context) func() {
+	if c.ctx == nil {
+		c.ctx = ctx
+		return func() {}
+	}
+	merged, cancel := context.WithCancel(c.ctx)
+	stop := context.AfterFunc(ctx, cancel)
+	c.ctx = merged
+	return func() {
+		stop()
+		cancel()
+	}
+}
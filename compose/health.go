@@ -0,0 +1,125 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ErrHealthcheckNotExecutable is returned while waiting for a container to become
+// healthy when the daemon repeatedly fails to run the healthcheck command at all,
+// e.g. a CMD-SHELL healthcheck in an image without /bin/sh. Such a container would
+// otherwise stay "starting" until its start period ends.
+var ErrHealthcheckNotExecutable = errors.New("compose: healthcheck command cannot be executed")
+
+// HealthProbe is the result of one run of a container's healthcheck.
+type HealthProbe struct {
+	// Start and End are when the probe started and finished.
+	Start time.Time
+	End   time.Time
+	// ExitCode is the probe's exit code: 0 is healthy, 1 unhealthy, and -1 means
+	// the probe could not be run or timed out.
+	ExitCode int
+	// Output is the (truncated) combined output of the probe.
+	Output string
+}
+
+// HealthLog returns the recent healthcheck probe results of the started container,
+// oldest first, as kept by the daemon (the last five runs). It returns an error if
+// the container has no healthcheck.
+//
+// It is an error to call HealthLog before Start or after Wait has released the
+// container.
+func (c *Cmd) HealthLog(ctx context.Context) ([]HealthProbe, error) {
+	j, err := c.Inspect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if j.ContainerJSONBase == nil || j.State == nil {
+		return nil, errors.New("compose: container state unavailable")
+	}
+	if j.State.Health == nil {
+		return nil, errors.New("compose: container has no healthcheck")
+	}
+	return healthProbes(j.State.Health), nil
+}
+
+func healthProbes(h *container.Health) []HealthProbe {
+	probes := make([]HealthProbe, 0, len(h.Log))
+	for _, r := range h.Log {
+		if r == nil {
+			continue
+		}
+		probes = append(probes, HealthProbe{
+			Start:    r.Start,
+			End:      r.End,
+			ExitCode: r.ExitCode,
+			Output:   r.Output,
+		})
+	}
+	return probes
+}
+
+// unhealthyErr reports an unhealthy container with the output of its last probe.
+func unhealthyErr(h *container.Health) error {
+	probes := healthProbes(h)
+	if len(probes) == 0 {
+		return errors.New("compose: container became unhealthy")
+	}
+	last := probes[len(probes)-1]
+	return fmt.Errorf("compose: container became unhealthy (exit code %d): %s",
+		last.ExitCode, strings.TrimSpace(last.Output))
+}
+
+// healthExecFailureThreshold is the number of consecutive healthcheck runs that
+// must fail to execute before the failure is reported.
+const healthExecFailureThreshold = 3
+
+// healthExecFailureMarkers identify the errors the daemon records when it cannot
+// start the healthcheck process, as opposed to the check itself failing.
+var healthExecFailureMarkers = []string{
+	"exec failed",
+	"executable file not found",
+	"no such file or directory",
+}
+
+// healthExecError returns an ErrHealthcheckNotExecutable error if the most recent
+// healthcheck runs in h all failed to execute, and nil otherwise. test is the
+// container's healthcheck command.
+func healthExecError(h *container.Health, test []string) error {
+	if h == nil || len(h.Log) < healthExecFailureThreshold {
+		return nil
+	}
+	recent := h.Log[len(h.Log)-healthExecFailureThreshold:]
+	for _, r := range recent {
+		if !isHealthExecFailure(r) {
+			return nil
+		}
+	}
+	output := strings.TrimSpace(recent[len(recent)-1].Output)
+	if len(test) > 0 && test[0] == "CMD-SHELL" && strings.Contains(output, "/bin/sh") {
+		return fmt.Errorf("%w: the image has no /bin/sh to run the CMD-SHELL healthcheck; "+
+			"use the CMD form with an executable from the image (%s)",
+			ErrHealthcheckNotExecutable, output)
+	}
+	return fmt.Errorf("%w: %s", ErrHealthcheckNotExecutable, output)
+}
+
+func isHealthExecFailure(r *container.HealthcheckResult) bool {
+	// The daemon reports exit code -1 when it could not run the check or the check
+	// timed out; only the former carries an exec error in its output.
+	if r == nil || r.ExitCode != -1 {
+		return false
+	}
+	out := strings.ToLower(r.Output)
+	for _, m := range healthExecFailureMarkers {
+		if strings.Contains(out, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package compose
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// maxHostnameLen is the longest valid hostname label.
+const maxHostnameLen = 63
+
+// HostnameData is the data of the template set with SetHostnameTemplate.
+type HostnameData struct {
+	// Service is the compose service name.
+	Service string
+	// Project is the compose project name.
+	Project string
+	// RunID identifies this process; see RunID.
+	RunID string
+	// Suffix is the random suffix that makes the container name unique.
+	Suffix string
+}
+
+var (
+	hostnameMu       sync.Mutex
+	hostnameTemplate *template.Template
+)
+
+// RunID returns a random ID generated once per process, e.g. to log it alongside
+// test results when it is part of the container hostnames (see
+// SetHostnameTemplate). The cleanup journal names its files with the same ID.
+func RunID() string {
+	return journalNonce
+}
+
+// SetHostnameTemplate sets a text/template, executed with a HostnameData, that
+// names the container host of every Cmd, e.g. "{{.Service}}-{{.RunID}}", so logs
+// shipped from inside containers (which usually embed the hostname) can be tied
+// back to a specific run. The result is lowercased and reduced to a valid
+// hostname of at most 63 characters. Services that set hostname, or share the
+// network namespace of the host or another container, keep their hostname. An
+// empty text restores the default, the container ID.
+func SetHostnameTemplate(text string) error {
+	var tmpl *template.Template
+	if text != "" {
+		var err error
+		tmpl, err = template.New("hostname").Option("missingkey=error").Parse(text)
+		if err != nil {
+			return fmt.Errorf("compose: invalid hostname template: %w", err)
+		}
+	}
+	hostnameMu.Lock()
+	defer hostnameMu.Unlock()
+	hostnameTemplate = tmpl
+	return nil
+}
+
+func activeHostnameTemplate() *template.Template {
+	hostnameMu.Lock()
+	defer hostnameMu.Unlock()
+	return hostnameTemplate
+}
+
+// applyHostnameTemplate sets cfg.Hostname per SetHostnameTemplate for the
+// container named containerName.
+func (c *Cmd) applyHostnameTemplate(
+	cfg *container.Config,
+	hostCfg *container.HostConfig,
+	containerName string,
+) error {
+	tmpl := activeHostnameTemplate()
+	if tmpl == nil || cfg.Hostname != "" {
+		return nil
+	}
+	if mode := hostCfg.NetworkMode; mode.IsHost() || mode.IsContainer() {
+		return nil
+	}
+	data := HostnameData{
+		Service: c.Service.Name,
+		Project: c.projectName(),
+		RunID:   RunID(),
+		Suffix:  containerName[strings.LastIndex(containerName, "-")+1:],
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return fmt.Errorf("compose: hostname template: %w", err)
+	}
+	name := sanitizeHostname(b.String())
+	if name == "" {
+		return fmt.Errorf("compose: hostname template produced no valid hostname: %q", b.String())
+	}
+	cfg.Hostname = name
+	return nil
+}
+
+// sanitizeHostname lowercases s, replaces characters invalid in hostnames with
+// '-' and trims it to a valid label.
+func sanitizeHostname(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '-'
+		}
+	}, s)
+	if len(s) > maxHostnameLen {
+		s = s[:maxHostnameLen]
+	}
+	return strings.Trim(s, "-")
+}
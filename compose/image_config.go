@@ -0,0 +1,65 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// ImageConfig is the run configuration built into a service's image: what the
+// container uses where neither the service nor the Cmd overrides it.
+type ImageConfig struct {
+	// Entrypoint is the image's ENTRYPOINT.
+	Entrypoint []string
+	// Cmd is the image's CMD, the default arguments of Entrypoint.
+	Cmd []string
+	// Env holds the image's ENV entries as KEY=value.
+	Env []string
+	// ExposedPorts lists the image's EXPOSE ports as "port/protocol", sorted.
+	ExposedPorts []string
+	// User is the image's USER; empty means root.
+	User string
+}
+
+// ImageConfig returns the configuration of the service's image, pulling it first
+// if it is not present, e.g. to learn which default command will run or which
+// port to probe before starting a container.
+func (s *Service) ImageConfig(ctx context.Context) (ImageConfig, error) {
+	if s.loadErr != nil {
+		return ImageConfig{}, s.loadErr
+	}
+	dc, err := newDockerClient()
+	if err != nil {
+		return ImageConfig{}, err
+	}
+	defer func() { _ = dc.Close() }()
+	return s.imageConfig(ctx, dc)
+}
+
+func (s *Service) imageConfig(ctx context.Context, dc Backend) (ImageConfig, error) {
+	if s.config.Image == "" {
+		return ImageConfig{}, errors.New(
+			"compose: service.image is required (build is out of scope)",
+		)
+	}
+	if err := pullImage(ctx, dc, s.config.Image, s.config.Platform); err != nil {
+		return ImageConfig{}, err
+	}
+	img, _, err := dc.ImageInspectWithRaw(ctx, s.config.Image)
+	if err != nil {
+		return ImageConfig{}, engineErr("inspect image", err)
+	}
+	var out ImageConfig
+	if img.Config == nil {
+		return out, nil
+	}
+	out.Entrypoint = append([]string(nil), img.Config.Entrypoint...)
+	out.Cmd = append([]string(nil), img.Config.Cmd...)
+	out.Env = append([]string(nil), img.Config.Env...)
+	out.User = img.Config.User
+	for port := range img.Config.ExposedPorts {
+		out.ExposedPorts = append(out.ExposedPorts, port)
+	}
+	sort.Strings(out.ExposedPorts)
+	return out, nil
+}
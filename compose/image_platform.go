@@ -0,0 +1,178 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/containerd/platforms"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ErrImagePlatformMismatch is matched (via errors.Is) by errors from Start when the
+// image is present locally for a different platform than the service's `platform:`
+// and pulling the right variant failed. Running such an image fails with a
+// confusing "exec format error" from inside the container.
+var ErrImagePlatformMismatch = errors.New("compose: image platform mismatch")
+
+// daemonPlatforms caches the platform of each daemon host.
+var daemonPlatforms sync.Map // string -> ocispec.Platform
+
+// ensureImagePlatform re-pulls ref for the service's explicit platform when the
+// local image was built for another one. Without an explicit platform, an image
+// for another platform than the daemon's is used as is, as it may be built for it
+// or run under emulation, and only a warning is written.
+func ensureImagePlatform(
+	ctx context.Context,
+	dc Backend,
+	ref, platform string,
+	local image.InspectResponse,
+) error {
+	if platform == "" {
+		warnForeignPlatform(ctx, dc, ref, local)
+		return nil
+	}
+	want, err := platforms.Parse(platform)
+	if err != nil || platformMatches(want, local) {
+		return err
+	}
+	st, err := detectImageStore(ctx, dc)
+	if err != nil {
+		return err
+	}
+	if st.containerd {
+		return ensureContainerdPlatform(ctx, dc, ref, want)
+	}
+	have := imagePlatform(local)
+	pullErr := pullPlatform(ctx, dc, ref, platforms.Format(want))
+	if pullErr == nil {
+		pulled, _, inspectErr := dc.ImageInspectWithRaw(ctx, ref)
+		if inspectErr != nil {
+			return engineErr("inspect image", inspectErr)
+		}
+		if platformMatches(want, pulled) {
+			return nil
+		}
+		have = imagePlatform(pulled)
+	}
+	return platformMismatchErr(ref, &have, want, pullErr)
+}
+
+// ensureContainerdPlatform handles the containerd image store, where an image holds
+// several platform variants and a plain inspect reports only one of them: the
+// wanted variant is inspected explicitly and pulled if it is missing, which adds it
+// to the image without replacing the others.
+func ensureContainerdPlatform(
+	ctx context.Context,
+	dc Backend,
+	ref string,
+	want ocispec.Platform,
+) error {
+	// Inspecting a platform variant needs API 1.49; older daemons can only pull.
+	canInspect := !versions.LessThan(dc.ClientVersion(), "1.49")
+	if canInspect {
+		present, err := inspectPlatform(ctx, dc, ref, want)
+		if err != nil || present {
+			return err
+		}
+	}
+	if err := pullPlatform(ctx, dc, ref, platforms.Format(want)); err != nil {
+		return platformMismatchErr(ref, nil, want, err)
+	}
+	if !canInspect {
+		return nil
+	}
+	present, err := inspectPlatform(ctx, dc, ref, want)
+	if err != nil || present {
+		return err
+	}
+	return platformMismatchErr(ref, nil, want, nil)
+}
+
+// inspectPlatform reports whether the want variant of ref is present.
+func inspectPlatform(
+	ctx context.Context,
+	dc Backend,
+	ref string,
+	want ocispec.Platform,
+) (bool, error) {
+	img, err := dc.ImageInspect(ctx, ref, client.ImageInspectWithPlatform(&want))
+	if cerrdefs.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, engineErr("inspect image", err)
+	}
+	return platformMatches(want, img), nil
+}
+
+// platformMismatchErr describes an image that is not available for want; have is
+// the platform found locally, if known, and pullErr the failed pull, if any.
+func platformMismatchErr(ref string, have *ocispec.Platform, want ocispec.Platform,
+	pullErr error,
+) error {
+	found := "not available"
+	if have != nil {
+		found = platforms.Format(*have)
+	}
+	err := fmt.Errorf("%w: image %q is %s but %s is needed; pull it for %s or set the "+
+		"service's platform", ErrImagePlatformMismatch, ref, found,
+		platforms.Format(want), platforms.Format(want))
+	if pullErr != nil {
+		return errors.Join(err, pullErr)
+	}
+	return err
+}
+
+// warnForeignPlatform warns when the local image was built for another platform
+// than the daemon's.
+func warnForeignPlatform(ctx context.Context, dc Backend, ref string, local image.InspectResponse) {
+	want, ok := daemonPlatform(ctx, dc)
+	if !ok || platformMatches(want, local) {
+		return
+	}
+	writeWarning(os.Stderr, fmt.Sprintf(
+		"image %q is %s but the daemon is %s; it fails with \"exec format error\" "+
+			"unless emulation is set up (set the service's platform to pull another variant)",
+		ref, platforms.Format(imagePlatform(local)), platforms.Format(want)))
+}
+
+// daemonPlatform returns the daemon's platform. ok is false when it is unknown.
+func daemonPlatform(ctx context.Context, dc Backend) (ocispec.Platform, bool) {
+	host := dc.DaemonHost()
+	if p, ok := daemonPlatforms.Load(host); ok && host != "" {
+		return p.(ocispec.Platform), true
+	}
+	v, err := dc.ServerVersion(ctx)
+	if err != nil || v.Os == "" || v.Arch == "" {
+		return ocispec.Platform{}, false
+	}
+	p := platforms.Normalize(ocispec.Platform{OS: v.Os, Architecture: v.Arch})
+	if host != "" {
+		daemonPlatforms.Store(host, p)
+	}
+	return p, true
+}
+
+func imagePlatform(img image.InspectResponse) ocispec.Platform {
+	return platforms.Normalize(ocispec.Platform{
+		OS:           img.Os,
+		Architecture: img.Architecture,
+		Variant:      img.Variant,
+	})
+}
+
+// platformMatches reports whether img can run on want. Images without platform
+// information are assumed to match.
+func platformMatches(want ocispec.Platform, img image.InspectResponse) bool {
+	if img.Os == "" || img.Architecture == "" {
+		return true
+	}
+	return platforms.Only(want).Match(imagePlatform(img))
+}
@@ -0,0 +1,53 @@
+package compose
+
+import (
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// ImageRewriter maps a service's image reference to the one to pull and run, e.g.
+// to route pulls through a caching registry. It must return ref unchanged for
+// images it does not handle.
+type ImageRewriter func(ref string) string
+
+// WithImageRewriter applies rw to the image of every service when the project is
+// loaded. It may be given several times; rewriters run in order.
+func WithImageRewriter(rw ImageRewriter) LoadOption {
+	return func(o *loadOptions) {
+		if rw != nil {
+			o.imageRewriters = append(o.imageRewriters, rw)
+		}
+	}
+}
+
+// MirrorRegistry returns an ImageRewriter that pulls Docker Hub images from the
+// pull-through mirror host (optionally with a path prefix), e.g. with
+// "mirror.internal" the image postgres:16 becomes
+// mirror.internal/library/postgres:16. Images of other registries are unchanged.
+func MirrorRegistry(mirror string) ImageRewriter {
+	mirror = strings.TrimSuffix(mirror, "/")
+	return func(ref string) string {
+		named, err := reference.ParseNormalizedNamed(ref)
+		if err != nil || reference.Domain(named) != "docker.io" {
+			return ref
+		}
+		return mirror + "/" + strings.TrimPrefix(named.String(), "docker.io/")
+	}
+}
+
+// rewriteImages applies rewriters to the images of all services.
+func rewriteImages(p *Project, rewriters []ImageRewriter) {
+	if len(rewriters) == 0 {
+		return
+	}
+	for name, svc := range p.Services {
+		if svc.Image == "" {
+			continue
+		}
+		for _, rw := range rewriters {
+			svc.Image = rw(svc.Image)
+		}
+		p.Services[name] = svc
+	}
+}
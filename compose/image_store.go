@@ -0,0 +1,58 @@
+package compose
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types/system"
+)
+
+// containerdDriverType is the "driver-type" the daemon reports in its driver status
+// when images are stored by containerd snapshotters instead of a graph driver.
+const containerdDriverType = "io.containerd.snapshotter.v1"
+
+// lazySnapshotters are containerd snapshotters that fetch image layers on demand.
+var lazySnapshotters = map[string]bool{
+	"stargz": true,
+	"soci":   true,
+	"nydus":  true,
+}
+
+// imageStore describes how the daemon stores images.
+type imageStore struct {
+	// containerd is true for the containerd image store, where images are
+	// multi-platform and inspect reports one platform variant of them.
+	containerd bool
+	// snapshotter is the containerd snapshotter or the graph driver.
+	snapshotter string
+}
+
+func imageStoreOf(info system.Info) imageStore {
+	st := imageStore{snapshotter: info.Driver}
+	for _, kv := range info.DriverStatus {
+		if kv[0] == "driver-type" && kv[1] == containerdDriverType {
+			st.containerd = true
+		}
+	}
+	return st
+}
+
+func detectImageStore(ctx context.Context, dc Backend) (imageStore, error) {
+	info, err := dc.Info(ctx)
+	if err != nil {
+		return imageStore{}, engineErr("get daemon info", err)
+	}
+	return imageStoreOf(info), nil
+}
+
+// lazyPulling reports whether layers are pulled on demand, so a present image may
+// still fetch data when a container starts.
+func (st imageStore) lazyPulling() bool {
+	return st.containerd && lazySnapshotters[st.snapshotter]
+}
+
+func (st imageStore) String() string {
+	if st.containerd {
+		return "containerd"
+	}
+	return "graphdriver"
+}
@@ -0,0 +1,91 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// SaveImages writes the images of all services of project to w as one tar archive
+// (the `docker save` format), pulling images that are not present first. Together
+// with LoadImages it moves images between CI stages or into air-gapped
+// environments without a registry.
+func SaveImages(ctx context.Context, project *Project, w io.Writer) error {
+	if project == nil {
+		return errors.New("compose: project is nil")
+	}
+	dc, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dc.Close() }()
+	return saveImages(ctx, dc, project, w)
+}
+
+func saveImages(ctx context.Context, dc Backend, project *Project, w io.Writer) error {
+	images := projectImages(project)
+	if len(images) == 0 {
+		return errors.New("compose: project has no service images")
+	}
+	for _, ref := range images {
+		if err := pullImage(ctx, dc, ref, ""); err != nil {
+			return err
+		}
+	}
+	rc, err := dc.ImageSave(ctx, images)
+	if err != nil {
+		return engineErr("save images", err)
+	}
+	defer func() { _ = rc.Close() }()
+	if _, copyErr := io.Copy(w, rc); copyErr != nil {
+		return fmt.Errorf("compose: save images: %w", copyErr)
+	}
+	return nil
+}
+
+// projectImages returns the distinct images of project's services, sorted.
+func projectImages(project *Project) []string {
+	seen := map[string]bool{}
+	var images []string
+	for _, svc := range project.Services {
+		if svc.Image != "" && !seen[svc.Image] {
+			seen[svc.Image] = true
+			images = append(images, svc.Image)
+		}
+	}
+	sort.Strings(images)
+	return images
+}
+
+// LoadImages loads the images of a tar archive written by SaveImages (or
+// `docker save`) from r.
+func LoadImages(ctx context.Context, r io.Reader) error {
+	dc, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dc.Close() }()
+	return loadImages(ctx, dc, r)
+}
+
+func loadImages(ctx context.Context, dc Backend, r io.Reader) error {
+	resp, err := dc.ImageLoad(ctx, r)
+	if err != nil {
+		return engineErr("load images", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if !resp.JSON {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	// The engine reports errors in the archive inside the progress stream.
+	err = jsonmessage.DisplayJSONMessagesStream(resp.Body, io.Discard, 0, false, nil)
+	if err != nil {
+		return fmt.Errorf("compose: load images: %w", err)
+	}
+	return nil
+}
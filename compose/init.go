@@ -0,0 +1,56 @@
+package compose
+
+import "sync"
+
+// InitDefault is the init setting of services that do not set `init` (see
+// SetDefaultInit).
+type InitDefault int
+
+const (
+	// InitEnabled runs the engine's init process (docker-init, i.e. tini) as PID 1,
+	// so signals reach the command and orphaned children are reaped. It is the
+	// package default.
+	InitEnabled InitDefault = iota
+	// InitEngine leaves the choice to the engine, like docker compose: no init
+	// process unless the daemon is configured with "init": true.
+	InitEngine
+	// InitDisabled runs the command as PID 1 regardless of the daemon's setting.
+	InitDisabled
+)
+
+var (
+	initMu      sync.Mutex
+	initDefault = InitEnabled
+)
+
+// SetDefaultInit sets the init setting of services that do not set `init`; a
+// service's `init: true` or `init: false` always applies as written. The package
+// default, InitEnabled, differs from docker compose, which uses InitEngine; images
+// that must run as PID 1 need InitEngine or InitDisabled, or `init: false`.
+func SetDefaultInit(d InitDefault) {
+	initMu.Lock()
+	defer initMu.Unlock()
+	initDefault = d
+}
+
+func activeInitDefault() InitDefault {
+	initMu.Lock()
+	defer initMu.Unlock()
+	return initDefault
+}
+
+// serviceInit returns the HostConfig.Init for a service with the given `init`
+// setting; nil defers to the daemon.
+func serviceInit(init *bool) *bool {
+	if init != nil {
+		return ptr(*init)
+	}
+	switch activeInitDefault() {
+	case InitEngine:
+		return nil
+	case InitDisabled:
+		return ptr(false)
+	default:
+		return ptr(true)
+	}
+}
@@ -0,0 +1,130 @@
+package compose
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// InstanceState is the liveness state of a ServiceInstance as seen by Supervise.
+type InstanceState string
+
+const (
+	// InstanceStarting means the container runs but its healthcheck has not
+	// passed yet.
+	InstanceStarting InstanceState = "starting"
+	// InstanceHealthy means the container runs and is healthy, or runs and has
+	// no healthcheck.
+	InstanceHealthy InstanceState = "healthy"
+	// InstanceUnhealthy means the container runs but its healthcheck fails.
+	InstanceUnhealthy InstanceState = "unhealthy"
+	// InstanceStopped means the container exists but is not running.
+	InstanceStopped InstanceState = "stopped"
+	// InstanceGone means the container was removed.
+	InstanceGone InstanceState = "gone"
+)
+
+// defaultSuperviseInterval is the Supervise interval used when none is given.
+const defaultSuperviseInterval = time.Second
+
+// InstanceTransition is a change of a ServiceInstance's liveness.
+type InstanceTransition struct {
+	// From is the previous state; it is empty for the first transition, which
+	// reports the state when supervision started.
+	From InstanceState
+	// To is the new state.
+	To InstanceState
+	// Restarted is set when the container was started again since the previous
+	// check, e.g. by its restart policy or Restart, even if To equals From.
+	Restarted bool
+	// ExitCode is the container's exit status when To is InstanceStopped.
+	ExitCode int
+	// Time is when the transition was observed.
+	Time time.Time
+}
+
+// Supervise checks the container's running state and health status every
+// interval (one second if zero) and sends a transition whenever they change:
+// first the current state, then e.g. healthy to unhealthy, a restart, or the
+// container being gone.
+//
+// The channel is closed when ctx is done or after the InstanceGone transition.
+// Transitions are not dropped: a receiver that falls behind delays the checks.
+// Checks failing for other reasons than the container being gone are retried on
+// the next tick.
+func (s *ServiceInstance) Supervise(
+	ctx context.Context,
+	interval time.Duration,
+) <-chan InstanceTransition {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	if interval <= 0 {
+		interval = defaultSuperviseInterval
+	}
+	ch := make(chan InstanceTransition, 1)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var (
+			prev      InstanceState
+			startedAt string
+		)
+		for {
+			j, err := s.dc.ContainerInspect(ctx, s.ID)
+			if err == nil || isNotFoundErr(err) {
+				tr := InstanceTransition{From: prev, To: InstanceGone, Time: time.Now()}
+				var started string
+				if err == nil {
+					tr.To, tr.ExitCode, started = instanceState(j)
+					tr.Restarted = startedAt != "" && started != "" && started != startedAt
+				}
+				if tr.To != prev || tr.Restarted {
+					select {
+					case ch <- tr:
+					case <-ctx.Done():
+						return
+					}
+				}
+				if tr.To == InstanceGone {
+					return
+				}
+				prev = tr.To
+				if started != "" {
+					startedAt = started
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return ch
+}
+
+// instanceState maps inspect data to a state, the exit code of a stopped
+// container and the start time of the container's current run.
+func instanceState(j container.InspectResponse) (InstanceState, int, string) {
+	if j.ContainerJSONBase == nil || j.State == nil {
+		return InstanceStopped, 0, ""
+	}
+	st := j.State
+	if !st.Running {
+		return InstanceStopped, st.ExitCode, st.StartedAt
+	}
+	if st.Health == nil {
+		return InstanceHealthy, 0, st.StartedAt
+	}
+	switch st.Health.Status {
+	case "healthy":
+		return InstanceHealthy, 0, st.StartedAt
+	case "unhealthy":
+		return InstanceUnhealthy, 0, st.StartedAt
+	default:
+		return InstanceStarting, 0, st.StartedAt
+	}
+}
@@ -3,7 +3,10 @@
 package compose
 
 import (
+	"archive/tar"
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
@@ -13,6 +16,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -20,6 +24,7 @@ import (
 
 	cerrdefs "github.com/containerd/errdefs"
 	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
 )
 
@@ -586,11 +591,7 @@ func TestIntegration_PrivilegedAndCapabilitiesMapping(t *testing.T) {
 	if err := capsCmd.Start(); err != nil {
 		t.Fatalf("caps Start: %v", err)
 	}
-	st, err := capsCmd.snapshotWaitState()
-	if err != nil {
-		t.Fatalf("caps snapshot: %v", err)
-	}
-	j, err := st.dc.ContainerInspect(ctx, st.id)
+	j, err := capsCmd.Inspect(ctx)
 	if err != nil {
 		t.Fatalf("caps inspect: %v", err)
 	}
@@ -636,11 +637,7 @@ func TestIntegration_HostConfigSecurityShmAndExtraHostsMapping(t *testing.T) {
 		t.Fatalf("Start: %v", err)
 	}
 
-	st, err := cmd.snapshotWaitState()
-	if err != nil {
-		t.Fatalf("snapshot: %v", err)
-	}
-	j, err := st.dc.ContainerInspect(ctx, st.id)
+	j, err := cmd.Inspect(ctx)
 	if err != nil {
 		t.Fatalf("inspect: %v", err)
 	}
@@ -699,11 +696,7 @@ func TestIntegration_HostConfigDevicesAndCPUMapping(t *testing.T) {
 		t.Fatalf("Start: %v", err)
 	}
 
-	st, err := cmd.snapshotWaitState()
-	if err != nil {
-		t.Fatalf("snapshot: %v", err)
-	}
-	j, err := st.dc.ContainerInspect(ctx, st.id)
+	j, err := cmd.Inspect(ctx)
 	if err != nil {
 		t.Fatalf("inspect: %v", err)
 	}
@@ -759,11 +752,10 @@ func TestIntegration_DownRemovesContainers(t *testing.T) {
 		t.Fatalf("Start: %v", err)
 	}
 
-	st, err := cmd.snapshotWaitState()
-	if err != nil {
-		t.Fatalf("snapshot: %v", err)
+	containerID := cmd.ContainerID()
+	if containerID == "" {
+		t.Fatalf("ContainerID is empty after Start")
 	}
-	containerID := st.id
 
 	downCtx, cancelDown := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancelDown()
@@ -1037,6 +1029,88 @@ services:
 	}
 }
 
+func TestIntegration_SetStdinFile_LargePayload(t *testing.T) {
+	yaml := `
+services:
+  wc_svc:
+    image: alpine:latest
+    command: ["wc", "-c"]
+`
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+	svc, err := proj.Service("wc_svc")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+
+	const size = 8 << 20
+	path := filepath.Join(t.TempDir(), "payload")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("x"), size), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cmd := svc.CommandContext(ctx)
+	if err := cmd.SetStdinFile(path); err != nil {
+		t.Fatalf("SetStdinFile: %v", err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Output: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != strconv.Itoa(size) {
+		t.Fatalf("byte count=%s want=%d", got, size)
+	}
+}
+
+func TestIntegration_StreamArchiveTo(t *testing.T) {
+	yaml := `
+services:
+  cat_svc:
+    image: alpine:latest
+    command: ["cat", "/tmp/fixture.txt"]
+`
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+	svc, err := proj.Service("cat_svc")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+
+	const content = "fixture data\n"
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	hdr := &tar.Header{Name: "fixture.txt", Mode: 0o644, Size: int64(len(content))}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cmd := svc.CommandContext(ctx)
+	if err := cmd.StreamArchiveTo("/tmp", &buf); err != nil {
+		t.Fatalf("StreamArchiveTo: %v", err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Output: %v", err)
+	}
+	if string(out) != content {
+		t.Fatalf("stdout=%q want=%q", out, content)
+	}
+}
+
 func TestIntegration_StdinPipe_Streaming(t *testing.T) {
 	yaml := `
 services:
@@ -1087,3 +1161,533 @@ services:
 		t.Fatalf("stdout mismatch.\ngot:\n%q\nwant:\n%q", got, inputData)
 	}
 }
+
+func TestIntegration_ForEachService(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  one:\n" +
+		"    image: alpine:latest\n" +
+		"    labels:\n" +
+		"      test.target: \"true\"\n" +
+		"  two:\n" +
+		"    image: alpine:latest\n" +
+		"    labels:\n" +
+		"      test.target: \"true\"\n" +
+		"  other:\n" +
+		"    image: alpine:latest\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	results, err := proj.ForEachService(
+		ctx,
+		MatchLabel("test.target", "true"),
+		"sh", "-c", "echo ok",
+	)
+	if err != nil {
+		t.Fatalf("ForEachService: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results=%d want=2", len(results))
+	}
+	for _, r := range results {
+		if r.ExitCode != 0 || strings.TrimSpace(string(r.Stdout)) != "ok" {
+			t.Fatalf("result=%+v", r)
+		}
+	}
+}
+
+func TestIntegration_Matrix(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  os:\n" +
+		"    image: alpine:latest\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+	svc, err := proj.Service("os")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	images := []string{"alpine:3.19", "alpine:3.20"}
+	m := Matrix(svc, images)
+	t.Cleanup(func() {
+		if err := m.Down(context.Background()); err != nil {
+			t.Errorf("Matrix.Down: %v", err)
+		}
+	})
+	results, err := m.Run(ctx, "cat", "/etc/alpine-release")
+	if err != nil {
+		t.Fatalf("Matrix.Run: %v", err)
+	}
+	for i, r := range results {
+		version := strings.TrimPrefix(images[i], "alpine:")
+		if r.Image != images[i] || !strings.HasPrefix(string(r.Stdout), version+".") {
+			t.Fatalf("result=%+v", r)
+		}
+	}
+}
+
+func TestIntegration_ProbeFromProjectNetwork(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  web:\n" +
+		"    image: alpine:latest\n" +
+		"    command: [\"sh\", \"-c\", \"while true; do nc -l -p 8080 </dev/null; done\"]\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	cmd := proj.CommandContext(runCtx, "web")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() {
+		stop()
+		_ = cmd.Wait()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	if err := cmd.WaitFor(ctx, WaitForProbe("tcp", "web:8080")); err != nil {
+		t.Fatalf("WaitForProbe: %v", err)
+	}
+	if err := proj.Probe(ctx, "tcp", "web:8081"); err == nil {
+		t.Fatalf("expected probe of closed port to fail")
+	}
+}
+
+func TestIntegration_WaitForHTTPFromProjectNetwork(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  web:\n" +
+		"    image: busybox:1.36\n" +
+		"    command: [\"sh\", \"-c\", " +
+		"\"mkdir /www && echo ok > /www/index.html && httpd -f -p 8080 -h /www\"]\n" +
+		"    expose: [\"8080\"]\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	cmd := proj.CommandContext(runCtx, "web")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() {
+		stop()
+		_ = cmd.Wait()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	if err := cmd.WaitFor(ctx, WaitForHTTP("/", WithProjectNetwork())); err != nil {
+		t.Fatalf("WaitForHTTP: %v", err)
+	}
+	short, cancelShort := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelShort()
+	err := cmd.WaitFor(short, WaitForHTTP("/missing", WithProjectNetwork()))
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected 404 status error, got %v", err)
+	}
+}
+
+func TestIntegration_NetworkPartition(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  web:\n" +
+		"    image: alpine:latest\n" +
+		"    command: [\"sh\", \"-c\", \"while true; do nc -l -p 8080 </dev/null; done\"]\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	cmd := proj.CommandContext(runCtx, "web")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() {
+		stop()
+		_ = cmd.Wait()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	if err := cmd.WaitFor(ctx, WaitForProbe("tcp", "web:8080")); err != nil {
+		t.Fatalf("WaitForProbe: %v", err)
+	}
+
+	if err := cmd.DisconnectNetwork(ctx, "default"); err != nil {
+		t.Fatalf("DisconnectNetwork: %v", err)
+	}
+	if err := proj.Probe(ctx, "tcp", "web:8080"); err == nil {
+		t.Fatalf("expected probe to fail while partitioned")
+	}
+	if err := cmd.ConnectNetwork(ctx, "default", nil); err != nil {
+		t.Fatalf("ConnectNetwork: %v", err)
+	}
+	if err := cmd.WaitFor(ctx, WaitForProbe("tcp", "web:8080")); err != nil {
+		t.Fatalf("WaitForProbe after reconnect: %v", err)
+	}
+}
+
+func TestIntegration_InjectLatency(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  db:\n" +
+		"    image: alpine:latest\n" +
+		"    command: [\"sleep\", \"300\"]\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	cmd := proj.CommandContext(runCtx, "db")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() {
+		stop()
+		_ = cmd.Wait()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	restore, err := proj.InjectLatency(ctx, "db", 200*time.Millisecond, WithPacketLoss(1))
+	if err != nil {
+		t.Fatalf("InjectLatency: %v", err)
+	}
+	if err := restore(ctx); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+}
+
+func TestIntegration_EphemeralPortsAvoidCollisions(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  web:\n" +
+		"    image: alpine:latest\n" +
+		"    command: [\"sleep\", \"300\"]\n" +
+		"    ports:\n" +
+		"      - \"18089:8080\"\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	seen := map[int]bool{}
+	for i := 0; i < 2; i++ {
+		runCtx, stop := context.WithCancel(context.Background())
+		cmd := proj.CommandContext(runCtx, "web")
+		cmd.EphemeralPorts = true
+		if err := cmd.Start(); err != nil {
+			stop()
+			t.Fatalf("Start #%d: %v", i, err)
+		}
+		defer func() {
+			stop()
+			_ = cmd.Wait()
+		}()
+		ports, err := cmd.PublishedPorts(ctx)
+		if err != nil || len(ports) == 0 {
+			t.Fatalf("PublishedPorts #%d: %v %v", i, ports, err)
+		}
+		for _, p := range ports {
+			if p.Declared != "18089" || p.HostPort == 18089 {
+				t.Fatalf("port=%+v want ephemeral remap of 18089", p)
+			}
+			seen[p.HostPort] = true
+		}
+	}
+	if len(seen) < 2 {
+		t.Fatalf("host ports=%v want distinct ports per run", seen)
+	}
+}
+
+func TestIntegration_CheckpointRestore(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  counter:\n" +
+		"    image: alpine:latest\n" +
+		"    command:\n" +
+		"      - sh\n" +
+		"      - -c\n" +
+		"      - i=0; while true; do i=$$((i+1)); echo $$i; sleep 0.2; done\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	warm := proj.CommandContext(runCtx, "counter")
+	if err := warm.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() {
+		stop()
+		_ = warm.Wait()
+	}()
+	if err := warm.WaitFor(ctx, WaitForLog("10")); err != nil {
+		t.Fatalf("WaitForLog: %v", err)
+	}
+
+	cp := Checkpoint{Name: "warm", Dir: t.TempDir()}
+	if err := warm.Checkpoint(ctx, cp); err != nil {
+		if errors.Is(err, ErrCheckpointUnsupported) {
+			t.Skipf("checkpoint/restore unsupported: %v", err)
+		}
+		t.Fatalf("Checkpoint: %v", err)
+	}
+
+	restoreCtx, stopRestored := context.WithCancel(ctx)
+	defer stopRestored()
+	restored := proj.CommandContext(restoreCtx, "counter")
+	restored.RestoreFrom = &cp
+	out, err := restored.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe: %v", err)
+	}
+	if err := restored.Start(); err != nil {
+		t.Fatalf("Start restored: %v", err)
+	}
+	defer func() {
+		stopRestored()
+		_ = restored.Wait()
+	}()
+	sc := bufio.NewScanner(out)
+	if !sc.Scan() {
+		t.Fatalf("no output from restored container: %v", sc.Err())
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(sc.Text())); err != nil || n <= 10 {
+		t.Fatalf("restored counter started at %q, want > 10", sc.Text())
+	}
+}
+
+func TestIntegration_FixtureClonesGoldenVolume(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  db:\n" +
+		"    image: alpine:latest\n" +
+		"    command: [\"sh\", \"-c\", \"echo seeded > /data/seed && echo ready && sleep 300\"]\n" +
+		"    volumes:\n" +
+		"      - data:/data\n" +
+		"volumes:\n" +
+		"  data: {}\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	f, err := proj.NewFixture(ctx, "db", "data", func(ctx context.Context, cmd *Cmd) error {
+		return cmd.WaitFor(ctx, WaitForLog("ready"))
+	})
+	if err != nil {
+		t.Fatalf("NewFixture: %v", err)
+	}
+	defer func() {
+		if err := f.Close(context.Background()); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	}()
+
+	first, err := f.Clone(ctx)
+	if err != nil {
+		t.Fatalf("Clone: %v", err)
+	}
+	second, err := f.Clone(ctx)
+	if err != nil {
+		t.Fatalf("Clone: %v", err)
+	}
+	out, err := first.CommandContext(ctx, "sh", "-c", "cat /data/seed && rm /data/seed").Output()
+	if err != nil || strings.TrimSpace(string(out)) != "seeded" {
+		t.Fatalf("first clone: out=%q err=%v", out, err)
+	}
+	if err := first.Remove(ctx); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	out, err = second.CommandContext(ctx, "cat", "/data/seed").Output()
+	if err != nil || strings.TrimSpace(string(out)) != "seeded" {
+		t.Fatalf("second clone was affected by the first: out=%q err=%v", out, err)
+	}
+}
+
+func TestIntegration_InitCommands(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  app:\n" +
+		"    image: alpine:latest\n" +
+		"    user: \"1000\"\n" +
+		"    command:\n" +
+		"      - sh\n" +
+		"      - -c\n" +
+		"      - until [ -f /data/seed ]; do sleep 0.1; done; cat /data/seed\n" +
+		"    x-init:\n" +
+		"      - {command: [mkdir, -p, /data], user: root}\n" +
+		"      - {command: chown 1000 /data, user: root}\n" +
+		"      - echo seeded > /data/seed\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	out, err := proj.Command("app").Output()
+	if err != nil {
+		t.Fatalf("Output: %v", err)
+	}
+	if strings.TrimSpace(string(out)) != "seeded" {
+		t.Fatalf("out=%q want seeded", out)
+	}
+
+	cmd := proj.Command("app")
+	cmd.InitCommands = [][]string{{"false"}}
+	var ee *ExitError
+	if err := cmd.Start(); !errors.As(err, &ee) || ee.Code != 1 {
+		t.Fatalf("Start err=%v want ExitError(1)", err)
+	}
+}
+
+func TestIntegration_Commit(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  app:\n" +
+		"    image: alpine:latest\n" +
+		"    command: [sleep, \"60\"]\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cmd := proj.CommandContext(ctx, "app")
+	cmd.InitCommands = [][]string{{"sh", "-c", "echo provisioned > /marker"}}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	ref := "compose-exec-commit-test:" + proj.Name
+	id, err := cmd.Commit(ctx, ref, CommitOptions{Changes: []string{"ENV PROVISIONED=1"}})
+	cancel()
+	_ = cmd.Wait()
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		t.Fatalf("docker client: %v", err)
+	}
+	defer cli.Close()
+	t.Cleanup(func() {
+		_, _ = cli.ImageRemove(context.Background(), id, image.RemoveOptions{Force: true})
+	})
+
+	svc, err := proj.Service("app")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+	out, err := svc.With(OverrideImage(ref)).
+		Command("sh", "-c", "cat /marker; echo $PROVISIONED").Output()
+	if err != nil {
+		t.Fatalf("Output: %v", err)
+	}
+	if string(out) != "provisioned\n1\n" {
+		t.Fatalf("out=%q", out)
+	}
+}
+
+func TestIntegration_SaveLoadImages(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  app:\n" +
+		"    image: alpine:latest\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "images.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := SaveImages(ctx, proj, f); err != nil {
+		t.Fatalf("SaveImages: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	r, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer r.Close()
+	if err := LoadImages(ctx, r); err != nil {
+		t.Fatalf("LoadImages: %v", err)
+	}
+}
+
+func TestIntegration_IncludeEarlyLogs(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  fast:\n" +
+		"    image: alpine:latest\n" +
+		"  quiet:\n" +
+		"    image: alpine:latest\n" +
+		"    logging:\n" +
+		"      driver: none\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	for _, early := range []bool{false, true} {
+		cmd := proj.CommandContext(ctx, "fast", "echo", "done")
+		cmd.IncludeEarlyLogs = early
+		out, err := cmd.Output()
+		if err != nil || string(out) != "done\n" {
+			t.Fatalf("early=%v: out=%q err=%v", early, out, err)
+		}
+	}
+
+	// Without log replay, attaching works with logging drivers that cannot be read.
+	out, err := proj.CommandContext(ctx, "quiet", "echo", "done").Output()
+	if err != nil || string(out) != "done\n" {
+		t.Fatalf("logging driver none: out=%q err=%v", out, err)
+	}
+}
+
+func TestIntegration_ExtraHostsHostGateway(t *testing.T) {
+	yaml := "" +
+		"services:\n" +
+		"  app:\n" +
+		"    image: alpine:latest\n" +
+		"    extra_hosts:\n" +
+		"      - \"api.local:10.0.0.10\"\n"
+
+	_, proj := setupIntegrationWithComposeYAML(t, yaml)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cmd := proj.CommandContext(ctx, "app", "cat", "/etc/hosts")
+	cmd.ExtraHosts = []string{"host.docker.internal:host-gateway", "api.local:10.0.0.20"}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Output: %v", err)
+	}
+	hosts := string(out)
+	if strings.Contains(hosts, "host-gateway") ||
+		!strings.Contains(hosts, "host.docker.internal") {
+		t.Fatalf("host-gateway not resolved:\n%s", hosts)
+	}
+	if strings.Contains(hosts, "10.0.0.10") || !strings.Contains(hosts, "10.0.0.20") {
+		t.Fatalf("Cmd.ExtraHosts must replace the service entry:\n%s", hosts)
+	}
+}
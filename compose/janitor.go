@@ -0,0 +1,214 @@
+package compose
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// expiresAtLabel carries the RFC 3339 time after which Janitor may remove a
+// resource (see SetResourceTTL).
+const expiresAtLabel = "io.github.hnw.compose-exec.expires-at"
+
+var (
+	resourceTTLMu sync.Mutex
+	resourceTTL   time.Duration
+)
+
+// SetResourceTTL labels every container, network and volume created afterwards
+// with an expiry time ttl from its creation, after which Janitor removes it even
+// if the process that created it crashed. Zero, the default, disables the label.
+func SetResourceTTL(ttl time.Duration) {
+	resourceTTLMu.Lock()
+	defer resourceTTLMu.Unlock()
+	resourceTTL = max(ttl, 0)
+}
+
+// addExpiryLabel adds the label of SetResourceTTL to labels, which may be nil, and
+// returns the result.
+func addExpiryLabel(labels map[string]string, now time.Time) map[string]string {
+	resourceTTLMu.Lock()
+	ttl := resourceTTL
+	resourceTTLMu.Unlock()
+	if ttl == 0 {
+		return labels
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[expiresAtLabel] = now.Add(ttl).UTC().Format(time.RFC3339)
+	return labels
+}
+
+// Janitor removes expired resources created by this package, of any project:
+// containers, then networks and volumes no longer in use. A resource is expired
+// when the time of its expires-at label (see SetResourceTTL) has passed. If
+// olderThan is positive, containers and networks without that label are also
+// expired when they were created more than olderThan ago; such containers are only
+// removed once they stopped, and volumes are only removed by their label, so data
+// is never lost to the age rule. Resources of `docker compose` and other tools are
+// never touched. It protects shared hosts such as CI runners from resources leaked
+// by crashed jobs.
+//
+// Failures are returned as a *MultiError.
+func Janitor(ctx context.Context, olderThan time.Duration) error {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cli.Close() }()
+	return janitor(ctx, cli, time.Now(), olderThan)
+}
+
+func janitor(ctx context.Context, dc Backend, now time.Time, olderThan time.Duration) error {
+	errs := &MultiError{Op: "janitor"}
+	j := janitorPolicy{now: now, olderThan: olderThan}
+	managedFilter := filters.NewArgs(
+		filters.Arg("label", "com.docker.compose.project"),
+		filters.Arg("label", managedLabel+"=true"),
+	)
+	if err := janitorContainers(ctx, dc, managedFilter, j, errs); err != nil {
+		return err
+	}
+	janitorNetworks(ctx, dc, managedFilter, j, errs)
+	janitorVolumes(ctx, dc, managedFilter, j, errs)
+	return errs.errOrNil()
+}
+
+// janitorPolicy decides which resources Janitor removes.
+type janitorPolicy struct {
+	now       time.Time
+	olderThan time.Duration
+}
+
+// labeled reports whether labels carry a valid expires-at label and whether it
+// has passed. Resources not created by this package are never expired.
+func (j janitorPolicy) labeled(labels map[string]string) (ok, expired bool) {
+	if labels[managedLabel] != "true" {
+		return false, false
+	}
+	at, err := time.Parse(time.RFC3339, labels[expiresAtLabel])
+	if err != nil {
+		return false, false
+	}
+	return true, j.now.After(at)
+}
+
+// aged reports whether a resource created by this package without an expires-at
+// label is older than olderThan.
+func (j janitorPolicy) aged(labels map[string]string, created time.Time) bool {
+	return labels[managedLabel] == "true" && j.olderThan > 0 && !created.IsZero() &&
+		j.now.Sub(created) > j.olderThan
+}
+
+func janitorContainers(
+	ctx context.Context,
+	dc Backend,
+	managedFilter filters.Args,
+	j janitorPolicy,
+	errs *MultiError,
+) error {
+	containers, err := dc.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: managedFilter,
+	})
+	if err != nil {
+		return engineErr("list containers", err)
+	}
+	for _, c := range containers {
+		labeled, expired := j.labeled(c.Labels)
+		if !labeled {
+			// Without an explicit expiry, running containers are left alone.
+			expired = !containerActive(c.State) && j.aged(c.Labels, time.Unix(c.Created, 0))
+		}
+		if !expired {
+			continue
+		}
+		rmErr := dc.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: labeled})
+		journalContainerRemoved(c.ID, rmErr)
+		if rmErr != nil && !isNotFoundErr(rmErr) {
+			errs.add("container", strings.Join(c.Names, ","), engineErr("remove container", rmErr))
+		}
+	}
+	return nil
+}
+
+// containerActive reports whether a container in state (container.Summary.State)
+// may still be doing work.
+func containerActive(state container.ContainerState) bool {
+	switch state {
+	case container.StateCreated, container.StateExited, container.StateDead:
+		return false
+	default:
+		return true
+	}
+}
+
+func janitorNetworks(
+	ctx context.Context,
+	dc Backend,
+	managedFilter filters.Args,
+	j janitorPolicy,
+	errs *MultiError,
+) {
+	networks, err := dc.NetworkList(ctx, network.ListOptions{Filters: managedFilter})
+	if err != nil {
+		errs.add("network", "", engineErr("list networks", err))
+		return
+	}
+	for _, n := range networks {
+		labeled, expired := j.labeled(n.Labels)
+		if !labeled {
+			expired = j.aged(n.Labels, n.Created)
+		}
+		if !expired {
+			continue
+		}
+		rmErr := dc.NetworkRemove(ctx, n.ID)
+		journalNetworkRemoved(n.ID, rmErr)
+		// Networks still used by unexpired containers are kept.
+		if rmErr != nil && !isNotFoundErr(rmErr) && !isActiveEndpointsErr(rmErr) {
+			errs.add("network", n.Name, engineErr("remove network", rmErr))
+		}
+	}
+}
+
+// janitorVolumes removes volumes only by their expires-at label; olderThan does
+// not apply, as volumes hold data.
+func janitorVolumes(
+	ctx context.Context,
+	dc Backend,
+	managedFilter filters.Args,
+	j janitorPolicy,
+	errs *MultiError,
+) {
+	vols, err := dc.VolumeList(ctx, volume.ListOptions{Filters: managedFilter})
+	if err != nil {
+		errs.add("volume", "", engineErr("list volumes", err))
+		return
+	}
+	for _, v := range vols.Volumes {
+		if v == nil {
+			continue
+		}
+		if _, expired := j.labeled(v.Labels); !expired {
+			continue
+		}
+		rmErr := dc.VolumeRemove(ctx, v.Name, false)
+		journalVolumeRemoved(v.Name, rmErr)
+		// Volumes still used by unexpired containers are kept.
+		if rmErr != nil && !isNotFoundErr(rmErr) && !cerrdefs.IsConflict(rmErr) {
+			errs.add("volume", v.Name, engineErr("remove volume", rmErr))
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package compose
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Resource kinds recorded in the cleanup journal.
+const (
+	journalKindContainer = "container"
+	journalKindNetwork   = "network"
+	journalKindVolume    = "volume"
+)
+
+const (
+	journalOpCreate = "create"
+	journalOpRemove = "remove"
+)
+
+// journalEntry is one JSON line of a journal file.
+type journalEntry struct {
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	Kind string    `json:"kind"`
+	ID   string    `json:"id"`
+	Name string    `json:"name,omitempty"`
+}
+
+// journal is the per-process cleanup journal.
+type journal struct {
+	mu   sync.Mutex
+	dir  string
+	file *os.File
+	// live holds the kind/ID of recorded resources not removed yet. The file is
+	// deleted when it becomes empty.
+	live map[string]struct{}
+}
+
+var (
+	journalMu      sync.Mutex
+	currentJournal *journal
+	// journalNonce distinguishes this process from earlier ones that had the same
+	// PID (e.g. PID 1 in a restarted container).
+	journalNonce = func() string {
+		sfx, _ := randSuffix(4)
+		return sfx
+	}()
+)
+
+// SetJournalDir enables the crash-safe cleanup journal in dir, or disables it when
+// dir is empty (the default).
+//
+// While enabled, every container, network, and volume created by this package is
+// recorded in a per-process file in dir before it can leak, and their removals
+// are recorded as they happen; the file is deleted once every recorded resource
+// is gone, e.g. after Down. RecoverAndClean uses these files to reap resources
+// left behind by processes that crashed or were killed.
+func SetJournalDir(dir string) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if currentJournal != nil {
+		currentJournal.close()
+		currentJournal = nil
+	}
+	if dir == "" {
+		return nil
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(absDir, 0o700); err != nil {
+		return fmt.Errorf("compose: create journal dir: %w", err)
+	}
+	currentJournal = &journal{dir: absDir}
+	return nil
+}
+
+func activeJournal() *journal {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	return currentJournal
+}
+
+// journalRecord appends an entry to the active journal, if any. Journal write
+// failures must not break container execution, so they are reported as warnings.
+func journalRecord(op, kind, id, name string) {
+	j := activeJournal()
+	if j == nil || id == "" {
+		return
+	}
+	if err := j.append(journalEntry{
+		Time: time.Now().UTC(),
+		Op:   op,
+		Kind: kind,
+		ID:   id,
+		Name: name,
+	}); err != nil {
+		writeWarning(os.Stderr, fmt.Sprintf("cleanup journal write failed: %v", err))
+	}
+}
+
+func (j *journal) append(e journalEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	key := e.Kind + "/" + e.ID
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if e.Op == journalOpRemove {
+		if _, ok := j.live[key]; !ok {
+			// Not created by this process: nothing to cancel.
+			return nil
+		}
+		delete(j.live, key)
+		if len(j.live) == 0 {
+			return j.remove()
+		}
+	}
+	if j.file == nil {
+		// #nosec G304 -- path is built from the configured journal dir.
+		f, err := os.OpenFile(j.path(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		j.file = f
+	}
+	if _, err := j.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if e.Op == journalOpCreate {
+		if j.live == nil {
+			j.live = map[string]struct{}{}
+		}
+		j.live[key] = struct{}{}
+	}
+	// Sync so the record survives a crash right after the engine call.
+	return j.file.Sync()
+}
+
+func (j *journal) path() string {
+	return filepath.Join(j.dir, journalFileName(journalHostname(), os.Getpid(), journalNonce))
+}
+
+// remove deletes the journal file once nothing recorded in it is left to clean up.
+// The caller holds j.mu.
+func (j *journal) remove() error {
+	if j.file != nil {
+		_ = j.file.Close()
+		j.file = nil
+	}
+	if err := os.Remove(j.path()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (j *journal) close() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file != nil {
+		_ = j.file.Close()
+		j.file = nil
+	}
+}
+
+// RecoverAndClean removes containers and networks recorded in the cleanup journal
+// (see SetJournalDir) by processes on this host that are no longer running, then
+// deletes their journal files. Networks still used by other containers are left
+// in place. Recorded volumes are never deleted, as they hold data: each one still
+// present is reported as a warning on os.Stderr instead.
+//
+// Failures are returned as a *MultiError; journal files with failures are kept so
+// that a later call can retry.
+func RecoverAndClean(ctx context.Context) error {
+	j := activeJournal()
+	if j == nil {
+		return errors.New("compose: cleanup journal is not enabled (see SetJournalDir)")
+	}
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cli.Close() }()
+	return recoverJournalDir(ctx, cli, j.dir)
+}
+
+func recoverJournalDir(ctx context.Context, dc Backend, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return err
+	}
+	errs := &MultiError{Op: "recover"}
+	host := journalHostname()
+	for _, path := range files {
+		if !isStaleJournal(filepath.Base(path), host) {
+			continue
+		}
+		entries, err := readJournal(path)
+		if err != nil {
+			errs.add("journal", path, err)
+			continue
+		}
+		before := len(errs.Errors)
+		for _, name := range reapJournalEntries(ctx, dc, entries, errs) {
+			writeWarning(os.Stderr, fmt.Sprintf(
+				"cleanup journal: volume %s of a terminated process was kept; "+
+					"remove it with `docker volume rm` if it is not needed", name))
+		}
+		if len(errs.Errors) == before {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				errs.add("journal", path, err)
+			}
+		}
+	}
+	return errs.errOrNil()
+}
+
+// reapJournalEntries removes the containers and networks left by entries and
+// returns the names of the volumes left, which it keeps.
+func reapJournalEntries(
+	ctx context.Context,
+	dc Backend,
+	entries []journalEntry,
+	errs *MultiError,
+) (volumes []string) {
+	type resource struct {
+		kind, id, name string
+	}
+	var order []resource
+	live := map[string]bool{}
+	for _, e := range entries {
+		key := e.Kind + "/" + e.ID
+		switch e.Op {
+		case journalOpCreate:
+			if _, seen := live[key]; !seen {
+				order = append(order, resource{kind: e.Kind, id: e.ID, name: e.Name})
+			}
+			live[key] = true
+		case journalOpRemove:
+			live[key] = false
+		}
+	}
+
+	// Containers first: networks cannot be removed while containers are attached.
+	for _, kind := range []string{journalKindContainer, journalKindNetwork} {
+		for _, r := range order {
+			if r.kind != kind || !live[r.kind+"/"+r.id] {
+				continue
+			}
+			var err error
+			switch kind {
+			case journalKindContainer:
+				err = forceRemoveContainer(ctx, dc, r.id)
+			case journalKindNetwork:
+				err = dc.NetworkRemove(ctx, r.id)
+				if err != nil && isActiveEndpointsErr(err) {
+					// Still used by someone else: not leaked.
+					err = nil
+				}
+			}
+			if err != nil && !isNotFoundErr(err) {
+				errs.add(kind, r.name, err)
+			}
+		}
+	}
+	for _, r := range order {
+		if r.kind == journalKindVolume && live[r.kind+"/"+r.id] {
+			volumes = append(volumes, r.id)
+		}
+	}
+	return volumes
+}
+
+func readJournal(path string) ([]journalEntry, error) {
+	// #nosec G304 -- path comes from globbing the configured journal dir.
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var out []journalEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			// A crash may leave a truncated last line.
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
+
+func journalFileName(host string, pid int, nonce string) string {
+	return fmt.Sprintf("%s_%d_%s.jsonl", sanitizeName(host), pid, nonce)
+}
+
+// isStaleJournal reports whether the journal file name belongs to a process on
+// this host that is no longer running.
+func isStaleJournal(name, host string) bool {
+	// The host part may itself contain underscores, so split from the right.
+	parts := strings.Split(strings.TrimSuffix(name, ".jsonl"), "_")
+	n := len(parts)
+	if n < 3 || strings.Join(parts[:n-2], "_") != sanitizeName(host) {
+		return false
+	}
+	pid, err := strconv.Atoi(parts[n-2])
+	if err != nil {
+		return false
+	}
+	if pid == os.Getpid() {
+		return parts[n-1] != journalNonce
+	}
+	return !processAlive(pid)
+}
+
+func journalHostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "localhost"
+	}
+	return host
+}
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess only succeeds for existing processes on Windows.
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// journalContainerRemoved records a container removal. It is a no-op for failures.
+func journalContainerRemoved(id string, err error) {
+	if err == nil || isNotFoundErr(err) {
+		journalRecord(journalOpRemove, journalKindContainer, id, "")
+	}
+}
+
+// journalNetworkRemoved records a network removal. It is a no-op for failures.
+func journalNetworkRemoved(id string, err error) {
+	if err == nil || isNotFoundErr(err) {
+		journalRecord(journalOpRemove, journalKindNetwork, id, "")
+	}
+}
+
+// journalVolumeRemoved records a volume removal. It is a no-op for failures.
+func journalVolumeRemoved(name string, err error) {
+	if err == nil || isNotFoundErr(err) {
+		journalRecord(journalOpRemove, journalKindVolume, name, "")
+	}
+}
@@ -0,0 +1,208 @@
+package compose
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Keys recognized in JSON log lines, in order of precedence. They cover the
+// defaults of log/slog, zap, zerolog, logrus, and bunyan or pino, whose numeric
+// levels are mapped to names by numericLogLevels.
+var (
+	logLevelKeys = []string{"level", "lvl", "severity"}
+	logMsgKeys   = []string{"msg", "message"}
+	logTimeKeys  = []string{"time", "ts", "timestamp"}
+)
+
+// numericLogLevels maps the lower bound of each bunyan/pino numeric level range
+// to its name, highest first. Lower levels are "TRACE".
+var numericLogLevels = []struct {
+	min  int64
+	name string
+}{
+	{60, "FATAL"},
+	{50, "ERROR"},
+	{40, "WARN"},
+	{30, "INFO"},
+	{20, "DEBUG"},
+}
+
+// LogRecord is one JSON log line written by a service.
+type LogRecord struct {
+	// Time is parsed from a time/ts/timestamp field (RFC 3339 or Unix seconds) and
+	// is zero if there is none.
+	Time time.Time
+	// Level is the upper-cased level/lvl/severity field, e.g. "ERROR". Numeric
+	// bunyan/pino levels are mapped to names: 50 and above is "ERROR" (60 and
+	// above "FATAL"), 40 "WARN", 30 "INFO", 20 "DEBUG", and lower "TRACE".
+	Level string
+	// Msg is the msg or message field.
+	Msg string
+	// Fields holds the remaining fields; numbers are json.Number.
+	Fields map[string]any
+	// Raw is the line without its trailing newline.
+	Raw []byte
+}
+
+// JSONLineDemuxer is an io.Writer for Cmd.Stdout or Cmd.Stderr that parses JSON log
+// lines into LogRecords, e.g. so a supervisor can alert on ERROR logs of a service.
+// Lines that are not JSON objects are skipped. All output is also passed through to
+// the writer given to NewJSONLineDemuxer.
+//
+// Records are delivered on a buffered channel. Writing never blocks on a slow
+// reader: records that do not fit in the buffer are dropped and counted by Dropped.
+type JSONLineDemuxer struct {
+	next    io.Writer
+	records chan LogRecord
+	dropped atomic.Int64
+
+	mu     sync.Mutex
+	line   bytes.Buffer
+	closed bool
+}
+
+// NewJSONLineDemuxer returns a demuxer that passes output through to next (which
+// may be nil) and buffers up to buffer records.
+func NewJSONLineDemuxer(next io.Writer, buffer int) *JSONLineDemuxer {
+	return &JSONLineDemuxer{next: next, records: make(chan LogRecord, max(buffer, 0))}
+}
+
+// Records returns the channel of parsed records. It is closed by Close.
+func (d *JSONLineDemuxer) Records() <-chan LogRecord {
+	return d.records
+}
+
+// Dropped returns the number of records dropped because the channel was full.
+func (d *JSONLineDemuxer) Dropped() int64 {
+	return d.dropped.Load()
+}
+
+// Write passes p through and parses every line it completes.
+func (d *JSONLineDemuxer) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closed {
+		for rest := p; len(rest) > 0; {
+			i := bytes.IndexByte(rest, '\n')
+			if i < 0 {
+				d.line.Write(rest)
+				break
+			}
+			d.line.Write(rest[:i])
+			d.emit()
+			rest = rest[i+1:]
+		}
+	}
+	if d.next == nil {
+		return len(p), nil
+	}
+	return d.next.Write(p)
+}
+
+// Close parses a final unterminated line and closes the Records channel. Call it
+// after Wait returned.
+func (d *JSONLineDemuxer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.emit()
+	d.closed = true
+	close(d.records)
+	return nil
+}
+
+func (d *JSONLineDemuxer) emit() {
+	defer d.line.Reset()
+	rec, ok := parseLogRecord(d.line.Bytes())
+	if !ok {
+		return
+	}
+	select {
+	case d.records <- rec:
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+func parseLogRecord(line []byte) (LogRecord, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return LogRecord{}, false
+	}
+	var fields map[string]any
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil || dec.More() {
+		return LogRecord{}, false
+	}
+	rec := LogRecord{Raw: append([]byte(nil), line...), Fields: fields}
+	rec.Level = takeLevel(fields)
+	rec.Msg, _ = takeString(fields, logMsgKeys)
+	for _, k := range logTimeKeys {
+		if t, ok := parseLogTime(fields[k]); ok {
+			rec.Time = t
+			delete(fields, k)
+			break
+		}
+	}
+	return rec, true
+}
+
+// takeString removes and returns the first string field among keys.
+func takeString(fields map[string]any, keys []string) (string, bool) {
+	for _, k := range keys {
+		if s, ok := fields[k].(string); ok {
+			delete(fields, k)
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// takeLevel removes and returns the first level field, named or numeric.
+func takeLevel(fields map[string]any) string {
+	for _, k := range logLevelKeys {
+		switch v := fields[k].(type) {
+		case string:
+			delete(fields, k)
+			return strings.ToUpper(v)
+		case json.Number:
+			n, err := v.Int64()
+			if err != nil {
+				continue
+			}
+			delete(fields, k)
+			for _, l := range numericLogLevels {
+				if n >= l.min {
+					return l.name
+				}
+			}
+			return "TRACE"
+		}
+	}
+	return ""
+}
+
+func parseLogTime(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		sec := int64(f)
+		return time.Unix(sec, int64((f-float64(sec))*1e9)).UTC(), true
+	default:
+		return time.Time{}, false
+	}
+}
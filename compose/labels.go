@@ -0,0 +1,56 @@
+package compose
+
+import (
+	"sync"
+	"time"
+)
+
+// managedLabel marks the containers, networks and volumes this package created, so
+// Janitor never touches resources of `docker compose` or other tools.
+const managedLabel = "io.github.hnw.compose-exec.managed"
+
+var (
+	globalLabelsMu sync.Mutex
+	globalLabels   map[string]string
+)
+
+// SetGlobalLabels sets labels applied to every container, network and volume this
+// package creates, across all projects, e.g. an owner or team namespace that an
+// organization-wide janitor job filters on to find and expire them. Labels set by
+// the compose file or by this package itself (com.docker.compose.*) take
+// precedence. Entries with an empty key are ignored; nil removes all.
+func SetGlobalLabels(labels map[string]string) {
+	var copied map[string]string
+	for k, v := range labels {
+		if k == "" {
+			continue
+		}
+		if copied == nil {
+			copied = make(map[string]string, len(labels))
+		}
+		copied[k] = v
+	}
+	globalLabelsMu.Lock()
+	defer globalLabelsMu.Unlock()
+	globalLabels = copied
+}
+
+// addGlobalLabels adds the labels of SetGlobalLabels missing from labels, the
+// expiry label of SetResourceTTL and managedLabel, and returns the result. labels
+// may be nil.
+func addGlobalLabels(labels map[string]string) map[string]string {
+	globalLabelsMu.Lock()
+	defer globalLabelsMu.Unlock()
+	labels = addExpiryLabel(labels, time.Now())
+	if labels == nil {
+		labels = make(map[string]string, len(globalLabels)+1)
+	}
+	for k, v := range globalLabels {
+		if _, ok := labels[k]; ok {
+			continue
+		}
+		labels[k] = v
+	}
+	labels[managedLabel] = "true"
+	return labels
+}
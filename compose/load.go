@@ -5,28 +5,99 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/compose-spec/compose-go/v2/loader"
 	"github.com/compose-spec/compose-go/v2/types"
 )
 
+// LoadOption configures LoadProject.
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	files       []string
+	projectName string
+	overlays    []types.Project
+	ipv6Default bool
+
+	imageRewriters []ImageRewriter
+	lockTimeout    *time.Duration
+}
+
+// WithFiles selects the compose files to load instead of the default lookup.
+// Relative paths are resolved against the project directory.
+func WithFiles(files ...string) LoadOption {
+	return func(o *loadOptions) {
+		o.files = append(o.files, files...)
+	}
+}
+
+// WithProjectName overrides the project name, taking precedence over 'name:' in YAML
+// and the directory name. Use it to run several isolated instances of the same
+// compose directory side by side.
+func WithProjectName(name string) LoadOption {
+	return func(o *loadOptions) {
+		o.projectName = name
+	}
+}
+
+// WithOverlay merges overlay on top of the compose files, with the same semantics as
+// an override file: set fields replace, and maps and lists are merged. It may be
+// given several times; later overlays win. Only the fields to change need to be
+// set, e.g. a service's Image or Environment.
+func WithOverlay(overlay types.Project) LoadOption {
+	return func(o *loadOptions) {
+		o.overlays = append(o.overlays, overlay)
+	}
+}
+
+// WithDualStackDefaultNetwork creates the project's implicit "default" network with
+// IPv6 enabled in addition to IPv4, for services that test IPv6 paths. Without an
+// ipam subnet the daemon allocates the IPv6 prefix from its default address pools
+// (Docker Engine 27 and later). A default network that is external or sets
+// enable_ipv6 explicitly is left as is.
+func WithDualStackDefaultNetwork() LoadOption {
+	return func(o *loadOptions) {
+		o.ipv6Default = true
+	}
+}
+
+// LoadProjectFiles loads a compose project from the given compose files within dir,
+// like LoadProject(ctx, dir, WithFiles(files...)). It keeps the signature LoadProject
+// had before it took load options.
+func LoadProjectFiles(ctx context.Context, dir string, files ...string) (*Project, error) {
+	return LoadProject(ctx, dir, WithFiles(files...))
+}
+
 // LoadProject loads a compose project from compose files within dir.
 //
-// If files is empty, it defaults to docker-compose.yml and docker-compose.override.yml
-// (the latter only if it exists).
+// Unless WithFiles is given, it defaults to docker-compose.yml and
+// docker-compose.override.yml (the latter only if it exists).
 //
 // Environment variable resolution follows compose-go behavior, including .env in dir.
-func LoadProject(ctx context.Context, dir string, files ...string) (*Project, error) {
+func LoadProject(ctx context.Context, dir string, opts ...LoadOption) (*Project, error) {
 	if dir == "" {
 		return nil, errors.New("dir is required")
 	}
 
+	var lo loadOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&lo)
+		}
+	}
+	if lo.projectName != "" {
+		if err := validateProjectName(lo.projectName); err != nil {
+			return nil, err
+		}
+	}
+
 	absDir, err := filepath.Abs(dir)
 	if err != nil {
 		return nil, err
 	}
 
-	configFiles := defaultComposeFiles(absDir, files)
+	configFiles := defaultComposeFiles(absDir, lo.files)
 
 	cd := types.ConfigDetails{
 		WorkingDir: absDir,
@@ -39,13 +110,21 @@ func LoadProject(ctx context.Context, dir string, files ...string) (*Project, er
 		}(),
 		Environment: currentEnvMap(),
 	}
+	overlays, err := overlayConfigFiles(lo.overlays)
+	if err != nil {
+		return nil, err
+	}
+	cd.ConfigFiles = append(cd.ConfigFiles, overlays...)
 
 	project, err := loader.LoadWithContext(ctx, cd, func(opts *loader.Options) {
 		// Try loading without forcing a project name, so that 'name:' in YAML takes precedence.
 		opts.SkipNormalization = false
 		opts.Profiles = []string{"*"}
+		if lo.projectName != "" {
+			opts.SetProjectName(lo.projectName, true)
+		}
 	})
-	if err != nil {
+	if err != nil && lo.projectName == "" {
 		project, err = loader.LoadWithContext(ctx, cd, func(opts *loader.Options) {
 			// If loading failed (likely due to missing project name in YAML),
 			// fallback to using the directory name with standard normalization.
@@ -59,7 +138,22 @@ func LoadProject(ctx context.Context, dir string, files ...string) (*Project, er
 	if err != nil {
 		return nil, err
 	}
-	return (*Project)(project), nil
+	if lo.ipv6Default {
+		enableDefaultNetworkIPv6(project)
+	}
+	p := (*Project)(project)
+	rewriteImages(p, lo.imageRewriters)
+	if lo.lockTimeout != nil {
+		projectLocks.Store(p.Name, *lo.lockTimeout)
+	}
+	return p, nil
+}
+
+func validateProjectName(name string) error {
+	if name == "" || loader.NormalizeProjectName(name) != name {
+		return loader.InvalidProjectNameErr(name)
+	}
+	return nil
 }
 
 func defaultComposeFiles(dir string, files []string) []string {
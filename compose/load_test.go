@@ -1,11 +1,26 @@
 package compose
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
 )
 
+func writeComposeFile(t *testing.T, dir, yaml string) {
+	t.Helper()
+	path := filepath.Join(dir, "docker-compose.yml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("write compose yaml: %v", err)
+	}
+}
+
 func TestDefaultComposeFiles_UsesYamlWhenYmlMissing(t *testing.T) {
 	dir := t.TempDir()
 	base := filepath.Join(dir, "docker-compose.yaml")
@@ -61,3 +76,489 @@ func TestDefaultComposeFiles_UsesOverrideYaml(t *testing.T) {
 		t.Fatalf("files=%v want=[%q %q]", files, base, override)
 	}
 }
+
+func TestLoadProject_WithProjectNameOverridesYAMLName(t *testing.T) {
+	dir := t.TempDir()
+	writeComposeFile(t, dir, "name: from-yaml\nservices:\n  s:\n    image: alpine:latest\n")
+
+	proj, err := LoadProject(context.Background(), dir, WithProjectName("explicit"))
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	if proj.Name != "explicit" {
+		t.Fatalf("Name=%q want=%q", proj.Name, "explicit")
+	}
+	if got := proj.Networks["default"].Name; got != "explicit_default" {
+		t.Fatalf("default network=%q want=%q", got, "explicit_default")
+	}
+
+	if _, err := LoadProject(context.Background(), dir, WithProjectName("Bad Name")); err == nil {
+		t.Fatalf("expected invalid project name error")
+	}
+}
+
+func TestLoadProjectFiles(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "custom.yml"),
+		[]byte("name: files\nservices:\n  s:\n    image: alpine:latest\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proj, err := LoadProjectFiles(context.Background(), dir, "custom.yml")
+	if err != nil {
+		t.Fatalf("LoadProjectFiles: %v", err)
+	}
+	if proj.Name != "files" || proj.Services["s"].Image != "alpine:latest" {
+		t.Fatalf("project=%q services=%v", proj.Name, proj.Services)
+	}
+}
+
+func TestRenderConfig_ResolvesOverridesAndVariables(t *testing.T) {
+	dir := t.TempDir()
+	writeComposeFile(t, dir, "name: render\nservices:\n  app:\n    image: alpine:${TAG}\n")
+	override := "services:\n  app:\n    environment:\n      MODE: test\n"
+	err := os.WriteFile(filepath.Join(dir, "docker-compose.override.yml"), []byte(override), 0o600)
+	if err != nil {
+		t.Fatalf("write override: %v", err)
+	}
+	t.Setenv("TAG", "3.20")
+
+	proj, err := LoadProject(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	out, err := RenderConfig(proj)
+	if err != nil {
+		t.Fatalf("RenderConfig: %v", err)
+	}
+	for _, want := range []string{"name: render", "image: alpine:3.20", "MODE: test"} {
+		if !strings.Contains(string(out), want) {
+			t.Fatalf("rendered config lacks %q:\n%s", want, out)
+		}
+	}
+
+	// Literal dollars are escaped, as by `docker compose config`.
+	writeComposeFile(t, dir, "name: render\nservices:\n  app:\n    image: alpine\n"+
+		"    command: [\"echo\", \"$$HOME\"]\n")
+	if proj, err = LoadProject(context.Background(), dir); err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	if out, err = RenderConfig(proj); err != nil {
+		t.Fatalf("RenderConfig: %v", err)
+	}
+	if !strings.Contains(string(out), "$$HOME") {
+		t.Fatalf("literal $ not escaped:\n%s", out)
+	}
+
+	if _, err := (*Project)(nil).MarshalYAML(); err == nil {
+		t.Fatalf("expected error for nil project")
+	}
+}
+
+func TestLoadProject_WithOverlayAndMerge(t *testing.T) {
+	dir := t.TempDir()
+	writeComposeFile(t, dir, `name: overlay
+services:
+  db:
+    image: postgres:15
+    environment:
+      KEEP: "1"
+  web:
+    image: nginx:latest
+`)
+
+	overlay := types.Project{Services: types.Services{"db": {
+		Image:       "postgres:16.3",
+		Environment: types.NewMappingWithEquals([]string{"EXTRA=2"}),
+	}}}
+	proj, err := LoadProject(context.Background(), dir, WithOverlay(overlay))
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	db := proj.Services["db"]
+	if db.Image != "postgres:16.3" {
+		t.Fatalf("image=%q want=postgres:16.3", db.Image)
+	}
+	if *db.Environment["KEEP"] != "1" || *db.Environment["EXTRA"] != "2" {
+		t.Fatalf("environment=%v want KEEP and EXTRA", db.Environment)
+	}
+	if proj.Services["web"].Image != "nginx:latest" {
+		t.Fatalf("web service changed: %+v", proj.Services["web"])
+	}
+
+	merged, err := proj.Merge(&Project{Services: types.Services{"web": {Image: "nginx:1.27"}}})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if merged.Name != "overlay" || merged.Services["web"].Image != "nginx:1.27" {
+		t.Fatalf("merged name=%q web image=%q", merged.Name, merged.Services["web"].Image)
+	}
+	if merged.Services["db"].Image != "postgres:16.3" {
+		t.Fatalf("merged db image=%q", merged.Services["db"].Image)
+	}
+	if proj.Services["web"].Image != "nginx:latest" {
+		t.Fatalf("Merge modified the receiver")
+	}
+}
+
+func TestLoadProject_OverlayAndMergeKeepLiteralDollar(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", "/home/test")
+	writeComposeFile(t, dir, `name: dollar
+services:
+  app:
+    image: alpine
+    command: ["echo", "$$HOME"]
+`)
+	overlay := types.Project{Services: types.Services{"app": {
+		Environment: types.NewMappingWithEquals([]string{"PRICE=$5"}),
+	}}}
+	proj, err := LoadProject(context.Background(), dir, WithOverlay(overlay))
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	merged, err := proj.Merge(&Project{Services: types.Services{"app": {
+		Labels: types.Labels{"cost": "$$"},
+	}}})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	app := merged.Services["app"]
+	if got := app.Command; len(got) != 2 || got[1] != "$HOME" {
+		t.Fatalf("command=%q want literal $HOME", got)
+	}
+	if got := app.Environment["PRICE"]; got == nil || *got != "$5" {
+		t.Fatalf("PRICE=%v want literal $5", got)
+	}
+	if got := app.Labels["cost"]; got != "$$" {
+		t.Fatalf("label=%q want literal $$", got)
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	dir := t.TempDir()
+	writeComposeFile(t, dir, `name: ext
+x-suite:
+  owner: team-a
+x-env: &env
+  LOG_LEVEL: debug
+services:
+  app:
+    image: alpine:latest
+    environment: *env
+    x-test:
+      timeout_seconds: 30
+      tags: [slow, db]
+`)
+	proj, err := LoadProject(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+
+	var suite struct{ Owner string }
+	if ok, err := proj.Extension("x-suite", &suite); !ok || err != nil || suite.Owner != "team-a" {
+		t.Fatalf("x-suite ok=%v err=%v value=%+v", ok, err, suite)
+	}
+	if _, ok := proj.Extensions["x-env"]; !ok {
+		t.Fatalf("x-env missing from Extensions: %v", proj.Extensions)
+	}
+
+	svc, err := proj.Service("app")
+	if err != nil {
+		t.Fatalf("Project.Service: %v", err)
+	}
+	var meta struct {
+		TimeoutSeconds int      `json:"timeout_seconds"`
+		Tags           []string `json:"tags"`
+	}
+	ok, err := svc.Extension("x-test", &meta)
+	wantTags := []string{"slow", "db"}
+	if !ok || err != nil || meta.TimeoutSeconds != 30 || !reflect.DeepEqual(meta.Tags, wantTags) {
+		t.Fatalf("x-test ok=%v err=%v value=%+v", ok, err, meta)
+	}
+	if got := svc.Config().Environment["LOG_LEVEL"]; got == nil || *got != "debug" {
+		t.Fatalf("anchor not applied: LOG_LEVEL=%v", got)
+	}
+	if ok, _ := svc.Extension("x-missing", &meta); ok {
+		t.Fatalf("x-missing reported present")
+	}
+	var wrong int
+	if ok, err := svc.Extension("x-test", &wrong); !ok || err == nil {
+		t.Fatalf("expected decode error, ok=%v err=%v", ok, err)
+	}
+}
+
+func TestLoadProject_WithDualStackDefaultNetwork(t *testing.T) {
+	dir := t.TempDir()
+	writeComposeFile(t, dir, "name: v6\nservices:\n  s:\n    image: alpine:latest\n")
+
+	proj, err := LoadProject(context.Background(), dir, WithDualStackDefaultNetwork())
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	def := proj.Networks["default"]
+	if def.EnableIPv6 == nil || !*def.EnableIPv6 || def.Name != "v6_default" {
+		t.Fatalf("default network=%+v want dual-stack v6_default", def)
+	}
+
+	writeComposeFile(t, dir, `name: v6
+services:
+  s:
+    image: alpine:latest
+networks:
+  default:
+    enable_ipv6: false
+`)
+	proj, err = LoadProject(context.Background(), dir, WithDualStackDefaultNetwork())
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	if def := proj.Networks["default"]; def.EnableIPv6 == nil || *def.EnableIPv6 {
+		t.Fatalf("explicit enable_ipv6 overridden: %+v", def)
+	}
+}
+
+func TestLoadProject_WithImageRewriter(t *testing.T) {
+	dir := t.TempDir()
+	writeComposeFile(t, dir, `name: mirror
+services:
+  db:
+    image: postgres:16
+  cache:
+    image: bitnami/redis:7.2
+  app:
+    image: ghcr.io/acme/app@sha256:`+strings.Repeat("a", 64)+`
+`)
+
+	tagged := func(ref string) string {
+		if strings.HasPrefix(ref, "mirror.internal/bitnami/") {
+			return ref + "-ci"
+		}
+		return ref
+	}
+	proj, err := LoadProject(context.Background(), dir,
+		WithImageRewriter(MirrorRegistry("mirror.internal/")),
+		WithImageRewriter(tagged),
+	)
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	want := map[string]string{
+		"db":    "mirror.internal/library/postgres:16",
+		"cache": "mirror.internal/bitnami/redis:7.2-ci",
+		"app":   "ghcr.io/acme/app@sha256:" + strings.Repeat("a", 64),
+	}
+	for name, image := range want {
+		if got := proj.Services[name].Image; got != image {
+			t.Fatalf("%s image=%q want=%q", name, got, image)
+		}
+	}
+}
+
+func TestWithProjectLock(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir := t.TempDir()
+	writeComposeFile(t, dir, "name: locked\nservices:\n  s:\n    image: alpine:latest\n")
+	proj, err := LoadProject(context.Background(), dir, WithProjectLock(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	defer projectLocks.Delete(proj.Name)
+
+	ctx := context.Background()
+	c := proj.Command("s", "true")
+	unlock1, err := c.lockProjectResources(ctx)
+	if err != nil {
+		t.Fatalf("first shared lock: %v", err)
+	}
+	unlock2, err := c.lockProjectResources(ctx)
+	if err != nil {
+		t.Fatalf("second shared lock: %v", err)
+	}
+
+	start := time.Now()
+	err = Down(ctx, "locked")
+	if !errors.Is(err, ErrProjectLocked) || time.Since(start) < 100*time.Millisecond {
+		t.Fatalf("Down=%v after %s want ErrProjectLocked after the timeout", err, time.Since(start))
+	}
+	unlock1()
+	unlock2()
+	unlock2()
+
+	unlockDown, err := lockProject(ctx, "locked", true, time.Second)
+	if err != nil {
+		t.Fatalf("exclusive lock after release: %v", err)
+	}
+	if _, err := c.lockProjectResources(ctx); !errors.Is(err, ErrProjectLocked) {
+		t.Fatalf("shared lock during Down=%v want ErrProjectLocked", err)
+	}
+	unlockDown()
+
+	other := (&Project{Name: "unlocked", Services: proj.Services}).Command("s", "true")
+	if unlock, err := other.lockProjectResources(ctx); err != nil {
+		t.Fatalf("projects without WithProjectLock must not lock: %v", err)
+	} else {
+		unlock()
+	}
+}
+
+func TestProject_WithNameIsolatesDerivedResources(t *testing.T) {
+	dir := t.TempDir()
+	writeComposeFile(t, dir, ""+
+		"name: base\n"+
+		"services:\n"+
+		"  s:\n"+
+		"    image: alpine:latest\n"+
+		"    volumes:\n"+
+		"      - data:/data\n"+
+		"      - shared:/shared\n"+
+		"volumes:\n"+
+		"  data: {}\n"+
+		"  shared:\n"+
+		"    name: fixed-shared\n")
+
+	proj, err := LoadProject(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	renamed, err := proj.WithName("other")
+	if err != nil {
+		t.Fatalf("WithName: %v", err)
+	}
+
+	if renamed.Name != "other" || proj.Name != "base" {
+		t.Fatalf("names=%q/%q", renamed.Name, proj.Name)
+	}
+	if got := renamed.Networks["default"].Name; got != "other_default" {
+		t.Fatalf("default network=%q want=%q", got, "other_default")
+	}
+	if got := renamed.Volumes["data"].Name; got != "other_data" {
+		t.Fatalf("data volume=%q want=%q", got, "other_data")
+	}
+	if got := renamed.Volumes["shared"].Name; got != "fixed-shared" {
+		t.Fatalf("shared volume=%q want=%q", got, "fixed-shared")
+	}
+	if got := proj.Volumes["data"].Name; got != "base_data" {
+		t.Fatalf("original data volume mutated: %q", got)
+	}
+}
+
+func TestEphemeralProject_RandomizesName(t *testing.T) {
+	dir := t.TempDir()
+	writeComposeFile(t, dir, "name: eph\nservices:\n  s:\n    image: alpine:latest\n")
+
+	a, cleanupA, err := EphemeralProject(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("EphemeralProject: %v", err)
+	}
+	b, cleanupB, err := EphemeralProject(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("EphemeralProject: %v", err)
+	}
+	if cleanupA == nil || cleanupB == nil {
+		t.Fatalf("EphemeralProject returned no cleanup")
+	}
+	if a.Name == b.Name {
+		t.Fatalf("names collide: %q", a.Name)
+	}
+	if !strings.HasPrefix(a.Name, "eph-") {
+		t.Fatalf("Name=%q want prefix %q", a.Name, "eph-")
+	}
+	if got, want := a.Networks["default"].Name, a.Name+"_default"; got != want {
+		t.Fatalf("default network=%q want=%q", got, want)
+	}
+}
+
+func TestProject_ServiceDiscovery(t *testing.T) {
+	dir := t.TempDir()
+	writeComposeFile(t, dir, ""+
+		"services:\n"+
+		"  web:\n"+
+		"    image: alpine:latest\n"+
+		"    labels:\n"+
+		"      test.target: \"true\"\n"+
+		"  db:\n"+
+		"    image: alpine:latest\n"+
+		"    profiles: [\"deps\"]\n"+
+		"    labels:\n"+
+		"      test.target: \"false\"\n"+
+		"  cache:\n"+
+		"    image: alpine:latest\n")
+
+	proj, err := LoadProject(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	want := []string{"cache", "db", "web"}
+	if got := proj.ServiceNames(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ServiceNames=%v want=%v", got, want)
+	}
+	if !proj.HasService("db") || proj.HasService("missing") {
+		t.Fatalf("HasService mismatch")
+	}
+
+	tests := []struct {
+		name     string
+		selector ServiceSelector
+		want     []string
+	}{
+		{"label value", MatchLabel("test.target", "true"), []string{"web"}},
+		{"label key", MatchLabel("test.target", ""), []string{"db", "web"}},
+		{"profile", MatchProfile("deps"), []string{"db"}},
+	}
+	for _, tt := range tests {
+		got := []string{}
+		for _, s := range proj.ServicesMatching(tt.selector) {
+			got = append(got, s.Name())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: got=%v want=%v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProject_WithProfiles(t *testing.T) {
+	dir := t.TempDir()
+	writeComposeFile(t, dir, `name: profiles
+services:
+  app:
+    image: alpine:latest
+  debug:
+    image: alpine:latest
+    profiles: [debug, tools]
+`)
+	proj, err := LoadProject(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("LoadProject: %v", err)
+	}
+	if !proj.HasService("debug") {
+		t.Fatal("LoadProject should enable all profiles")
+	}
+
+	filtered, err := proj.WithProfiles()
+	if err != nil {
+		t.Fatalf("WithProfiles: %v", err)
+	}
+	if got := filtered.ServiceNames(); !reflect.DeepEqual(got, []string{"app"}) {
+		t.Fatalf("ServiceNames()=%v", got)
+	}
+	var pe *ProfileError
+	if err := filtered.Command("debug", "true").Err; !errors.As(err, &pe) ||
+		!reflect.DeepEqual(pe.Profiles, []string{"debug", "tools"}) {
+		t.Fatalf("Command(debug).Err=%v", err)
+	}
+	if err := filtered.Command("missing").Err; errors.As(err, &pe) {
+		t.Fatalf("unknown service reported as disabled: %v", err)
+	}
+
+	enabled, err := filtered.WithProfiles("tools")
+	if err != nil {
+		t.Fatalf("WithProfiles(tools): %v", err)
+	}
+	if err := enabled.Command("debug", "true").Err; err != nil {
+		t.Fatalf("Command(debug) with profile: %v", err)
+	}
+	if !proj.HasService("debug") {
+		t.Fatal("WithProfiles modified the original project")
+	}
+}
@@ -0,0 +1,123 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ServiceMatrix is a service derived once per image, for running the same command
+// against several versions of an image (compatibility-matrix testing).
+type ServiceMatrix struct {
+	images   []string
+	services []*Service
+}
+
+// MatrixResult is the outcome of running a command against one image of a
+// ServiceMatrix.
+type MatrixResult struct {
+	// Image is the image the command ran in.
+	Image string
+	ServiceResult
+}
+
+// Matrix derives one Service per image from service, e.g.
+//
+//	Matrix(db, []string{"postgres:14", "postgres:15", "postgres:16"})
+//
+// Every derived Service has the image replaced and belongs to its own copy of the
+// project, named "<project>-matrix-<n>" for the n-th image, so the images never
+// share named volumes or networks, e.g. one version's data volume. Down removes
+// them.
+func Matrix(service *Service, images []string) *ServiceMatrix {
+	m := &ServiceMatrix{images: append([]string(nil), images...)}
+	if service == nil {
+		return m
+	}
+	for i, img := range m.images {
+		m.services = append(m.services, matrixService(service, img, i+1))
+	}
+	return m
+}
+
+func matrixService(service *Service, image string, n int) *Service {
+	derived := service.With(OverrideImage(image))
+	if derived.loadErr != nil {
+		return derived
+	}
+	name := fmt.Sprintf("%s-matrix-%d", service.project.Name, n)
+	proj, err := service.project.WithName(name)
+	if err != nil {
+		derived.loadErr = fmt.Errorf("compose: matrix service %q: %w", service.config.Name, err)
+		return derived
+	}
+	if _, ok := proj.Services[derived.config.Name]; ok {
+		proj.Services[derived.config.Name] = copyServiceConfig(derived.config)
+	}
+	derived.project = proj
+	return derived
+}
+
+// Images returns the images of the matrix in order.
+func (m *ServiceMatrix) Images() []string {
+	return append([]string(nil), m.images...)
+}
+
+// Services returns the derived Services, in the order of Images.
+func (m *ServiceMatrix) Services() []*Service {
+	return append([]*Service(nil), m.services...)
+}
+
+// Run runs args concurrently against every image of the matrix and waits for all
+// of them. Published ports are shared by all images, so derive the matrix from a
+// service with ephemeral ports (e.g. OverridePorts("0:5432")) if it publishes any.
+//
+// Results are returned in the order of Images. If any run fails, the returned
+// error is a *MultiError with one "image" entry per failure.
+func (m *ServiceMatrix) Run(ctx context.Context, arg ...string) ([]MatrixResult, error) {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	if len(m.services) != len(m.images) {
+		return nil, errors.New("compose: matrix service is nil")
+	}
+	results := make([]MatrixResult, len(m.services))
+	var wg sync.WaitGroup
+	for i, svc := range m.services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = MatrixResult{
+				Image:         m.images[i],
+				ServiceResult: runServiceCommand(ctx, svc, arg),
+			}
+		}()
+	}
+	wg.Wait()
+
+	errs := &MultiError{Op: "matrix"}
+	for _, r := range results {
+		if r.Err != nil {
+			errs.add("image", r.Image, r.Err)
+		}
+	}
+	return results, errs.errOrNil()
+}
+
+// Down removes the containers, networks, and volumes of every image's project.
+// If any removal fails, the returned error is a *MultiError with one "image"
+// entry per failure.
+func (m *ServiceMatrix) Down(ctx context.Context) error {
+	errs := &MultiError{Op: "matrix"}
+	for i, svc := range m.services {
+		if svc.loadErr != nil {
+			continue
+		}
+		err := DownWithOptions(ctx, svc.project.Name, DownOptions{RemoveVolumes: true})
+		if err != nil {
+			errs.add("image", m.images[i], err)
+		}
+	}
+	return errs.errOrNil()
+}
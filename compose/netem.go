@@ -0,0 +1,174 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// netemImage is the helper image used by InjectLatency. It must provide sh and tc.
+var netemImage = "nicolaka/netshoot:v0.13"
+
+// netemServiceName is the service name of netem helper containers.
+const netemServiceName = "compose-exec-netem"
+
+// NetemOption configures InjectLatency.
+type NetemOption func(*netemSpec)
+
+type netemSpec struct {
+	delay  time.Duration
+	jitter time.Duration
+	loss   float64
+}
+
+// WithJitter varies the injected delay randomly by up to ±d.
+func WithJitter(d time.Duration) NetemOption {
+	return func(s *netemSpec) { s.jitter = d }
+}
+
+// WithPacketLoss drops the given percentage (0-100) of outgoing packets.
+func WithPacketLoss(percent float64) NetemOption {
+	return func(s *netemSpec) { s.loss = percent }
+}
+
+// InjectLatency delays outgoing traffic of every running container of service by
+// delay, using netem. It runs tc in a short-lived helper container with NET_ADMIN
+// that shares the target's network namespace, so the service image needs no
+// tooling. The returned restore function removes the impairment; it is also gone
+// when the target container is recreated.
+func (p *Project) InjectLatency(
+	ctx context.Context,
+	service string,
+	delay time.Duration,
+	opts ...NetemOption,
+) (restore func(context.Context) error, err error) {
+	if p == nil {
+		return nil, errors.New("compose: project is nil")
+	}
+	spec := netemSpec{delay: delay}
+	for _, opt := range opts {
+		opt(&spec)
+	}
+	args, err := spec.args()
+	if err != nil {
+		return nil, err
+	}
+
+	dc, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := p.runningContainers(ctx, dc, service)
+	_ = dc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	restore = func(ctx context.Context) error {
+		var errs []error
+		for _, id := range applied {
+			errs = append(errs, p.runNetem(ctx, id, netemScript("del", "")))
+		}
+		return errors.Join(errs...)
+	}
+	for _, id := range ids {
+		if runErr := p.runNetem(ctx, id, netemScript("replace", args)); runErr != nil {
+			return nil, errors.Join(runErr, restore(context.Background()))
+		}
+		applied = append(applied, id)
+	}
+	return restore, nil
+}
+
+func (s netemSpec) args() (string, error) {
+	if s.delay < 0 || s.jitter < 0 {
+		return "", errors.New("compose: netem delay must not be negative")
+	}
+	if s.loss < 0 || s.loss > 100 {
+		return "", fmt.Errorf("compose: packet loss %v%% out of range 0-100", s.loss)
+	}
+	args := fmt.Sprintf("delay %dus", s.delay.Microseconds())
+	if s.jitter > 0 {
+		args += fmt.Sprintf(" %dus", s.jitter.Microseconds())
+	}
+	if s.loss > 0 {
+		args += fmt.Sprintf(" loss %g%%", s.loss)
+	}
+	return args, nil
+}
+
+// netemScript applies op ("replace" or "del") to the root qdisc of every
+// non-loopback interface.
+func netemScript(op, args string) string {
+	qdisc := "tc qdisc replace dev \"$i\" root netem " + args
+	if op == "del" {
+		qdisc = "tc qdisc del dev \"$i\" root 2>/dev/null || true"
+	}
+	return "set -e; for i in $(ls /sys/class/net); do " +
+		"[ \"$i\" = lo ] && continue; " + qdisc + "; done"
+}
+
+// runningContainers returns the IDs of the running containers of service.
+func (p *Project) runningContainers(
+	ctx context.Context,
+	dc Backend,
+	service string,
+) ([]string, error) {
+	if _, err := p.serviceConfig(service); err != nil {
+		return nil, err
+	}
+	list, err := dc.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", "com.docker.compose.project="+p.Name),
+			filters.Arg("label", "com.docker.compose.service="+service),
+			filters.Arg("status", "running"),
+		),
+	})
+	if err != nil {
+		return nil, engineErr("list containers", err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("compose: service %q has no running container", service)
+	}
+	ids := make([]string, 0, len(list))
+	for _, c := range list {
+		ids = append(ids, c.ID)
+	}
+	return ids, nil
+}
+
+func (p *Project) runNetem(ctx context.Context, id, script string) error {
+	cfg := types.ServiceConfig{
+		Name:        netemServiceName,
+		Image:       netemImage,
+		NetworkMode: "container:" + id,
+		CapAdd:      []string{"NET_ADMIN"},
+	}
+	cmd := newService(p, cfg).CommandContext(ctx, "sh", "-c", script)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(out.String())
+		if msg == "" {
+			return fmt.Errorf("compose: netem on %s: %w", shortID(id), err)
+		}
+		return fmt.Errorf("compose: netem on %s: %s: %w", shortID(id), msg, err)
+	}
+	return nil
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,110 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+)
+
+// driverModes lists the valid values of mode driver_opts of built-in drivers.
+var driverModes = map[string]struct {
+	opt    string
+	values []string
+}{
+	"macvlan": {opt: "macvlan_mode", values: []string{"bridge", "vepa", "passthru", "private"}},
+	"ipvlan":  {opt: "ipvlan_mode", values: []string{"l2", "l3", "l3s"}},
+}
+
+// builtinNetworkDrivers are the drivers built into Docker Engine. Plugin drivers
+// are not checked up front: managed plugins may be referenced without their tag
+// and legacy plugins are only listed once loaded, so the daemon reports them.
+var builtinNetworkDrivers = map[string]bool{
+	"bridge": true, "host": true, "none": true, "overlay": true, "macvlan": true,
+	"ipvlan": true, "nat": true, "transparent": true, "l2bridge": true,
+	"l2tunnel": true, "ics": true, "internal": true, "private": true,
+}
+
+// networkLabel names a network for error messages: the compose key, plus the
+// resolved engine name when it differs (custom name, external alias, project prefix).
+func networkLabel(spec networkSpec, netName string) string {
+	if spec.key == "" || spec.key == netName {
+		return fmt.Sprintf("%q", netName)
+	}
+	return fmt.Sprintf("%q (%s)", spec.key, netName)
+}
+
+// validateNetworkDriver checks that the daemon provides spec's built-in driver and
+// that its driver_opts are consistent, so misconfigurations surface with an
+// actionable message instead of a generic create failure. info is fetched on first
+// use.
+func validateNetworkDriver(
+	spec networkSpec,
+	netName string,
+	info func() (system.Info, error),
+) error {
+	driver := strings.TrimSpace(spec.config.Driver)
+	if driver == "" || driver == "bridge" || !builtinNetworkDrivers[driver] {
+		return nil
+	}
+	label := networkLabel(spec, netName)
+
+	if m, ok := driverModes[driver]; ok {
+		if mode, set := spec.config.DriverOpts[m.opt]; set && !slices.Contains(m.values, mode) {
+			return fmt.Errorf(
+				"compose: network %s: invalid %s %q (valid: %s)",
+				label, m.opt, mode, strings.Join(m.values, ", "),
+			)
+		}
+	}
+
+	in, err := info()
+	if err != nil {
+		// Let the create call report connectivity problems.
+		return nil
+	}
+	if available := in.Plugins.Network; len(available) > 0 && !slices.Contains(available, driver) {
+		sorted := slices.Clone(available)
+		sort.Strings(sorted)
+		return fmt.Errorf(
+			"compose: network %s: driver %q is not available on the daemon "+
+				"(available: %s); install the network plugin or choose another driver",
+			label, driver, strings.Join(sorted, ", "),
+		)
+	}
+	if driver == "overlay" && in.Swarm.LocalNodeState != swarm.LocalNodeStateActive {
+		return fmt.Errorf(
+			"compose: network %s: the overlay driver requires swarm mode "+
+				"(run `docker swarm init`), or use the bridge driver for single-host tests",
+			label,
+		)
+	}
+	return nil
+}
+
+// lazyInfo returns a function that fetches the daemon info at most once.
+func lazyInfo(ctx context.Context, dc Backend) func() (system.Info, error) {
+	var (
+		done bool
+		in   system.Info
+		err  error
+	)
+	return func() (system.Info, error) {
+		if !done {
+			in, err = dc.Info(ctx)
+			done = true
+		}
+		return in, err
+	}
+}
+
+// isDriverNotFoundErr reports whether a network create failed because the daemon
+// could not load the driver plugin.
+func isDriverNotFoundErr(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "plugin") && strings.Contains(msg, "not found")
+}
@@ -0,0 +1,60 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/compose-spec/compose-go/v2/loader"
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// overlayConfigFiles renders overlays as in-memory compose files. Their values are
+// literal, so a `$` is escaped rather than interpolated when the files are loaded.
+func overlayConfigFiles(overlays []types.Project) ([]types.ConfigFile, error) {
+	out := make([]types.ConfigFile, 0, len(overlays))
+	for i := range overlays {
+		content, err := (*Project)(&overlays[i]).MarshalYAML()
+		if err != nil {
+			return nil, fmt.Errorf("compose: render overlay %d: %w", i, err)
+		}
+		out = append(out, types.ConfigFile{
+			Filename: fmt.Sprintf("overlay-%d.yaml", i),
+			Content:  content,
+		})
+	}
+	return out, nil
+}
+
+// Merge returns a new project with other layered on top of p, using the merge
+// semantics of compose override files. p and other are left unchanged. The result
+// keeps p's name, working directory and environment.
+func (p *Project) Merge(other *Project) (*Project, error) {
+	if p == nil || other == nil {
+		return nil, errors.New("compose: project is nil")
+	}
+	base, err := p.MarshalYAML()
+	if err != nil {
+		return nil, err
+	}
+	files, err := overlayConfigFiles([]types.Project{types.Project(*other)})
+	if err != nil {
+		return nil, err
+	}
+	cd := types.ConfigDetails{
+		WorkingDir: p.WorkingDir,
+		ConfigFiles: append([]types.ConfigFile{
+			{Filename: "base.yaml", Content: base},
+		}, files...),
+		Environment: p.Environment,
+	}
+	merged, err := loader.LoadWithContext(context.Background(), cd, func(opts *loader.Options) {
+		opts.Profiles = []string{"*"}
+		opts.SetProjectName(p.Name, true)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("compose: merge projects: %w", err)
+	}
+	merged.ComposeFiles = p.ComposeFiles
+	return (*Project)(merged), nil
+}
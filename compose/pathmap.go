@@ -0,0 +1,93 @@
+package compose
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+type pathMapEntry struct {
+	local, host string
+}
+
+var (
+	pathMapMu sync.RWMutex
+	// pathMapping is sorted by descending local prefix length (longest match first).
+	pathMapping []pathMapEntry
+)
+
+// SetPathMapping configures the translation of bind mount sources for
+// Docker-outside-of-Docker setups: when compose-exec runs in a container, bind
+// sources are paths inside that container, but the daemon resolves them on the host.
+// Each key is a local (container) path prefix and its value the corresponding host
+// path, e.g. {"/workspace": "/home/me/project"}. The longest matching prefix wins;
+// unmatched paths are used as is. A nil or empty map disables the translation.
+//
+// The mapping applies to all Cmds started afterwards. SelfMount.PathMapping has the
+// expected format.
+func SetPathMapping(m map[string]string) error {
+	entries := make([]pathMapEntry, 0, len(m))
+	for local, host := range m {
+		if !path.IsAbs(local) {
+			return fmt.Errorf("compose: path mapping key %q must be an absolute path", local)
+		}
+		if host == "" {
+			return fmt.Errorf("compose: path mapping for %q has an empty host path", local)
+		}
+		entries = append(entries, pathMapEntry{local: path.Clean(local), host: host})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return len(entries[i].local) > len(entries[j].local)
+	})
+	pathMapMu.Lock()
+	pathMapping = entries
+	pathMapMu.Unlock()
+	return nil
+}
+
+// mapHostPath translates a local path according to SetPathMapping.
+func mapHostPath(p string) string {
+	host, _ := lookupHostPath(p)
+	return host
+}
+
+// lookupHostPath translates a local path according to SetPathMapping. ok is false
+// when no mapping matches, and p is returned as is.
+func lookupHostPath(p string) (host string, ok bool) {
+	pathMapMu.RLock()
+	defer pathMapMu.RUnlock()
+	for _, e := range pathMapping {
+		rest, ok := strings.CutPrefix(p, e.local)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/") && e.local != "/") {
+			continue
+		}
+		if e.local == "/" {
+			rest = "/" + rest
+		}
+		return strings.TrimSuffix(e.host, "/") + hostPathSuffix(e.host, rest), true
+	}
+	return p, false
+}
+
+// hostPathSuffix converts the remainder of a mapped path to the separator style of
+// the host path (Windows host paths use backslashes).
+func hostPathSuffix(host, rest string) string {
+	if strings.Contains(host, `\`) {
+		return strings.ReplaceAll(rest, "/", `\`)
+	}
+	return rest
+}
+
+// mapBindSources applies SetPathMapping to bind mount sources.
+func mapBindSources(mounts []mount.Mount) []mount.Mount {
+	for i := range mounts {
+		if mounts[i].Type == mount.TypeBind {
+			mounts[i].Source = mapHostPath(mounts[i].Source)
+		}
+	}
+	return mounts
+}
@@ -0,0 +1,217 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrDependencyFailed is matched (via errors.Is) by the errors of pipeline steps
+// that were skipped because a step they depend on failed.
+var ErrDependencyFailed = errors.New("compose: dependency failed")
+
+// Pipeline runs Cmds as a dependency graph (e.g. build → seed → test → report):
+// every step starts as soon as all steps it depends on have succeeded, so
+// independent branches run in parallel. Edges are explicit and independent of the
+// services' depends_on.
+type Pipeline struct {
+	// FailFast stops all running steps and starts no new ones after the first
+	// failure, which is then the only one reported. By default independent branches
+	// keep running and only the dependents of a failed step are skipped.
+	FailFast bool
+
+	steps []*pipelineStep
+	index map[string]*pipelineStep
+	err   error
+}
+
+type pipelineStep struct {
+	name  string
+	cmd   *Cmd
+	after []string
+}
+
+// Add adds a step named name that runs cmd after every step in after succeeded, and
+// returns p for chaining. Steps may be added in any order; invalid steps are
+// reported by Run.
+func (p *Pipeline) Add(name string, cmd *Cmd, after ...string) *Pipeline {
+	if p.index == nil {
+		p.index = map[string]*pipelineStep{}
+	}
+	switch {
+	case name == "":
+		p.err = errors.Join(p.err, errors.New("compose: pipeline step name is required"))
+	case cmd == nil:
+		p.err = errors.Join(p.err, fmt.Errorf("compose: pipeline step %q has no Cmd", name))
+	case p.index[name] != nil:
+		p.err = errors.Join(p.err, fmt.Errorf("compose: duplicate pipeline step %q", name))
+	default:
+		s := &pipelineStep{name: name, cmd: cmd, after: append([]string(nil), after...)}
+		p.steps = append(p.steps, s)
+		p.index[name] = s
+	}
+	return p
+}
+
+// Run executes the pipeline and waits for every started step. ctx cancels all
+// steps in addition to the contexts their Cmds were created with.
+//
+// If any step fails or is skipped, the returned error is a *MultiError with one
+// "step" entry per such step, in the order they were added. Skipped steps match
+// ErrDependencyFailed.
+func (p *Pipeline) Run(ctx context.Context) error {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := &pipelineRun{
+		ctx:        runCtx,
+		done:       make(chan stepResult),
+		pending:    make(map[string]int, len(p.steps)),
+		dependents: make(map[string][]*pipelineStep, len(p.steps)),
+		errs:       make(map[string]error, len(p.steps)),
+	}
+	for _, s := range p.steps {
+		r.pending[s.name] = len(s.after)
+		for _, dep := range s.after {
+			r.dependents[dep] = append(r.dependents[dep], s)
+		}
+	}
+	for _, s := range p.steps {
+		if r.pending[s.name] == 0 {
+			r.start(s)
+		}
+	}
+	for r.running > 0 {
+		res := <-r.done
+		r.running--
+		if r.stopped {
+			continue
+		}
+		if res.err == nil {
+			r.succeeded(res.step)
+			continue
+		}
+		r.errs[res.step.name] = res.err
+		if p.FailFast {
+			r.stopped = true
+			cancel()
+			continue
+		}
+		r.skipDependents(res.step, res.step.name)
+	}
+
+	me := &MultiError{Op: "pipeline"}
+	for _, s := range p.steps {
+		if err := r.errs[s.name]; err != nil {
+			me.add("step", s.name, err)
+		}
+	}
+	return me.errOrNil()
+}
+
+type stepResult struct {
+	step *pipelineStep
+	err  error
+}
+
+// pipelineRun is the scheduling state of one Pipeline.Run. It is only used from
+// the goroutine of Run; steps report back through done.
+type pipelineRun struct {
+	ctx        context.Context
+	done       chan stepResult
+	pending    map[string]int
+	dependents map[string][]*pipelineStep
+	errs       map[string]error
+	running    int
+	stopped    bool
+}
+
+func (r *pipelineRun) start(s *pipelineStep) {
+	r.running++
+	unbind := s.cmd.bindContext(r.ctx)
+	go func() {
+		err := s.cmd.Run()
+		unbind()
+		r.done <- stepResult{step: s, err: err}
+	}()
+}
+
+// succeeded starts the dependents of s whose dependencies have all succeeded.
+func (r *pipelineRun) succeeded(s *pipelineStep) {
+	for _, d := range r.dependents[s.name] {
+		r.pending[d.name]--
+		if r.pending[d.name] == 0 && r.errs[d.name] == nil {
+			r.start(d)
+		}
+	}
+}
+
+// skipDependents marks every transitive dependent of s as skipped because of the
+// failed step cause.
+func (r *pipelineRun) skipDependents(s *pipelineStep, cause string) {
+	for _, d := range r.dependents[s.name] {
+		if r.errs[d.name] == nil {
+			r.errs[d.name] = fmt.Errorf("%w: %s", ErrDependencyFailed, cause)
+			r.skipDependents(d, cause)
+		}
+	}
+}
+
+// validate reports invalid steps, unknown dependencies and dependency cycles.
+func (p *Pipeline) validate() error {
+	if p.err != nil {
+		return p.err
+	}
+	for _, s := range p.steps {
+		for _, dep := range s.after {
+			if p.index[dep] == nil {
+				return fmt.Errorf("compose: pipeline step %q depends on unknown step %q",
+					s.name, dep)
+			}
+		}
+	}
+	// Kahn's algorithm: steps left over are on or behind a cycle.
+	pending := make(map[string]int, len(p.steps))
+	var ready []string
+	for _, s := range p.steps {
+		pending[s.name] = len(s.after)
+		if len(s.after) == 0 {
+			ready = append(ready, s.name)
+		}
+	}
+	dependents := map[string][]string{}
+	for _, s := range p.steps {
+		for _, dep := range s.after {
+			dependents[dep] = append(dependents[dep], s.name)
+		}
+	}
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		delete(pending, name)
+		for _, d := range dependents[name] {
+			pending[d]--
+			if pending[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	if len(pending) > 0 {
+		names := make([]string, 0, len(pending))
+		for name := range pending {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("compose: pipeline has a dependency cycle among %s",
+			strings.Join(names, ", "))
+	}
+	return nil
+}
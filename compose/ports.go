@@ -0,0 +1,218 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/go-connections/nat"
+)
+
+// ServicePort is a port declared in a service's `ports:` section.
+type ServicePort struct {
+	// Target is the container port.
+	Target uint32
+	// Protocol is "tcp", "udp" or "sctp".
+	Protocol string
+	// HostIP is the host address to bind, or "" for all addresses.
+	HostIP string
+	// Published is the host port or port range, e.g. "8080" or "8000-8010".
+	// "" or "0" lets the engine choose a free port.
+	Published string
+	// Name is the port's name from the long syntax, e.g. "web". It can be passed
+	// wherever a container port is expected, e.g. to WaitForPort.
+	Name string
+	// Mode is "ingress" (the default, also when empty) or "host". Containers do not
+	// run in swarm mode, so both publish the port on the engine host.
+	Mode string
+	// AppProtocol is the application protocol from the long syntax, e.g. "http";
+	// it is informational.
+	AppProtocol string
+}
+
+// PublishedPort is a container port bound on the host, as reported by the engine.
+type PublishedPort struct {
+	// Target is the container port.
+	Target int
+	// Protocol is "tcp", "udp" or "sctp".
+	Protocol string
+	// HostIP is the bound host address, e.g. "0.0.0.0" or "::".
+	HostIP string
+	// HostPort is the bound host port.
+	HostPort int
+	// Declared is the host port declared in the compose file ("" if none). It
+	// differs from HostPort for ephemeral ports, e.g. with Cmd.EphemeralPorts.
+	Declared string
+	// Name and AppProtocol are those of the port's declaration, if any.
+	Name        string
+	AppProtocol string
+}
+
+// Ports returns the service's port declarations.
+func (s *Service) Ports() []ServicePort {
+	if len(s.config.Ports) == 0 {
+		return nil
+	}
+	out := make([]ServicePort, 0, len(s.config.Ports))
+	for _, p := range s.config.Ports {
+		out = append(out, ServicePort{
+			Target:      p.Target,
+			Protocol:    portProtocol(p),
+			HostIP:      p.HostIP,
+			Published:   p.Published,
+			Name:        p.Name,
+			Mode:        p.Mode,
+			AppProtocol: p.AppProtocol,
+		})
+	}
+	return out
+}
+
+// PublishedPorts returns the host bindings of the started container, sorted by
+// container port, protocol and host address. Ephemeral ports ("0") are reported
+// with the port the engine chose.
+func (c *Cmd) PublishedPorts(ctx context.Context) ([]PublishedPort, error) {
+	j, err := c.Inspect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ports nat.PortMap
+	if j.NetworkSettings != nil {
+		ports = j.NetworkSettings.Ports
+	}
+	out := publishedPorts(ports)
+	for i := range out {
+		if decl, ok := c.declaredPort(out[i]); ok {
+			out[i].Declared = decl.Published
+			out[i].Name = decl.Name
+			out[i].AppProtocol = decl.AppProtocol
+		}
+	}
+	return out, nil
+}
+
+// declaredPort returns the service declaration that produced the binding p.
+func (c *Cmd) declaredPort(p PublishedPort) (types.ServicePortConfig, bool) {
+	for _, sp := range c.Service.Ports {
+		if int(sp.Target) != p.Target || portProtocol(sp) != p.Protocol {
+			continue
+		}
+		if sp.HostIP == "" || sp.HostIP == p.HostIP {
+			return sp, true
+		}
+	}
+	return types.ServicePortConfig{}, false
+}
+
+// validatePorts checks the port declarations for settings the engine would reject
+// or that cannot be honored.
+func validatePorts(ports []types.ServicePortConfig) error {
+	for _, p := range ports {
+		switch p.Mode {
+		case "", "ingress", "host":
+		default:
+			return fmt.Errorf(
+				"compose: port %d: invalid mode %q (supported: \"ingress\", \"host\")",
+				p.Target,
+				p.Mode,
+			)
+		}
+		switch portProtocol(p) {
+		case "tcp", "udp", "sctp":
+		default:
+			return fmt.Errorf(
+				"compose: port %d: invalid protocol %q (supported: tcp, udp, sctp)",
+				p.Target,
+				p.Protocol,
+			)
+		}
+		if p.Target == 0 || p.Target > maxPort {
+			return fmt.Errorf("compose: invalid port target %d", p.Target)
+		}
+		if _, _, err := parsePublished(p.Published); err != nil {
+			return fmt.Errorf("compose: port %d: %w", p.Target, err)
+		}
+	}
+	return nil
+}
+
+const maxPort = 65535
+
+// portProtocol returns the lowercase protocol of p, tcp by default.
+func portProtocol(p types.ServicePortConfig) string {
+	if p.Protocol == "" {
+		return "tcp"
+	}
+	return strings.ToLower(p.Protocol)
+}
+
+// parsePublished parses a published host port or port range ("8080" or
+// "8000-8010") into its bounds; "" yields 0, 0. A range on a single container port
+// lets the engine bind one free port of it, as with docker compose; ranges on
+// port ranges are expanded to single ports when the compose file is loaded.
+func parsePublished(published string) (int, int, error) {
+	if published == "" {
+		return 0, 0, nil
+	}
+	loStr, hiStr, isRange := strings.Cut(published, "-")
+	lo, loErr := strconv.Atoi(loStr)
+	hi, hiErr := lo, loErr
+	if isRange {
+		hi, hiErr = strconv.Atoi(hiStr)
+	}
+	switch {
+	case loErr != nil || hiErr != nil:
+		return 0, 0, fmt.Errorf("invalid published port %q", published)
+	case lo < 0 || hi > maxPort:
+		return 0, 0, fmt.Errorf("published port %q is out of range 0-%d", published, maxPort)
+	case lo > hi:
+		return 0, 0, fmt.Errorf("published port range %q is reversed", published)
+	case isRange && lo == 0:
+		return 0, 0, fmt.Errorf("published port range %q must not start at 0", published)
+	}
+	return lo, hi, nil
+}
+
+// resolvePortName returns the container port ("80/tcp") of the declaration named
+// port, or port unchanged if none has that name.
+func resolvePortName(ports []types.ServicePortConfig, port string) string {
+	for _, p := range ports {
+		if p.Name == "" || p.Name != port {
+			continue
+		}
+		return fmt.Sprintf("%d/%s", p.Target, portProtocol(p))
+	}
+	return port
+}
+
+func publishedPorts(ports nat.PortMap) []PublishedPort {
+	var out []PublishedPort
+	for p, bindings := range ports {
+		for _, b := range bindings {
+			hostPort, err := strconv.Atoi(b.HostPort)
+			if err != nil {
+				continue
+			}
+			out = append(out, PublishedPort{
+				Target:   p.Int(),
+				Protocol: p.Proto(),
+				HostIP:   b.HostIP,
+				HostPort: hostPort,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.HostIP < b.HostIP
+	})
+	return out
+}
@@ -0,0 +1,117 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/versions"
+)
+
+const (
+	// minDaemonAPIVersion is the oldest Engine API version compose-exec supports.
+	minDaemonAPIVersion = "1.40"
+	// lowDiskSpaceThreshold triggers a preflight warning when less space is available.
+	lowDiskSpaceThreshold = 1 << 30
+)
+
+// PreflightReport describes the Docker daemon compose-exec would talk to.
+type PreflightReport struct {
+	// ServerVersion is the Docker Engine version (e.g. "28.5.2").
+	ServerVersion string
+	// APIVersion is the maximum Engine API version supported by the daemon.
+	APIVersion string
+	// MinAPIVersion is the minimum Engine API version supported by the daemon.
+	MinAPIVersion string
+	// OS and Arch describe the daemon platform.
+	OS   string
+	Arch string
+	// DockerRootDir is the daemon's data directory.
+	DockerRootDir string
+	// ImageStore is "containerd" when images are stored by containerd snapshotters
+	// and "graphdriver" otherwise; Snapshotter names the snapshotter or graph driver.
+	ImageStore  string
+	Snapshotter string
+	// LazyPulling is true when the snapshotter fetches image layers on demand
+	// (stargz, soci or nydus), so starting a container may still download data.
+	LazyPulling bool
+
+	// DiskFree is the free space in bytes on the filesystem holding DockerRootDir.
+	// It is only meaningful when DiskFreeKnown is true: the value can only be measured
+	// when the daemon runs on the same host as this process.
+	DiskFree      uint64
+	DiskFreeKnown bool
+
+	// Warnings lists actionable problems found, including those reported by the daemon.
+	Warnings []string
+}
+
+// Preflight queries the Docker daemon and reports its version, API version, and
+// available disk space, with warnings for configurations known to cause failures.
+//
+// It returns an error only if the daemon cannot be reached.
+func Preflight(ctx context.Context) (*PreflightReport, error) {
+	cli, err := newDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cli.Close() }()
+	return preflight(ctx, cli)
+}
+
+func preflight(ctx context.Context, dc Backend) (*PreflightReport, error) {
+	v, err := dc.ServerVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("compose: docker daemon not reachable: %w", err)
+	}
+	report := &PreflightReport{
+		ServerVersion: v.Version,
+		APIVersion:    v.APIVersion,
+		MinAPIVersion: v.MinAPIVersion,
+		OS:            v.Os,
+		Arch:          v.Arch,
+	}
+	if v.APIVersion != "" && versions.LessThan(v.APIVersion, minDaemonAPIVersion) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(
+			"Docker Engine API %s is older than the supported minimum %s; upgrade Docker Engine",
+			v.APIVersion,
+			minDaemonAPIVersion,
+		))
+	}
+
+	info, err := dc.Info(ctx)
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("daemon info unavailable: %v", err))
+		return report, nil
+	}
+	report.DockerRootDir = info.DockerRootDir
+	st := imageStoreOf(info)
+	report.ImageStore = st.String()
+	report.Snapshotter = st.snapshotter
+	report.LazyPulling = st.lazyPulling()
+	for _, w := range info.Warnings {
+		if w = strings.TrimSpace(w); w != "" {
+			report.Warnings = append(report.Warnings, w)
+		}
+	}
+
+	if isLocalDaemon(dc.DaemonHost()) && !isProbablyRunningInContainer() {
+		if free, ok := diskFree(info.DockerRootDir); ok {
+			report.DiskFree = free
+			report.DiskFreeKnown = true
+			if free < lowDiskSpaceThreshold {
+				report.Warnings = append(report.Warnings, fmt.Sprintf(
+					"only %d MiB free on %s; image pulls and container creation may fail",
+					free>>20,
+					info.DockerRootDir,
+				))
+			}
+		}
+	}
+	return report, nil
+}
+
+// isLocalDaemon reports whether host refers to a daemon on this machine.
+func isLocalDaemon(host string) bool {
+	return strings.HasPrefix(host, "unix://") || strings.HasPrefix(host, "npipe://")
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package compose
+
+// diskFree is not implemented on this platform.
+func diskFree(_ string) (uint64, bool) {
+	return 0, false
+}
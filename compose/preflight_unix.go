@@ -0,0 +1,17 @@
+//go:build unix
+
+package compose
+
+import "golang.org/x/sys/unix"
+
+// diskFree returns the space available to unprivileged users on the filesystem holding path.
+func diskFree(path string) (uint64, bool) {
+	if path == "" {
+		return 0, false
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, false
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), true //nolint:gosec // Bsize is positive.
+}
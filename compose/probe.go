@@ -0,0 +1,108 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// probeImage is the image of the helper containers started by Project.Probe.
+var probeImage = "busybox:1.36"
+
+// probeServiceName is the service name (and network alias) of probe containers.
+// It must not collide with real services, whose aliases it would shadow.
+const probeServiceName = "compose-exec-probe"
+
+// Probe checks from inside the project network whether address ("host:port") accepts
+// connections, by running a short-lived helper container attached to the project
+// network. Use it when the calling process cannot reach the compose network (e.g.
+// Docker Desktop on macOS) or a port is not published.
+//
+// If host is a service of the project, the helper joins that service's networks;
+// otherwise it joins the project's default network. Only network "tcp" is supported.
+func (p *Project) Probe(ctx context.Context, network, address string) error {
+	cmd, err := p.probeCmd(ctx, network, address, false)
+	if err != nil {
+		return err
+	}
+	return runProbe(cmd, address)
+}
+
+// WaitForProbe is ready when Project.Probe for address succeeds, retrying from a
+// single helper container until ctx is done. The project is the one the Cmd
+// belongs to.
+func WaitForProbe(network, address string) WaitStrategy {
+	return func(ctx context.Context, c *Cmd) error {
+		c.ensureService()
+		cmd, err := c.service.project.probeCmd(ctx, network, address, true)
+		if err != nil {
+			return err
+		}
+		if runErr := runProbe(cmd, address); runErr != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("compose: not ready: %w", errors.Join(ctx.Err(), runErr))
+			}
+			return runErr
+		}
+		return nil
+	}
+}
+
+func (p *Project) probeCmd(ctx context.Context, network, address string, retry bool) (*Cmd, error) {
+	if p == nil {
+		return nil, errors.New("compose: project is nil")
+	}
+	if network != "tcp" {
+		return nil, fmt.Errorf("compose: unsupported probe network %q (supported: tcp)", network)
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("compose: invalid probe address %q: %w", address, err)
+	}
+
+	check := fmt.Sprintf("nc -z -w 2 %s %s", shellQuote(host), shellQuote(port))
+	script := check
+	if retry {
+		script = fmt.Sprintf("until %s; do sleep 0.2; done", check)
+	}
+	return p.probeService(host).CommandContext(ctx, "sh", "-c", script), nil
+}
+
+// probeService returns the helper service, on the networks of the service host if
+// it is one of the project, or else on the project's default network.
+func (p *Project) probeService(host string) *Service {
+	cfg := types.ServiceConfig{Name: probeServiceName, Image: probeImage}
+	if target, ok := p.Services[host]; ok && len(target.Networks) > 0 {
+		cfg.Networks = make(map[string]*types.ServiceNetworkConfig, len(target.Networks))
+		for key := range target.Networks {
+			cfg.Networks[key] = nil
+		}
+	}
+	return newService(p, cfg)
+}
+
+func runProbe(cmd *Cmd, address string) error {
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	var ee *ExitError
+	if errors.As(err, &ee) {
+		msg := strings.TrimSpace(out.String())
+		if msg == "" {
+			msg = "connection failed"
+		}
+		return fmt.Errorf("compose: probe %s: %s", address, msg)
+	}
+	return err
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
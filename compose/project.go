@@ -1,9 +1,12 @@
 package compose
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 
 	"github.com/compose-spec/compose-go/v2/types"
 )
@@ -20,7 +23,7 @@ func (p *Project) Service(name string) (*Service, error) {
 	if p == nil {
 		return nil, errors.New("compose: project is nil")
 	}
-	cfg, err := findService(p.Services, name)
+	cfg, err := p.serviceConfig(name)
 	if err != nil {
 		return nil, err
 	}
@@ -32,29 +35,160 @@ func (p *Project) Command(service string, arg ...string) *Cmd {
 	svc, err := p.Service(service)
 	if err != nil {
 		return &Cmd{
-			Args:    append([]string(nil), arg...),
-			loadErr: err,
+			Args: append([]string(nil), arg...),
+			Err:  err,
 		}
 	}
 	return svc.Command(arg...)
 }
 
 // CommandContext returns a Cmd bound to ctx to execute args in the named service.
+// If ctx is nil, the returned Cmd's Err reports it.
 func (p *Project) CommandContext(ctx context.Context, service string, arg ...string) *Cmd {
-	if ctx == nil {
-		panic("nil Context")
-	}
 	svc, err := p.Service(service)
 	if err != nil {
 		return &Cmd{
-			Args:    append([]string(nil), arg...),
-			loadErr: err,
-			ctx:     ctx,
+			Args: append([]string(nil), arg...),
+			Err:  err,
+			ctx:  ctx,
 		}
 	}
 	return svc.CommandContext(ctx, arg...)
 }
 
+// ServiceNames returns the names of the project's services, sorted.
+func (p *Project) ServiceNames() []string {
+	if p == nil {
+		return nil
+	}
+	names := make([]string, 0, len(p.Services))
+	for name := range p.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasService reports whether the project defines the named service.
+func (p *Project) HasService(name string) bool {
+	if p == nil {
+		return false
+	}
+	_, err := findService(p.Services, name)
+	return err == nil
+}
+
+// ServiceSelector reports whether a service should be selected.
+type ServiceSelector func(types.ServiceConfig) bool
+
+// MatchLabel selects services carrying label key. If value is non-empty, the label
+// must also have that value.
+func MatchLabel(key, value string) ServiceSelector {
+	return func(s types.ServiceConfig) bool {
+		v, ok := s.Labels[key]
+		return ok && (value == "" || v == value)
+	}
+}
+
+// MatchProfile selects services assigned to profile.
+func MatchProfile(profile string) ServiceSelector {
+	return func(s types.ServiceConfig) bool {
+		return slices.Contains(s.Profiles, profile)
+	}
+}
+
+// ServicesMatching returns the services matching all selectors, sorted by name.
+// With no selectors, every service is returned.
+func (p *Project) ServicesMatching(selectors ...ServiceSelector) []*Service {
+	var out []*Service
+	for _, name := range p.ServiceNames() {
+		cfg := p.Services[name]
+		if matchesAll(cfg, selectors) {
+			out = append(out, newService(p, cfg))
+		}
+	}
+	return out
+}
+
+func matchesAll(cfg types.ServiceConfig, selectors []ServiceSelector) bool {
+	for _, sel := range selectors {
+		if sel != nil && !sel(cfg) {
+			return false
+		}
+	}
+	return true
+}
+
+// WithName returns a copy of the project renamed to name.
+//
+// Networks and volumes whose names were derived from the previous project name
+// are renamed accordingly, so the copy uses its own isolated resources. Explicitly
+// named and external resources are kept as-is.
+func (p *Project) WithName(name string) (*Project, error) {
+	if p == nil {
+		return nil, errors.New("compose: project is nil")
+	}
+	if err := validateProjectName(name); err != nil {
+		return nil, err
+	}
+	np := p.clone()
+	oldName := p.Name
+	np.Name = name
+	for key, cfg := range np.Networks {
+		if !bool(cfg.External) && cfg.Name == resolveVolumeName(oldName, key) {
+			cfg.Name = resolveVolumeName(name, key)
+			np.Networks[key] = cfg
+		}
+	}
+	for key, cfg := range np.Volumes {
+		if !bool(cfg.External) && cfg.Name == resolveVolumeName(oldName, key) {
+			cfg.Name = resolveVolumeName(name, key)
+			np.Volumes[key] = cfg
+		}
+	}
+	return np, nil
+}
+
+// clone returns a deep copy of the project.
+func (p *Project) clone() *Project {
+	// WithServicesEnabled without names is compose-go's public deep copy.
+	cp, _ := (*types.Project)(p).WithServicesEnabled()
+	return (*Project)(cp)
+}
+
+// WithProfiles returns a copy of the project in which only the services without
+// profiles and those assigned to one of profiles are enabled, like
+// `docker compose --profile`. "*" enables all services. Commands for a disabled
+// service fail with a *ProfileError.
+//
+// LoadProject enables all services; WithProfiles re-filters them, also on a
+// project returned by an earlier WithProfiles.
+func (p *Project) WithProfiles(profiles ...string) (*Project, error) {
+	if p == nil {
+		return nil, errors.New("compose: project is nil")
+	}
+	np, err := (*types.Project)(p).WithProfiles(append([]string(nil), profiles...))
+	if err != nil {
+		return nil, err
+	}
+	return (*Project)(np), nil
+}
+
+// serviceConfig returns the config of the named enabled service.
+func (p *Project) serviceConfig(name string) (types.ServiceConfig, error) {
+	cfg, err := findService(p.Services, name)
+	if err == nil {
+		return cfg, nil
+	}
+	if disabled, ok := p.DisabledServices[name]; ok {
+		return types.ServiceConfig{}, &ProfileError{
+			Service:  name,
+			Profiles: append([]string(nil), disabled.Profiles...),
+		}
+	}
+	return types.ServiceConfig{}, err
+}
+
 func findService(services types.Services, name string) (types.ServiceConfig, error) {
 	for _, s := range services {
 		if s.Name == name {
@@ -63,3 +197,23 @@ func findService(services types.Services, name string) (types.ServiceConfig, err
 	}
 	return types.ServiceConfig{}, fmt.Errorf("compose: service %q not found", name)
 }
+
+// MarshalYAML returns the project's fully resolved configuration as YAML, like
+// `docker compose config`: files are merged, variables interpolated and defaults
+// applied, so it shows exactly what this package will run. As there, a literal `$`
+// is written as `$$`, so the output loads back unchanged.
+func (p *Project) MarshalYAML() ([]byte, error) {
+	if p == nil {
+		return nil, errors.New("compose: project is nil")
+	}
+	out, err := (*types.Project)(p).MarshalYAML()
+	if err != nil {
+		return nil, err
+	}
+	return bytes.ReplaceAll(out, []byte("$"), []byte("$$")), nil
+}
+
+// RenderConfig is p.MarshalYAML.
+func RenderConfig(p *Project) ([]byte, error) {
+	return p.MarshalYAML()
+}
@@ -0,0 +1,260 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Stop gracefully stops all running containers of the project, like
+// `docker compose stop`, but keeps them, their anonymous volumes and the project
+// networks, e.g. for inspection or to start them again. It is a lighter alternative
+// to Down.
+//
+// Each container gets timeout to exit after its stop signal before it is killed;
+// zero uses the container's stop_grace_period (10 seconds by default). A Cmd
+// still waiting on its container removes it when Wait returns, as after any exit.
+//
+// If stopping any container fails, the returned error is a *MultiError with one
+// "container" entry per failure.
+func (p *Project) Stop(ctx context.Context, timeout time.Duration) error {
+	if p == nil {
+		return errors.New("compose: project is nil")
+	}
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cli.Close() }()
+	return stopProject(ctx, cli, p.Name, timeout)
+}
+
+func stopProject(
+	ctx context.Context,
+	dc Backend,
+	projectName string,
+	timeout time.Duration,
+) error {
+	list, err := dc.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", "com.docker.compose.project="+projectName),
+			filters.Arg("status", "running"),
+		),
+	})
+	if err != nil {
+		return engineErr("list containers", err)
+	}
+	opts := stopOptions(timeout)
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = &MultiError{Op: "stop"}
+	)
+	for _, c := range list {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopErr := dc.ContainerStop(ctx, c.ID, opts)
+			if stopErr == nil || isNotFoundErr(stopErr) {
+				return
+			}
+			mu.Lock()
+			errs.add("container", strings.Join(c.Names, ","), engineErr("stop container", stopErr))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return errs.errOrNil()
+}
+
+// restartHealthInterval is how often a rolling restart polls the health status.
+var restartHealthInterval = 500 * time.Millisecond
+
+// RestartOptions configures RestartWithOptions.
+type RestartOptions struct {
+	// Timeouts overrides, per service name, how long a container may take to exit
+	// after its stop signal before it is killed. Services without an entry use
+	// their stop_grace_period (10 seconds by default).
+	Timeouts map[string]time.Duration
+	// Rolling restarts one service at a time, in the order given (name order if no
+	// services are given), and waits until the restarted containers with a
+	// healthcheck are healthy before moving on. The restart stops at the first
+	// service that fails.
+	Rolling bool
+	// HealthTimeout, if positive, bounds the health wait per service in Rolling
+	// mode. Otherwise it is bounded by ctx only.
+	HealthTimeout time.Duration
+}
+
+// Restart restarts the running containers of the given services, or of all
+// services if none are given, like `docker compose restart`. Each container gets
+// its service's stop_grace_period to exit before it is killed.
+//
+// A Cmd attached to a restarted container sees it exit: its Wait returns and
+// removes the container. Restart is meant for containers that outlive their Cmd,
+// e.g. those kept by Stop or started by `docker compose up`.
+func (p *Project) Restart(ctx context.Context, services ...string) error {
+	return p.RestartWithOptions(ctx, RestartOptions{}, services...)
+}
+
+// RestartWithOptions is like Restart but accepts options, e.g. to restart the
+// services one by one while waiting for their health.
+//
+// If restarting any service fails, the returned error is a *MultiError with one
+// "service" entry per failure.
+func (p *Project) RestartWithOptions(
+	ctx context.Context,
+	opts RestartOptions,
+	services ...string,
+) error {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	if p == nil {
+		return errors.New("compose: project is nil")
+	}
+	for _, name := range services {
+		if _, err := p.serviceConfig(name); err != nil {
+			return err
+		}
+	}
+	cli, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cli.Close() }()
+	return p.restartServices(ctx, cli, opts, services)
+}
+
+func (p *Project) restartServices(
+	ctx context.Context,
+	dc Backend,
+	opts RestartOptions,
+	services []string,
+) error {
+	explicit := len(services) > 0
+	if !explicit {
+		services = p.ServiceNames()
+	}
+	errs := &MultiError{Op: "restart"}
+	if opts.Rolling {
+		for _, name := range services {
+			if err := p.restartService(ctx, dc, opts, name, explicit); err != nil {
+				errs.add("service", name, err)
+				break
+			}
+		}
+		return errs.errOrNil()
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, name := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.restartService(ctx, dc, opts, name, explicit); err != nil {
+				mu.Lock()
+				errs.add("service", name, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errs.errOrNil()
+}
+
+// restartService restarts the running containers of service and, in Rolling mode,
+// waits for their health. A service without running containers is an error only
+// if it was named explicitly.
+func (p *Project) restartService(
+	ctx context.Context,
+	dc Backend,
+	opts RestartOptions,
+	service string,
+	explicit bool,
+) error {
+	list, err := dc.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", "com.docker.compose.project="+p.Name),
+			filters.Arg("label", "com.docker.compose.service="+service),
+			filters.Arg("status", "running"),
+		),
+	})
+	if err != nil {
+		return engineErr("list containers", err)
+	}
+	if len(list) == 0 {
+		if explicit {
+			return fmt.Errorf("compose: service %q has no running container", service)
+		}
+		return nil
+	}
+
+	var stopOpts container.StopOptions
+	if timeout, ok := opts.Timeouts[service]; ok {
+		stopOpts.Timeout = stopSeconds(timeout)
+	}
+	for _, c := range list {
+		if err := dc.ContainerRestart(ctx, c.ID, stopOpts); err != nil {
+			return engineErr("restart container", err)
+		}
+	}
+	if !opts.Rolling {
+		return nil
+	}
+
+	if opts.HealthTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.HealthTimeout)
+		defer cancel()
+	}
+	for _, c := range list {
+		if err := waitRestartedHealthy(ctx, dc, c.ID); err != nil {
+			return fmt.Errorf("compose: service %q did not become healthy: %w", service, err)
+		}
+	}
+	return nil
+}
+
+// waitRestartedHealthy waits until the container is healthy. It returns at once
+// for running containers without a healthcheck, and fails once the container is
+// unhealthy or no longer running.
+func waitRestartedHealthy(ctx context.Context, dc Backend, id string) error {
+	j, err := dc.ContainerInspect(ctx, id)
+	if err != nil {
+		return engineErr("inspect container", err)
+	}
+	if j.State != nil && !j.State.Running {
+		return fmt.Errorf("compose: container stopped (status=%s, exit code %d)",
+			j.State.Status, j.State.ExitCode)
+	}
+	if j.State == nil || j.State.Health == nil {
+		return nil
+	}
+	ticker := time.NewTicker(restartHealthInterval)
+	defer ticker.Stop()
+	for {
+		status, statusErr := inspectHealthStatus(ctx, dc, id)
+		if statusErr != nil {
+			return statusErr
+		}
+		if status == healthStatusHealthy {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrProjectLocked is returned when the project lock enabled by WithProjectLock or
+// DownOptions.LockTimeout could not be acquired in time.
+var ErrProjectLocked = errors.New("compose: project is locked")
+
+// projectLockPollInterval is how often a contended project lock is retried.
+const projectLockPollInterval = 50 * time.Millisecond
+
+// projectLocks maps project names loaded with WithProjectLock to their timeout.
+var projectLocks sync.Map // string -> time.Duration
+
+// WithProjectLock serializes conflicting operations on the project across
+// processes on this host with an advisory file lock keyed by the project name:
+// Cmds of the project hold it shared while they create networks, volumes and their
+// container, and Down holds it exclusively, so Down never removes a network that
+// a concurrent Start is about to use. Down and DownWithOptions in this process
+// take the lock for every project name loaded with this option.
+//
+// timeout bounds the wait for the lock; the operation then fails with
+// ErrProjectLocked. Zero waits until the operation's context is done.
+func WithProjectLock(timeout time.Duration) LoadOption {
+	return func(o *loadOptions) {
+		o.lockTimeout = &timeout
+	}
+}
+
+// projectLockTimeout reports whether operations on the named project take the
+// project lock, and how long they wait for it.
+func projectLockTimeout(name string) (time.Duration, bool) {
+	if name == "" {
+		return 0, false
+	}
+	v, ok := projectLocks.Load(name)
+	if !ok {
+		return 0, false
+	}
+	return v.(time.Duration), true
+}
+
+// projectLockDir is the directory of the lock files.
+func projectLockDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "compose-exec", "locks")
+	}
+	return filepath.Join(os.TempDir(), "compose-exec-locks")
+}
+
+// lockProject acquires the lock of the named project, shared or exclusive, and
+// returns the function releasing it.
+func lockProject(
+	ctx context.Context,
+	name string,
+	exclusive bool,
+	timeout time.Duration,
+) (func(), error) {
+	dir := projectLockDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("compose: create lock dir: %w", err)
+	}
+	path := filepath.Join(dir, filepath.Base(name)+".lock")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("compose: open project lock: %w", err)
+	}
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		deadline = t.C
+	}
+	ticker := time.NewTicker(projectLockPollInterval)
+	defer ticker.Stop()
+	for {
+		ok, lockErr := tryLockFile(f, exclusive)
+		if lockErr != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("compose: lock project %q: %w", name, lockErr)
+		}
+		if ok {
+			var once sync.Once
+			return func() {
+				once.Do(func() {
+					_ = unlockFile(f)
+					_ = f.Close()
+				})
+			}, nil
+		}
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, ctx.Err()
+		case <-deadline:
+			_ = f.Close()
+			return nil, fmt.Errorf("%w: project %q (waited %s)", ErrProjectLocked, name, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// lockProjectResources takes the project lock shared, if the Cmd's project was
+// loaded with WithProjectLock, while Start creates resources.
+func (c *Cmd) lockProjectResources(ctx context.Context) (func(), error) {
+	name := c.projectName()
+	timeout, ok := projectLockTimeout(name)
+	if !ok {
+		return func() {}, nil
+	}
+	return lockProject(ctx, name, false, timeout)
+}
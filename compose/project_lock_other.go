@@ -0,0 +1,17 @@
+//go:build !unix && !windows
+
+package compose
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLockFile is not implemented on this platform.
+func tryLockFile(_ *os.File, _ bool) (bool, error) {
+	return false, errors.ErrUnsupported
+}
+
+func unlockFile(_ *os.File) error {
+	return nil
+}
@@ -0,0 +1,192 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// UpOptions configures UpWithOptions.
+type UpOptions struct {
+	// Stdout and Stderr, if set, receive the output of the started services, each
+	// line prefixed with the service name like `docker compose up`. Services with
+	// `attach: false` are not streamed there, so noisy dependencies do not drown
+	// the service under test.
+	Stdout io.Writer
+	Stderr io.Writer
+	// Output routes the output of individual services by name instead, regardless
+	// of their attach setting.
+	Output map[string]ServiceOutput
+}
+
+// ServiceOutput routes the output of one service. Nil writers discard it.
+type ServiceOutput struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// UpWithOptions starts a container for each of services like `docker compose up`
+// without -d, and streams their output as configured by opts until each container
+// stops or its ServiceInstance is removed. Without services it starts all services.
+//
+// Services start one at a time, each after the services it lists in depends_on,
+// and otherwise in the order given (name order without services). Unlike
+// `docker compose up`, dependencies missing from services are not started, and
+// depends_on conditions are not waited for: use the WaitFor helpers for that.
+//
+// If a service fails to start, the containers already started are removed and the
+// error is returned.
+func (p *Project) UpWithOptions(
+	ctx context.Context,
+	opts UpOptions,
+	services ...string,
+) ([]*ServiceInstance, error) {
+	if p == nil {
+		return nil, errors.New("compose: project is nil")
+	}
+	if len(services) == 0 {
+		services = p.ServiceNames()
+	}
+	services, err := p.dependencyOrder(services)
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]*ServiceInstance, 0, len(services))
+	for _, name := range services {
+		inst, err := p.upService(ctx, opts, name)
+		if err != nil {
+			for _, started := range instances {
+				_ = started.Remove(context.Background())
+			}
+			return nil, err
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+// dependencyOrder orders services so that each one comes after the services it
+// depends on that are also in services. Otherwise the given order is kept.
+func (p *Project) dependencyOrder(services []string) ([]string, error) {
+	wanted := make(map[string]bool, len(services))
+	for _, name := range services {
+		wanted[name] = true
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(services))
+	ordered := make([]string, 0, len(services))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("compose: dependency cycle involving service %q", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		deps := make([]string, 0, len(p.Services[name].DependsOn))
+		for dep := range p.Services[name].DependsOn {
+			if wanted[dep] {
+				deps = append(deps, dep)
+			}
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		ordered = append(ordered, name)
+		return nil
+	}
+	for _, name := range services {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+func (p *Project) upService(
+	ctx context.Context,
+	opts UpOptions,
+	name string,
+) (*ServiceInstance, error) {
+	svc, err := p.Service(name)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := p.Up(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	out := opts.outputFor(name, svc.config.Attach)
+	if out.Stdout == nil && out.Stderr == nil {
+		return inst, nil
+	}
+	if err := inst.streamOutput(out.Stdout, out.Stderr); err != nil {
+		_ = inst.Remove(context.Background())
+		return nil, err
+	}
+	return inst, nil
+}
+
+// outputFor returns where the output of service goes.
+func (o UpOptions) outputFor(service string, attach *bool) ServiceOutput {
+	if out, ok := o.Output[service]; ok {
+		return out
+	}
+	if attach != nil && !*attach {
+		return ServiceOutput{}
+	}
+	var out ServiceOutput
+	if o.Stdout != nil {
+		out.Stdout = DecorateWriter(o.Stdout, WithColor(service))
+	}
+	if o.Stderr != nil {
+		out.Stderr = DecorateWriter(o.Stderr, WithColor(service))
+	}
+	return out
+}
+
+// streamOutput copies the container's output, from its start, to stdout and
+// stderr until the container stops or Remove is called.
+func (s *ServiceInstance) streamOutput(stdout, stderr io.Writer) error {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rc, err := s.dc.ContainerLogs(ctx, s.ID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		cancel()
+		return engineErr("follow container logs", err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() { _ = rc.Close() }()
+		_, _ = copyOutput(stdout, stderr, rc, s.raw)
+	}()
+	s.stopOutput = func() {
+		cancel()
+		wg.Wait()
+	}
+	return nil
+}
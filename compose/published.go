@@ -0,0 +1,139 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// HostPort returns the host address ("host:port") at which the started container's
+// port is published, e.g. for "5432" (tcp by default), "53/udp", "9899/sctp" or the
+// name of a declared port. An empty port selects the lowest published TCP port.
+func (c *Cmd) HostPort(ctx context.Context, port string) (string, error) {
+	return c.publishedAddr(ctx, port)
+}
+
+// HostPortUDP is HostPort for the UDP container port.
+func (c *Cmd) HostPortUDP(ctx context.Context, port int) (string, error) {
+	return c.publishedAddr(ctx, fmt.Sprintf("%d/udp", port))
+}
+
+// HostPortSCTP is HostPort for the SCTP container port.
+func (c *Cmd) HostPortSCTP(ctx context.Context, port int) (string, error) {
+	return c.publishedAddr(ctx, fmt.Sprintf("%d/sctp", port))
+}
+
+// publishedAddr returns the host address ("host:port") at which the container port
+// (e.g. "5432" or "5432/udp"; tcp by default, or the name of a declared port) is
+// published. An empty port selects the lowest published TCP port.
+func (c *Cmd) publishedAddr(ctx context.Context, port string) (string, error) {
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return "", err
+	}
+	return publishedAddr(ctx, dc, id, resolvePortName(c.Service.Ports, port))
+}
+
+func publishedAddr(ctx context.Context, dc Backend, id, port string) (string, error) {
+	var (
+		key nat.Port
+		err error
+	)
+	if port != "" {
+		if key, err = natPort(port); err != nil {
+			return "", err
+		}
+	}
+	j, err := dc.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	var ports nat.PortMap
+	if j.NetworkSettings != nil {
+		ports = j.NetworkSettings.Ports
+	}
+	if key == "" {
+		if key = lowestPublishedTCPPort(ports); key == "" {
+			return "", errors.New("compose: no published tcp port")
+		}
+	}
+	for _, b := range ports[key] {
+		if b.HostPort == "" {
+			continue
+		}
+		return net.JoinHostPort(dialHost(b.HostIP, dc.DaemonHost()), b.HostPort), nil
+	}
+	return "", fmt.Errorf("compose: port %s is not published", key)
+}
+
+// exposedPort returns the container port to reach from the project network: port,
+// or else the lowest TCP port the container exposes.
+func (c *Cmd) exposedPort(ctx context.Context, port string) (string, error) {
+	if port != "" {
+		key, err := natPort(resolvePortName(c.Service.Ports, port))
+		return key.Port(), err
+	}
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return "", err
+	}
+	j, err := dc.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	var best nat.Port
+	if j.Config != nil {
+		for p := range j.Config.ExposedPorts {
+			if p.Proto() == "tcp" && (best == "" || p.Int() < best.Int()) {
+				best = p
+			}
+		}
+	}
+	if best == "" {
+		return "", errors.New("compose: no exposed tcp port")
+	}
+	return best.Port(), nil
+}
+
+func lowestPublishedTCPPort(ports nat.PortMap) nat.Port {
+	var best nat.Port
+	for p, bindings := range ports {
+		if p.Proto() != "tcp" || len(bindings) == 0 {
+			continue
+		}
+		if best == "" || p.Int() < best.Int() {
+			best = p
+		}
+	}
+	return best
+}
+
+func natPort(port string) (nat.Port, error) {
+	proto, p := nat.SplitProtoPort(strings.ToLower(port))
+	if p == "" {
+		return "", fmt.Errorf("compose: invalid port %q", port)
+	}
+	return nat.NewPort(proto, p)
+}
+
+// dialHost returns the host to dial for a port binding on hostIP. Wildcard bindings
+// are reached via loopback for local daemons and via the daemon's host otherwise.
+func dialHost(hostIP, daemonHost string) string {
+	switch hostIP {
+	case "", "0.0.0.0", "::":
+	default:
+		return hostIP
+	}
+	if u, err := url.Parse(daemonHost); err == nil &&
+		(u.Scheme == "tcp" || u.Scheme == "ssh" || u.Scheme == "http" || u.Scheme == "https") {
+		if h := u.Hostname(); h != "" {
+			return h
+		}
+	}
+	return "127.0.0.1"
+}
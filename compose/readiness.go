@@ -0,0 +1,236 @@
+package compose
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+)
+
+// readinessPollInterval is the retry interval of polling wait strategies.
+var readinessPollInterval = 200 * time.Millisecond
+
+// maxLogLineSize bounds the lines WaitForLog can match.
+const maxLogLineSize = 16 << 20
+
+// WaitStrategy blocks until a started Cmd is ready for use, or returns an error if
+// it cannot become ready (or ctx is done). Strategies can be combined with All, Any,
+// WithTimeout and WithInitialDelay.
+type WaitStrategy func(ctx context.Context, c *Cmd) error
+
+// WaitFor blocks until s reports the started container as ready.
+func (c *Cmd) WaitFor(ctx context.Context, s WaitStrategy) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	if s == nil {
+		return errors.New("compose: wait strategy is nil")
+	}
+	return s(ctx, c)
+}
+
+// All is ready when every strategy is ready. Strategies run concurrently; the
+// first failure cancels the others and is returned.
+func All(strategies ...WaitStrategy) WaitStrategy {
+	return func(ctx context.Context, c *Cmd) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var (
+			wg       sync.WaitGroup
+			once     sync.Once
+			firstErr error
+		)
+		for _, s := range strategies {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := s(ctx, c); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}()
+		}
+		wg.Wait()
+		return firstErr
+	}
+}
+
+// Any is ready as soon as one strategy is ready; the others are canceled. If all
+// strategies fail, their errors are joined.
+func Any(strategies ...WaitStrategy) WaitStrategy {
+	return func(ctx context.Context, c *Cmd) error {
+		if len(strategies) == 0 {
+			return nil
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		errCh := make(chan error, len(strategies))
+		for _, s := range strategies {
+			go func() { errCh <- s(ctx, c) }()
+		}
+		var errs []error
+		for range strategies {
+			err := <-errCh
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// WithTimeout limits s to d.
+func WithTimeout(s WaitStrategy, d time.Duration) WaitStrategy {
+	return func(ctx context.Context, c *Cmd) error {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		if err := s(ctx, c); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("compose: not ready after %s: %w", d, err)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// WithInitialDelay waits d before running s.
+func WithInitialDelay(s WaitStrategy, d time.Duration) WaitStrategy {
+	return func(ctx context.Context, c *Cmd) error {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		return s(ctx, c)
+	}
+}
+
+// WaitForHealthy is ready when the container's healthcheck reports healthy
+// (see WaitUntilHealthy).
+func WaitForHealthy() WaitStrategy {
+	return func(ctx context.Context, c *Cmd) error {
+		return c.waitUntilHealthy(ctx)
+	}
+}
+
+// WaitForLog is ready when a line of the container's stdout or stderr contains
+// substr. Output written before the call is included.
+func WaitForLog(substr string) WaitStrategy {
+	return func(ctx context.Context, c *Cmd) error {
+		id, dc, err := c.activeContainer()
+		if err != nil {
+			return err
+		}
+		raw := c.isRawOutput()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		rc, err := dc.ContainerLogs(ctx, id, container.LogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Follow:     true,
+		})
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rc.Close() }()
+
+		pr, pw := io.Pipe()
+		defer func() { _ = pr.Close() }()
+		go func() {
+			_, copyErr := copyOutput(pw, pw, rc, raw)
+			_ = pw.CloseWithError(copyErr)
+		}()
+		sc := bufio.NewScanner(pr)
+		sc.Buffer(make([]byte, 64<<10), maxLogLineSize)
+		for sc.Scan() {
+			if strings.Contains(sc.Text(), substr) {
+				return nil
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if scanErr := sc.Err(); scanErr != nil {
+			return scanErr
+		}
+		return fmt.Errorf("compose: log output ended before %q appeared", substr)
+	}
+}
+
+// WaitForPort is ready when a TCP connection to the host binding of the published
+// container port (e.g. "5432" or "5432/tcp") succeeds.
+func WaitForPort(port string) WaitStrategy {
+	return func(ctx context.Context, c *Cmd) error {
+		return pollReady(ctx, c, func() error {
+			addr, err := c.publishedAddr(ctx, port)
+			if err != nil {
+				return err
+			}
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		})
+	}
+}
+
+// pollReady calls check until it succeeds or ctx is done, in which case the last
+// check error is included. It fails early when c's container stopped, as it cannot
+// become ready anymore.
+func pollReady(ctx context.Context, c *Cmd, check func() error) error {
+	ticker := time.NewTicker(readinessPollInterval)
+	defer ticker.Stop()
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		if stopErr := c.checkRunning(ctx); stopErr != nil {
+			return fmt.Errorf("compose: not ready: %w", errors.Join(stopErr, err))
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("compose: not ready: %w", errors.Join(ctx.Err(), err))
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkRunning returns an error when the container is gone or no longer running.
+// Other inspect failures are left to the readiness checks.
+func (c *Cmd) checkRunning(ctx context.Context) error {
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return err
+	}
+	j, err := dc.ContainerInspect(ctx, id)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return engineErr("inspect container", err)
+		}
+		return nil
+	}
+	if j.ContainerJSONBase == nil || j.State == nil || j.State.Running {
+		return nil
+	}
+	return fmt.Errorf("compose: container stopped (status=%s, exit code %d)",
+		j.State.Status, j.State.ExitCode)
+}
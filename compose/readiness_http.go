@@ -0,0 +1,227 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// HTTPOption configures WaitForHTTP.
+type HTTPOption func(*httpProbe)
+
+type httpProbe struct {
+	port       string
+	statuses   []int
+	tls        bool
+	skipVerify bool
+	username   string
+	password   string
+	basicAuth  bool
+	header     http.Header
+	network    bool
+}
+
+// WithPort selects the container port to probe, e.g. "8080". By default the
+// lowest published TCP port is used, or with WithProjectNetwork the lowest exposed
+// one.
+func WithPort(port string) HTTPOption {
+	return func(p *httpProbe) { p.port = port }
+}
+
+// WithStatus sets the accepted response status codes. By default any 2xx status
+// is accepted.
+func WithStatus(codes ...int) HTTPOption {
+	return func(p *httpProbe) { p.statuses = append(p.statuses, codes...) }
+}
+
+// WithTLS probes over https, verifying the server certificate.
+func WithTLS() HTTPOption {
+	return func(p *httpProbe) { p.tls = true }
+}
+
+// WithTLSSkipVerify probes over https without verifying the server certificate,
+// as needed for self-signed test certificates.
+func WithTLSSkipVerify() HTTPOption {
+	return func(p *httpProbe) {
+		p.tls = true
+		p.skipVerify = true
+	}
+}
+
+// WithBasicAuth sends HTTP basic authentication credentials.
+func WithBasicAuth(username, password string) HTTPOption {
+	return func(p *httpProbe) {
+		p.username = username
+		p.password = password
+		p.basicAuth = true
+	}
+}
+
+// WithHeader adds a request header. It may be given several times.
+func WithHeader(key, value string) HTTPOption {
+	return func(p *httpProbe) { p.header.Add(key, value) }
+}
+
+// WithProjectNetwork sends the requests from a short-lived helper container on the
+// service's networks (see Project.Probe) instead of to a published port, for
+// services that publish none. The helper cannot verify certificates, so https
+// needs WithTLSSkipVerify.
+func WithProjectNetwork() HTTPOption {
+	return func(p *httpProbe) { p.network = true }
+}
+
+// WaitForHTTP is ready when a GET request for path on the container's published
+// port returns an accepted status.
+func WaitForHTTP(path string, opts ...HTTPOption) WaitStrategy {
+	p := &httpProbe{header: http.Header{}}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	client := &http.Client{Transport: p.transport()}
+
+	return func(ctx context.Context, c *Cmd) error {
+		if p.network {
+			return p.waitFromNetwork(ctx, c, path)
+		}
+		return pollReady(ctx, c, func() error {
+			hostPort, err := c.publishedAddr(ctx, p.port)
+			if err != nil {
+				return err
+			}
+			return p.check(ctx, client, hostPort, path)
+		})
+	}
+}
+
+func (p *httpProbe) transport() http.RoundTripper {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.DisableKeepAlives = true
+	if p.skipVerify {
+		// #nosec G402 -- explicitly requested for test certificates.
+		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return tr
+}
+
+func (p *httpProbe) check(ctx context.Context, client *http.Client, hostPort, path string) error {
+	scheme := "http"
+	if p.tls {
+		scheme = "https"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+hostPort+path, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range p.header {
+		req.Header[k] = slices.Clone(vs)
+	}
+	if p.basicAuth {
+		req.SetBasicAuth(p.username, p.password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if !p.accepts(resp.StatusCode) {
+		return fmt.Errorf("compose: GET %s returned %s", path, resp.Status)
+	}
+	return nil
+}
+
+func (p *httpProbe) accepts(status int) bool {
+	if len(p.statuses) == 0 {
+		return status >= 200 && status < 300
+	}
+	return slices.Contains(p.statuses, status)
+}
+
+// waitFromNetwork polls path with wget from a helper container per request.
+func (p *httpProbe) waitFromNetwork(ctx context.Context, c *Cmd, path string) error {
+	if p.tls && !p.skipVerify {
+		return errors.New("compose: WaitForHTTP with WithProjectNetwork cannot verify " +
+			"certificates; use WithTLSSkipVerify")
+	}
+	c.ensureService()
+	return pollReady(ctx, c, func() error {
+		port, err := c.exposedPort(ctx, p.port)
+		if err != nil {
+			return err
+		}
+		probe := c.service.project.probeService(c.Service.Name).
+			CommandContext(ctx, p.wgetArgs(net.JoinHostPort(c.Service.Name, port), path)...)
+		var out bytes.Buffer
+		probe.Stdout = &out
+		probe.Stderr = &out
+		runErr := probe.Run()
+		status, line, ok := lastHTTPStatus(out.String())
+		if !ok {
+			var ee *ExitError
+			if errors.As(runErr, &ee) {
+				return fmt.Errorf("compose: GET %s: %s", path, strings.TrimSpace(out.String()))
+			}
+			if runErr == nil {
+				runErr = fmt.Errorf("compose: GET %s: no response", path)
+			}
+			return runErr
+		}
+		if !p.accepts(status) {
+			return fmt.Errorf("compose: GET %s returned %s", path, line)
+		}
+		return nil
+	})
+}
+
+// wgetArgs is the busybox wget command requesting path from hostPort. -S prints
+// the response status, also for error statuses that make wget fail.
+func (p *httpProbe) wgetArgs(hostPort, path string) []string {
+	args := []string{"wget", "-S", "-O", "/dev/null", "-T", "5"}
+	scheme := "http"
+	if p.tls {
+		scheme = "https"
+		args = append(args, "--no-check-certificate")
+	}
+	keys := make([]string, 0, len(p.header))
+	for k := range p.header {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		for _, v := range p.header[k] {
+			args = append(args, "--header", k+": "+v)
+		}
+	}
+	userinfo := ""
+	if p.basicAuth {
+		userinfo = url.UserPassword(p.username, p.password).String() + "@"
+	}
+	return append(args, scheme+"://"+userinfo+hostPort+path)
+}
+
+var httpStatusLine = regexp.MustCompile(`HTTP/[0-9.]+ (([0-9]{3})[^\r\n]*)`)
+
+// lastHTTPStatus returns the last response status in wget output, which follows
+// redirects, and its status line, e.g. "401 Unauthorized".
+func lastHTTPStatus(out string) (int, string, bool) {
+	matches := httpStatusLine.FindAllStringSubmatch(out, -1)
+	if len(matches) == 0 {
+		return 0, "", false
+	}
+	m := matches[len(matches)-1]
+	status, _ := strconv.Atoi(m[2])
+	return status, strings.TrimSpace(m[1]), true
+}
@@ -0,0 +1,110 @@
+package compose
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"text/template"
+)
+
+// sqlDefaultPorts maps database/sql driver names to the default container port of
+// their database.
+var sqlDefaultPorts = map[string]string{
+	"postgres":  "5432",
+	"pgx":       "5432",
+	"mysql":     "3306",
+	"sqlserver": "1433",
+}
+
+// sqlDSNData is the data passed to WaitForSQL DSN templates.
+type sqlDSNData struct {
+	// Host and Port are the host address of the driver's default container port.
+	Host string
+	Port string
+}
+
+// WaitForSQL is ready when a database/sql connection opened with driver pings
+// successfully. The driver must be registered by the caller (e.g. by importing
+// github.com/lib/pq or github.com/go-sql-driver/mysql).
+//
+// dsnTemplate is a text/template expanded against the published ports:
+// {{.Host}} and {{.Port}} refer to the host binding of the driver's default port
+// (5432 for postgres/pgx, 3306 for mysql, 1433 for sqlserver), and
+// {{addr "5433"}} returns "host:port" for any other container port. For example:
+//
+//	WaitForSQL("pgx", "postgres://app:secret@{{.Host}}:{{.Port}}/app?sslmode=disable")
+func WaitForSQL(driver, dsnTemplate string) WaitStrategy {
+	return func(ctx context.Context, c *Cmd) error {
+		if !driverRegistered(driver) {
+			return fmt.Errorf("compose: sql driver %q is not registered (missing import?)", driver)
+		}
+		return pollReady(ctx, c, func() error {
+			dsn, err := expandDSN(ctx, c, driver, dsnTemplate)
+			if err != nil {
+				return err
+			}
+			db, err := sql.Open(driver, dsn)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = db.Close() }()
+			return db.PingContext(ctx)
+		})
+	}
+}
+
+func driverRegistered(name string) bool {
+	for _, d := range sql.Drivers() {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+func expandDSN(ctx context.Context, c *Cmd, driver, dsnTemplate string) (string, error) {
+	var addrErr error
+	addr := func(port string) string {
+		a, err := c.publishedAddr(ctx, port)
+		if err != nil && addrErr == nil {
+			addrErr = err
+		}
+		return a
+	}
+	tmpl, err := template.New("dsn").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"addr": addr}).
+		Parse(dsnTemplate)
+	if err != nil {
+		return "", fmt.Errorf("compose: invalid DSN template: %w", err)
+	}
+
+	var data sqlDSNData
+	if strings.Contains(dsnTemplate, ".Host") || strings.Contains(dsnTemplate, ".Port") {
+		port, ok := sqlDefaultPorts[driver]
+		if !ok {
+			return "", fmt.Errorf(
+				"compose: no default port for sql driver %q; use {{addr \"<port>\"}}",
+				driver,
+			)
+		}
+		hostPort, portErr := c.publishedAddr(ctx, port)
+		if portErr != nil {
+			return "", portErr
+		}
+		if data.Host, data.Port, err = net.SplitHostPort(hostPort); err != nil {
+			return "", err
+		}
+	}
+
+	var b strings.Builder
+	if err = tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("compose: expand DSN template: %w", err)
+	}
+	if addrErr != nil {
+		return "", addrErr
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,142 @@
+package compose
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// reaperImage is the sidecar image used by StartReaper. It speaks the Ryuk protocol
+// of testcontainers: clients send label filters over a TCP connection, and resources
+// matching them are removed once all connections have been closed for a while.
+var reaperImage = "testcontainers/ryuk:0.11.0"
+
+const (
+	reaperPort             = "8080"
+	reaperProjectName      = "compose-exec-reaper"
+	reaperReconnectTimeout = 10 * time.Second
+)
+
+// Reaper is a running cleanup sidecar for a project. See StartReaper.
+type Reaper struct {
+	cmd  *Cmd
+	conn net.Conn
+	once sync.Once
+}
+
+// StartReaper starts a sidecar container that holds a heartbeat connection from this
+// process. When the connection drops, because Close was called or the process died
+// (including SIGKILL or power loss of the client machine), the sidecar force-removes
+// all containers, networks and volumes labeled with the project name after a
+// grace period of about 10 seconds.
+//
+// Named volumes of the project are removed as well, so do not use a reaper for
+// projects whose volumes must outlive this process.
+func (p *Project) StartReaper(ctx context.Context) (*Reaper, error) {
+	if p == nil {
+		return nil, errors.New("compose: project is nil")
+	}
+	if p.Name == "" {
+		return nil, errors.New("compose: project name is required")
+	}
+
+	cmd := newService(&Project{Name: reaperProjectName}, reaperServiceConfig()).Command()
+	cmd.AutoRemove = true
+	cmd.DisableSignalHandling = true
+	cmd.MountDockerSocket()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("compose: start reaper: %w", err)
+	}
+	r := &Reaper{cmd: cmd}
+
+	conn, err := connectReaper(ctx, cmd, p.Name)
+	if err != nil {
+		if id, dc, activeErr := cmd.activeContainer(); activeErr == nil {
+			_ = stopAndKill(context.Background(), dc, id, time.Second)
+		}
+		_ = cmd.Wait()
+		return nil, err
+	}
+	r.conn = conn
+	return r, nil
+}
+
+func reaperServiceConfig() types.ServiceConfig {
+	return types.ServiceConfig{
+		Name:        "reaper",
+		Image:       reaperImage,
+		NetworkMode: "bridge",
+		Ports: []types.ServicePortConfig{
+			{Target: 8080, Published: "0", Protocol: "tcp"},
+		},
+		Environment: types.NewMappingWithEquals([]string{
+			"RYUK_RECONNECTION_TIMEOUT=" + reaperReconnectTimeout.String(),
+		}),
+	}
+}
+
+// connectReaper registers the project filter and returns the heartbeat connection.
+func connectReaper(ctx context.Context, cmd *Cmd, projectName string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	var conn net.Conn
+	err := pollReady(ctx, cmd, func() error {
+		addr, err := cmd.publishedAddr(ctx, reaperPort)
+		if err != nil {
+			return err
+		}
+		var d net.Dialer
+		c, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		if regErr := registerReaperFilter(c, projectName); regErr != nil {
+			_ = c.Close()
+			return regErr
+		}
+		conn = c
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("compose: connect to reaper: %w", err)
+	}
+	return conn, nil
+}
+
+func registerReaperFilter(conn net.Conn, projectName string) error {
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+
+	filter := "label=com.docker.compose.project=" + projectName + "\n"
+	if _, err := conn.Write([]byte(filter)); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(line) != "ACK" {
+		return fmt.Errorf("compose: unexpected reaper response %q", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// Close drops the heartbeat connection, so the sidecar removes the project's
+// resources after its grace period and then exits.
+func (r *Reaper) Close() error {
+	var err error
+	r.once.Do(func() {
+		err = r.conn.Close()
+		// The sidecar removes itself (AutoRemove); release the client once it exits.
+		go func() { _ = r.cmd.Wait() }()
+	})
+	return err
+}
@@ -0,0 +1,105 @@
+package compose
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redactedValue replaces secret values in redacted output.
+const redactedValue = "****"
+
+// minSecretLen is the shortest secret value masked inside free text such as error
+// messages; shorter values would mask unrelated text.
+const minSecretLen = 4
+
+var (
+	redactMu      sync.Mutex
+	redactPattern = regexp.MustCompile(`(?i)PASSWORD|PASSWD|SECRET|TOKEN|KEY|CREDENTIAL`)
+)
+
+// SetRedactPattern sets the pattern selecting secret environment variables by
+// name. Their values are masked in Cmd.String, Cmd.DebugString, RedactEnv and the
+// errors returned by Start and Wait, so credentials do not leak into CI logs. The
+// default matches names containing PASSWORD, PASSWD, SECRET, TOKEN, KEY or
+// CREDENTIAL, ignoring case. A nil re disables redaction.
+func SetRedactPattern(re *regexp.Regexp) {
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	redactPattern = re
+}
+
+func activeRedactPattern() *regexp.Regexp {
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	return redactPattern
+}
+
+// RedactEnv returns a copy of env ("KEY=value" entries) with the values of secret
+// variables (see SetRedactPattern) masked.
+func RedactEnv(env []string) []string {
+	re := activeRedactPattern()
+	out := make([]string, len(env))
+	for i, kv := range env {
+		out[i] = redactEnvEntry(re, kv)
+	}
+	return out
+}
+
+func redactEnvEntry(re *regexp.Regexp, kv string) string {
+	k, v, ok := strings.Cut(kv, "=")
+	if !ok || v == "" || re == nil || !re.MatchString(k) {
+		return kv
+	}
+	return k + "=" + redactedValue
+}
+
+// secretValues returns the values of the Cmd's secret environment variables,
+// longest first so overlapping values are masked completely.
+func (c *Cmd) secretValues() []string {
+	re := activeRedactPattern()
+	if re == nil {
+		return nil
+	}
+	var out []string
+	for _, kv := range c.Environ() {
+		k, v, ok := strings.Cut(kv, "=")
+		if ok && len(v) >= minSecretLen && re.MatchString(k) {
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return len(out[i]) > len(out[j]) })
+	return out
+}
+
+func redactSecrets(s string, secrets []string) string {
+	for _, v := range secrets {
+		s = strings.ReplaceAll(s, v, redactedValue)
+	}
+	return s
+}
+
+// redactErr masks the Cmd's secret values in err's message. err itself is
+// returned if its message contains none, and is otherwise still reachable
+// through errors.Is and errors.As.
+func (c *Cmd) redactErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	redacted := redactSecrets(msg, c.secretValues())
+	if redacted == msg {
+		return err
+	}
+	return &redactedError{msg: redacted, err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
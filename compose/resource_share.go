@@ -0,0 +1,131 @@
+package compose
+
+import (
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// cgroupRoot is where the cgroup filesystem is mounted.
+var cgroupRoot = "/sys/fs/cgroup"
+
+var (
+	resourceShareMu sync.Mutex
+	resourceShare   int
+	// controllerLimits caches the CPU and memory limits of this process.
+	controllerLimits = sync.OnceValues(func() (float64, int64) {
+		return cgroupLimits(cgroupRoot, "/proc/self/cgroup")
+	})
+)
+
+// SetResourceShare gives every container whose service sets no CPU or memory
+// limit at most 1/n of this process's own limits: the CPU quota and memory limit
+// of its cgroup, or the number of CPUs if it has no CPU quota. When many test
+// containers start on a constrained CI runner, none can then starve the others or
+// the test process. Services with cpus, cpu_quota, cpuset or mem_limit keep their
+// settings. n <= 0 disables this (the default).
+//
+// The limits are read once, on Linux only, and assume the Docker Engine runs on
+// the same machine as this process.
+func SetResourceShare(n int) {
+	resourceShareMu.Lock()
+	defer resourceShareMu.Unlock()
+	resourceShare = n
+}
+
+func activeResourceShare() int {
+	resourceShareMu.Lock()
+	defer resourceShareMu.Unlock()
+	return resourceShare
+}
+
+// applyResourceShare sets default limits per SetResourceShare.
+func applyResourceShare(hostCfg *container.HostConfig) {
+	n := activeResourceShare()
+	if n <= 0 {
+		return
+	}
+	cpus, memory := controllerLimits()
+	if cpus <= 0 {
+		cpus = float64(runtime.NumCPU())
+	}
+	if hostCfg.NanoCPUs == 0 && hostCfg.CPUQuota == 0 && hostCfg.CpusetCpus == "" {
+		hostCfg.NanoCPUs = int64(math.Round(cpus / float64(n) * 1_000_000_000))
+	}
+	if hostCfg.Memory == 0 && memory > 0 {
+		hostCfg.Memory = memory / int64(n)
+	}
+}
+
+// cgroupLimits returns the CPU quota (in CPUs) and memory limit (in bytes) of the
+// cgroup listed in procCgroup, zero where there is no limit. For cgroup v2 the
+// tightest limit on the path to the root applies.
+func cgroupLimits(root, procCgroup string) (float64, int64) {
+	b, err := os.ReadFile(procCgroup)
+	if err != nil {
+		return 0, 0
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if p, ok := strings.CutPrefix(line, "0::"); ok {
+			return cgroupV2Limits(root, p)
+		}
+	}
+	return cgroupV1Limits(root)
+}
+
+func cgroupV2Limits(root, cgroupPath string) (float64, int64) {
+	var (
+		cpus   float64
+		memory int64
+	)
+	for p := path.Clean("/" + cgroupPath); ; p = path.Dir(p) {
+		dir := filepath.Join(root, filepath.FromSlash(p))
+		if f := strings.Fields(readCgroupFile(dir, "cpu.max")); len(f) == 2 {
+			quota, qErr := strconv.ParseFloat(f[0], 64)
+			period, pErr := strconv.ParseFloat(f[1], 64)
+			if qErr == nil && pErr == nil && period > 0 && (cpus == 0 || quota/period < cpus) {
+				cpus = quota / period
+			}
+		}
+		if m, mErr := strconv.ParseInt(readCgroupFile(dir, "memory.max"), 10, 64); mErr == nil &&
+			(memory == 0 || m < memory) {
+			memory = m
+		}
+		if p == "/" {
+			return cpus, memory
+		}
+	}
+}
+
+func cgroupV1Limits(root string) (float64, int64) {
+	var cpus float64
+	cpuDir := filepath.Join(root, "cpu")
+	quota, qErr := strconv.ParseFloat(readCgroupFile(cpuDir, "cpu.cfs_quota_us"), 64)
+	period, pErr := strconv.ParseFloat(readCgroupFile(cpuDir, "cpu.cfs_period_us"), 64)
+	if qErr == nil && pErr == nil && quota > 0 && period > 0 {
+		cpus = quota / period
+	}
+	memory, err := strconv.ParseInt(
+		readCgroupFile(filepath.Join(root, "memory"), "memory.limit_in_bytes"), 10, 64,
+	)
+	// Unlimited is reported as a huge, page-aligned value.
+	if err != nil || memory >= math.MaxInt64/2 {
+		memory = 0
+	}
+	return cpus, memory
+}
+
+func readCgroupFile(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
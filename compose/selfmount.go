@@ -0,0 +1,95 @@
+package compose
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+// SelfMount describes how to launch a controller container that runs compose-exec
+// against the host's Docker engine (Docker-outside-of-Docker).
+type SelfMount struct {
+	// Mounts are the project directory and the Docker socket.
+	Mounts []mount.Mount
+	// GroupAdd lists groups the controller needs to access the Docker socket.
+	GroupAdd []string
+	// WorkingDir is the project directory inside the controller.
+	WorkingDir string
+	// PathMapping maps controller paths to host paths. It is nil when the project
+	// is mirror-mounted (same path on both sides), and set when that is impossible,
+	// e.g. for Windows drive paths.
+	PathMapping map[string]string
+}
+
+// SelfMountSpec computes the mounts needed to run the current working directory's
+// project from a controller container, so that bind mount sources resolved inside
+// the controller are valid on the host where the daemon resolves them.
+//
+// It is meant to be called on the host. The project directory is mirror-mounted
+// when possible; otherwise it is mounted under a POSIX path and PathMapping records
+// the translation.
+func SelfMountSpec() (*SelfMount, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	wd, err = filepath.Abs(wd)
+	if err != nil {
+		return nil, err
+	}
+	host := os.Getenv(client.EnvOverrideHost)
+	if host == "" {
+		host = client.DefaultDockerHost
+	}
+	return selfMountFor(wd, host), nil
+}
+
+func selfMountFor(dir, daemonHost string) *SelfMount {
+	target, mirrored := controllerPath(dir)
+	sm := &SelfMount{
+		Mounts:     []mount.Mount{{Type: mount.TypeBind, Source: dir, Target: target}},
+		WorkingDir: target,
+	}
+	if !mirrored {
+		sm.PathMapping = map[string]string{target: dir}
+	}
+	sock, groups, _ := dockerSocketMount(daemonHost)
+	sm.Mounts = append(sm.Mounts, sock)
+	sm.GroupAdd = groups
+	return sm
+}
+
+// controllerPath returns the path at which the host directory dir is mounted in a
+// Linux controller, and whether it is the same path (a mirror mount).
+// "C:\src\app" maps to "/c/src/app".
+func controllerPath(dir string) (string, bool) {
+	if strings.HasPrefix(dir, "/") {
+		return dir, true
+	}
+	p := strings.ReplaceAll(dir, `\`, "/")
+	if len(p) >= 2 && p[1] == ':' {
+		p = "/" + strings.ToLower(p[:1]) + p[2:]
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return strings.TrimSuffix(p, "/"), false
+}
+
+// DockerRunArgs returns the equivalent `docker run` flags.
+func (s *SelfMount) DockerRunArgs() []string {
+	var args []string
+	for _, m := range s.Mounts {
+		args = append(args, "-v", m.Source+":"+m.Target)
+	}
+	for _, g := range s.GroupAdd {
+		args = append(args, "--group-add", g)
+	}
+	if s.WorkingDir != "" {
+		args = append(args, "-w", s.WorkingDir)
+	}
+	return args
+}
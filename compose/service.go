@@ -40,6 +40,30 @@ func newService(project *Project, config types.ServiceConfig) *Service {
 	}
 }
 
+// Name returns the compose service name.
+func (s *Service) Name() string {
+	return s.config.Name
+}
+
+// Config returns a deep copy of the resolved service configuration
+// (interpolated image, ports, environment, etc.). Modifying it does not affect s.
+func (s *Service) Config() types.ServiceConfig {
+	return copyServiceConfig(s.config)
+}
+
+// Project returns a deep copy of the project the service belongs to.
+// Modifying it does not affect s.
+func (s *Service) Project() *Project {
+	return s.project.clone()
+}
+
+// ConfigHash returns the hash of the resolved service configuration, computed like
+// the docker compose CLI's "com.docker.compose.config-hash" label. Containers started
+// by compose-exec carry this label, so callers can detect config changes.
+func (s *Service) ConfigHash() (string, error) {
+	return serviceConfigHash(s.config)
+}
+
 // Command returns a Cmd to execute the given command arguments in the service.
 //
 // When called with zero args, Docker Engine/image defaults (or YAML service.command
@@ -49,7 +73,7 @@ func (s *Service) Command(arg ...string) *Cmd {
 	return &Cmd{
 		Service: s.config,
 		Args:    args,
-		loadErr: s.loadErr,
+		Err:     cmdErr(s.loadErr, args),
 		service: s,
 	}
 }
@@ -57,17 +81,18 @@ func (s *Service) Command(arg ...string) *Cmd {
 // CommandContext returns a Cmd to execute the given command arguments in the service,
 // bound to the provided context for lifecycle cancellation.
 //
-// It panics if ctx is nil, matching os/exec.CommandContext behavior.
+// If ctx is nil, the returned Cmd's Err reports it.
 func (s *Service) CommandContext(ctx context.Context, arg ...string) *Cmd {
-	if ctx == nil {
-		panic("nil Context")
-	}
-	args := append([]string(nil), arg...)
-	return &Cmd{
-		Service: s.config,
-		Args:    args,
-		loadErr: s.loadErr,
-		service: s,
-		ctx:     ctx,
+	c := s.Command(arg...)
+	c.ctx = ctx
+	if ctx == nil && c.Err == nil {
+		c.Err = errNilContext
 	}
+	return c
+}
+
+func copyServiceConfig(cfg types.ServiceConfig) types.ServiceConfig {
+	// Round-trip through a project to reuse compose-go's generated deep copy.
+	p := &Project{Services: types.Services{cfg.Name: cfg}}
+	return p.clone().Services[cfg.Name]
 }
@@ -0,0 +1,201 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// ServiceInstance is a handle to a service container whose lifetime exceeds a
+// single command, e.g. a database started once for a whole test suite. Unlike a
+// Cmd it is not tied to Wait: the container runs until it is stopped or removed,
+// and can be stopped, restarted and inspected any number of times.
+//
+// Call Remove when done with it; Down removes it along with the rest of the project.
+type ServiceInstance struct {
+	// Service is the compose service name.
+	Service string
+	// ID is the container ID.
+	ID string
+
+	dc      Backend
+	dcOwned bool
+	// raw is true when the container's output is not stdcopy-framed (a TTY container).
+	raw bool
+	// ports are the service's port declarations, to resolve port names.
+	ports []types.ServicePortConfig
+	// stopOutput ends streaming the output started by UpWithOptions.
+	stopOutput func()
+}
+
+// Up starts a container for service, like `docker compose up -d <service>`, and
+// returns a handle to it. It is Start followed by Detach; ctx bounds Start only.
+func (p *Project) Up(ctx context.Context, service string) (*ServiceInstance, error) {
+	cmd := p.CommandContext(ctx, service)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd.Detach()
+}
+
+// Detach releases the started container from the Cmd and returns a handle to it,
+// so the container keeps running after the Cmd is done with it. Output streaming,
+// stdin and signal handling end; Wait must not be called afterwards.
+func (c *Cmd) Detach() (*ServiceInstance, error) {
+	c.mu.Lock()
+	switch {
+	case c.detached:
+		c.mu.Unlock()
+		return nil, errors.New("compose: already detached")
+	case !c.started || c.containerID == "":
+		c.mu.Unlock()
+		return nil, errors.New("compose: not started")
+	case c.docker == nil:
+		c.mu.Unlock()
+		return nil, errors.New("compose: container already released")
+	}
+	c.detached = true
+	inst := &ServiceInstance{
+		Service: c.Service.Name,
+		ID:      c.containerID,
+		dc:      c.docker,
+		dcOwned: c.dockerOwned,
+		raw:     c.rawOutput,
+		ports:   append([]types.ServicePortConfig(nil), c.Service.Ports...),
+	}
+	c.docker, c.dockerOwned = nil, false
+	stopSignals := c.signalStop
+	c.mu.Unlock()
+
+	c.stopWatchers()
+	if stopSignals != nil {
+		stopSignals()
+	}
+	c.releaseIO(nil)
+	c.finished(nil)
+	return inst, nil
+}
+
+// Stop stops the container but keeps it, so Restart can start it again. It gets
+// timeout to exit after its stop signal before it is killed; zero uses the
+// service's stop_grace_period.
+func (s *ServiceInstance) Stop(ctx context.Context, timeout time.Duration) error {
+	return engineErr("stop container", s.dc.ContainerStop(ctx, s.ID, stopOptions(timeout)))
+}
+
+// Restart stops the container, if it is running, and starts it again. timeout is
+// as for Stop.
+func (s *ServiceInstance) Restart(ctx context.Context, timeout time.Duration) error {
+	return engineErr("restart container", s.dc.ContainerRestart(ctx, s.ID, stopOptions(timeout)))
+}
+
+// Remove force-removes the container and releases the handle.
+func (s *ServiceInstance) Remove(ctx context.Context) error {
+	if s.stopOutput != nil {
+		s.stopOutput()
+		s.stopOutput = nil
+	}
+	err := s.dc.ContainerRemove(ctx, s.ID, container.RemoveOptions{Force: true})
+	if err != nil && isNotFoundErr(err) {
+		err = nil
+	}
+	journalContainerRemoved(s.ID, err)
+	if err != nil {
+		return engineErr("remove container", err)
+	}
+	if s.dcOwned {
+		s.dcOwned = false
+		_ = s.dc.Close()
+	}
+	return nil
+}
+
+// Exec runs args in the running container, like `docker compose exec`, and returns
+// its combined output. A non-zero exit status is reported as an *ExitError.
+func (s *ServiceInstance) Exec(ctx context.Context, args ...string) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, errors.New("compose: no command to exec")
+	}
+	var out bytes.Buffer
+	code, err := execAttached(ctx, s.dc, s.ID, container.ExecOptions{
+		Cmd:          args,
+		AttachStdout: true,
+		AttachStderr: true,
+	}, &out)
+	if err != nil {
+		return out.Bytes(), err
+	}
+	if code != 0 {
+		return out.Bytes(), &ExitError{Code: code, Stderr: out.Bytes()}
+	}
+	return out.Bytes(), nil
+}
+
+// Logs copies the container's output so far to stdout and stderr.
+func (s *ServiceInstance) Logs(ctx context.Context, stdout, stderr io.Writer) error {
+	rc, err := s.dc.ContainerLogs(ctx, s.ID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return engineErr("read container logs", err)
+	}
+	defer func() { _ = rc.Close() }()
+	_, err = copyOutput(stdout, stderr, rc, s.raw)
+	return err
+}
+
+// HostPort returns the host address ("host:port") at which the container port
+// (e.g. "5432" or "5432/udp"; tcp by default, or the name of a declared port) is
+// published. An empty port selects the lowest published TCP port.
+func (s *ServiceInstance) HostPort(ctx context.Context, port string) (string, error) {
+	return publishedAddr(ctx, s.dc, s.ID, resolvePortName(s.ports, port))
+}
+
+// HostPortUDP is HostPort for the UDP container port.
+func (s *ServiceInstance) HostPortUDP(ctx context.Context, port int) (string, error) {
+	return s.HostPort(ctx, fmt.Sprintf("%d/udp", port))
+}
+
+// HostPortSCTP is HostPort for the SCTP container port.
+func (s *ServiceInstance) HostPortSCTP(ctx context.Context, port int) (string, error) {
+	return s.HostPort(ctx, fmt.Sprintf("%d/sctp", port))
+}
+
+// Inspect returns the Docker inspect data of the container.
+func (s *ServiceInstance) Inspect(ctx context.Context) (container.InspectResponse, error) {
+	resp, err := s.dc.ContainerInspect(ctx, s.ID)
+	return resp, engineErr("inspect container", err)
+}
+
+// Healthy reports whether the container is running and, if it has a healthcheck,
+// currently healthy.
+func (s *ServiceInstance) Healthy(ctx context.Context) (bool, error) {
+	j, err := s.Inspect(ctx)
+	if err != nil {
+		return false, err
+	}
+	state, _, _ := instanceState(j)
+	return state == InstanceHealthy, nil
+}
+
+func stopOptions(timeout time.Duration) container.StopOptions {
+	var opts container.StopOptions
+	if timeout > 0 {
+		opts.Timeout = stopSeconds(timeout)
+	}
+	return opts
+}
+
+// stopSeconds converts timeout to the whole seconds the engine accepts. It rounds
+// up, as truncating a sub-second timeout to 0 would kill the container at once.
+func stopSeconds(timeout time.Duration) *int {
+	seconds := max(int((timeout+time.Second-1)/time.Second), 0)
+	return &seconds
+}
@@ -0,0 +1,74 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// ServiceOverride changes the configuration of a Service derived by Service.With.
+type ServiceOverride func(*types.ServiceConfig) error
+
+// With returns a copy of s with overrides applied, keeping test-specific tweaks
+// local to the test instead of in override files. s itself is unchanged. An
+// override error is reported by the derived Service's commands.
+func (s *Service) With(overrides ...ServiceOverride) *Service {
+	derived := *s
+	derived.config = copyServiceConfig(s.config)
+	if derived.loadErr != nil {
+		return &derived
+	}
+	for _, o := range overrides {
+		if o == nil {
+			continue
+		}
+		if err := o(&derived.config); err != nil {
+			derived.loadErr = fmt.Errorf("compose: override service %q: %w", s.config.Name, err)
+			break
+		}
+	}
+	return &derived
+}
+
+// OverrideEnv sets environment variables given as "KEY=value". A bare "KEY" takes
+// its value from the host environment, as in compose files.
+func OverrideEnv(env ...string) ServiceOverride {
+	return func(cfg *types.ServiceConfig) error {
+		resolved := types.NewMappingWithEquals(env).Resolve(os.LookupEnv)
+		if cfg.Environment == nil {
+			cfg.Environment = types.MappingWithEquals{}
+		}
+		cfg.Environment = cfg.Environment.OverrideBy(resolved)
+		return nil
+	}
+}
+
+// OverrideImage replaces the service image.
+func OverrideImage(image string) ServiceOverride {
+	return func(cfg *types.ServiceConfig) error {
+		if image == "" {
+			return errors.New("image is empty")
+		}
+		cfg.Image = image
+		return nil
+	}
+}
+
+// OverridePorts replaces the published ports with the given short-syntax specs,
+// e.g. "0:5432" to publish container port 5432 on an ephemeral host port.
+func OverridePorts(ports ...string) ServiceOverride {
+	return func(cfg *types.ServiceConfig) error {
+		var out []types.ServicePortConfig
+		for _, p := range ports {
+			parsed, err := types.ParsePortConfig(p)
+			if err != nil {
+				return fmt.Errorf("invalid port %q: %w", p, err)
+			}
+			out = append(out, parsed...)
+		}
+		cfg.Ports = out
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package compose
+
+import (
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Timing reports when a Cmd's container ran and how long each phase took.
+type Timing struct {
+	// StartedAt and FinishedAt are the container timestamps reported by the engine.
+	// They are zero until Wait returns, and stay zero with AutoRemove because the
+	// container is gone before it can be inspected.
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	// Pull is the wall-clock time spent ensuring the image is present.
+	Pull time.Duration
+	// Create covers network/volume setup, container creation and attach.
+	Create time.Duration
+	// Run is measured from ContainerStart until the container exited.
+	Run time.Duration
+	// Cleanup covers draining output and removing the container.
+	Cleanup time.Duration
+}
+
+// Total returns the sum of all phase durations.
+func (t Timing) Total() time.Duration {
+	return t.Pull + t.Create + t.Run + t.Cleanup
+}
+
+// Timing returns the timestamps and phase durations recorded so far.
+// Phases that have not completed yet are zero.
+func (c *Cmd) Timing() Timing {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.timing
+}
+
+func (c *Cmd) updateTiming(fn func(*Timing)) {
+	c.mu.Lock()
+	fn(&c.timing)
+	c.mu.Unlock()
+}
+
+func (c *Cmd) markRunStart() {
+	c.mu.Lock()
+	c.runStart = time.Now()
+	c.mu.Unlock()
+}
+
+// markRunEnd records the Run phase and returns the exit time.
+func (c *Cmd) markRunEnd() time.Time {
+	now := time.Now()
+	c.mu.Lock()
+	if !c.runStart.IsZero() {
+		c.timing.Run = now.Sub(c.runStart)
+	}
+	c.mu.Unlock()
+	return now
+}
+
+func (c *Cmd) recordContainerTimes(state *container.State) {
+	if state == nil {
+		return
+	}
+	c.updateTiming(func(t *Timing) {
+		t.StartedAt = parseEngineTime(state.StartedAt)
+		t.FinishedAt = parseEngineTime(state.FinishedAt)
+	})
+}
+
+// parseEngineTime parses an engine timestamp; the engine reports unset times as
+// "0001-01-01T00:00:00Z", which maps to the zero time.
+func parseEngineTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil || t.IsZero() {
+		return time.Time{}
+	}
+	return t
+}
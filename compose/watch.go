@@ -0,0 +1,310 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// watchRule is a develop.watch trigger resolved for a started container.
+type watchRule struct {
+	spec   syncSpec
+	action types.WatchAction
+	exec   types.ServiceHook
+	// initialSync copies all matching files when watching starts.
+	initialSync bool
+	// restart restarts the container, for the "restart" and "sync+restart" actions.
+	restart func(context.Context) error
+}
+
+// Watch implements the service's develop.watch section for a started Cmd:
+// files changed under each trigger path are copied into the running container
+// (action "sync"), and for "sync+exec" the trigger's exec hook is started afterwards.
+// Deleted files are removed from the container. Actions "restart" and
+// "sync+restart" restart the container; Wait keeps waiting across restarts and
+// output is re-attached, but stdin is not.
+//
+// Host paths are polled for changes. Watch blocks until ctx is done, returning
+// ctx.Err(), or until the container is gone, returning nil once Wait released it.
+// Failed syncs are reported as warnings on os.Stderr and retried on the next poll.
+//
+// Building images is not supported: "rebuild" rules are skipped with a warning on
+// os.Stderr, and Watch fails if no rule is left.
+func (c *Cmd) Watch(ctx context.Context) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	if c.Service.Develop == nil || len(c.Service.Develop.Watch) == 0 {
+		return fmt.Errorf("compose: service %q has no develop.watch section", c.Service.Name)
+	}
+	rules, err := c.watchRules()
+	if err != nil {
+		return err
+	}
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return err
+	}
+	for i := range rules {
+		if rules[i].action == types.WatchActionRestart ||
+			rules[i].action == types.WatchActionSyncRestart {
+			rules[i].restart = func(ctx context.Context) error {
+				return c.restartContainer(ctx, dc, id)
+			}
+		}
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c.registerWatcher(cancel)
+	err = runWatch(watchCtx, dc, id, rules)
+	if ctx.Err() == nil && watchCtx.Err() != nil {
+		// Stopped by Wait.
+		return nil
+	}
+	return err
+}
+
+func (c *Cmd) watchRules() ([]watchRule, error) {
+	baseDir := ""
+	if c.service != nil {
+		baseDir = c.service.workingDir
+	}
+	rules := make([]watchRule, 0, len(c.Service.Develop.Watch))
+	for _, t := range c.Service.Develop.Watch {
+		switch t.Action {
+		case types.WatchActionSync, types.WatchActionSyncExec, types.WatchActionSyncRestart:
+			if t.Target == "" {
+				return nil, errors.New("compose: develop.watch sync requires path and target")
+			}
+		case types.WatchActionRestart:
+		default:
+			writeWarning(os.Stderr, fmt.Sprintf(
+				"develop.watch %s: action %q is not supported; rule skipped", t.Path, t.Action))
+			continue
+		}
+		if t.Path == "" {
+			return nil, errors.New("compose: develop.watch requires path")
+		}
+		if t.Target != "" && !path.IsAbs(t.Target) {
+			return nil, fmt.Errorf("compose: develop.watch target %q must be absolute", t.Target)
+		}
+		root := t.Path
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(baseDir, root)
+		}
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, watchRule{
+			spec: syncSpec{
+				root:    root,
+				target:  t.Target,
+				include: t.Include,
+				ignore:  t.Ignore,
+			},
+			action:      t.Action,
+			exec:        t.Exec,
+			initialSync: t.InitialSync,
+		})
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf(
+			"compose: service %q has no develop.watch rule with a supported action "+
+				"(%q, %q, %q, %q)",
+			c.Service.Name,
+			types.WatchActionSync,
+			types.WatchActionSyncExec,
+			types.WatchActionSyncRestart,
+			types.WatchActionRestart,
+		)
+	}
+	return rules, nil
+}
+
+func runWatch(ctx context.Context, dc Backend, id string, rules []watchRule) error {
+	snaps := make([]fileSnapshot, len(rules))
+	for i := range rules {
+		snap, err := rules[i].spec.snapshot()
+		if err != nil {
+			return err
+		}
+		snaps[i] = snap
+		if rules[i].initialSync {
+			all, _ := diffSnapshots(nil, snap)
+			err = rules[i].apply(ctx, dc, id, all, nil)
+			if fatal := rules[i].handleErr(ctx, err); fatal != nil {
+				return fatal
+			}
+		}
+	}
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := pollWatch(ctx, dc, id, rules, snaps); err != nil {
+			return err
+		}
+	}
+}
+
+// pollWatch applies the changes found since snaps to the container and updates
+// snaps. Changes matching several restart rules restart the container once.
+func pollWatch(
+	ctx context.Context,
+	dc Backend,
+	id string,
+	rules []watchRule,
+	snaps []fileSnapshot,
+) error {
+	var restart func(context.Context) error
+	for i := range rules {
+		next, err := rules[i].spec.snapshot()
+		if err != nil {
+			writeWarning(os.Stderr, fmt.Sprintf("watch %s: %v", rules[i].spec.root, err))
+			continue
+		}
+		changed, removed := diffSnapshots(snaps[i], next)
+		if len(changed) == 0 && len(removed) == 0 {
+			continue
+		}
+		if err := rules[i].apply(ctx, dc, id, changed, removed); err != nil {
+			if fatal := rules[i].handleErr(ctx, err); fatal != nil {
+				return fatal
+			}
+			// Keep the old snapshot so the batch is retried on the next poll.
+			continue
+		}
+		snaps[i] = next
+		if rules[i].restart != nil {
+			restart = rules[i].restart
+		}
+	}
+	if restart != nil {
+		if err := restart(ctx); err != nil && ctx.Err() == nil {
+			writeWarning(os.Stderr, fmt.Sprintf("watch restart: %v", err))
+		}
+	}
+	return nil
+}
+
+// apply syncs one batch of changes into the container.
+func (r *watchRule) apply(
+	ctx context.Context,
+	dc Backend,
+	id string,
+	changed, removed []string,
+) error {
+	if r.action == types.WatchActionRestart {
+		return nil
+	}
+	err := r.spec.copyToContainer(ctx, dc, id, changed)
+	if err == nil {
+		err = r.spec.removeFromContainer(ctx, dc, id, removed)
+	}
+	if err == nil && r.action == types.WatchActionSyncExec && len(r.exec.Command) > 0 {
+		err = execDetached(ctx, dc, id, container.ExecOptions{
+			Cmd:        r.exec.Command,
+			User:       r.exec.User,
+			Privileged: r.exec.Privileged,
+			WorkingDir: r.exec.WorkingDir,
+			Env:        r.exec.Environment.ToMapping().Values(),
+		})
+	}
+	return err
+}
+
+// handleErr returns err if watching cannot continue (the container is gone or ctx
+// is done) and reports other failures as warnings.
+func (r *watchRule) handleErr(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if isNotFoundErr(err) {
+		return fmt.Errorf("compose: watch stopped: %w", err)
+	}
+	writeWarning(os.Stderr, fmt.Sprintf("watch sync %s: %v", r.spec.root, err))
+	return nil
+}
+
+// WatchPath copies files changed under hostPath (a file or directory) into the
+// running container at containerPath until stop is called or Wait releases the
+// container. Deleted files are removed from the container. It is independent of
+// develop.watch and can be called several times for different paths.
+//
+// Changes are detected by polling; sync failures are reported as warnings on
+// os.Stderr.
+func (c *Cmd) WatchPath(hostPath, containerPath string) (stop func(), err error) {
+	if !path.IsAbs(containerPath) {
+		return nil, fmt.Errorf("compose: container path %q must be absolute", containerPath)
+	}
+	root, err := filepath.Abs(hostPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, statErr := os.Stat(root); statErr != nil {
+		return nil, statErr
+	}
+	id, dc, err := c.activeContainer()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(c.contextOrBackground())
+	c.registerWatcher(cancel)
+
+	rule := watchRule{
+		spec:   syncSpec{root: root, target: containerPath},
+		action: types.WatchActionSync,
+	}
+	go func() {
+		defer cancel()
+		watchErr := runWatch(ctx, dc, id, []watchRule{rule})
+		if watchErr != nil && ctx.Err() == nil {
+			writeWarning(os.Stderr, watchErr.Error())
+		}
+	}()
+	return cancel, nil
+}
+
+// registerWatcher makes stopWatchers call stop, or calls it at once if the
+// watchers were already stopped.
+func (c *Cmd) registerWatcher(stop context.CancelFunc) {
+	c.mu.Lock()
+	if !c.watchersStopped {
+		c.watchStops = append(c.watchStops, stop)
+		stop = nil
+	}
+	c.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
+
+// stopWatchers cancels Watch, the WatchPath goroutines, and the zombie check.
+func (c *Cmd) stopWatchers() {
+	c.mu.Lock()
+	stops := c.watchStops
+	c.watchStops = nil
+	c.watchersStopped = true
+	c.mu.Unlock()
+	for _, stop := range stops {
+		stop()
+	}
+}
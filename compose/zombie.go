@@ -0,0 +1,78 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+)
+
+// startZombieCheck polls the container's processes every ZombieCheck while it runs
+// and warns on os.Stderr once zombies show up (see Cmd.ZombieCheck).
+func (c *Cmd) startZombieCheck(dc Backend, id string) {
+	ctx, cancel := context.WithCancel(c.contextOrBackground())
+	c.registerWatcher(cancel)
+	service := c.Service.Name
+	go func() {
+		defer cancel()
+		zombies := watchZombies(ctx, dc, id, c.ZombieCheck)
+		if len(zombies) == 0 {
+			return
+		}
+		writeWarning(os.Stderr, fmt.Sprintf(
+			"service %s runs without an init process and has %d zombie process(es), e.g. %q: "+
+				"its PID 1 does not reap child processes; set `init: true` for the service "+
+				"or SetDefaultInit(InitEnabled)",
+			service, len(zombies), zombies[0],
+		))
+	}()
+}
+
+// watchZombies lists the container's processes every interval until zombies are
+// found, which it returns, or the container is gone or ctx is done.
+func watchZombies(ctx context.Context, dc Backend, id string, interval time.Duration) []string {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		top, err := dc.ContainerTop(ctx, id, nil)
+		if err != nil {
+			// Listing fails for a stopped or removed container; it is over then.
+			if isNotFoundErr(err) || cerrdefs.IsConflict(err) {
+				return nil
+			}
+			continue
+		}
+		if zombies := zombieProcesses(top); len(zombies) > 0 {
+			return zombies
+		}
+	}
+}
+
+// zombieProcesses returns the ps lines of the defunct processes in top: those in
+// state Z, or marked <defunct> when ps reports no state column.
+func zombieProcesses(top container.TopResponse) []string {
+	stat := slices.Index(top.Titles, "STAT")
+	if stat < 0 {
+		stat = slices.Index(top.Titles, "S")
+	}
+	var out []string
+	for _, proc := range top.Processes {
+		line := strings.Join(proc, " ")
+		switch {
+		case stat >= 0 && stat < len(proc) && strings.HasPrefix(proc[stat], "Z"),
+			strings.Contains(line, "<defunct>"):
+			out = append(out, line)
+		}
+	}
+	return out
+}